@@ -0,0 +1,295 @@
+// Command rcurl sends an HTTP request with the retryable client, printing
+// every attempt to stderr, so retry behavior can be reproduced from the shell
+// with the same code as services:
+//
+//	rcurl --retries 5 --backoff exponential:200ms --retry-on 429,5xx \
+//	      --max-time 30s --hedge-after 300ms https://api.example.com/health
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	rhttp "github.com/kdkumawat/golang/http-retry/http"
+)
+
+// headerFlags collects repeated -H flags.
+type headerFlags []string
+
+func (h *headerFlags) String() string { return strings.Join(*h, ", ") }
+
+func (h *headerFlags) Set(v string) error {
+	*h = append(*h, v)
+	return nil
+}
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	var (
+		method     = flag.String("X", "", "request `method`, GET or POST with -d by default")
+		data       = flag.String("d", "", "request body, @file to read it from a file")
+		include    = flag.Bool("i", false, "print the response status and headers")
+		silent     = flag.Bool("s", false, "do not print attempts")
+		fail       = flag.Bool("f", false, "exit with code 22 on statuses of 400 and above")
+		retries    = flag.Int("retries", rhttp.RetryCount, "retries after the first attempt")
+		backoff    = flag.String("backoff", "exponential:1s", "backoff as `type:base[:max]`, type exponential or constant")
+		jitter     = flag.String("jitter", "full", "exponential backoff jitter: full, decorrelated or none")
+		retryOn    = flag.String("retry-on", "", "comma separated `statuses` to retry, 5xx for every 5xx (default 429,502,503,504)")
+		unsafe     = flag.Bool("retry-unsafe", false, "retry non-idempotent methods such as POST")
+		maxTime    = flag.Duration("max-time", 0, "bound the whole request, retries included")
+		attemptMax = flag.Duration("attempt-timeout", 0, "bound each attempt")
+		hedgeAfter = flag.Duration("hedge-after", 0, "send a hedged copy after this long without a response")
+		maxHedges  = flag.Int("max-hedges", 1, "hedged copies sent at most, see --hedge-after")
+		headers    headerFlags
+	)
+	flag.Var(&headers, "H", "request `header` such as \"Accept: application/json\", may be repeated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: rcurl [flags] url\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		return 2
+	}
+
+	opts := []rhttp.Option{rhttp.WithMaxRetries(*retries), rhttp.WithNetworkTimings()}
+	b, err := parseBackoff(*backoff, *jitter)
+	if err != nil {
+		return fatal(err)
+	}
+	opts = append(opts, rhttp.WithBackoff(b))
+	if *retryOn != "" {
+		policy, err := parseRetryOn(*retryOn)
+		if err != nil {
+			return fatal(err)
+		}
+		opts = append(opts, policy...)
+	}
+	if *unsafe {
+		opts = append(opts, rhttp.WithRetryUnsafeMethods())
+	}
+	if *maxTime > 0 {
+		opts = append(opts, rhttp.WithTimeout(*maxTime))
+	}
+	if *attemptMax > 0 {
+		opts = append(opts, rhttp.WithAttemptTimeout(*attemptMax))
+	}
+	if *hedgeAfter > 0 {
+		opts = append(opts, rhttp.WithHedging(*hedgeAfter, *maxHedges))
+	}
+	if !*silent {
+		opts = append(opts, rhttp.WithHooks(attemptLog(os.Stderr)))
+	}
+
+	body, err := requestBody(*data)
+	if err != nil {
+		return fatal(err)
+	}
+	if *method == "" {
+		*method = http.MethodGet
+		if body != nil {
+			*method = http.MethodPost
+		}
+	}
+
+	ctx := context.Background()
+	req, err := rhttp.NewRequest(ctx, *method, flag.Arg(0), body)
+	if err != nil {
+		return fatal(err)
+	}
+	for _, h := range headers {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 {
+			return fatal(fmt.Errorf("malformed header %q", h))
+		}
+		req.Header.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	client := rhttp.NewRetryableClient(opts...)
+	defer client.Close(ctx)
+	resp, err := client.Do(ctx, req)
+	if err != nil {
+		return fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if *include {
+		fmt.Printf("%s %s\n", resp.Proto, resp.Status)
+		resp.Header.Write(os.Stdout)
+		fmt.Println()
+	}
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		return fatal(err)
+	}
+	if *fail && resp.StatusCode >= 400 {
+		return 22
+	}
+
+	return 0
+}
+
+func fatal(err error) int {
+	fmt.Fprintf(os.Stderr, "rcurl: %v\n", err)
+	return 1
+}
+
+// parseBackoff parses a backoff such as exponential:200ms:10s or constant:1s.
+func parseBackoff(spec, jitter string) (rhttp.Backoff, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("malformed backoff %q, want type:base[:max]", spec)
+	}
+	base, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("backoff base: %w", err)
+	}
+	var max time.Duration
+	if len(parts) == 3 {
+		if max, err = time.ParseDuration(parts[2]); err != nil {
+			return nil, fmt.Errorf("backoff max: %w", err)
+		}
+	}
+
+	switch parts[0] {
+	case "constant":
+		return rhttp.ConstantBackoff(base), nil
+	case "exponential":
+		j, ok := map[string]rhttp.Jitter{
+			"full":         rhttp.FullJitter,
+			"decorrelated": rhttp.DecorrelatedJitter,
+			"none":         rhttp.NoJitter,
+		}[jitter]
+		if !ok {
+			return nil, fmt.Errorf("unknown jitter %q", jitter)
+		}
+		return rhttp.ExponentialBackoff{Base: base, Max: max, Jitter: j}, nil
+	default:
+		return nil, fmt.Errorf("unknown backoff type %q", parts[0])
+	}
+}
+
+// parseRetryOn parses a list of statuses such as 429,503,5xx.
+func parseRetryOn(list string) ([]rhttp.Option, error) {
+	var (
+		opts  []rhttp.Option
+		codes []int
+	)
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if strings.EqualFold(s, "5xx") {
+			opts = append(opts, rhttp.RetryOn5xx())
+			continue
+		}
+		code, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("malformed status %q in --retry-on", s)
+		}
+		codes = append(codes, code)
+	}
+
+	return append(opts, rhttp.RetryOn(codes...)), nil
+}
+
+// requestBody returns the body given with -d, nil if none.
+func requestBody(data string) (interface{}, error) {
+	switch {
+	case data == "":
+		return nil, nil
+	case strings.HasPrefix(data, "@"):
+		return ioutil.ReadFile(data[1:])
+	default:
+		return []byte(data), nil
+	}
+}
+
+// attemptLog prints a line per attempt, retry and give-up to w.
+func attemptLog(w io.Writer) rhttp.Hooks {
+	var (
+		mu    sync.Mutex
+		start = time.Now()
+		sent  = make(map[*http.Request]time.Time)
+	)
+	since := func() string {
+		return fmt.Sprintf("%8.3fs", time.Since(start).Seconds())
+	}
+
+	return rhttp.Hooks{
+		OnRequest: func(req *http.Request, attempt int) {
+			mu.Lock()
+			sent[req] = time.Now()
+			mu.Unlock()
+			fmt.Fprintf(w, "%s > attempt %d: %s %s\n", since(), attempt, req.Method, req.URL)
+		},
+		OnResponse: func(req *http.Request, resp *http.Response, err error, attempt int) {
+			mu.Lock()
+			took := time.Since(sent[req])
+			delete(sent, req)
+			mu.Unlock()
+
+			outcome := "error: "
+			if err != nil {
+				outcome += err.Error()
+			} else {
+				outcome = resp.Status
+			}
+			fmt.Fprintf(w, "%s < attempt %d: %s in %v%s\n", since(), attempt, outcome, round(took), timings(req))
+		},
+		OnRetry: func(req *http.Request, resp *http.Response, err error, attempt int, delay time.Duration) {
+			fmt.Fprintf(w, "%s * retrying in %v\n", since(), delay.Round(time.Millisecond))
+		},
+		OnGiveUp: func(req *http.Request, err *rhttp.RetryError) {
+			fmt.Fprintf(w, "%s * giving up: %v\n", since(), err.Reason)
+		},
+	}
+}
+
+// timings formats the network timings of the attempt req.
+func timings(req *http.Request) string {
+	t, ok := rhttp.AttemptTimingsOf(req)
+	if !ok {
+		return ""
+	}
+	if t.ReusedConn {
+		return fmt.Sprintf(" (reused connection, ttfb %v)", round(t.TimeToFirstByte))
+	}
+
+	var parts []string
+	if t.Phase != rhttp.PhaseResponse {
+		parts = append(parts, "failed in "+t.Phase.String())
+	}
+	for _, p := range []struct {
+		name string
+		d    time.Duration
+	}{{"dns", t.DNS}, {"connect", t.Connect}, {"tls", t.TLS}, {"ttfb", t.TimeToFirstByte}} {
+		if p.d > 0 {
+			parts = append(parts, p.name+" "+round(p.d).String())
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+// round rounds d to a precision readable at its scale.
+func round(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+
+	return d.Round(100 * time.Microsecond)
+}
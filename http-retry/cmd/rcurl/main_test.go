@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rhttp "github.com/kdkumawat/golang/http-retry/http"
+)
+
+func TestParseBackoff(t *testing.T) {
+	tests := []struct {
+		spec    string
+		jitter  string
+		want    rhttp.Backoff
+		wantErr bool
+	}{
+		{spec: "exponential:1s", jitter: "full", want: rhttp.ExponentialBackoff{Base: time.Second, Jitter: rhttp.FullJitter}},
+		{spec: "exponential:200ms:10s", jitter: "decorrelated", want: rhttp.ExponentialBackoff{Base: 200 * time.Millisecond, Max: 10 * time.Second, Jitter: rhttp.DecorrelatedJitter}},
+		{spec: "exponential:100ms", jitter: "none", want: rhttp.ExponentialBackoff{Base: 100 * time.Millisecond, Jitter: rhttp.NoJitter}},
+		{spec: "constant:1s", jitter: "bogus", want: rhttp.ConstantBackoff(time.Second)},
+		{spec: "exponential:1s", jitter: "bogus", wantErr: true},
+		{spec: "exponential", jitter: "full", wantErr: true},
+		{spec: "exponential:1s:2s:3s", jitter: "full", wantErr: true},
+		{spec: "exponential:soon", jitter: "full", wantErr: true},
+		{spec: "exponential:1s:later", jitter: "full", wantErr: true},
+		{spec: "linear:1s", jitter: "full", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec+"/"+tt.jitter, func(t *testing.T) {
+			got, err := parseBackoff(tt.spec, tt.jitter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBackoff() error = %v, want an error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !sameBackoff(got, tt.want) {
+				t.Errorf("parseBackoff() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// sameBackoff reports whether a and b are the same exponential backoff, or
+// wait the same for the first retries.
+func sameBackoff(a, b rhttp.Backoff) bool {
+	if _, ok := a.(rhttp.ExponentialBackoff); ok {
+		return reflect.DeepEqual(a, b)
+	}
+	for retries := 1; retries <= 3; retries++ {
+		if a.Backoff(retries, 0) != b.Backoff(retries, 0) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestParseRetryOn(t *testing.T) {
+	tests := []struct {
+		list    string
+		status  int
+		wantErr bool
+		// wantAttempts are sent to a server always answering status.
+		wantAttempts int32
+	}{
+		{list: "503", status: 503, wantAttempts: 3},
+		{list: "429, 503", status: 429, wantAttempts: 3},
+		{list: "429,503", status: 500, wantAttempts: 1},
+		{list: "5xx", status: 500, wantAttempts: 3},
+		{list: "5XX,429", status: 429, wantAttempts: 3},
+		{list: "404", status: 503, wantAttempts: 1},
+		{list: "5xx,abc", wantErr: true},
+		{list: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			opts, err := parseRetryOn(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRetryOn() error = %v, want an error: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var attempts int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+			backoff, _ := parseBackoff("constant:1ms", "none")
+			c := rhttp.NewRetryableClient(append([]rhttp.Option{rhttp.WithMaxRetries(2), rhttp.WithBackoff(backoff)}, opts...)...)
+
+			c.GetBytes(context.Background(), srv.URL)
+			if n := atomic.LoadInt32(&attempts); n != tt.wantAttempts {
+				t.Errorf("%d attempts, want %d", n, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRequestBody(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "body.json")
+	if err := ioutil.WriteFile(file, []byte(`{"a":1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		data    string
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "none", data: "", want: nil},
+		{name: "inline", data: "a=1", want: []byte("a=1")},
+		{name: "file", data: "@" + file, want: []byte(`{"a":1}`)},
+		{name: "missing file", data: "@" + filepath.Join(os.TempDir(), "rcurl-missing"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := requestBody(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("requestBody() error = %v, want an error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requestBody() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+const maxDuration = time.Duration(math.MaxInt64)
+
+// Backoff decides how long to wait before the next retry. retries is the
+// number of retries already made and prev is the previous wait.
+type Backoff interface {
+	Backoff(retries int, prev time.Duration) time.Duration
+}
+
+// BackoffFunc adapts a plain function to the Backoff interface.
+type BackoffFunc func(retries int, prev time.Duration) time.Duration
+
+func (f BackoffFunc) Backoff(retries int, prev time.Duration) time.Duration {
+	return f(retries, prev)
+}
+
+// Jitter selects how randomness is applied to an exponential backoff.
+type Jitter int
+
+const (
+	// FullJitter waits a random duration between zero and the exponential delay.
+	FullJitter Jitter = iota
+	// DecorrelatedJitter waits a random duration between Base and three times
+	// the previous wait.
+	DecorrelatedJitter
+	// NoJitter waits exactly the exponential delay.
+	NoJitter
+)
+
+// ExponentialBackoff doubles (or multiplies by Multiplier) the delay after each
+// retry, starting at Base and never exceeding Max. A Multiplier below 1 keeps
+// the delay at Base, so waits never shrink towards a busy loop. The zero
+// Jitter value is FullJitter so that clients retrying together spread out
+// over time.
+type ExponentialBackoff struct {
+	Base       time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     Jitter
+}
+
+func (b ExponentialBackoff) Backoff(retries int, prev time.Duration) time.Duration {
+	if b.Jitter == DecorrelatedJitter {
+		return b.decorrelated(prev)
+	}
+
+	delay := b.exponential(retries)
+	if b.Jitter == FullJitter {
+		delay = randomDuration(0, delay)
+	}
+
+	return delay
+}
+
+func (b ExponentialBackoff) exponential(retries int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	} else if multiplier < 1 {
+		multiplier = 1
+	}
+	if retries < 0 {
+		retries = 0
+	}
+
+	delay := float64(b.Base) * math.Pow(multiplier, float64(retries))
+	return b.cap(delay)
+}
+
+func (b ExponentialBackoff) decorrelated(prev time.Duration) time.Duration {
+	base := b.cap(float64(b.Base))
+	if prev < base {
+		prev = base
+	}
+
+	upper := b.cap(float64(prev) * 3)
+	return randomDuration(base, upper)
+}
+
+// cap bounds delay by Max, guarding against overflow of time.Duration. NaN,
+// e.g. a zero Base times an infinite factor, and negative delays are zero.
+func (b ExponentialBackoff) cap(delay float64) time.Duration {
+	if math.IsNaN(delay) || delay <= 0 {
+		return 0
+	}
+	if b.Max > 0 && delay > float64(b.Max) {
+		return b.Max
+	}
+	if delay >= float64(maxDuration) {
+		return maxDuration
+	}
+
+	return time.Duration(delay)
+}
+
+// ConstantBackoff waits the same duration before every retry.
+func ConstantBackoff(d time.Duration) Backoff {
+	return BackoffFunc(func(int, time.Duration) time.Duration {
+		return d
+	})
+}
+
+// backoffDelay returns the wait b chooses before retry number retries, never
+// negative whatever b returns.
+func backoffDelay(b Backoff, retries int, prev time.Duration) time.Duration {
+	return nonNegative(b.Backoff(retries, prev))
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+
+	return d
+}
+
+// randomDuration returns a random duration in [min, max), min taken as zero
+// if negative.
+func randomDuration(min, max time.Duration) time.Duration {
+	min = nonNegative(min)
+	if max <= min {
+		return min
+	}
+
+	return min + time.Duration(rand.Int63n(int64(max-min)))
+}
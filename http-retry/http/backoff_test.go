@@ -0,0 +1,138 @@
+package http
+
+import (
+	"context"
+	"math"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// backoffCase is an arbitrary exponential backoff and its arguments, for
+// property tests.
+type backoffCase struct {
+	Base, Max, Prev time.Duration
+	Multiplier      float64
+	Jitter          Jitter
+	Retries         int
+}
+
+func (c backoffCase) backoff() ExponentialBackoff {
+	return ExponentialBackoff{Base: c.Base, Max: c.Max, Multiplier: c.Multiplier, Jitter: c.Jitter % 3}
+}
+
+// multipliers includes the values a config file could hold that break naive
+// arithmetic.
+var multipliers = []float64{0, -1, 0.5, 1, 1.5, 2, 10, math.Inf(1), math.Inf(-1), math.NaN()}
+
+func checkBackoff(t *testing.T, name string, property func(backoffCase) bool) {
+	t.Helper()
+
+	f := func(base, max, prev int64, m uint8, jitter uint8, retries int) bool {
+		return property(backoffCase{
+			Base: time.Duration(base), Max: time.Duration(max), Prev: time.Duration(prev),
+			Multiplier: multipliers[int(m)%len(multipliers)],
+			Jitter:     Jitter(jitter),
+			Retries:    retries,
+		})
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 5000}); err != nil {
+		t.Errorf("%s: %v", name, err)
+	}
+}
+
+func TestBackoffProperties(t *testing.T) {
+	checkBackoff(t, "never negative", func(c backoffCase) bool {
+		return backoffDelay(c.backoff(), c.Retries, c.Prev) >= 0
+	})
+	checkBackoff(t, "capped at Max", func(c backoffCase) bool {
+		if c.Max <= 0 {
+			return true
+		}
+		return c.backoff().Backoff(c.Retries, c.Prev) <= c.Max
+	})
+	checkBackoff(t, "full jitter in [0, d)", func(c backoffCase) bool {
+		c.Jitter = FullJitter
+		d := ExponentialBackoff{Base: c.Base, Max: c.Max, Multiplier: c.Multiplier, Jitter: NoJitter}.Backoff(c.Retries, c.Prev)
+		got := c.backoff().Backoff(c.Retries, c.Prev)
+		if d == 0 {
+			return got == 0
+		}
+		return got >= 0 && got < d
+	})
+	checkBackoff(t, "no jitter never shrinks", func(c backoffCase) bool {
+		c.Jitter = NoJitter
+		if c.Retries < 0 || c.Retries == math.MaxInt {
+			return true
+		}
+		b := c.backoff()
+		return b.Backoff(c.Retries+1, 0) >= b.Backoff(c.Retries, 0)
+	})
+}
+
+func TestDecorrelatedJitterBounds(t *testing.T) {
+	// Base and prev within an hour, so three times prev does not overflow
+	f := func(base, prev uint32) bool {
+		b := ExponentialBackoff{Base: time.Duration(base)%time.Hour + 1, Jitter: DecorrelatedJitter}
+		p := b.Base + time.Duration(prev)%time.Hour
+		got := b.Backoff(0, p)
+		return got >= b.Base && got < 3*p
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 5000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff ExponentialBackoff
+		retries int
+		want    time.Duration
+	}{
+		{name: "first retry", backoff: ExponentialBackoff{Base: time.Second, Jitter: NoJitter}, want: time.Second},
+		{name: "doubles", backoff: ExponentialBackoff{Base: time.Second, Jitter: NoJitter}, retries: 3, want: 8 * time.Second},
+		{name: "multiplier", backoff: ExponentialBackoff{Base: time.Second, Multiplier: 3, Jitter: NoJitter}, retries: 2, want: 9 * time.Second},
+		{name: "multiplier below 1", backoff: ExponentialBackoff{Base: time.Second, Multiplier: 0.5, Jitter: NoJitter}, retries: 5, want: time.Second},
+		{name: "capped", backoff: ExponentialBackoff{Base: time.Second, Max: 5 * time.Second, Jitter: NoJitter}, retries: 10, want: 5 * time.Second},
+		{name: "overflow", backoff: ExponentialBackoff{Base: time.Second, Jitter: NoJitter}, retries: 1000, want: maxDuration},
+		{name: "overflow capped", backoff: ExponentialBackoff{Base: time.Second, Max: time.Minute, Jitter: NoJitter}, retries: 1000, want: time.Minute},
+		{name: "negative retries", backoff: ExponentialBackoff{Base: time.Second, Jitter: NoJitter}, retries: -3, want: time.Second},
+		{name: "negative base", backoff: ExponentialBackoff{Base: -time.Second, Jitter: NoJitter}, want: 0},
+		{name: "zero base infinite multiplier", backoff: ExponentialBackoff{Multiplier: math.Inf(1), Jitter: NoJitter}, retries: 2, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backoff.Backoff(tt.retries, 0); got != tt.want {
+				t.Errorf("Backoff(%d) = %v, want %v", tt.retries, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryLoopNeverSleepsNegative(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff Backoff
+	}{
+		{name: "negative constant", backoff: ConstantBackoff(-time.Second)},
+		{name: "negative base", backoff: ExponentialBackoff{Base: -time.Second, Jitter: DecorrelatedJitter}},
+		{name: "NaN multiplier", backoff: ExponentialBackoff{Base: time.Second, Multiplier: math.NaN()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503, 503, 200)
+			clock := newStepClock()
+			c := NewRetryableClient(WithClock(clock), WithBackoff(tt.backoff))
+
+			if _, _, err := c.GetBytes(context.Background(), srv.URL); err != nil {
+				t.Fatalf("GetBytes() error = %v", err)
+			}
+			for i, d := range clock.Waits() {
+				if d < 0 {
+					t.Errorf("wait %d = %v", i+1, d)
+				}
+			}
+		})
+	}
+}
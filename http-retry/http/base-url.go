@@ -0,0 +1,86 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WithBaseURL resolves requests made with a relative URL, such as
+// client.GetJSON(ctx, "/users/2", &user), against base: their path is
+// appended to the path of base and their query to its query. Absolute URLs
+// are left alone. If base is invalid, relative requests fail.
+func WithBaseURL(base string) Option {
+	u, err := url.Parse(base)
+	if err == nil && (u.Scheme == "" || u.Host == "") {
+		err = errors.New("missing scheme or host")
+	}
+
+	return func(c *config) {
+		c.baseURL, c.baseURLErr = u, nil
+		if err != nil {
+			c.baseURL, c.baseURLErr = nil, fmt.Errorf("rhttp: invalid base URL %q: %w", base, err)
+		}
+	}
+}
+
+// WithDefaultHeaders adds h to every attempt that does not set the same
+// headers itself, e.g. a User-Agent, credentials or a tenant ID shared by all
+// call sites. Headers are added to those of earlier WithDefaultHeaders
+// options, replacing the ones with the same name.
+func WithDefaultHeaders(h http.Header) Option {
+	return func(c *config) {
+		merged := make(http.Header, len(c.defaultHeaders)+len(h))
+		for name, values := range c.defaultHeaders {
+			merged[name] = values
+		}
+		for name, values := range h {
+			merged[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+		c.defaultHeaders = merged
+	}
+}
+
+// resolveURL returns u resolved against the base URL if it is relative.
+func (c *config) resolveURL(u *url.URL) (*url.URL, error) {
+	if u.IsAbs() || u.Host != "" {
+		return u, nil
+	}
+	if c.baseURLErr != nil {
+		return nil, c.baseURLErr
+	}
+	if c.baseURL == nil {
+		// http.Client reports the missing scheme
+		return u, nil
+	}
+
+	r := *c.baseURL
+	if u.Path != "" {
+		p := strings.TrimSuffix(r.EscapedPath(), "/") + "/" + strings.TrimPrefix(u.EscapedPath(), "/")
+		path, err := url.PathUnescape(p)
+		if err != nil {
+			return nil, fmt.Errorf("rhttp: resolving %s: %w", u, err)
+		}
+		r.Path, r.RawPath = path, p
+	}
+	switch {
+	case r.RawQuery == "":
+		r.RawQuery = u.RawQuery
+	case u.RawQuery != "":
+		r.RawQuery += "&" + u.RawQuery
+	}
+	r.Fragment, r.RawFragment = u.Fragment, u.RawFragment
+
+	return &r, nil
+}
+
+// setDefaultHeaders adds the default headers req does not set.
+func (c *config) setDefaultHeaders(req *http.Request) {
+	for name, values := range c.defaultHeaders {
+		if _, ok := req.Header[name]; !ok {
+			req.Header[name] = append([]string(nil), values...)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestResolveURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{name: "no base", url: "/users/2", want: "/users/2"},
+		{name: "absolute", base: "https://api.example.com/v1", url: "http://other.example.com/x", want: "http://other.example.com/x"},
+		{name: "path", base: "https://api.example.com/v1", url: "/users/2", want: "https://api.example.com/v1/users/2"},
+		{name: "trailing slash", base: "https://api.example.com/v1/", url: "/users/2", want: "https://api.example.com/v1/users/2"},
+		{name: "no leading slash", base: "https://api.example.com/v1", url: "users/2", want: "https://api.example.com/v1/users/2"},
+		{name: "base without path", base: "https://api.example.com", url: "/users", want: "https://api.example.com/users"},
+		{name: "query", base: "https://api.example.com/v1", url: "/users?page=2", want: "https://api.example.com/v1/users?page=2"},
+		{name: "queries merged", base: "https://api.example.com/v1?key=k", url: "/users?page=2", want: "https://api.example.com/v1/users?key=k&page=2"},
+		{name: "base query kept", base: "https://api.example.com/v1?key=k", url: "/users", want: "https://api.example.com/v1/users?key=k"},
+		{name: "query only", base: "https://api.example.com/v1", url: "?page=2", want: "https://api.example.com/v1?page=2"},
+		{name: "escaped", base: "https://api.example.com/a%2Fb", url: "/c%2Fd", want: "https://api.example.com/a%2Fb/c%2Fd"},
+		{name: "fragment", base: "https://api.example.com/v1", url: "/users#top", want: "https://api.example.com/v1/users#top"},
+		{name: "invalid base", base: "api.example.com", url: "/users", wantErr: true},
+		{name: "invalid base, absolute URL", base: "api.example.com", url: "https://api.example.com/users", want: "https://api.example.com/users"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.base != "" {
+				opts = append(opts, WithBaseURL(tt.base))
+			}
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := newConfig(opts...).resolveURL(u)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("resolveURL() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil || got.String() != tt.want {
+				t.Errorf("resolveURL() = %v, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithBaseURL(t *testing.T) {
+	srv := newScriptServer(t, 503, 200)
+	c := NewRetryableClient(fastBackoff, WithBaseURL(srv.URL+"/v1"))
+
+	status, _, err := c.GetBytes(context.Background(), "/users/2?fields=name")
+	if err != nil || status != 200 {
+		t.Fatalf("GetBytes() = %d, %v", status, err)
+	}
+	for i := 0; i < srv.count(); i++ {
+		if r, _ := srv.request(i); r.URL.String() != "/v1/users/2?fields=name" {
+			t.Errorf("attempt %d sent to %s", i+1, r.URL)
+		}
+	}
+}
+
+func TestWithDefaultHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		request http.Header
+		want    http.Header
+	}{
+		{
+			name: "added",
+			opts: []Option{WithDefaultHeaders(http.Header{"user-agent": {"svc/1.0"}, "X-Tenant": {"acme"}})},
+			want: http.Header{"User-Agent": {"svc/1.0"}, "X-Tenant": {"acme"}},
+		},
+		{
+			name:    "set by the request",
+			opts:    []Option{WithDefaultHeaders(http.Header{"X-Tenant": {"acme"}})},
+			request: http.Header{"X-Tenant": {"other"}},
+			want:    http.Header{"X-Tenant": {"other"}},
+		},
+		{
+			name: "merged",
+			opts: []Option{
+				WithDefaultHeaders(http.Header{"X-Tenant": {"acme"}, "X-Team": {"billing"}}),
+				WithDefaultHeaders(http.Header{"X-Tenant": {"globex"}}),
+			},
+			want: http.Header{"X-Tenant": {"globex"}, "X-Team": {"billing"}},
+		},
+		{
+			name: "several values",
+			opts: []Option{WithDefaultHeaders(http.Header{"Accept": {"application/json", "text/plain"}})},
+			want: http.Header{"Accept": {"application/json", "text/plain"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := mustNewRequest(t, "http://example.com")
+			for name, values := range tt.request {
+				req.Header[name] = values
+			}
+
+			newConfig(tt.opts...).setDefaultHeaders(req)
+			if !reflect.DeepEqual(req.Header, tt.want) {
+				t.Errorf("header = %v, want %v", req.Header, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultHeadersNotShared(t *testing.T) {
+	h := http.Header{"X-Tenant": {"acme"}}
+	cfg := newConfig(WithDefaultHeaders(h))
+	h.Set("X-Tenant", "changed")
+
+	req := mustNewRequest(t, "http://example.com")
+	cfg.setDefaultHeaders(req)
+	req.Header["X-Tenant"][0] = "modified"
+	other := mustNewRequest(t, "http://example.com")
+	cfg.setDefaultHeaders(other)
+	if got := other.Header.Get("X-Tenant"); got != "acme" {
+		t.Errorf("X-Tenant = %q, want acme", got)
+	}
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// BatchResult is the outcome of one request of a batch. The caller must close
+// Response.Body when Err is nil.
+type BatchResult struct {
+	Response *http.Response
+	Err      error
+}
+
+// Batch sends reqs with at most concurrency requests in flight, each retried
+// independently, and returns their results in the same order. A concurrency
+// below one sends every request at once.
+func (c *RetryableClient) Batch(ctx context.Context, reqs []*http.Request, concurrency int) []BatchResult {
+	if concurrency < 1 || concurrency > len(reqs) {
+		concurrency = len(reqs)
+	}
+
+	results := make([]BatchResult, len(reqs))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				resp, err := c.Do(ctx, reqs[i])
+				results[i] = BatchResult{Response: resp, Err: err}
+			}
+		}()
+	}
+
+	for i := range reqs {
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		requests    int
+		concurrency int
+		wantPeak    int64
+	}{
+		{name: "bounded", requests: 8, concurrency: 2, wantPeak: 2},
+		{name: "one at a time", requests: 4, concurrency: 1, wantPeak: 1},
+		{name: "unbounded", requests: 4, concurrency: 0, wantPeak: 4},
+		{name: "more workers than requests", requests: 2, concurrency: 10, wantPeak: 2},
+		{name: "empty", requests: 0, concurrency: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inflight, peak int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt64(&inflight, 1)
+				defer atomic.AddInt64(&inflight, -1)
+				for {
+					m := atomic.LoadInt64(&peak)
+					if n <= m || atomic.CompareAndSwapInt64(&peak, m, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				w.Write([]byte(r.URL.Query().Get("i")))
+			}))
+			defer srv.Close()
+			c := NewRetryableClient()
+
+			reqs := make([]*http.Request, tt.requests)
+			for i := range reqs {
+				reqs[i] = mustNewRequest(t, srv.URL+"?i="+strconv.Itoa(i))
+			}
+			results := c.Batch(context.Background(), reqs, tt.concurrency)
+			if len(results) != tt.requests {
+				t.Fatalf("%d results, want %d", len(results), tt.requests)
+			}
+			for i, res := range results {
+				if res.Err != nil {
+					t.Fatalf("request %d error = %v", i, res.Err)
+				}
+				body, _ := ioutil.ReadAll(res.Response.Body)
+				res.Response.Body.Close()
+				if string(body) != strconv.Itoa(i) {
+					t.Errorf("result %d is the response to request %s", i, body)
+				}
+			}
+			if peak != tt.wantPeak {
+				t.Errorf("%d requests in flight at most, want %d", peak, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestBatchRetriesEachRequest(t *testing.T) {
+	srv := newScriptServer(t, 503, 200, 200)
+	c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0))
+
+	results := c.Batch(context.Background(), []*http.Request{mustNewRequest(t, srv.URL), mustNewRequest(t, srv.URL)}, 1)
+	for i, res := range results {
+		if res.Err != nil || res.Response.StatusCode != 200 {
+			t.Fatalf("result %d = %v, %v", i, res.Response, res.Err)
+		}
+		drainBody(res.Response)
+	}
+	if srv.count() != 3 {
+		t.Errorf("server received %d requests, want 3", srv.count())
+	}
+}
+
+func TestBatchCancelled(t *testing.T) {
+	srv := newScriptServer(t, 200)
+	c := NewRetryableClient()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := c.Batch(ctx, []*http.Request{mustNewRequest(t, srv.URL), mustNewRequest(t, srv.URL)}, 1)
+	for i, res := range results {
+		if res.Err != context.Canceled {
+			t.Errorf("result %d error = %v, want context.Canceled", i, res.Err)
+		}
+	}
+	if srv.count() != 0 {
+		t.Errorf("server received %d requests after the batch was cancelled", srv.count())
+	}
+}
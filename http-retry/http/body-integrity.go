@@ -0,0 +1,122 @@
+package http
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ErrIncompleteBody is the error of an attempt whose response body ended
+// before its Content-Length, see WithBodyVerification. It is retried like a
+// connection closed in the middle of a response.
+var ErrIncompleteBody = errors.New("rhttp: incomplete response body")
+
+// WithBodyVerification reads response bodies in full within their attempt and
+// checks them against the Content-Length, Content-MD5 and Digest headers when
+// present, so a body cut short or corrupted on the way fails the attempt and
+// is retried instead of reaching the caller truncated. Bodies are buffered in
+// memory, bounded by WithMaxResponseBytes. SubscribeSSE streams are not
+// verified.
+func WithBodyVerification() Option {
+	return func(c *config) {
+		c.verifyBodies = true
+	}
+}
+
+// digestHashes are the Digest algorithms checked, by lower-case name.
+var digestHashes = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// checkBody reads the body of resp and verifies it if WithBodyVerification
+// is set.
+func (c *config) checkBody(resp *http.Response) (*http.Response, error) {
+	if !c.verifyBodies || resp.Body == nil || resp.Body == http.NoBody ||
+		resp.StatusCode == http.StatusSwitchingProtocols {
+		return resp, nil
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		return nil, &permanentError{err: err}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return nil, incompleteBody(len(data), resp.ContentLength)
+	case err != nil:
+		return nil, err
+	case resp.ContentLength >= 0 && int64(len(data)) != resp.ContentLength:
+		return nil, incompleteBody(len(data), resp.ContentLength)
+	}
+	// Checksums cover the encoded body, which the transport may have
+	// already decoded
+	if !resp.Uncompressed {
+		if err := verifyDigests(resp.Header, data); err != nil {
+			return nil, err
+		}
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	return resp, nil
+}
+
+func incompleteBody(n int, length int64) error {
+	return fmt.Errorf("%w: read %d of %d bytes", ErrIncompleteBody, n, length)
+}
+
+// verifyDigests checks data against the Content-MD5 header and the known
+// algorithms of the Digest header. Unknown algorithms and malformed values
+// are ignored.
+func verifyDigests(header http.Header, data []byte) error {
+	if v := header.Get("Content-MD5"); v != "" {
+		if err := verifyDigest("md5", v, data); err != nil {
+			return err
+		}
+	}
+	for _, part := range strings.Split(header.Get("Digest"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if err := verifyDigest(strings.ToLower(kv[0]), kv[1], data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func verifyDigest(algorithm, value string, data []byte) error {
+	newHash, ok := digestHashes[algorithm]
+	if !ok {
+		return nil
+	}
+	expected, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil
+	}
+
+	sum := newHash()
+	sum.Write(data)
+	if actual := sum.Sum(nil); !bytes.Equal(actual, expected) {
+		return &ChecksumError{
+			Algorithm: strings.Replace(algorithm, "-", "", 1),
+			Expected:  hex.EncodeToString(expected),
+			Actual:    hex.EncodeToString(actual),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package http
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func b64Sum(sum []byte) string {
+	return base64.StdEncoding.EncodeToString(sum)
+}
+
+func TestVerifyDigests(t *testing.T) {
+	data := []byte("payload")
+	md5Sum := md5.Sum(data)
+	sha256Sum := sha256.Sum256(data)
+	otherSum := sha256.Sum256([]byte("other"))
+	tests := []struct {
+		name          string
+		header        http.Header
+		wantAlgorithm string
+	}{
+		{name: "none", header: http.Header{}},
+		{name: "Content-MD5", header: http.Header{"Content-Md5": {b64Sum(md5Sum[:])}}},
+		{name: "wrong Content-MD5", header: http.Header{"Content-Md5": {b64Sum(otherSum[:16])}}, wantAlgorithm: "md5"},
+		{name: "Digest", header: http.Header{"Digest": {"SHA-256=" + b64Sum(sha256Sum[:])}}},
+		{name: "wrong Digest", header: http.Header{"Digest": {"sha-256=" + b64Sum(otherSum[:])}}, wantAlgorithm: "sha256"},
+		{name: "several", header: http.Header{"Digest": {"md5=" + b64Sum(md5Sum[:]) + ", SHA-256=" + b64Sum(sha256Sum[:])}}},
+		{name: "one of several wrong", header: http.Header{"Digest": {"md5=" + b64Sum(md5Sum[:]) + ", SHA-256=" + b64Sum(otherSum[:])}}, wantAlgorithm: "sha256"},
+		{name: "unknown algorithm", header: http.Header{"Digest": {"crc32c=AAAAAA=="}}},
+		{name: "malformed", header: http.Header{"Digest": {"sha-256=not base64!, garbage"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyDigests(tt.header, data)
+			var checksumErr *ChecksumError
+			if tt.wantAlgorithm == "" {
+				if err != nil {
+					t.Errorf("verifyDigests() error = %v", err)
+				}
+			} else if !errors.As(err, &checksumErr) || checksumErr.Algorithm != tt.wantAlgorithm {
+				t.Errorf("verifyDigests() error = %v, want a %s ChecksumError", err, tt.wantAlgorithm)
+			}
+		})
+	}
+}
+
+func TestWithBodyVerification(t *testing.T) {
+	const body = "the response body"
+	sum := sha256.Sum256([]byte(body))
+	corrupt := sha256.Sum256([]byte("corrupt"))
+	// Responses break the first attempt, then are served right.
+	tests := []struct {
+		name   string
+		broken func(w http.ResponseWriter)
+		opts   []Option
+		// wantSent is the number of attempts, wantErr the error of the
+		// request or of reading its body.
+		wantSent int
+		wantErr  func(error) bool
+	}{
+		{name: "intact", broken: func(w http.ResponseWriter) { w.Write([]byte(body)) }, wantSent: 1},
+		{
+			name: "cut short",
+			broken: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				w.Write([]byte(body[:5]))
+			},
+			wantSent: 2,
+		},
+		{
+			name: "digest mismatch",
+			broken: func(w http.ResponseWriter) {
+				w.Header().Set("Digest", "sha-256="+b64Sum(corrupt[:]))
+				w.Write([]byte(body))
+			},
+			wantSent: 2,
+		},
+		{
+			name: "digest matches",
+			broken: func(w http.ResponseWriter) {
+				w.Header().Set("Digest", "sha-256="+b64Sum(sum[:]))
+				w.Write([]byte(body))
+			},
+			wantSent: 1,
+		},
+		{
+			// The digest is of the encoded body, which was decoded
+			name: "decompressed",
+			broken: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Header().Set("Digest", "sha-256="+b64Sum(corrupt[:]))
+				w.Write(gzipped(body))
+			},
+			wantSent: 1,
+		},
+		{
+			name: "too large",
+			broken: func(w http.ResponseWriter) {
+				w.(http.Flusher).Flush()
+				w.Write([]byte(body))
+			},
+			opts:     []Option{WithMaxResponseBytes(5)},
+			wantSent: 1,
+			wantErr:  func(err error) bool { return errors.Is(err, ErrBodyTooLarge) },
+		},
+		{
+			name: "incomplete every time",
+			broken: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				w.Write([]byte(body[:5]))
+			},
+			opts:     []Option{WithMaxRetries(0)},
+			wantSent: 1,
+			wantErr:  func(err error) bool { return errors.Is(err, ErrIncompleteBody) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) == 1 {
+					tt.broken(w)
+					return
+				}
+				w.Write([]byte(body))
+			}))
+			defer srv.Close()
+			c := NewRetryableClient(append([]Option{fastBackoff, WithBodyVerification()}, tt.opts...)...)
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+			var got []byte
+			if err == nil {
+				got, err = ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("error = %v", err)
+				}
+			} else if err != nil || string(got) != body {
+				t.Errorf("body = %q, %v, want %q", got, err, body)
+			}
+			if n := atomic.LoadInt32(&attempts); int(n) != tt.wantSent {
+				t.Errorf("%d attempts, want %d", n, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestUnverifiedBodyCutShort(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("short"))
+	}))
+	defer srv.Close()
+
+	// Without verification the caller is left with the truncated body
+	resp, err := NewRetryableClient().Do(context.Background(), mustNewRequest(t, srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := ioutil.ReadAll(resp.Body); err == nil {
+		t.Error("truncated body read without an error")
+	}
+}
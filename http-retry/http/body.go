@@ -0,0 +1,106 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxBufferedBody is the largest request body buffered in memory so it
+// can be replayed on retry.
+const DefaultMaxBufferedBody = 10 << 20
+
+// BodyFunc returns a fresh copy of a request body. It is called once per
+// attempt, so retries never see a consumed or half-read body.
+type BodyFunc func() (io.ReadCloser, error)
+
+// NewRequest builds a request whose body can be replayed across retries.
+// body may be nil, []byte, string, *bytes.Buffer, *bytes.Reader,
+// *strings.Reader, a BodyFunc or any other io.Reader; plain readers are
+// buffered by the client when they are sent.
+func NewRequest(ctx context.Context, method, url string, body interface{}) (*http.Request, error) {
+	switch b := body.(type) {
+	case nil:
+		return http.NewRequestWithContext(ctx, method, url, nil)
+	case []byte:
+		return http.NewRequestWithContext(ctx, method, url, bytes.NewReader(b))
+	case string:
+		return http.NewRequestWithContext(ctx, method, url, strings.NewReader(b))
+	case BodyFunc:
+		return newFactoryRequest(ctx, method, url, b)
+	case func() (io.ReadCloser, error):
+		return newFactoryRequest(ctx, method, url, b)
+	case io.Reader:
+		return http.NewRequestWithContext(ctx, method, url, b)
+	default:
+		return nil, fmt.Errorf("rhttp: unsupported body type %T", body)
+	}
+}
+
+func newFactoryRequest(ctx context.Context, method, url string, body BodyFunc) (*http.Request, error) {
+	rc, err := body()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	req.GetBody = body
+
+	return req, nil
+}
+
+func nilBody() (io.ReadCloser, error) { return nil, nil }
+
+func noBody() (io.ReadCloser, error) { return http.NoBody, nil }
+
+func nopRelease() {}
+
+// replayableBody returns the body of the first attempt of req and a factory
+// producing the body of every retry. The factory is nil when the body cannot
+// be replayed: bodies without GetBody are buffered up to limit bytes, larger
+// ones are streamed once and never retried. Buffers come from a pool they go
+// back to, up to maxPooled bytes, once release is called and every body from
+// the factory is closed; release is never nil.
+func replayableBody(req *http.Request, limit int64, maxPooled int) (io.ReadCloser, BodyFunc, func(), error) {
+	if req.Body == nil {
+		return nil, nilBody, nopRelease, nil
+	}
+	if req.Body == http.NoBody {
+		return http.NoBody, noBody, nopRelease, nil
+	}
+
+	if req.GetBody != nil {
+		return req.Body, req.GetBody, nopRelease, nil
+	}
+
+	rb := newReplayBuffer(maxPooled)
+	if _, err := rb.buf.ReadFrom(io.LimitReader(req.Body, limit+1)); err != nil {
+		req.Body.Close()
+		rb.release()
+		return nil, nil, nopRelease, err
+	}
+
+	if int64(rb.buf.Len()) > limit {
+		// Too large to keep around: send what we read followed by the rest, once.
+		// The buffer stays with the body instead of going back to the pool.
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(rb.buf, req.Body), req.Body}, nil, nopRelease, nil
+	}
+
+	req.Body.Close()
+	getBody := func() (io.ReadCloser, error) {
+		return rb.open()
+	}
+	body, _ := rb.open()
+
+	return body, getBody, rb.release, nil
+}
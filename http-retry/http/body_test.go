@@ -0,0 +1,155 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// onlyReader hides every method of its reader but Read, so it is buffered.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestNewRequestReplaysBodies(t *testing.T) {
+	tests := []struct {
+		name string
+		body interface{}
+		want string
+	}{
+		{name: "nil", body: nil},
+		{name: "bytes", body: []byte("payload"), want: "payload"},
+		{name: "string", body: "payload", want: "payload"},
+		{name: "bytes.Buffer", body: bytes.NewBufferString("payload"), want: "payload"},
+		{name: "bytes.Reader", body: bytes.NewReader([]byte("payload")), want: "payload"},
+		{name: "strings.Reader", body: strings.NewReader("payload"), want: "payload"},
+		{name: "plain reader", body: onlyReader{strings.NewReader("payload")}, want: "payload"},
+		{
+			name: "BodyFunc",
+			body: BodyFunc(func() (io.ReadCloser, error) { return ioutil.NopCloser(strings.NewReader("payload")), nil }),
+			want: "payload",
+		},
+		{
+			name: "func",
+			body: func() (io.ReadCloser, error) { return ioutil.NopCloser(strings.NewReader("payload")), nil },
+			want: "payload",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503, 503, 200)
+			c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0))
+
+			req, err := NewRequest(context.Background(), http.MethodPut, srv.URL, tt.body)
+			if err != nil {
+				t.Fatalf("NewRequest() error = %v", err)
+			}
+			resp, err := c.Do(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			drainBody(resp)
+
+			if srv.count() != 3 {
+				t.Fatalf("server received %d requests, want 3", srv.count())
+			}
+			for i := 0; i < 3; i++ {
+				if _, body := srv.request(i); body != tt.want {
+					t.Errorf("attempt %d body = %q, want %q", i+1, body, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRequestErrors(t *testing.T) {
+	errOpen := errors.New("open")
+	tests := []struct {
+		name    string
+		body    interface{}
+		wantErr error
+	}{
+		{name: "unsupported type", body: 42},
+		{name: "failing BodyFunc", body: BodyFunc(func() (io.ReadCloser, error) { return nil, errOpen }), wantErr: errOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRequest(context.Background(), http.MethodPost, "http://example.com", tt.body)
+			if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("NewRequest() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReplayableBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       io.Reader
+		limit      int64
+		want       string
+		wantReplay bool
+	}{
+		{name: "buffered", body: onlyReader{strings.NewReader("payload")}, limit: 100, want: "payload", wantReplay: true},
+		{name: "exactly the limit", body: onlyReader{strings.NewReader("payload")}, limit: 7, want: "payload", wantReplay: true},
+		{name: "over the limit", body: onlyReader{strings.NewReader("payload")}, limit: 3, want: "payload"},
+		{name: "GetBody", body: strings.NewReader("payload"), limit: 3, want: "payload", wantReplay: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "http://example.com", tt.body)
+			first, getBody, release, err := replayableBody(req, tt.limit, DefaultMaxPooledBuffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			if got, _ := ioutil.ReadAll(first); string(got) != tt.want {
+				t.Errorf("first body = %q, want %q", got, tt.want)
+			}
+			first.Close()
+			if (getBody != nil) != tt.wantReplay {
+				t.Fatalf("replayable = %v, want %v", getBody != nil, tt.wantReplay)
+			}
+			if getBody == nil {
+				return
+			}
+			again, err := getBody()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := ioutil.ReadAll(again); string(got) != tt.want {
+				t.Errorf("replayed body = %q, want %q", got, tt.want)
+			}
+			again.Close()
+		})
+	}
+}
+
+func TestReplayableBodyWithoutBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body io.ReadCloser
+	}{
+		{name: "nil"},
+		{name: "NoBody", body: http.NoBody},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			req.Body = tt.body
+			first, getBody, release, err := replayableBody(req, 0, 0)
+			if err != nil || first != tt.body || getBody == nil || release == nil {
+				t.Fatalf("replayableBody() = %v, %v, %v", first, getBody != nil, err)
+			}
+			if again, err := getBody(); again != tt.body || err != nil {
+				t.Errorf("replayed body = %v, %v, want %v", again, err, tt.body)
+			}
+		})
+	}
+}
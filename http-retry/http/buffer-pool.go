@@ -0,0 +1,90 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMaxPooledBuffer is the largest buffer kept for reuse once the body
+// it held is no longer needed.
+const DefaultMaxPooledBuffer = 1 << 20
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+var errBodyReleased = errors.New("rhttp: request body already released")
+
+// WithMaxPooledBuffer sets the capacity up to which the buffers holding
+// request bodies for replay are reused by later requests. Larger buffers,
+// grown for an occasional huge body, are left to the garbage collector so
+// they do not bloat the pool. Zero disables reuse.
+func WithMaxPooledBuffer(n int) Option {
+	return func(c *config) {
+		c.maxPooledBuffer = n
+	}
+}
+
+// replayBuffer is a pooled buffer shared by the copies of a request body. It
+// goes back to the pool once its owner and every copy are done with it, as the
+// transport may close a body after RoundTrip returned.
+type replayBuffer struct {
+	buf  *bytes.Buffer
+	max  int
+	refs int32
+}
+
+func newReplayBuffer(max int) *replayBuffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	return &replayBuffer{buf: buf, max: max, refs: 1}
+}
+
+// acquire takes a reference, failing once the buffer went back to the pool.
+func (b *replayBuffer) acquire() bool {
+	for {
+		refs := atomic.LoadInt32(&b.refs)
+		if refs <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&b.refs, refs, refs+1) {
+			return true
+		}
+	}
+}
+
+func (b *replayBuffer) release() {
+	if atomic.AddInt32(&b.refs, -1) != 0 {
+		return
+	}
+	if b.buf.Cap() <= b.max {
+		bufferPool.Put(b.buf)
+	}
+	b.buf = nil
+}
+
+// open returns a copy of the body, holding a reference until it is closed.
+func (b *replayBuffer) open() (*replayReader, error) {
+	if !b.acquire() {
+		return nil, errBodyReleased
+	}
+
+	return &replayReader{Reader: bytes.NewReader(b.buf.Bytes()), buffer: b}, nil
+}
+
+type replayReader struct {
+	*bytes.Reader
+	buffer *replayBuffer
+	closed int32
+}
+
+func (r *replayReader) Close() error {
+	if atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		r.buffer.release()
+	}
+
+	return nil
+}
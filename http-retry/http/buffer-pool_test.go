@@ -0,0 +1,116 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReplayBufferReleased(t *testing.T) {
+	rb := newReplayBuffer(DefaultMaxPooledBuffer)
+	rb.buf.WriteString("payload")
+	r, err := rb.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The buffer outlives its owner while a copy is open
+	rb.release()
+	if got, _ := ioutil.ReadAll(r); string(got) != "payload" {
+		t.Errorf("open copy read %q after release, want %q", got, "payload")
+	}
+	r.Close()
+	r.Close()
+
+	if _, err := rb.open(); err != errBodyReleased {
+		t.Errorf("open() after every release error = %v, want errBodyReleased", err)
+	}
+}
+
+func TestReplayBufferCopies(t *testing.T) {
+	const owner = -1
+	tests := []struct {
+		name   string
+		copies int
+		// closes lists the copies closed in order, owner for the owner's
+		// release.
+		closes []int
+		// wantOpen is whether a new copy may be opened afterwards.
+		wantOpen bool
+	}{
+		{name: "owner only", closes: []int{owner}},
+		{name: "copies closed first", copies: 2, closes: []int{0, 1, owner}},
+		{name: "owner released first", copies: 2, closes: []int{owner, 1, 0}},
+		{name: "copy still open", copies: 2, closes: []int{owner, 0}, wantOpen: true},
+		{name: "owner not released", copies: 2, closes: []int{0, 1}, wantOpen: true},
+		{name: "copy closed twice", copies: 2, closes: []int{0, 0, owner}, wantOpen: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb := newReplayBuffer(DefaultMaxPooledBuffer)
+			rb.buf.WriteString("payload")
+			var copies []*replayReader
+			for i := 0; i < tt.copies; i++ {
+				r, err := rb.open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				copies = append(copies, r)
+			}
+
+			for _, i := range tt.closes {
+				if i == owner {
+					rb.release()
+				} else {
+					copies[i].Close()
+				}
+			}
+			r, err := rb.open()
+			if (err == nil) != tt.wantOpen {
+				t.Fatalf("open() error = %v, want a copy: %v", err, tt.wantOpen)
+			}
+			if err == nil {
+				if got, _ := ioutil.ReadAll(r); string(got) != "payload" {
+					t.Errorf("copy read %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestWithMaxPooledBuffer(t *testing.T) {
+	tests := []struct {
+		name string
+		max  int
+		size int
+	}{
+		{name: "default", max: DefaultMaxPooledBuffer, size: 1000},
+		{name: "no reuse", max: 0, size: 1000},
+		{name: "larger than pooled", max: 100, size: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewRetryableClient(fastBackoff, WithMaxPooledBuffer(tt.max))
+			body := strings.Repeat("x", tt.size)
+			// Several requests in turn reuse the buffers of the previous ones
+			for i := 0; i < 3; i++ {
+				srv := newScriptServer(t, 503, 200)
+				payload := body + strings.Repeat("y", i)
+				req, _ := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader(payload))
+
+				resp, err := c.Do(context.Background(), req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				drainBody(resp)
+				for n := 0; n < srv.count(); n++ {
+					if _, got := srv.request(n); got != payload {
+						t.Errorf("request %d attempt %d sent %d bytes, want %d", i+1, n+1, len(got), len(payload))
+					}
+				}
+			}
+		})
+	}
+}
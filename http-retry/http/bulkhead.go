@@ -0,0 +1,203 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBulkheadFull is returned without sending the request when its host's
+// bulkhead has every slot in use and its queue is full, or the request waited
+// in the queue for longer than QueueTimeout. It is not retried.
+var ErrBulkheadFull = errors.New("rhttp: bulkhead full")
+
+// BulkheadSettings sizes the compartment of a host.
+type BulkheadSettings struct {
+	// MaxInFlight is the number of attempts sent to the host at once, 32 if
+	// not positive.
+	MaxInFlight int
+	// MaxQueued is the number of attempts waiting for a slot. Zero rejects
+	// attempts as soon as every slot is in use.
+	MaxQueued int
+	// QueueTimeout bounds the wait for a slot. Zero waits as long as the
+	// request context allows.
+	QueueTimeout time.Duration
+	// PriorityAging is how long a queued attempt waits before it is promoted
+	// by one priority, DefaultPriorityAging if zero. The queue is ordered by
+	// priority, see WithPriority.
+	PriorityAging time.Duration
+	// EarliestDeadlineFirst orders queued attempts of the same priority by
+	// their context deadline instead of by arrival, those without a deadline
+	// last, so more requests complete in time under backpressure. Attempts
+	// whose deadline passes while queued fail with ErrExpiredInQueue.
+	EarliestDeadlineFirst bool
+}
+
+const defaultBulkheadInFlight = 32
+
+// Bulkhead isolates hosts from each other: each host gets its own
+// compartment of in-flight slots and queue, so an upstream that slows down
+// and ties up its compartment cannot starve the requests to healthy
+// upstreams made through the same client.
+type Bulkhead struct {
+	settings BulkheadSettings
+
+	mu    sync.Mutex
+	hosts map[string]BulkheadSettings
+	comps map[string]*compartment
+}
+
+type compartment struct {
+	bulkhead *Bulkhead
+	settings BulkheadSettings
+	clock    Clock
+	inflight int
+	queue    priorityQueue
+}
+
+// NewBulkhead returns a bulkhead applying settings to every host. A bulkhead
+// may be shared between clients.
+func NewBulkhead(settings BulkheadSettings) *Bulkhead {
+	return &Bulkhead{
+		settings: settings,
+		hosts:    make(map[string]BulkheadSettings),
+		comps:    make(map[string]*compartment),
+	}
+}
+
+// WithBulkhead sends every attempt within the compartment of its host in b.
+func WithBulkhead(b *Bulkhead) Option {
+	return func(c *config) {
+		c.bulkhead = b
+	}
+}
+
+// SetHostSettings overrides the settings used for host. It only applies to a
+// host not contacted yet.
+func (b *Bulkhead) SetHostSettings(host string, settings BulkheadSettings) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.hosts[host] = settings
+}
+
+// InFlight returns the attempts to host currently holding a slot.
+func (b *Bulkhead) InFlight(host string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.comps[host]
+	if !ok {
+		return 0
+	}
+
+	return c.inflight
+}
+
+// Queued returns the attempts to host waiting for a slot.
+func (b *Bulkhead) Queued(host string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.comps[host]
+	if !ok {
+		return 0
+	}
+
+	return c.queue.len()
+}
+
+// compartment returns the compartment of host, created with clock if new.
+// b.mu must be held.
+func (b *Bulkhead) compartment(host string, clock Clock) *compartment {
+	c, ok := b.comps[host]
+	if !ok {
+		settings, ok := b.hosts[host]
+		if !ok {
+			settings = b.settings
+		}
+		if settings.MaxInFlight <= 0 {
+			settings.MaxInFlight = defaultBulkheadInFlight
+		}
+		c = &compartment{
+			bulkhead: b,
+			settings: settings,
+			clock:    clock,
+			queue:    priorityQueue{aging: settings.PriorityAging, edf: settings.EarliestDeadlineFirst},
+		}
+		b.comps[host] = c
+	}
+
+	return c
+}
+
+// acquire takes a slot in the compartment of host, waiting in its queue if
+// needed, and returns the function giving it back.
+func (b *Bulkhead) acquire(ctx context.Context, clock Clock, host string) (func(), error) {
+	b.mu.Lock()
+	c := b.compartment(host, clock)
+	if c.inflight < c.settings.MaxInFlight {
+		c.inflight++
+		b.mu.Unlock()
+		return c.release, nil
+	}
+	if c.queue.expired(ctx.Err()) {
+		b.mu.Unlock()
+		return nil, fmt.Errorf("%w for %s", ErrExpiredInQueue, host)
+	}
+	if c.queue.len() >= c.settings.MaxQueued {
+		b.mu.Unlock()
+		return nil, fmt.Errorf("%w for %s", ErrBulkheadFull, host)
+	}
+	w := c.queue.push(ctx, c.clock.Now())
+	b.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if c.settings.QueueTimeout > 0 {
+		wake, stop := newTimer(clock, c.settings.QueueTimeout)
+		defer stop()
+		timeout = wake
+	}
+
+	var err error
+	select {
+	case <-w.ready:
+		if w.expired {
+			return nil, fmt.Errorf("%w for %s", ErrExpiredInQueue, host)
+		}
+		return c.release, nil
+	case <-timeout:
+		err = fmt.Errorf("%w for %s: queued for %v", ErrBulkheadFull, host, c.settings.QueueTimeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+		if c.queue.expired(err) {
+			err = fmt.Errorf("%w for %s", ErrExpiredInQueue, host)
+		}
+	}
+
+	b.mu.Lock()
+	granted := w.granted
+	if !granted {
+		c.queue.remove(w)
+	}
+	b.mu.Unlock()
+	if granted {
+		// The slot was handed over as we gave up, pass it on
+		c.release()
+	}
+
+	return nil, err
+}
+
+// release gives a slot back, handing it straight to the first queued attempt
+// if any.
+func (c *compartment) release() {
+	c.bulkhead.mu.Lock()
+	defer c.bulkhead.mu.Unlock()
+
+	if !c.queue.grant(c.clock.Now()) {
+		c.inflight--
+	}
+}
@@ -0,0 +1,235 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until n attempts to host are queued in b.
+func waitQueued(t *testing.T, b *Bulkhead, host string, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Queued(host) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Queued(%q) = %d, want %d", host, b.Queued(host), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBulkheadAcquire(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings BulkheadSettings
+		hosts    map[string]BulkheadSettings
+		acquire  []string
+		wantFull []bool
+	}{
+		{
+			name:     "free slots",
+			settings: BulkheadSettings{MaxInFlight: 2},
+			acquire:  []string{"a", "a"},
+			wantFull: []bool{false, false},
+		},
+		{
+			name:     "full without a queue",
+			settings: BulkheadSettings{MaxInFlight: 1},
+			acquire:  []string{"a", "a"},
+			wantFull: []bool{false, true},
+		},
+		{
+			name:     "hosts isolated",
+			settings: BulkheadSettings{MaxInFlight: 1},
+			acquire:  []string{"a", "a", "b"},
+			wantFull: []bool{false, true, false},
+		},
+		{
+			name:     "host settings",
+			settings: BulkheadSettings{MaxInFlight: 1},
+			hosts:    map[string]BulkheadSettings{"b": {MaxInFlight: 2}},
+			acquire:  []string{"a", "a", "b", "b", "b"},
+			wantFull: []bool{false, true, false, false, true},
+		},
+		{
+			name:     "default slots",
+			acquire:  make([]string, defaultBulkheadInFlight+1),
+			wantFull: append(make([]bool, defaultBulkheadInFlight), true),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBulkhead(tt.settings)
+			for host, settings := range tt.hosts {
+				b.SetHostSettings(host, settings)
+			}
+
+			held := map[string]int{}
+			for i, host := range tt.acquire {
+				release, err := b.acquire(context.Background(), systemClock{}, host)
+				if full := errors.Is(err, ErrBulkheadFull); full != tt.wantFull[i] || (err != nil && !full) {
+					t.Fatalf("acquire %d for %q error = %v, want full: %v", i+1, host, err, tt.wantFull[i])
+				}
+				if err == nil {
+					defer release()
+					held[host]++
+				}
+			}
+			for host, n := range held {
+				if got := b.InFlight(host); got != n {
+					t.Errorf("InFlight(%q) = %d, want %d", host, got, n)
+				}
+			}
+			if got := b.InFlight("unknown"); got != 0 {
+				t.Errorf("InFlight of an unknown host = %d", got)
+			}
+		})
+	}
+}
+
+func TestBulkheadQueue(t *testing.T) {
+	b := NewBulkhead(BulkheadSettings{MaxInFlight: 1, MaxQueued: 1})
+	release, err := b.acquire(context.Background(), systemClock{}, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type acquired struct {
+		release func()
+		err     error
+	}
+	queued := make(chan acquired, 1)
+	go func() {
+		release, err := b.acquire(context.Background(), systemClock{}, "a")
+		queued <- acquired{release, err}
+	}()
+	waitQueued(t, b, "a", 1)
+
+	if _, err := b.acquire(context.Background(), systemClock{}, "a"); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("acquire with a full queue error = %v, want ErrBulkheadFull", err)
+	}
+
+	// The slot goes straight to the queued attempt
+	release()
+	got := <-queued
+	if got.err != nil {
+		t.Fatalf("queued acquire error = %v", got.err)
+	}
+	if b.InFlight("a") != 1 || b.Queued("a") != 0 {
+		t.Errorf("after a handover InFlight = %d, Queued = %d, want 1, 0", b.InFlight("a"), b.Queued("a"))
+	}
+	got.release()
+	if b.InFlight("a") != 0 {
+		t.Errorf("after every release InFlight = %d", b.InFlight("a"))
+	}
+}
+
+func TestBulkheadQueueGivesUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings BulkheadSettings
+		clock    Clock
+		cancel   bool
+		wantErr  error
+	}{
+		{
+			name:     "queue timeout",
+			settings: BulkheadSettings{MaxInFlight: 1, MaxQueued: 1, QueueTimeout: time.Second},
+			clock:    newStepClock(),
+			wantErr:  ErrBulkheadFull,
+		},
+		{
+			name:     "cancelled",
+			settings: BulkheadSettings{MaxInFlight: 1, MaxQueued: 1},
+			clock:    systemClock{},
+			cancel:   true,
+			wantErr:  context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBulkhead(tt.settings)
+			release, err := b.acquire(context.Background(), tt.clock, "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() {
+				_, err := b.acquire(ctx, tt.clock, "a")
+				done <- err
+			}()
+			if tt.cancel {
+				waitQueued(t, b, "a", 1)
+				cancel()
+			}
+
+			if err := <-done; !errors.Is(err, tt.wantErr) {
+				t.Errorf("acquire error = %v, want %v", err, tt.wantErr)
+			}
+			if b.Queued("a") != 0 || b.InFlight("a") != 1 {
+				t.Errorf("after giving up Queued = %d, InFlight = %d, want 0, 1", b.Queued("a"), b.InFlight("a"))
+			}
+		})
+	}
+}
+
+func TestBulkheadRejectsWithoutSending(t *testing.T) {
+	srv := newScriptServer(t, 200)
+	b := NewBulkhead(BulkheadSettings{MaxInFlight: 1})
+	host := mustParseURL(t, srv.URL).Host
+	release, err := b.acquire(context.Background(), systemClock{}, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	c := NewRetryableClient(fastBackoff, WithBulkhead(b))
+	if _, _, err := c.GetBytes(context.Background(), srv.URL); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("GetBytes() error = %v, want ErrBulkheadFull", err)
+	}
+	if srv.count() != 0 {
+		t.Errorf("server received %d requests, want none", srv.count())
+	}
+}
+
+func TestBulkheadDropsExpiredAttempts(t *testing.T) {
+	tests := []struct {
+		name    string
+		edf     bool
+		wantErr error
+	}{
+		{name: "earliest deadline first", edf: true, wantErr: ErrExpiredInQueue},
+		{name: "arrival order", wantErr: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBulkhead(BulkheadSettings{MaxInFlight: 1, MaxQueued: 1, EarliestDeadlineFirst: tt.edf})
+			release, err := b.acquire(context.Background(), systemClock{}, "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err = b.acquire(ctx, systemClock{}, "a")
+			if !errors.Is(err, tt.wantErr) || !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("acquire error = %v, want %v", err, tt.wantErr)
+			}
+			if b.Queued("a") != 0 {
+				t.Errorf("Queued() = %d after the deadline passed", b.Queued("a"))
+			}
+
+			// An attempt already past its deadline is refused at once
+			if _, err := b.acquire(ctx, systemClock{}, "a"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("acquire past the deadline error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
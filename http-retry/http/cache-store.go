@@ -0,0 +1,173 @@
+package http
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/gob"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is how many bytes the store of NewCache holds.
+const DefaultCacheSize = 64 << 20
+
+// CacheStore holds the entries of a Cache, encoded. Implement it on top of
+// Redis, memcached or groupcache to share a cache between the instances of
+// a service. Its methods are called concurrently; Set may drop a value, e.g.
+// one too large to keep.
+type CacheStore interface {
+	Get(key string) (value []byte, ok bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// MemoryCacheStore is a CacheStore keeping up to a number of bytes in
+// memory, evicting the least recently used entries to make room.
+type MemoryCacheStore struct {
+	maxBytes int64
+
+	mu        sync.Mutex
+	bytes     int64
+	evictions int64
+	lru       *list.List
+	items     map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCacheStore returns an empty store holding up to maxBytes of keys
+// and values.
+func NewMemoryCacheStore(maxBytes int64) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryCacheStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(el)
+
+	return el.Value.(*memoryCacheItem).value, true
+}
+
+// Set stores value under key, unless it is larger than the whole store.
+func (s *MemoryCacheStore) Set(key string, value []byte) {
+	size := int64(len(key) + len(value))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	if size > s.maxBytes {
+		return
+	}
+	for s.bytes+size > s.maxBytes {
+		s.remove(s.lru.Back())
+		s.evictions++
+	}
+	s.items[key] = s.lru.PushFront(&memoryCacheItem{key: key, value: value})
+	s.bytes += size
+}
+
+func (s *MemoryCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+}
+
+// remove drops el. s.mu must be held.
+func (s *MemoryCacheStore) remove(el *list.Element) {
+	item := s.lru.Remove(el).(*memoryCacheItem)
+	delete(s.items, item.key)
+	s.bytes -= int64(len(item.key) + len(item.value))
+}
+
+// Len returns the number of entries in the store.
+func (s *MemoryCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.items)
+}
+
+// Size returns the bytes held by the store.
+func (s *MemoryCacheStore) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bytes
+}
+
+// Evictions returns how many entries were evicted to make room.
+func (s *MemoryCacheStore) Evictions() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.evictions
+}
+
+// storedEntry is the encoded form of a cacheEntry.
+type storedEntry struct {
+	Status               int
+	Header               http.Header
+	Body                 []byte
+	Vary                 http.Header
+	Stored               time.Time
+	Expires              time.Time
+	StaleIfError         time.Duration
+	StaleWhileRevalidate time.Duration
+}
+
+func encodeCacheEntry(e *cacheEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(storedEntry{
+		Status:               e.status,
+		Header:               e.header,
+		Body:                 e.body,
+		Vary:                 e.vary,
+		Stored:               e.stored,
+		Expires:              e.expires,
+		StaleIfError:         e.staleIfError,
+		StaleWhileRevalidate: e.staleWhileRevalidate,
+	})
+
+	return buf.Bytes(), err
+}
+
+func decodeCacheEntry(b []byte) (*cacheEntry, error) {
+	var s storedEntry
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Header == nil {
+		s.Header = make(http.Header)
+	}
+
+	return &cacheEntry{
+		status:               s.Status,
+		header:               s.Header,
+		body:                 s.Body,
+		vary:                 s.Vary,
+		stored:               s.Stored,
+		expires:              s.Expires,
+		staleIfError:         s.StaleIfError,
+		staleWhileRevalidate: s.StaleWhileRevalidate,
+	}, nil
+}
@@ -0,0 +1,208 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheStore(t *testing.T) {
+	type op struct {
+		set, get, delete string
+		value            string
+	}
+	tests := []struct {
+		name     string
+		maxBytes int64
+		ops      []op
+		// wantKeys are the keys left and wantSize their bytes.
+		wantKeys      []string
+		wantSize      int64
+		wantEvictions int64
+	}{
+		{
+			name:     "set",
+			maxBytes: 100,
+			ops:      []op{{set: "a", value: "1234"}, {set: "b", value: "12"}},
+			wantKeys: []string{"a", "b"},
+			wantSize: 8,
+		},
+		{
+			name:     "replaced",
+			maxBytes: 100,
+			ops:      []op{{set: "a", value: "1234"}, {set: "a", value: "1"}},
+			wantKeys: []string{"a"},
+			wantSize: 2,
+		},
+		{
+			name:     "deleted",
+			maxBytes: 100,
+			ops:      []op{{set: "a", value: "1"}, {set: "b", value: "1"}, {delete: "a"}, {delete: "c"}},
+			wantKeys: []string{"b"},
+			wantSize: 2,
+		},
+		{
+			name:          "least recently set evicted",
+			maxBytes:      10,
+			ops:           []op{{set: "a", value: "1234"}, {set: "b", value: "1234"}, {set: "c", value: "1234"}},
+			wantKeys:      []string{"b", "c"},
+			wantSize:      10,
+			wantEvictions: 1,
+		},
+		{
+			name:          "least recently read evicted",
+			maxBytes:      10,
+			ops:           []op{{set: "a", value: "1234"}, {set: "b", value: "1234"}, {get: "a"}, {set: "c", value: "1234"}},
+			wantKeys:      []string{"a", "c"},
+			wantSize:      10,
+			wantEvictions: 1,
+		},
+		{
+			name:          "several evicted",
+			maxBytes:      10,
+			ops:           []op{{set: "a", value: "12"}, {set: "b", value: "12"}, {set: "c", value: "12"}, {set: "d", value: "123456"}},
+			wantKeys:      []string{"c", "d"},
+			wantSize:      10,
+			wantEvictions: 2,
+		},
+		{
+			name:     "too large dropped",
+			maxBytes: 10,
+			ops:      []op{{set: "a", value: "1234"}, {set: "b", value: "1234567890"}},
+			wantKeys: []string{"a"},
+			wantSize: 5,
+		},
+		{
+			name:     "too large replacement drops the old value",
+			maxBytes: 10,
+			ops:      []op{{set: "a", value: "1234"}, {set: "a", value: "1234567890"}},
+			wantSize: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryCacheStore(tt.maxBytes)
+			values := make(map[string]string)
+			for _, o := range tt.ops {
+				switch {
+				case o.set != "":
+					s.Set(o.set, []byte(o.value))
+					values[o.set] = o.value
+				case o.get != "":
+					s.Get(o.get)
+				case o.delete != "":
+					s.Delete(o.delete)
+				}
+			}
+
+			var keys []string
+			for _, key := range []string{"a", "b", "c", "d"} {
+				if value, ok := s.Get(key); ok {
+					keys = append(keys, key)
+					if string(value) != values[key] {
+						t.Errorf("Get(%q) = %q, want %q", key, value, values[key])
+					}
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+			if s.Len() != len(tt.wantKeys) || s.Size() != tt.wantSize || s.Evictions() != tt.wantEvictions {
+				t.Errorf("Len() = %d, Size() = %d, Evictions() = %d, want %d, %d, %d",
+					s.Len(), s.Size(), s.Evictions(), len(tt.wantKeys), tt.wantSize, tt.wantEvictions)
+			}
+		})
+	}
+}
+
+func TestCacheEntryEncoding(t *testing.T) {
+	stored := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		entry *cacheEntry
+		want  *cacheEntry
+	}{
+		{
+			name: "full",
+			entry: &cacheEntry{
+				status:               http.StatusOK,
+				header:               http.Header{"Etag": {`"v1"`}, "Cache-Control": {"max-age=60", "stale-if-error=30"}},
+				body:                 []byte("body"),
+				vary:                 http.Header{"Accept-Language": {"fr"}},
+				stored:               stored,
+				expires:              stored.Add(time.Minute),
+				staleIfError:         30 * time.Second,
+				staleWhileRevalidate: 10 * time.Second,
+			},
+		},
+		{
+			name:  "no header",
+			entry: &cacheEntry{status: http.StatusNoContent, stored: stored, expires: stored},
+			want:  &cacheEntry{status: http.StatusNoContent, header: http.Header{}, stored: stored, expires: stored},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := encodeCacheEntry(tt.entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decodeCacheEntry(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if want == nil {
+				want = tt.entry
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	if _, err := decodeCacheEntry([]byte("not gob")); err == nil {
+		t.Error("decoded garbage")
+	}
+}
+
+func TestCacheWithStore(t *testing.T) {
+	tests := []struct {
+		name string
+		// corrupt replaces what the first client stored.
+		corrupt      bool
+		wantRequests int
+	}{
+		{name: "shared", wantRequests: 1},
+		{name: "corrupt entry dropped", corrupt: true, wantRequests: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newCacheServer(t, http.Header{"Cache-Control": {"max-age=60"}})
+			store := NewMemoryCacheStore(DefaultCacheSize)
+			clock := newStepClock()
+			// Two instances of a service, sharing their cache store
+			a := NewRetryableClient(WithClock(clock), WithCache(NewCacheWithStore(store, 0)))
+			b := NewRetryableClient(WithClock(clock), WithCache(NewCacheWithStore(store, 0)))
+
+			if _, _, err := a.GetBytes(context.Background(), srv.URL); err != nil {
+				t.Fatal(err)
+			}
+			if store.Len() != 1 {
+				t.Fatalf("store holds %d entries, want 1", store.Len())
+			}
+			if tt.corrupt {
+				store.Set(http.MethodGet+" "+srv.URL, []byte("corrupt"))
+			}
+			status, body, err := b.GetBytes(context.Background(), srv.URL)
+			if err != nil || status != http.StatusOK || string(body) != "cached body" {
+				t.Fatalf("GetBytes() = %d, %q, %v", status, body, err)
+			}
+			if requests, _ := srv.counts(); requests != tt.wantRequests {
+				t.Errorf("server received %d requests, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
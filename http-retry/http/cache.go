@@ -0,0 +1,439 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCachedBody is the largest response body kept by a Cache.
+const maxCachedBody = 1 << 20
+
+// Cache is an in-memory HTTP cache for GET requests. It honors Cache-Control
+// and Expires for freshness and revalidates stale entries with ETag and
+// Last-Modified. When StaleIfError is set, or a response carries a
+// stale-if-error directive, an expired entry is served if every retry fails.
+// Responses with a stale-while-revalidate directive are served stale within
+// that window while a fresh copy is fetched in the background. When
+// ServeStaleOnOpen is set, an entry of any age is served instead of
+// ErrCircuitOpen while the circuit for its host is open.
+//
+// Responses to requests carrying an Authorization or Cookie header are only
+// stored when marked Cache-Control: public, since the cache answers every
+// request for the same URL alike. Background revalidations belong to the
+// client that started them: Close waits for them, and cancels them if it
+// gives up waiting.
+type Cache struct {
+	StaleIfError     time.Duration
+	ServeStaleOnOpen bool
+
+	store CacheStore
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+	stats      CacheStats
+}
+
+// NewCache returns an empty cache serving stale entries for up to
+// staleIfError past their expiry when requests fail. It keeps up to
+// DefaultCacheSize bytes in memory, the least recently used entries going
+// first.
+func NewCache(staleIfError time.Duration) *Cache {
+	return NewCacheWithStore(NewMemoryCacheStore(DefaultCacheSize), staleIfError)
+}
+
+// NewCacheWithStore is like NewCache with the entries kept in store, e.g. a
+// MemoryCacheStore of another size or a store shared between instances.
+func NewCacheWithStore(store CacheStore, staleIfError time.Duration) *Cache {
+	return &Cache{
+		StaleIfError: staleIfError,
+		store:        store,
+		refreshing:   make(map[string]bool),
+	}
+}
+
+// CacheStats counts how a Cache answered requests.
+type CacheStats struct {
+	// Hits were answered from a fresh entry.
+	Hits int64 `json:"hits"`
+	// Misses were fetched in full from the server.
+	Misses int64 `json:"misses"`
+	// Revalidations were answered from an entry the server confirmed with a
+	// 304 response.
+	Revalidations int64 `json:"revalidations"`
+	// Stale were answered from a stale entry, while it was revalidated or
+	// because the request failed.
+	Stale int64 `json:"stale"`
+	// Entries, Bytes and Evictions describe a MemoryCacheStore, and are zero
+	// for other stores.
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	Evictions int64 `json:"evictions"`
+}
+
+// Stats returns the counts of c since it was created.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	s := c.stats
+	c.mu.Unlock()
+
+	if m, ok := c.store.(*MemoryCacheStore); ok {
+		s.Entries, s.Bytes, s.Evictions = m.Len(), m.Size(), m.Evictions()
+	}
+
+	return s
+}
+
+// count increments one of the counters of c.stats.
+func (c *Cache) count(counter *int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	*counter++
+}
+
+type cacheEntry struct {
+	status  int
+	header  http.Header
+	body    []byte
+	vary    http.Header
+	stored  time.Time
+	expires time.Time
+	// staleIfError extends how long past expires the entry may serve errors.
+	staleIfError time.Duration
+	// staleWhileRevalidate is how long past expires the entry may be served
+	// while it is refreshed in the background.
+	staleWhileRevalidate time.Duration
+}
+
+func cacheKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+func (c *Cache) get(req *http.Request) *cacheEntry {
+	key := cacheKey(req)
+	b, ok := c.store.Get(key)
+	if !ok {
+		return nil
+	}
+	e, err := decodeCacheEntry(b)
+	if err != nil {
+		c.store.Delete(key)
+		return nil
+	}
+	for name, values := range e.vary {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(values, ",") {
+			return nil
+		}
+	}
+
+	return e
+}
+
+func (c *Cache) put(req *http.Request, e *cacheEntry) {
+	if b, err := encodeCacheEntry(e); err == nil {
+		c.store.Set(cacheKey(req), b)
+	}
+}
+
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return now.Before(e.expires)
+}
+
+func (e *cacheEntry) hasValidators() bool {
+	return e.header.Get("ETag") != "" || e.header.Get("Last-Modified") != ""
+}
+
+// usableOnError reports whether the entry may be served after a failure.
+func (e *cacheEntry) usableOnError(now time.Time, staleIfError time.Duration) bool {
+	if e.staleIfError > staleIfError {
+		staleIfError = e.staleIfError
+	}
+
+	return now.Before(e.expires.Add(staleIfError))
+}
+
+// response builds a response from the entry. Stale responses carry a Warning
+// header, as RFC 7234 recommends.
+func (e *cacheEntry) response(req *http.Request, now time.Time, stale bool) *http.Response {
+	header := e.header.Clone()
+	header.Set("Age", strconv.Itoa(int(now.Sub(e.stored).Seconds())))
+	if stale {
+		header.Add("Warning", `110 - "Response is Stale"`)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.status, http.StatusText(e.status)),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+// IsStale reports whether resp was served stale by a Cache, as its Warning
+// header tells.
+func IsStale(resp *http.Response) bool {
+	for _, w := range resp.Header.Values("Warning") {
+		if strings.HasPrefix(w, "110 ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cacheControl parses a Cache-Control header into its directives.
+func cacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(strings.Join(h.Values("Cache-Control"), ","), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name, value = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+		directives[strings.ToLower(name)] = value
+	}
+
+	return directives
+}
+
+func directiveSeconds(cc map[string]string, name string) (time.Duration, bool) {
+	value, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
+
+// cacheable reports whether req may be answered from, and stored in, the cache.
+func cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return false
+	}
+	_, noStore := cacheControl(req.Header)["no-store"]
+
+	return !noStore
+}
+
+// hasCredentials reports whether req carries credentials, as a request that
+// may get a response meant for its user only.
+func hasCredentials(req *http.Request) bool {
+	return req != nil && (req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != "")
+}
+
+// newCacheEntry returns an entry for resp, or nil if it must not be stored.
+// The headers actually sent, those of resp.Request, count as much as those of
+// req, since cookies, signers and default headers are set on every attempt.
+func newCacheEntry(req *http.Request, resp *http.Response, now time.Time) *cacheEntry {
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Vary") == "*" {
+		return nil
+	}
+
+	cc := cacheControl(resp.Header)
+	if _, ok := cc["no-store"]; ok {
+		return nil
+	}
+	if _, public := cc["public"]; !public && (hasCredentials(req) || hasCredentials(resp.Request)) {
+		return nil
+	}
+
+	e := &cacheEntry{
+		status: resp.StatusCode,
+		header: resp.Header.Clone(),
+		vary:   make(http.Header),
+		stored: now,
+	}
+
+	_, noCache := cc["no-cache"]
+	if maxAge, ok := directiveSeconds(cc, "max-age"); ok && !noCache {
+		e.expires = now.Add(maxAge)
+	} else if expires, err := http.ParseTime(resp.Header.Get("Expires")); err == nil && !noCache {
+		date, err := http.ParseTime(resp.Header.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		e.expires = now.Add(expires.Sub(date))
+	} else if !e.hasValidators() {
+		// Neither fresh nor revalidatable: useless to keep
+		return nil
+	}
+	e.staleIfError, _ = directiveSeconds(cc, "stale-if-error")
+	e.staleWhileRevalidate, _ = directiveSeconds(cc, "stale-while-revalidate")
+
+	for _, name := range strings.Split(resp.Header.Get("Vary"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			e.vary[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+		}
+	}
+
+	return e
+}
+
+// revalidate updates the entry with the headers of a 304 response.
+func (e *cacheEntry) revalidate(resp *http.Response, now time.Time) *cacheEntry {
+	updated := *e
+	updated.header = e.header.Clone()
+	for name, values := range resp.Header {
+		updated.header[name] = values
+	}
+	updated.stored = now
+	updated.expires = now
+	if maxAge, ok := directiveSeconds(cacheControl(updated.header), "max-age"); ok {
+		updated.expires = now.Add(maxAge)
+	}
+
+	return &updated
+}
+
+// roundTrip answers req from the cache when possible, revalidates stale
+// entries, stores cacheable responses and serves stale entries on failure.
+// Freshness is judged by clock, the client's.
+func (c *Cache) roundTrip(req *http.Request, clock Clock, life *lifecycle, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if !cacheable(req) {
+		return next(req)
+	}
+
+	now := clock.Now()
+	entry := c.get(req)
+	if _, noCache := cacheControl(req.Header)["no-cache"]; entry != nil && !noCache {
+		if entry.fresh(now) {
+			c.count(&c.stats.Hits)
+			return entry.response(req, now, false), nil
+		}
+		if now.Before(entry.expires.Add(entry.staleWhileRevalidate)) {
+			c.count(&c.stats.Stale)
+			c.refresh(req, entry, clock, life, next)
+			return entry.response(req, now, true), nil
+		}
+	}
+
+	return c.fetch(req, entry, clock, next)
+}
+
+// refresh revalidates entry in the background, once at a time per key, as a
+// request of life, the client's lifecycle, if any.
+func (c *Cache) refresh(req *http.Request, entry *cacheEntry, clock Clock, life *lifecycle, next func(*http.Request) (*http.Response, error)) {
+	key := cacheKey(req)
+
+	c.mu.Lock()
+	if c.refreshing[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.mu.Unlock()
+
+	// Detach from the caller, who already has a response
+	ctx, leave := context.Background(), func() {}
+	if life != nil {
+		var err error
+		if ctx, leave, err = life.enter(ctx); err != nil {
+			// The client is closed
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+			return
+		}
+	}
+	bg := req.Clone(ctx)
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+			leave()
+		}()
+
+		resp, err := c.fetch(bg, entry, clock, next)
+		if err == nil {
+			drainBody(resp)
+		}
+	}()
+}
+
+// fetch sends req, conditionally if entry can be revalidated.
+func (c *Cache) fetch(req *http.Request, entry *cacheEntry, clock Clock, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	outgoing := req
+	if entry != nil && entry.hasValidators() {
+		outgoing = req.Clone(req.Context())
+		if etag := entry.header.Get("ETag"); etag != "" {
+			outgoing.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.header.Get("Last-Modified"); lastModified != "" {
+			outgoing.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := next(outgoing)
+	now := clock.Now()
+	if err != nil || resp.StatusCode >= 500 {
+		open := c.ServeStaleOnOpen && errors.Is(err, ErrCircuitOpen)
+		if entry != nil && (open || entry.usableOnError(now, c.StaleIfError)) {
+			drainBody(resp)
+			c.count(&c.stats.Stale)
+			return entry.response(req, now, true), nil
+		}
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil && outgoing != req {
+		drainBody(resp)
+		entry = entry.revalidate(resp, now)
+		c.put(req, entry)
+		c.count(&c.stats.Revalidations)
+		return entry.response(req, now, false), nil
+	}
+	c.count(&c.stats.Misses)
+
+	return c.keep(req, resp, now)
+}
+
+// keep stores a copy of resp if it is cacheable and small enough, handing the
+// caller an equivalent body.
+func (c *Cache) keep(req *http.Request, resp *http.Response, now time.Time) (*http.Response, error) {
+	entry := newCacheEntry(req, resp, now)
+	if entry == nil {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCachedBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > maxCachedBody {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	entry.body = body
+	c.put(req, entry)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return resp, nil
+}
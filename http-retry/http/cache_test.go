@@ -0,0 +1,308 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cacheServer answers with header and counts the requests it received, and
+// those that were conditional.
+type cacheServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	header      http.Header
+	status      int
+	requests    int
+	conditional int
+}
+
+func newCacheServer(t *testing.T, header http.Header) *cacheServer {
+	t.Helper()
+
+	s := &cacheServer{header: header, status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		status := s.status
+		if r.Header.Get("If-None-Match") != "" {
+			s.conditional++
+			status = http.StatusNotModified
+		}
+		for name, values := range s.header {
+			w.Header()[name] = values
+		}
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte("cached body"))
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *cacheServer) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status = status
+}
+
+func (s *cacheServer) counts() (requests, conditional int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests, s.conditional
+}
+
+func TestCacheFreshness(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        http.Header
+		advance       time.Duration
+		wantRequests  int
+		wantCondition int
+	}{
+		{name: "fresh", header: http.Header{"Cache-Control": {"max-age=60"}}, advance: 30 * time.Second, wantRequests: 1},
+		{name: "expired", header: http.Header{"Cache-Control": {"max-age=60"}}, advance: 61 * time.Second, wantRequests: 2},
+		{name: "no-store", header: http.Header{"Cache-Control": {"no-store, max-age=60"}}, wantRequests: 2},
+		{name: "no-cache revalidated", header: http.Header{"Cache-Control": {"no-cache"}, "Etag": {`"v1"`}}, wantRequests: 2, wantCondition: 1},
+		{name: "expired revalidated", header: http.Header{"Cache-Control": {"max-age=10"}, "Etag": {`"v1"`}}, advance: time.Minute, wantRequests: 2, wantCondition: 1},
+		{name: "no validators nor freshness", header: http.Header{}, wantRequests: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newCacheServer(t, tt.header)
+			clock := newStepClock()
+			c := NewRetryableClient(WithClock(clock), WithCache(NewCache(0)))
+
+			for i := 0; i < 2; i++ {
+				status, body, err := c.GetBytes(context.Background(), srv.URL)
+				if err != nil || status != http.StatusOK || string(body) != "cached body" {
+					t.Fatalf("request %d = %d, %q, %v", i+1, status, body, err)
+				}
+				clock.Advance(tt.advance)
+			}
+			if requests, conditional := srv.counts(); requests != tt.wantRequests || conditional != tt.wantCondition {
+				t.Errorf("server received %d requests, %d conditional, want %d, %d", requests, conditional, tt.wantRequests, tt.wantCondition)
+			}
+		})
+	}
+}
+
+func TestCacheCredentials(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		header       http.Header
+		opts         []Option
+		wantRequests int
+	}{
+		{name: "anonymous", cacheControl: "max-age=60", wantRequests: 1},
+		{name: "authorization", cacheControl: "max-age=60", header: http.Header{"Authorization": {"Bearer a"}}, wantRequests: 2},
+		{name: "cookie", cacheControl: "max-age=60", header: http.Header{"Cookie": {"session=a"}}, wantRequests: 2},
+		{name: "public", cacheControl: "public, max-age=60", header: http.Header{"Authorization": {"Bearer a"}}, wantRequests: 1},
+		{
+			name:         "default header",
+			cacheControl: "max-age=60",
+			opts:         []Option{WithDefaultHeaders(http.Header{"Authorization": {"Bearer a"}})},
+			wantRequests: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newCacheServer(t, http.Header{"Cache-Control": {tt.cacheControl}})
+			c := NewRetryableClient(append([]Option{WithCache(NewCache(0))}, tt.opts...)...)
+
+			for i := 0; i < 2; i++ {
+				req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+				for name, values := range tt.header {
+					req.Header[name] = values
+				}
+				resp, err := c.Do(context.Background(), req)
+				if err != nil {
+					t.Fatalf("request %d error = %v", i+1, err)
+				}
+				drainBody(resp)
+			}
+			if requests, _ := srv.counts(); requests != tt.wantRequests {
+				t.Errorf("server received %d requests, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestCacheServesStale(t *testing.T) {
+	tests := []struct {
+		name         string
+		staleIfError time.Duration
+		cacheControl string
+		advance      time.Duration
+		wantStale    bool
+	}{
+		{name: "within StaleIfError", staleIfError: time.Hour, cacheControl: "max-age=60", advance: 30 * time.Minute, wantStale: true},
+		{name: "past StaleIfError", staleIfError: time.Hour, cacheControl: "max-age=60", advance: 2 * time.Hour},
+		{name: "stale-if-error directive", cacheControl: "max-age=60, stale-if-error=3600", advance: 30 * time.Minute, wantStale: true},
+		{name: "no stale window", cacheControl: "max-age=60", advance: 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newCacheServer(t, http.Header{"Cache-Control": {tt.cacheControl}})
+			clock := newStepClock()
+			c := NewRetryableClient(WithClock(clock), WithMaxRetries(0), WithCache(NewCache(tt.staleIfError)))
+
+			if _, _, err := c.GetBytes(context.Background(), srv.URL); err != nil {
+				t.Fatal(err)
+			}
+			srv.setStatus(http.StatusServiceUnavailable)
+			clock.Advance(tt.advance)
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			resp, err := c.Do(context.Background(), req)
+			if tt.wantStale {
+				if err != nil || resp.StatusCode != http.StatusOK || !IsStale(resp) {
+					t.Fatalf("Do() = %v, %v, want a stale 200", resp, err)
+				}
+				drainBody(resp)
+				return
+			}
+			if err == nil {
+				defer drainBody(resp)
+				if IsStale(resp) {
+					t.Fatal("Do() served a stale entry")
+				}
+			}
+		})
+	}
+}
+
+func TestCacheRevalidationEndsWithClose(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "client options"},
+		{name: "request options", opts: []Option{WithMaxRetries(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testRevalidationEndsWithClose(t, tt.opts)
+		})
+	}
+}
+
+func testRevalidationEndsWithClose(t *testing.T, opts []Option) {
+	var mu sync.Mutex
+	requests := 0
+	refreshing := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=3600")
+		w.Header().Set("Etag", `"v1"`)
+		if n > 1 {
+			// Hold the background revalidation until the client gives up
+			refreshing <- struct{}{}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte("cached body"))
+	}))
+	defer srv.Close()
+
+	clock := newStepClock()
+	c := NewRetryableClient(WithClock(clock), WithMaxRetries(0), WithCache(NewCache(0)))
+	if _, _, err := c.GetBytes(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(2 * time.Minute)
+
+	// Served stale, revalidated in the background
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := c.Do(context.Background(), req, opts...)
+	if err != nil || resp.StatusCode != http.StatusOK || !IsStale(resp) {
+		t.Fatalf("stale request = %v, %v", resp, err)
+	}
+	drainBody(resp)
+	select {
+	case <-refreshing:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stale entry was not revalidated")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close() = %v, want it to wait for the revalidation and give up", err)
+	}
+
+	// A closed client starts no revalidation
+	if _, _, err := c.GetBytes(context.Background(), srv.URL); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("GetBytes() after Close error = %v, want ErrClientClosed", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 2 {
+		t.Errorf("server received %d requests, want 2", requests)
+	}
+}
+
+func TestCacheServesStaleOnOpen(t *testing.T) {
+	tests := []struct {
+		name       string
+		serveStale bool
+	}{
+		{name: "stale entry served", serveStale: true},
+		{name: "circuit error without ServeStaleOnOpen"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newCacheServer(t, http.Header{"Cache-Control": {"max-age=60"}})
+			clock := newStepClock()
+			cache := NewCache(0)
+			cache.ServeStaleOnOpen = tt.serveStale
+			breaker := NewCircuitBreaker(CircuitSettings{FailureThreshold: 1, Cooldown: time.Hour})
+			c := NewRetryableClient(WithClock(clock), WithMaxRetries(0), WithCache(cache), WithCircuitBreaker(breaker))
+
+			if _, _, err := c.GetBytes(context.Background(), srv.URL); err != nil {
+				t.Fatal(err)
+			}
+			srv.setStatus(http.StatusServiceUnavailable)
+			clock.Advance(2 * time.Hour)
+
+			// The expired entry has no stale window, so this failure opens the circuit
+			if status, _, err := c.GetBytes(context.Background(), srv.URL); err == nil && status == http.StatusOK {
+				t.Fatal("GetBytes() served the expired entry")
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			resp, err := c.Do(context.Background(), req)
+			if !tt.serveStale {
+				if !errors.Is(err, ErrCircuitOpen) {
+					t.Errorf("Do() error = %v, want ErrCircuitOpen", err)
+				}
+				return
+			}
+			if err != nil || resp.StatusCode != http.StatusOK || !IsStale(resp) {
+				t.Fatalf("Do() = %v, %v, want a stale 200", resp, err)
+			}
+			drainBody(resp)
+			if requests, _ := srv.counts(); requests != 2 {
+				t.Errorf("server received %d requests, want 2", requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Code is a canonical status code, the same as gRPC's, so retries can be
+// configured alike for HTTP and gRPC services. CodeOf maps HTTP outcomes to
+// codes.
+type Code int
+
+const (
+	// CodeOK means success.
+	CodeOK Code = iota
+	// CodeCanceled means the caller canceled the request.
+	CodeCanceled
+	// CodeUnknown is any error not covered by another code.
+	CodeUnknown
+	// CodeInvalidArgument means the request was malformed, a 400.
+	CodeInvalidArgument
+	// CodeDeadlineExceeded means the request timed out.
+	CodeDeadlineExceeded
+	// CodeNotFound means the resource does not exist, a 404.
+	CodeNotFound
+	// CodeAlreadyExists means the resource to create already exists.
+	CodeAlreadyExists
+	// CodePermissionDenied means the caller may not do this, a 403.
+	CodePermissionDenied
+	// CodeResourceExhausted means a quota or limit was hit, e.g. a 429.
+	CodeResourceExhausted
+	// CodeFailedPrecondition means the request cannot apply in the resource's
+	// current state, a 412.
+	CodeFailedPrecondition
+	// CodeAborted means the request conflicted with another, a 409.
+	CodeAborted
+	// CodeOutOfRange means a range past the resource's end, a 416.
+	CodeOutOfRange
+	// CodeUnimplemented means the server does not support the request, a 501.
+	CodeUnimplemented
+	// CodeInternal means the server failed, a 500.
+	CodeInternal
+	// CodeUnavailable means the service cannot be reached for now, e.g. a 503.
+	CodeUnavailable
+	// CodeDataLoss means the response was corrupted.
+	CodeDataLoss
+	// CodeUnauthenticated means the credentials are missing or invalid, a 401.
+	CodeUnauthenticated
+)
+
+var codeNames = [...]string{
+	"OK", "Canceled", "Unknown", "InvalidArgument", "DeadlineExceeded",
+	"NotFound", "AlreadyExists", "PermissionDenied", "ResourceExhausted",
+	"FailedPrecondition", "Aborted", "OutOfRange", "Unimplemented",
+	"Internal", "Unavailable", "DataLoss", "Unauthenticated",
+}
+
+func (c Code) String() string {
+	if c < 0 || int(c) >= len(codeNames) {
+		return fmt.Sprintf("Code(%d)", int(c))
+	}
+
+	return codeNames[c]
+}
+
+// statusCodes maps the statuses with a code of their own.
+var statusCodes = map[int]Code{
+	http.StatusBadRequest:                   CodeInvalidArgument,
+	http.StatusUnauthorized:                 CodeUnauthenticated,
+	http.StatusForbidden:                    CodePermissionDenied,
+	http.StatusNotFound:                     CodeNotFound,
+	http.StatusRequestTimeout:               CodeDeadlineExceeded,
+	http.StatusConflict:                     CodeAborted,
+	http.StatusPreconditionFailed:           CodeFailedPrecondition,
+	http.StatusRequestedRangeNotSatisfiable: CodeOutOfRange,
+	http.StatusTooManyRequests:              CodeResourceExhausted,
+	499:                                     CodeCanceled,
+	http.StatusNotImplemented:               CodeUnimplemented,
+	http.StatusBadGateway:                   CodeUnavailable,
+	http.StatusServiceUnavailable:           CodeUnavailable,
+	http.StatusGatewayTimeout:               CodeDeadlineExceeded,
+}
+
+// CodeForStatus returns the code of an HTTP status: CodeOK below 400, a
+// specific code for the usual error statuses, CodeInternal for other 5xx
+// and CodeUnknown otherwise.
+func CodeForStatus(status int) Code {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+
+	switch {
+	case status >= 100 && status < 400:
+		return CodeOK
+	case status >= 500 && status < 600:
+		return CodeInternal
+	default:
+		return CodeUnknown
+	}
+}
+
+// CodeOf returns the code of an attempt's outcome, as seen by a RetryPolicy:
+// the code of resp's status, or of err if not nil.
+func CodeOf(resp *http.Response, err error) Code {
+	if err != nil {
+		return ErrorCode(err)
+	}
+
+	return CodeForStatus(resp.StatusCode)
+}
+
+// ErrorCode returns the code of an error returned by the client, CodeOK for
+// nil. Network failures are CodeUnavailable, timeouts and exhausted deadlines
+// CodeDeadlineExceeded, and response statuses are mapped by CodeForStatus.
+func ErrorCode(err error) Code {
+	var (
+		status   *StatusError
+		checksum *ChecksumError
+	)
+
+	switch {
+	case err == nil:
+		return CodeOK
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, ErrMaxElapsedTimeExceeded), errors.Is(err, ErrDeadlineWouldExceed),
+		errors.Is(err, ErrExpiredInQueue):
+		return CodeDeadlineExceeded
+	case errors.As(err, &status):
+		return CodeForStatus(status.Code)
+	case errors.As(err, &checksum):
+		return CodeDataLoss
+	case errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrClientClosed), errors.Is(err, ErrQueueClosed):
+		return CodeUnavailable
+	case errors.Is(err, ErrRetryThrottled), errors.Is(err, ErrBodyTooLarge), errors.Is(err, ErrBulkheadFull),
+		errors.Is(err, ErrConcurrencyLimited), errors.Is(err, ErrQueueFull):
+		return CodeResourceExhausted
+	}
+
+	switch ClassifyError(err) {
+	case ErrorClassOther:
+		return CodeUnknown
+	case ErrorClassTimeout:
+		return CodeDeadlineExceeded
+	case ErrorClassTLSCertificate:
+		return CodeUnauthenticated
+	default:
+		return CodeUnavailable
+	}
+}
+
+// CanonicalCode returns the code of the last attempt, see ErrorCode.
+func (e *RetryError) CanonicalCode() Code {
+	return ErrorCode(e)
+}
+
+// CanonicalCode returns the code of the status, see CodeForStatus.
+func (e *StatusError) CanonicalCode() Code {
+	return CodeForStatus(e.Code)
+}
+
+// CodePolicy is a RetryPolicy retrying the outcomes whose code is listed in
+// Codes, as a gRPC retry policy's retryableStatusCodes. Map replaces CodeOf
+// if set.
+type CodePolicy struct {
+	Codes []Code
+	Map   func(resp *http.Response, err error) Code
+}
+
+func (p *CodePolicy) ShouldRetry(resp *http.Response, err error, attempt int) bool {
+	code := CodeOf(resp, err)
+	if p.Map != nil {
+		code = p.Map(resp, err)
+	}
+	for _, c := range p.Codes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RetryOnCodes retries the outcomes with the given canonical codes, replacing
+// the retry policy, e.g. RetryOnCodes(CodeUnavailable, CodeResourceExhausted).
+func RetryOnCodes(codes ...Code) Option {
+	return func(c *config) {
+		c.policy = &CodePolicy{Codes: append([]Code(nil), codes...)}
+	}
+}
@@ -0,0 +1,194 @@
+package http
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+)
+
+func TestCodeString(t *testing.T) {
+	tests := []struct {
+		code Code
+		want string
+	}{
+		{CodeOK, "OK"},
+		{CodeDeadlineExceeded, "DeadlineExceeded"},
+		{CodeUnavailable, "Unavailable"},
+		{CodeUnauthenticated, "Unauthenticated"},
+		{Code(-1), "Code(-1)"},
+		{Code(17), "Code(17)"},
+	}
+	for _, tt := range tests {
+		if got := tt.code.String(); got != tt.want {
+			t.Errorf("Code(%d).String() = %q, want %q", int(tt.code), got, tt.want)
+		}
+	}
+}
+
+func TestCodeForStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   Code
+	}{
+		{http.StatusOK, CodeOK},
+		{http.StatusSwitchingProtocols, CodeOK},
+		{http.StatusNotModified, CodeOK},
+		{http.StatusBadRequest, CodeInvalidArgument},
+		{http.StatusUnauthorized, CodeUnauthenticated},
+		{http.StatusForbidden, CodePermissionDenied},
+		{http.StatusNotFound, CodeNotFound},
+		{http.StatusRequestTimeout, CodeDeadlineExceeded},
+		{http.StatusConflict, CodeAborted},
+		{http.StatusPreconditionFailed, CodeFailedPrecondition},
+		{http.StatusRequestedRangeNotSatisfiable, CodeOutOfRange},
+		{http.StatusTooManyRequests, CodeResourceExhausted},
+		{499, CodeCanceled},
+		{http.StatusTeapot, CodeUnknown},
+		{http.StatusInternalServerError, CodeInternal},
+		{http.StatusNotImplemented, CodeUnimplemented},
+		{http.StatusBadGateway, CodeUnavailable},
+		{http.StatusServiceUnavailable, CodeUnavailable},
+		{http.StatusGatewayTimeout, CodeDeadlineExceeded},
+		{599, CodeInternal},
+		{0, CodeUnknown},
+		{600, CodeUnknown},
+	}
+	for _, tt := range tests {
+		if got := CodeForStatus(tt.status); got != tt.want {
+			t.Errorf("CodeForStatus(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{name: "nil", err: nil, want: CodeOK},
+		{name: "canceled", err: fmt.Errorf("send: %w", context.Canceled), want: CodeCanceled},
+		{name: "deadline", err: context.DeadlineExceeded, want: CodeDeadlineExceeded},
+		{name: "max elapsed time", err: ErrMaxElapsedTimeExceeded, want: CodeDeadlineExceeded},
+		{name: "deadline would exceed", err: ErrDeadlineWouldExceed, want: CodeDeadlineExceeded},
+		{name: "expired in queue", err: ErrExpiredInQueue, want: CodeDeadlineExceeded},
+		{name: "status", err: &StatusError{Code: http.StatusNotFound}, want: CodeNotFound},
+		{name: "checksum", err: &ChecksumError{Algorithm: "sha256"}, want: CodeDataLoss},
+		{name: "circuit open", err: ErrCircuitOpen, want: CodeUnavailable},
+		{name: "client closed", err: ErrClientClosed, want: CodeUnavailable},
+		{name: "queue closed", err: ErrQueueClosed, want: CodeUnavailable},
+		{name: "throttled", err: ErrRetryThrottled, want: CodeResourceExhausted},
+		{name: "body too large", err: ErrBodyTooLarge, want: CodeResourceExhausted},
+		{name: "bulkhead full", err: ErrBulkheadFull, want: CodeResourceExhausted},
+		{name: "concurrency limited", err: ErrConcurrencyLimited, want: CodeResourceExhausted},
+		{name: "queue full", err: ErrQueueFull, want: CodeResourceExhausted},
+		{name: "connection refused", err: refused, want: CodeUnavailable},
+		{name: "connection reset", err: syscall.ECONNRESET, want: CodeUnavailable},
+		{name: "EOF", err: io.ErrUnexpectedEOF, want: CodeUnavailable},
+		{name: "DNS", err: &net.DNSError{Err: "no such host", Name: "example.invalid"}, want: CodeUnavailable},
+		{name: "certificate", err: x509.UnknownAuthorityError{}, want: CodeUnauthenticated},
+		{name: "other", err: errors.New("boom"), want: CodeUnknown},
+		{
+			name: "retry error",
+			err:  &RetryError{Reason: ErrMaxRetriesExceeded, Attempts: []Attempt{{StatusCode: http.StatusServiceUnavailable, Err: &StatusError{Code: http.StatusServiceUnavailable}}}},
+			want: CodeUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorCode(tt.err); got != tt.want {
+				t.Errorf("ErrorCode(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *http.Response
+		err  error
+		want Code
+	}{
+		{name: "response", resp: &http.Response{StatusCode: http.StatusTooManyRequests}, want: CodeResourceExhausted},
+		{name: "error", err: ErrCircuitOpen, want: CodeUnavailable},
+		{name: "error wins", resp: &http.Response{StatusCode: http.StatusOK}, err: context.Canceled, want: CodeCanceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CodeOf(tt.resp, tt.err); got != tt.want {
+				t.Errorf("CodeOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalCode(t *testing.T) {
+	if got := (&StatusError{Code: http.StatusForbidden}).CanonicalCode(); got != CodePermissionDenied {
+		t.Errorf("StatusError.CanonicalCode() = %v, want %v", got, CodePermissionDenied)
+	}
+
+	// A RetryError has the code of its last attempt
+	srv := newScriptServer(t, 503)
+	_, err := NewRetryableClient(fastBackoff, WithMaxRetries(1)).Do(context.Background(), mustNewRequest(t, srv.URL))
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("Do() error = %v, want a RetryError", err)
+	}
+	if got := retryErr.CanonicalCode(); got != CodeUnavailable {
+		t.Errorf("RetryError.CanonicalCode() = %v, want %v", got, CodeUnavailable)
+	}
+}
+
+func TestRetryOnCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		opt        Option
+		wantSent   int
+		wantStatus int
+	}{
+		{name: "listed", statuses: []int{503, 200}, opt: RetryOnCodes(CodeUnavailable), wantSent: 2, wantStatus: 200},
+		{name: "same code", statuses: []int{502, 200}, opt: RetryOnCodes(CodeUnavailable), wantSent: 2, wantStatus: 200},
+		{name: "not listed", statuses: []int{429, 200}, opt: RetryOnCodes(CodeUnavailable), wantSent: 1, wantStatus: 429},
+		{name: "not retried by default", statuses: []int{500, 200}, opt: RetryOnCodes(CodeInternal), wantSent: 2, wantStatus: 200},
+		{name: "none", statuses: []int{503, 200}, opt: RetryOnCodes(), wantSent: 1, wantStatus: 503},
+		{
+			name:     "mapped",
+			statuses: []int{409, 200},
+			opt: WithRetryPolicy(&CodePolicy{
+				Codes: []Code{CodeUnavailable},
+				Map: func(resp *http.Response, err error) Code {
+					if err == nil && resp.StatusCode == http.StatusConflict {
+						return CodeUnavailable
+					}
+					return CodeOf(resp, err)
+				},
+			}),
+			wantSent:   2,
+			wantStatus: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			c := NewRetryableClient(fastBackoff, tt.opt)
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			drainBody(resp)
+			if resp.StatusCode != tt.wantStatus || srv.count() != tt.wantSent {
+				t.Errorf("got %d after %d attempts, want %d after %d", resp.StatusCode, srv.count(), tt.wantStatus, tt.wantSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"strings"
+)
+
+// CertificateError is the error of an attempt whose TLS handshake failed
+// because a certificate was rejected: the server's, or the client certificate
+// presented for mutual TLS when Client is set. No retry fixes it, so the
+// default policy does not retry it.
+type CertificateError struct {
+	// Client is set when the server rejected our certificate.
+	Client bool
+	// Expired is set when the rejected certificate has expired.
+	Expired bool
+	Err     error
+}
+
+func (e *CertificateError) Error() string {
+	if e.Client {
+		return "rhttp: client certificate rejected: " + e.Err.Error()
+	}
+
+	return "rhttp: server certificate rejected: " + e.Err.Error()
+}
+
+func (e *CertificateError) Unwrap() error {
+	return e.Err
+}
+
+// clientCertAlerts are the TLS alerts a server sends when it refuses the
+// client certificate, as worded by crypto/tls.
+var clientCertAlerts = []string{
+	"bad certificate",
+	"unsupported certificate",
+	"revoked certificate",
+	"expired certificate",
+	"unknown certificate",
+	"certificate required",
+}
+
+// certificateError returns err as a *CertificateError if it is a rejected
+// certificate, or nil.
+func certificateError(err error) *CertificateError {
+	var certErr *CertificateError
+	if errors.As(err, &certErr) {
+		return certErr
+	}
+
+	var (
+		unknownAuth x509.UnknownAuthorityError
+		invalidCert x509.CertificateInvalidError
+		hostnameErr x509.HostnameError
+	)
+	switch {
+	case errors.As(err, &invalidCert):
+		return &CertificateError{Expired: invalidCert.Reason == x509.Expired, Err: err}
+	case errors.As(err, &unknownAuth), errors.As(err, &hostnameErr):
+		return &CertificateError{Err: err}
+	}
+
+	msg := err.Error()
+	if i := strings.Index(msg, "remote error: tls: "); i >= 0 {
+		alert := msg[i+len("remote error: tls: "):]
+		for _, a := range clientCertAlerts {
+			if strings.HasPrefix(alert, a) {
+				return &CertificateError{Client: true, Expired: a == "expired certificate", Err: err}
+			}
+		}
+	}
+
+	return nil
+}
+
+// WithClientCertificate presents the certificate returned by get for mutual
+// TLS. get is called on every handshake, so a rotated certificate is picked
+// up by new connections without recreating the client.
+func WithClientCertificate(get func(*tls.CertificateRequestInfo) (*tls.Certificate, error)) Option {
+	return func(c *config) {
+		c.getClientCertificate = get
+	}
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCertificateError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		want        bool
+		wantClient  bool
+		wantExpired bool
+	}{
+		{name: "unknown authority", err: x509.UnknownAuthorityError{}, want: true},
+		{name: "wrong host", err: x509.HostnameError{Host: "example.com", Certificate: &x509.Certificate{}}, want: true},
+		{name: "expired", err: x509.CertificateInvalidError{Reason: x509.Expired}, want: true, wantExpired: true},
+		{name: "not valid", err: x509.CertificateInvalidError{Reason: x509.NotAuthorizedToSign}, want: true},
+		{name: "wrapped", err: fmt.Errorf("Get: %w", x509.UnknownAuthorityError{}), want: true},
+		{name: "client certificate rejected", err: errors.New("remote error: tls: bad certificate"), want: true, wantClient: true},
+		{name: "client certificate required", err: errors.New("remote error: tls: certificate required"), want: true, wantClient: true},
+		{
+			name:        "client certificate expired",
+			err:         errors.New("read tcp: remote error: tls: expired certificate"),
+			want:        true,
+			wantClient:  true,
+			wantExpired: true,
+		},
+		{name: "other alert", err: errors.New("remote error: tls: handshake failure")},
+		{name: "other error", err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := certificateError(tt.err)
+			if (got != nil) != tt.want {
+				t.Fatalf("certificateError() = %v, want a certificate error: %v", got, tt.want)
+			}
+			if got == nil {
+				return
+			}
+			if got.Client != tt.wantClient || got.Expired != tt.wantExpired {
+				t.Errorf("client = %v, expired = %v, want %v, %v", got.Client, got.Expired, tt.wantClient, tt.wantExpired)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Error("CertificateError does not unwrap to the TLS error")
+			}
+			if certificateError(got) != got {
+				t.Error("a CertificateError is not returned as it is")
+			}
+		})
+	}
+}
+
+func TestCertificateErrorNotRetried(t *testing.T) {
+	var conns int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	// The default transport does not trust the test server's certificate
+	c := NewRetryableClient(fastBackoff)
+
+	_, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+	var certErr *CertificateError
+	if !errors.As(err, &certErr) || certErr.Client {
+		t.Fatalf("Do() error = %v, want a server CertificateError", err)
+	}
+	if ClassifyError(err) != ErrorClassTLSCertificate {
+		t.Errorf("ClassifyError() = %v", ClassifyError(err))
+	}
+	if n := atomic.LoadInt64(&conns); n != 1 {
+		t.Errorf("%d connections, want the handshake tried once", n)
+	}
+}
+
+func TestWithClientCertificate(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.Organization[0]))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+	roots := srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	tests := []struct {
+		name string
+		cert *tls.Certificate
+		// wantErr is set when the server should refuse the handshake.
+		wantErr bool
+	}{
+		// The test server's certificate is as good a client certificate as any
+		{name: "presented", cert: &srv.TLS.Certificates[0]},
+		{name: "none", cert: &tls.Certificate{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int64
+			c := NewRetryableClient(fastBackoff, WithTLSConfig(roots), WithClientCertificate(func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				atomic.AddInt64(&calls, 1)
+				return tt.cert, nil
+			}))
+
+			_, body, err := c.GetBytes(context.Background(), srv.URL)
+			if calls == 0 {
+				t.Error("client certificate not asked for")
+			}
+			if !tt.wantErr {
+				if err != nil || string(body) != "Acme Co" {
+					t.Errorf("GetBytes() = %q, %v", body, err)
+				}
+				return
+			}
+			var certErr *CertificateError
+			if !errors.As(err, &certErr) || !certErr.Client {
+				t.Errorf("GetBytes() error = %v, want a client CertificateError", err)
+			}
+		})
+	}
+}
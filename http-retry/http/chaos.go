@@ -0,0 +1,187 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ChaosConfig sets how often a chaos transport injects each kind of fault.
+// Rates are probabilities between 0 and 1, rolled independently per request.
+type ChaosConfig struct {
+	// ErrorRate is the share of requests failing with a connection reset
+	// before being sent.
+	ErrorRate float64
+	// StatusRate is the share of requests answered with Status without being
+	// sent.
+	StatusRate float64
+	// Status is the injected status, 503 if zero.
+	Status int
+	// LatencyRate is the share of requests delayed by up to MaxLatency.
+	LatencyRate float64
+	MaxLatency  time.Duration
+	// TruncateRate is the share of responses whose body is cut short with
+	// io.ErrUnexpectedEOF.
+	TruncateRate float64
+	// Seed makes the faults reproducible. Zero seeds from the current time.
+	Seed int64
+}
+
+type chaosTransport struct {
+	transport http.RoundTripper
+	config    ChaosConfig
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewChaosTransport wraps base with a transport injecting errors, latency,
+// error statuses and truncated bodies as set by cfg, to check how a retry
+// and circuit breaker configuration copes with failures, e.g. in staging:
+//
+//	client := rhttp.NewRetryableClient(rhttp.WithHTTPClient(&http.Client{
+//		Transport: rhttp.NewChaosTransport(nil, rhttp.ChaosConfig{ErrorRate: 0.1}),
+//	}))
+//
+// A nil base uses http.DefaultTransport.
+func NewChaosTransport(base http.RoundTripper, cfg ChaosConfig) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if cfg.Status == 0 {
+		cfg.Status = http.StatusServiceUnavailable
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &chaosTransport{
+		transport: base,
+		config:    cfg,
+		rand:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+// roll returns true with probability rate.
+func (t *chaosTransport) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.rand.Float64() < rate
+}
+
+// intn returns a random int in [0, n).
+func (t *chaosTransport) intn(n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.rand.Int63n(n)
+}
+
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.roll(t.config.LatencyRate) {
+		delay := time.Duration(t.intn(int64(t.config.MaxLatency)))
+		if err := sleep(req.Context(), systemClock{}, delay); err != nil {
+			closeRequestBody(req)
+			return nil, err
+		}
+	}
+
+	if t.roll(t.config.ErrorRate) {
+		closeRequestBody(req)
+		return nil, &net.OpError{
+			Op:  "read",
+			Net: "tcp",
+			Err: os.NewSyscallError("read", syscall.ECONNRESET),
+		}
+	}
+
+	if t.roll(t.config.StatusRate) {
+		closeRequestBody(req)
+		return chaosResponse(req, t.config.Status), nil
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil || !t.roll(t.config.TruncateRate) {
+		return resp, err
+	}
+
+	limit := resp.ContentLength
+	if limit <= 0 {
+		limit = 4 << 10
+	}
+	resp.Body = &truncatedBody{ReadCloser: resp.Body, remaining: t.intn(limit)}
+
+	return resp, nil
+}
+
+// CloseIdleConnections forwards to the wrapped transport.
+func (t *chaosTransport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if ci, ok := t.transport.(closeIdler); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+// closeRequestBody closes the body of a request that is not sent, as
+// RoundTrip must.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func chaosResponse(req *http.Request, status int) *http.Response {
+	body := fmt.Sprintf("rhttp: chaos: injected %d", status)
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// truncatedBody fails with io.ErrUnexpectedEOF after remaining bytes.
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+
+	return n, err
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// closeTracker records whether a request body was closed.
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeTracker) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestChaosTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      ChaosConfig
+		wantSent bool
+		// check inspects the outcome of the round trip.
+		check func(t *testing.T, resp *http.Response, err error)
+	}{
+		{
+			name:     "no faults",
+			wantSent: true,
+			check: func(t *testing.T, resp *http.Response, err error) {
+				if err != nil || resp.StatusCode != 200 {
+					t.Errorf("RoundTrip() = %v, %v", resp, err)
+				}
+			},
+		},
+		{
+			name: "connection reset",
+			cfg:  ChaosConfig{ErrorRate: 1},
+			check: func(t *testing.T, resp *http.Response, err error) {
+				if !errors.Is(err, syscall.ECONNRESET) || ClassifyError(err) != ErrorClassConnReset {
+					t.Errorf("RoundTrip() error = %v, want a connection reset", err)
+				}
+			},
+		},
+		{
+			name: "default status",
+			cfg:  ChaosConfig{StatusRate: 1},
+			check: func(t *testing.T, resp *http.Response, err error) {
+				if err != nil || resp.StatusCode != 503 {
+					t.Errorf("RoundTrip() = %v, %v, want a 503", resp, err)
+				}
+			},
+		},
+		{
+			name: "status",
+			cfg:  ChaosConfig{StatusRate: 1, Status: 429},
+			check: func(t *testing.T, resp *http.Response, err error) {
+				if err != nil || resp.StatusCode != 429 || resp.Status != "429 Too Many Requests" {
+					t.Errorf("RoundTrip() = %v, %v, want a 429", resp, err)
+				}
+			},
+		},
+		{
+			name:     "truncated body",
+			cfg:      ChaosConfig{TruncateRate: 1, Seed: 1},
+			wantSent: true,
+			check: func(t *testing.T, resp *http.Response, err error) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := ioutil.ReadAll(resp.Body)
+				if err != io.ErrUnexpectedEOF || len(b) >= 10 {
+					t.Errorf("read %d bytes, %v, want fewer than 10 and io.ErrUnexpectedEOF", len(b), err)
+				}
+			},
+		},
+		{
+			name:     "latency",
+			cfg:      ChaosConfig{LatencyRate: 1, MaxLatency: time.Millisecond},
+			wantSent: true,
+			check: func(t *testing.T, resp *http.Response, err error) {
+				if err != nil || resp.StatusCode != 200 {
+					t.Errorf("RoundTrip() = %v, %v", resp, err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := false
+			base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				sent = true
+				return &http.Response{
+					StatusCode:    200,
+					Body:          ioutil.NopCloser(strings.NewReader("0123456789")),
+					ContentLength: 10,
+				}, nil
+			})
+			body := &closeTracker{Reader: bytes.NewReader(nil)}
+			req, _ := http.NewRequest(http.MethodPost, "http://example.com", body)
+
+			resp, err := NewChaosTransport(base, tt.cfg).RoundTrip(req)
+			tt.check(t, resp, err)
+			if sent != tt.wantSent {
+				t.Errorf("request sent = %v, want %v", sent, tt.wantSent)
+			}
+			if !tt.wantSent && !body.closed {
+				t.Error("body of the request not sent left open")
+			}
+		})
+	}
+}
+
+func TestChaosTransportSeed(t *testing.T) {
+	faults := func() []int {
+		tr := NewChaosTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}), ChaosConfig{StatusRate: 0.5, Seed: 42})
+
+		var statuses []int
+		for i := 0; i < 20; i++ {
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			resp, _ := tr.RoundTrip(req)
+			statuses = append(statuses, resp.StatusCode)
+		}
+		return statuses
+	}
+
+	if a, b := faults(), faults(); !equalInts(a, b) {
+		t.Errorf("faults with the same seed differ: %v and %v", a, b)
+	}
+}
+
+func TestChaosTransportLatencyCancelled(t *testing.T) {
+	tr := NewChaosTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Error("request sent after its context was done")
+		return nil, nil
+	}), ChaosConfig{LatencyRate: 1, MaxLatency: time.Hour, Seed: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+
+	if _, err := tr.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RoundTrip() error = %v, want context.DeadlineExceeded", err)
+	}
+}
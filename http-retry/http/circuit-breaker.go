@@ -0,0 +1,281 @@
+package http
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of the circuit for one host.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects requests with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen lets a single probe request through to test the host.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitSettings controls when a circuit trips and recovers.
+type CircuitSettings struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// circuit, that of DefaultCircuitSettings if not positive.
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before a probe is allowed.
+	Cooldown time.Duration
+}
+
+// DefaultCircuitSettings opens after 5 consecutive failures for 30 seconds.
+var DefaultCircuitSettings = CircuitSettings{
+	FailureThreshold: 5,
+	Cooldown:         30 * time.Second,
+}
+
+type circuit struct {
+	settings CircuitSettings
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// synced is when the shared state was last checked, see
+	// NewSharedCircuitBreaker.
+	synced time.Time
+}
+
+// CircuitBreaker tracks a circuit per host. A failure is any attempt the retry
+// policy would retry; anything else counts as a success.
+type CircuitBreaker struct {
+	settings CircuitSettings
+	shared   *sharedCircuits
+
+	mu       sync.Mutex
+	hosts    map[string]CircuitSettings
+	circuits map[string]*circuit
+}
+
+// NewCircuitBreaker returns a breaker applying settings to every host.
+func NewCircuitBreaker(settings CircuitSettings) *CircuitBreaker {
+	return &CircuitBreaker{
+		settings: settings.withDefaults(),
+		hosts:    make(map[string]CircuitSettings),
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// NewSharedCircuitBreaker is like NewCircuitBreaker with the circuits shared
+// through store by every breaker using the same prefix, typically one per
+// replica of a service. The failures of every replica within Cooldown count
+// towards FailureThreshold, and a circuit opened by one replica opens on the
+// others within a second.
+func NewSharedCircuitBreaker(settings CircuitSettings, store StateStore, prefix string) *CircuitBreaker {
+	b := NewCircuitBreaker(settings)
+	b.shared = &sharedCircuits{store: store, prefix: prefix}
+
+	return b
+}
+
+func (s CircuitSettings) withDefaults() CircuitSettings {
+	if s.FailureThreshold <= 0 {
+		s.FailureThreshold = DefaultCircuitSettings.FailureThreshold
+	}
+
+	return s
+}
+
+// SetHostSettings overrides the settings used for host.
+func (b *CircuitBreaker) SetHostSettings(host string, settings CircuitSettings) {
+	settings = settings.withDefaults()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.hosts[host] = settings
+	if c, ok := b.circuits[host]; ok {
+		c.settings = settings
+	}
+}
+
+func (b *CircuitBreaker) circuit(host string) *circuit {
+	c, ok := b.circuits[host]
+	if !ok {
+		settings, ok := b.hosts[host]
+		if !ok {
+			settings = b.settings
+		}
+		c = &circuit{settings: settings}
+		b.circuits[host] = c
+	}
+
+	return c
+}
+
+// Allow reports whether a request to host may be sent, returning an error
+// wrapping ErrCircuitOpen if not.
+func (b *CircuitBreaker) Allow(host string) error {
+	return b.allow(host, time.Now())
+}
+
+// allow is Allow at time now, as told by the client's clock.
+func (b *CircuitBreaker) allow(host string, now time.Time) error {
+	if b.shared != nil {
+		b.sync(host, now)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(host)
+	if c.state == CircuitClosed {
+		return nil
+	}
+
+	if now.Sub(c.openedAt) < c.settings.Cooldown {
+		return fmt.Errorf("%w for %s", ErrCircuitOpen, host)
+	}
+
+	// Let one probe through; restart the cooldown in case it never reports back
+	c.state = CircuitHalfOpen
+	c.openedAt = now
+
+	return nil
+}
+
+// Record reports the outcome of a request to host. Failures reported while
+// the circuit is open, by attempts sent before it opened, are ignored so they
+// do not extend the cooldown.
+func (b *CircuitBreaker) Record(host string, success bool) {
+	b.record(host, success, time.Now())
+}
+
+// record is Record at time now, as told by the client's clock.
+func (b *CircuitBreaker) record(host string, success bool, now time.Time) {
+	if b.shared != nil {
+		b.recordShared(host, success, now)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(host)
+	if success {
+		c.state = CircuitClosed
+		c.failures = 0
+		return
+	}
+
+	if c.state == CircuitOpen {
+		return
+	}
+	c.failures++
+	if c.state == CircuitHalfOpen || c.failures >= c.settings.FailureThreshold {
+		c.state = CircuitOpen
+		c.openedAt = now
+	}
+}
+
+// sync opens the closed circuit for host if another replica opened it,
+// checking the store at most once a second.
+func (b *CircuitBreaker) sync(host string, now time.Time) {
+	b.mu.Lock()
+	c := b.circuit(host)
+	due := c.state == CircuitClosed && now.Sub(c.synced) >= sharedSyncInterval
+	if due {
+		c.synced = now
+	}
+	b.mu.Unlock()
+	if !due {
+		return
+	}
+
+	openedAt, ok := b.shared.opened(host)
+	if !ok {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c.state == CircuitClosed {
+		c.state = CircuitOpen
+		c.openedAt = openedAt
+	}
+}
+
+// recordShared is Record for a shared breaker: failures are counted in the
+// store, and opening or closing a circuit is published there. The store is
+// never called with b.mu held.
+func (b *CircuitBreaker) recordShared(host string, success bool, now time.Time) {
+	b.mu.Lock()
+	c := b.circuit(host)
+	settings := c.settings
+	if success {
+		reset := c.state != CircuitClosed || c.failures > 0
+		c.state = CircuitClosed
+		c.failures = 0
+		b.mu.Unlock()
+		if reset {
+			b.shared.reset(host)
+		}
+		return
+	}
+	open := c.state == CircuitOpen
+	b.mu.Unlock()
+	if open {
+		return
+	}
+
+	failures := b.shared.fail(host, settings.Cooldown)
+
+	b.mu.Lock()
+	c.failures++
+	if c.failures > failures {
+		failures = c.failures
+	}
+	opening := c.state == CircuitHalfOpen || (c.state == CircuitClosed && failures >= settings.FailureThreshold)
+	if opening {
+		c.state = CircuitOpen
+		c.openedAt = now
+	}
+	openedAt := c.openedAt
+	b.mu.Unlock()
+
+	if opening {
+		b.shared.open(host, openedAt, settings.Cooldown)
+	}
+}
+
+// State returns the current state of the circuit for host.
+func (b *CircuitBreaker) State(host string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.circuit(host).state
+}
+
+// States returns the state of every circuit the breaker knows of, by host.
+func (b *CircuitBreaker) States() map[string]CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	states := make(map[string]CircuitState, len(b.circuits))
+	for host, c := range b.circuits {
+		states[host] = c.state
+	}
+
+	return states
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		want      int
+	}{
+		{name: "explicit", threshold: 3, want: 3},
+		{name: "one", threshold: 1, want: 1},
+		{name: "zero defaults", threshold: 0, want: DefaultCircuitSettings.FailureThreshold},
+		{name: "negative defaults", threshold: -2, want: DefaultCircuitSettings.FailureThreshold},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker(CircuitSettings{FailureThreshold: tt.threshold, Cooldown: time.Hour})
+			for i := 1; i < tt.want; i++ {
+				b.Record("h", false)
+				if b.State("h") != CircuitClosed {
+					t.Fatalf("circuit opened after %d failures, want %d", i, tt.want)
+				}
+			}
+			b.Record("h", false)
+			if b.State("h") != CircuitOpen {
+				t.Fatalf("circuit %v after %d failures, want open", b.State("h"), tt.want)
+			}
+			if err := b.Allow("h"); !errors.Is(err, ErrCircuitOpen) {
+				t.Errorf("Allow() = %v, want ErrCircuitOpen", err)
+			}
+			if err := b.Allow("other"); err != nil {
+				t.Errorf("Allow() for another host = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	b := NewCircuitBreaker(CircuitSettings{FailureThreshold: 2, Cooldown: time.Hour})
+	b.Record("h", false)
+	b.Record("h", true)
+	b.Record("h", false)
+
+	if b.State("h") != CircuitClosed {
+		t.Errorf("state = %v, want closed: failures were not consecutive", b.State("h"))
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe bool
+		want  CircuitState
+	}{
+		{name: "probe succeeds", probe: true, want: CircuitClosed},
+		{name: "probe fails", probe: false, want: CircuitOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker(CircuitSettings{FailureThreshold: 1, Cooldown: 20 * time.Millisecond})
+			b.Record("h", false)
+			time.Sleep(30 * time.Millisecond)
+
+			if err := b.Allow("h"); err != nil {
+				t.Fatalf("Allow() after the cooldown = %v, want a probe", err)
+			}
+			if b.State("h") != CircuitHalfOpen {
+				t.Fatalf("state = %v, want half-open", b.State("h"))
+			}
+			if err := b.Allow("h"); !errors.Is(err, ErrCircuitOpen) {
+				t.Errorf("second Allow() while probing = %v, want ErrCircuitOpen", err)
+			}
+			b.Record("h", tt.probe)
+			if b.State("h") != tt.want {
+				t.Errorf("state after the probe = %v, want %v", b.State("h"), tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerIgnoresLateFailures(t *testing.T) {
+	b := NewCircuitBreaker(CircuitSettings{FailureThreshold: 1, Cooldown: 40 * time.Millisecond})
+	b.Record("h", false)
+
+	// Attempts sent before the circuit opened keep failing during the cooldown
+	for i := 0; i < 3; i++ {
+		time.Sleep(15 * time.Millisecond)
+		b.Record("h", false)
+	}
+
+	if err := b.Allow("h"); err != nil {
+		t.Errorf("Allow() after the cooldown = %v, want a probe: late failures extended it", err)
+	}
+}
+
+func TestCircuitBreakerRejectsRequests(t *testing.T) {
+	srv := newScriptServer(t, 503)
+	b := NewCircuitBreaker(CircuitSettings{FailureThreshold: 2, Cooldown: time.Hour})
+	c := NewRetryableClient(WithCircuitBreaker(b), WithMaxRetries(5), fastBackoff)
+
+	_, _, err := c.GetBytes(context.Background(), srv.URL)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("GetBytes() error = %v, want ErrCircuitOpen", err)
+	}
+	if srv.count() != 2 {
+		t.Errorf("server received %d requests, want 2 before the circuit opened", srv.count())
+	}
+}
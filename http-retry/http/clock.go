@@ -0,0 +1,83 @@
+package http
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and waits, so tests can drive the retry loop with a
+// fake clock instead of sleeping, see the rhttptest package.
+type Clock interface {
+	Now() time.Time
+	// After returns a channel receiving the current time once d has passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// TimerClock is a Clock whose waits can be released early. The client uses
+// Timer instead of After when a clock implements it, so a cancelled request
+// leaves no pending wait behind.
+type TimerClock interface {
+	Clock
+	// Timer returns a channel receiving the current time once d has passed,
+	// and a function stopping the wait if it has not fired yet.
+	Timer(d time.Duration) (c <-chan time.Time, stop func() bool)
+}
+
+// systemClock is the Clock backed by the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (systemClock) Timer(d time.Duration) (<-chan time.Time, func() bool) {
+	timer := time.NewTimer(d)
+	return timer.C, timer.Stop
+}
+
+type clockKey struct{}
+
+// withClock returns ctx carrying clock, for the limiters measuring time
+// through the client's clock. The system clock is left out.
+func withClock(ctx context.Context, clock Clock) context.Context {
+	if _, ok := clock.(systemClock); ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, clockKey{}, clock)
+}
+
+// clockFromContext returns the clock set by withClock, the system clock by
+// default.
+func clockFromContext(ctx context.Context) Clock {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return clock
+	}
+
+	return systemClock{}
+}
+
+// newTimer returns a channel receiving the time once d has passed on clock,
+// and a function releasing the timer early when it is not needed anymore.
+func newTimer(clock Clock, d time.Duration) (<-chan time.Time, func()) {
+	if tc, ok := clock.(TimerClock); ok {
+		// A timer can be stopped instead of lingering until it fires
+		c, stop := tc.Timer(d)
+		return c, func() { stop() }
+	}
+
+	return clock.After(d), func() {}
+}
+
+// sleep waits for d on clock, returning early with the context error if ctx
+// is done.
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	wake, stop := newTimer(clock, d)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-wake:
+		return nil
+	}
+}
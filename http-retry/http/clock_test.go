@@ -0,0 +1,182 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClockDrivesCircuitCooldown(t *testing.T) {
+	srv := newScriptServer(t, 503, 200)
+	clock := newStepClock()
+	c := NewRetryableClient(WithMaxRetries(0), WithClock(clock),
+		WithCircuitBreaker(NewCircuitBreaker(CircuitSettings{FailureThreshold: 1, Cooldown: time.Hour})))
+
+	steps := []struct {
+		advance time.Duration
+		wantErr error
+	}{
+		{wantErr: nil},
+		{advance: 59 * time.Minute, wantErr: ErrCircuitOpen},
+		{advance: time.Minute, wantErr: nil},
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		_, _, err := c.GetBytes(context.Background(), srv.URL)
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("request %d error = %v, want %v", i+1, err, step.wantErr)
+		}
+	}
+	if srv.count() != 2 {
+		t.Errorf("server received %d requests, want 2", srv.count())
+	}
+}
+
+func TestClockDrivesCacheFreshness(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+	}))
+	defer srv.Close()
+
+	clock := newStepClock()
+	cache := NewCache(0)
+	c := NewRetryableClient(WithClock(clock), WithCache(cache))
+
+	tests := []struct {
+		advance    time.Duration
+		wantMisses int64
+	}{
+		{wantMisses: 1},
+		{advance: 59 * time.Second, wantMisses: 1},
+		{advance: 2 * time.Second, wantMisses: 2},
+	}
+	for i, tt := range tests {
+		clock.Advance(tt.advance)
+		if _, _, err := c.GetBytes(context.Background(), srv.URL); err != nil {
+			t.Fatalf("request %d error = %v", i+1, err)
+		}
+		if got := cache.Stats().Misses; got != tt.wantMisses {
+			t.Errorf("after request %d misses = %d, want %d", i+1, got, tt.wantMisses)
+		}
+	}
+}
+
+func TestClockDrivesBodyReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	// Every wait of a step clock is over at once, so the hour passes now
+	c := NewRetryableClient(WithClock(newStepClock()), WithBodyReadTimeout(time.Hour))
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := c.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ioutil.ReadAll(resp.Body)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		var timeout *TimeoutError
+		if !errors.As(err, &timeout) || timeout.Phase != TimeoutBodyRead {
+			t.Errorf("reading the body error = %v, want a body read timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the body read timeout did not follow the client's clock")
+	}
+}
+
+func TestDeadlineIgnoresClientClock(t *testing.T) {
+	// A clock far behind the system clock must not make a distant deadline
+	// look close, nor one far ahead a close deadline look distant
+	tests := []struct {
+		name    string
+		clock   time.Time
+		timeout time.Duration
+		delay   time.Duration
+		want    bool
+	}{
+		{name: "clock behind, time left", clock: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), timeout: time.Hour, delay: time.Second},
+		{name: "clock ahead, time left", clock: time.Now().Add(24 * time.Hour), timeout: time.Hour, delay: time.Second},
+		{name: "clock behind, no time left", clock: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), timeout: time.Second, delay: time.Minute, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newStepClock()
+			clock.now = tt.clock
+			cfg := newConfig(WithClock(clock))
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			if got := cfg.wouldExceedDeadline(ctx, "example.com", tt.delay); got != tt.want {
+				t.Errorf("wouldExceedDeadline() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClockDrivesSignatures(t *testing.T) {
+	tests := []struct {
+		name   string
+		signer Signer
+		header string
+		want   string
+	}{
+		{name: "webhook", signer: WebhookSigner{Secret: []byte("secret")}, header: DefaultWebhookSignatureHeader, want: "t=" + strconv.FormatInt(newStepClock().Now().Unix(), 10) + ","},
+		{name: "SigV4", signer: SigV4Signer{AccessKeyID: "id", SecretAccessKey: "key", Region: "eu-west-1", Service: "s3"}, header: "X-Amz-Date", want: "20240101T000000Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t)
+			c := NewRetryableClient(WithClock(newStepClock()), WithSigner(tt.signer))
+
+			resp, err := c.PostContext(context.Background(), srv.URL, "application/json", strings.NewReader(`{}`))
+			if err != nil {
+				t.Fatalf("PostContext() error = %v", err)
+			}
+			resp.Body.Close()
+			req, _ := srv.request(0)
+			if got := req.Header.Get(tt.header); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("%s = %q, want it to start with %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBulkheadGettersLeaveHostsAlone(t *testing.T) {
+	b := NewBulkhead(BulkheadSettings{MaxInFlight: 1})
+	if b.InFlight("example.com") != 0 || b.Queued("example.com") != 0 {
+		t.Error("an unknown host has attempts in flight or queued")
+	}
+	if len(b.comps) != 0 {
+		t.Fatalf("the getters created %d compartments", len(b.comps))
+	}
+
+	release, err := b.acquire(context.Background(), newStepClock(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.InFlight("example.com"); got != 1 {
+		t.Errorf("InFlight() = %d, want 1", got)
+	}
+	release()
+}
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrConcurrencyLimited is returned without sending the request when its host
+// already has as many attempts in flight as its adaptive limit allows, see
+// WithAdaptiveConcurrency. It is not retried.
+var ErrConcurrencyLimited = errors.New("rhttp: concurrency limit reached")
+
+// AdaptiveLimitSettings tunes an AdaptiveLimiter. Zero fields take the
+// defaults of DefaultAdaptiveLimitSettings.
+type AdaptiveLimitSettings struct {
+	// Initial, Min and Max bound the number of attempts in flight per host.
+	Initial, Min, Max int
+	// Decrease multiplies the limit after an overloaded attempt.
+	Decrease float64
+	// LatencyThreshold counts attempts slower than it as overloaded, like
+	// failed ones. Zero only counts failures.
+	LatencyThreshold time.Duration
+}
+
+// DefaultAdaptiveLimitSettings starts at 20 attempts in flight per host,
+// between 1 and 200, and cuts the limit by 10% on overload.
+var DefaultAdaptiveLimitSettings = AdaptiveLimitSettings{
+	Initial:  20,
+	Min:      1,
+	Max:      200,
+	Decrease: 0.9,
+}
+
+// AdaptiveLimiter limits the attempts in flight to each host with an additive
+// increase, multiplicative decrease algorithm: every failed or overly slow
+// attempt cuts the host's limit by a factor, and every successful attempt
+// sent while the limit was at least half used raises it by one. When an
+// upstream degrades the client thus sheds load itself, with
+// ErrConcurrencyLimited, instead of piling up requests and retries on it.
+type AdaptiveLimiter struct {
+	settings AdaptiveLimitSettings
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimit
+}
+
+type hostLimit struct {
+	limit    float64
+	inflight int
+}
+
+// NewAdaptiveLimiter returns a limiter applying settings to every host. A
+// limiter may be shared between clients.
+func NewAdaptiveLimiter(settings AdaptiveLimitSettings) *AdaptiveLimiter {
+	d := DefaultAdaptiveLimitSettings
+	if settings.Min <= 0 {
+		settings.Min = d.Min
+	}
+	if settings.Max <= 0 {
+		settings.Max = d.Max
+	}
+	if settings.Initial <= 0 {
+		settings.Initial = d.Initial
+	}
+	if settings.Initial < settings.Min {
+		settings.Initial = settings.Min
+	}
+	if settings.Initial > settings.Max {
+		settings.Initial = settings.Max
+	}
+	if settings.Decrease <= 0 || settings.Decrease >= 1 {
+		settings.Decrease = d.Decrease
+	}
+
+	return &AdaptiveLimiter{settings: settings, hosts: make(map[string]*hostLimit)}
+}
+
+// WithAdaptiveConcurrency limits the attempts in flight per host with l.
+func WithAdaptiveConcurrency(l *AdaptiveLimiter) Option {
+	return func(c *config) {
+		c.concurrency = l
+	}
+}
+
+// Limit returns the current limit of host.
+func (l *AdaptiveLimiter) Limit(host string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.host(host).limit)
+}
+
+// InFlight returns the attempts to host currently in flight.
+func (l *AdaptiveLimiter) InFlight(host string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.host(host).inflight
+}
+
+// host returns the limit of host. l.mu must be held.
+func (l *AdaptiveLimiter) host(host string) *hostLimit {
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostLimit{limit: float64(l.settings.Initial)}
+		l.hosts[host] = h
+	}
+
+	return h
+}
+
+// acquire reserves a slot for an attempt to host. done releases it with the
+// outcome of the attempt; ignore is set for attempts that tell nothing about
+// the host, e.g. cancelled ones.
+func (l *AdaptiveLimiter) acquire(host string) (done func(success, ignore bool, d time.Duration), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h := l.host(host)
+	if h.inflight >= int(h.limit) {
+		return nil, fmt.Errorf("%w for %s (%d in flight)", ErrConcurrencyLimited, host, h.inflight)
+	}
+	h.inflight++
+	inflight := h.inflight
+
+	return func(success, ignore bool, d time.Duration) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		h.inflight--
+		if ignore {
+			return
+		}
+
+		s := l.settings
+		switch {
+		case !success || (s.LatencyThreshold > 0 && d > s.LatencyThreshold):
+			h.limit *= s.Decrease
+			if h.limit < float64(s.Min) {
+				h.limit = float64(s.Min)
+			}
+		case 2*inflight >= int(h.limit):
+			h.limit++
+			if h.limit > float64(s.Max) {
+				h.limit = float64(s.Max)
+			}
+		}
+	}, nil
+}
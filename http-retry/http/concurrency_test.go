@@ -0,0 +1,149 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewAdaptiveLimiter(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings AdaptiveLimitSettings
+		want     AdaptiveLimitSettings
+	}{
+		{name: "defaults", want: DefaultAdaptiveLimitSettings},
+		{
+			name:     "set",
+			settings: AdaptiveLimitSettings{Initial: 5, Min: 2, Max: 10, Decrease: 0.5, LatencyThreshold: time.Second},
+			want:     AdaptiveLimitSettings{Initial: 5, Min: 2, Max: 10, Decrease: 0.5, LatencyThreshold: time.Second},
+		},
+		{name: "initial below min", settings: AdaptiveLimitSettings{Initial: 1, Min: 4}, want: AdaptiveLimitSettings{Initial: 4, Min: 4, Max: 200, Decrease: 0.9}},
+		{name: "initial above max", settings: AdaptiveLimitSettings{Initial: 50, Max: 10}, want: AdaptiveLimitSettings{Initial: 10, Min: 1, Max: 10, Decrease: 0.9}},
+		{name: "no decrease", settings: AdaptiveLimitSettings{Decrease: 1}, want: DefaultAdaptiveLimitSettings},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewAdaptiveLimiter(tt.settings).settings; got != tt.want {
+				t.Errorf("settings = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	type outcome struct {
+		success, ignore bool
+		d               time.Duration
+	}
+	ok := outcome{success: true}
+	tests := []struct {
+		name     string
+		settings AdaptiveLimitSettings
+		// concurrent attempts are in flight together, then finish with their
+		// outcomes, in rounds.
+		rounds    [][]outcome
+		wantLimit int
+	}{
+		{name: "unused", settings: AdaptiveLimitSettings{Initial: 4}, wantLimit: 4},
+		{name: "raised while half used", settings: AdaptiveLimitSettings{Initial: 4}, rounds: [][]outcome{{ok, ok}, {ok, ok}}, wantLimit: 5},
+		{name: "kept when idle", settings: AdaptiveLimitSettings{Initial: 4}, rounds: [][]outcome{{ok}, {ok}}, wantLimit: 4},
+		{name: "raised up to max", settings: AdaptiveLimitSettings{Initial: 4, Max: 5}, rounds: [][]outcome{{ok, ok, ok, ok}}, wantLimit: 5},
+		{name: "cut on failure", settings: AdaptiveLimitSettings{Initial: 10, Decrease: 0.5}, rounds: [][]outcome{{{}}}, wantLimit: 5},
+		{name: "cut down to min", settings: AdaptiveLimitSettings{Initial: 10, Min: 3, Decrease: 0.5}, rounds: [][]outcome{{{}, {}, {}}}, wantLimit: 3},
+		{
+			name:      "cut when slow",
+			settings:  AdaptiveLimitSettings{Initial: 10, Decrease: 0.5, LatencyThreshold: time.Second},
+			rounds:    [][]outcome{{{success: true, d: 2 * time.Second}}},
+			wantLimit: 5,
+		},
+		{
+			name:      "fast enough",
+			settings:  AdaptiveLimitSettings{Initial: 2, LatencyThreshold: time.Second},
+			rounds:    [][]outcome{{{success: true, d: time.Second}}},
+			wantLimit: 3,
+		},
+		{name: "ignored", settings: AdaptiveLimitSettings{Initial: 10, Decrease: 0.5}, rounds: [][]outcome{{{ignore: true}}}, wantLimit: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewAdaptiveLimiter(tt.settings)
+			for _, round := range tt.rounds {
+				var dones []func(success, ignore bool, d time.Duration)
+				for range round {
+					done, err := l.acquire("example.com")
+					if err != nil {
+						t.Fatal(err)
+					}
+					dones = append(dones, done)
+				}
+				if l.InFlight("example.com") != len(round) {
+					t.Errorf("%d in flight, want %d", l.InFlight("example.com"), len(round))
+				}
+				for i, o := range round {
+					dones[i](o.success, o.ignore, o.d)
+				}
+			}
+
+			if got := l.Limit("example.com"); got != tt.wantLimit {
+				t.Errorf("Limit() = %d, want %d", got, tt.wantLimit)
+			}
+			if l.InFlight("example.com") != 0 {
+				t.Errorf("%d still in flight", l.InFlight("example.com"))
+			}
+		})
+	}
+}
+
+func TestAdaptiveLimiterLimited(t *testing.T) {
+	l := NewAdaptiveLimiter(AdaptiveLimitSettings{Initial: 2})
+	for i := 0; i < 2; i++ {
+		if _, err := l.acquire("a.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := l.acquire("a.example.com"); !errors.Is(err, ErrConcurrencyLimited) {
+		t.Errorf("acquire() error = %v, want ErrConcurrencyLimited", err)
+	}
+	if _, err := l.acquire("b.example.com"); err != nil {
+		t.Errorf("other host limited: %v", err)
+	}
+}
+
+func TestWithAdaptiveConcurrency(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+	l := NewAdaptiveLimiter(AdaptiveLimitSettings{Initial: 1})
+	c := NewRetryableClient(fastBackoff, WithAdaptiveConcurrency(l))
+
+	done := make(chan error)
+	go func() {
+		resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+		if err == nil {
+			drainBody(resp)
+		}
+		done <- err
+	}()
+	<-received
+
+	// The second request is shed at once, not retried
+	if _, err := c.Do(context.Background(), mustNewRequest(t, srv.URL)); !errors.Is(err, ErrConcurrencyLimited) {
+		t.Errorf("Do() error = %v, want ErrConcurrencyLimited", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if host := mustParseURL(t, srv.URL).Host; l.InFlight(host) != 0 || l.Limit(host) != 2 {
+		t.Errorf("%d in flight, limit %d, want 0, 2", l.InFlight(host), l.Limit(host))
+	}
+}
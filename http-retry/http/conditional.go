@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// Conditional fetches resources with conditional requests: it remembers the
+// ETag and Last-Modified of the last response for each URL and sends them
+// back, so a resource that did not change costs a 304 without a body. It
+// suits clients polling a configuration or any resource that rarely
+// changes. Unlike Cache, it ignores freshness and always asks the server.
+type Conditional struct {
+	client *RetryableClient
+
+	mu      sync.Mutex
+	entries map[string]*conditionalEntry
+}
+
+type conditionalEntry struct {
+	etag, lastModified string
+	body               []byte
+}
+
+// NewConditional returns a helper sending its requests with c, so failed
+// revalidations are retried like any other request.
+func NewConditional(c *RetryableClient) *Conditional {
+	return &Conditional{client: c, entries: make(map[string]*conditionalEntry)}
+}
+
+// Get fetches url, conditionally if it was fetched before. It returns the
+// body of the response, or the body kept from last time on a 304, and whether
+// it changed since the last call. Non-2xx responses other than a 304 are
+// returned as *StatusError and leave the kept body alone.
+func (c *Conditional) Get(ctx context.Context, url string) (body []byte, modified bool, err error) {
+	req, err := NewRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.mu.Lock()
+	entry := c.entries[url]
+	c.mu.Unlock()
+	if entry != nil {
+		if entry.etag != "" {
+			req.Header.Set("If-None-Match", entry.etag)
+		}
+		if entry.lastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.lastModified)
+		}
+	}
+
+	resp, err := c.client.Do(ctx, req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer drainBody(resp)
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		return entry.body, false, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, false, c.client.current().statusError(resp)
+	}
+
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	c.mu.Lock()
+	if etag != "" || lastModified != "" {
+		c.entries[url] = &conditionalEntry{etag: etag, lastModified: lastModified, body: body}
+	} else {
+		delete(c.entries, url)
+	}
+	c.mu.Unlock()
+
+	return body, true, nil
+}
+
+// Forget drops what is kept for url, so the next Get fetches it in full.
+func (c *Conditional) Forget(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, url)
+}
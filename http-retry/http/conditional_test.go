@@ -0,0 +1,178 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// resource is what a conditionalServer serves.
+type resource struct {
+	body, etag, lastModified string
+	// status, if set, is sent instead of the resource.
+	status int
+}
+
+// conditionalServer serves a resource that may change, answering
+// conditional requests with a 304 when it did not.
+type conditionalServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	current  resource
+	requests []*http.Request
+}
+
+func newConditionalServer(t *testing.T) *conditionalServer {
+	s := &conditionalServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		res := s.current
+		s.requests = append(s.requests, r)
+		s.mu.Unlock()
+
+		if res.status != 0 {
+			w.WriteHeader(res.status)
+			return
+		}
+		if res.etag != "" {
+			w.Header().Set("ETag", res.etag)
+		}
+		if res.lastModified != "" {
+			w.Header().Set("Last-Modified", res.lastModified)
+		}
+		if inm := r.Header.Get("If-None-Match"); (inm != "" && inm == res.etag) ||
+			(inm == "" && r.Header.Get("If-Modified-Since") != "" && r.Header.Get("If-Modified-Since") == res.lastModified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(res.body))
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *conditionalServer) serve(res resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.current = res
+}
+
+func (s *conditionalServer) last() *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[len(s.requests)-1]
+}
+
+func TestConditional(t *testing.T) {
+	const lastModified = "Mon, 01 Jan 2024 00:00:00 GMT"
+	v1 := resource{body: "v1", etag: `"1"`}
+	v2 := resource{body: "v2", etag: `"2"`}
+	type step struct {
+		serve  resource
+		forget bool
+		// wantINM and wantIMS are the validators sent.
+		wantINM, wantIMS string
+		wantBody         string
+		wantModified     bool
+		wantErr          bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "unchanged",
+			steps: []step{
+				{serve: v1, wantBody: "v1", wantModified: true},
+				{serve: v1, wantINM: `"1"`, wantBody: "v1"},
+				{serve: v1, wantINM: `"1"`, wantBody: "v1"},
+			},
+		},
+		{
+			name: "changed",
+			steps: []step{
+				{serve: v1, wantBody: "v1", wantModified: true},
+				{serve: v2, wantINM: `"1"`, wantBody: "v2", wantModified: true},
+				{serve: v2, wantINM: `"2"`, wantBody: "v2"},
+			},
+		},
+		{
+			name: "Last-Modified",
+			steps: []step{
+				{serve: resource{body: "v1", lastModified: lastModified}, wantBody: "v1", wantModified: true},
+				{serve: resource{body: "v1", lastModified: lastModified}, wantIMS: lastModified, wantBody: "v1"},
+			},
+		},
+		{
+			name: "no validators",
+			steps: []step{
+				{serve: resource{body: "v1"}, wantBody: "v1", wantModified: true},
+				{serve: resource{body: "v1"}, wantBody: "v1", wantModified: true},
+			},
+		},
+		{
+			name: "validators dropped",
+			steps: []step{
+				{serve: v1, wantBody: "v1", wantModified: true},
+				{serve: resource{body: "v2"}, wantINM: `"1"`, wantBody: "v2", wantModified: true},
+				{serve: v1, wantBody: "v1", wantModified: true},
+			},
+		},
+		{
+			name: "error keeps the body",
+			steps: []step{
+				{serve: v1, wantBody: "v1", wantModified: true},
+				{serve: resource{status: http.StatusNotFound}, wantINM: `"1"`, wantErr: true},
+				{serve: v1, wantINM: `"1"`, wantBody: "v1"},
+			},
+		},
+		{
+			name: "forgotten",
+			steps: []step{
+				{serve: v1, wantBody: "v1", wantModified: true},
+				{serve: v1, forget: true, wantBody: "v1", wantModified: true},
+			},
+		},
+		{
+			// A 304 to an unconditional request tells nothing
+			name: "unexpected 304",
+			steps: []step{
+				{serve: resource{status: http.StatusNotModified}, wantErr: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newConditionalServer(t)
+			c := NewConditional(NewRetryableClient())
+
+			for i, s := range tt.steps {
+				srv.serve(s.serve)
+				if s.forget {
+					c.Forget(srv.URL)
+				}
+
+				body, modified, err := c.Get(context.Background(), srv.URL)
+				if s.wantErr {
+					var statusErr *StatusError
+					if !errors.As(err, &statusErr) {
+						t.Errorf("step %d: Get() error = %v, want a StatusError", i+1, err)
+					}
+				} else if err != nil || string(body) != s.wantBody || modified != s.wantModified {
+					t.Errorf("step %d: Get() = %q, %v, %v, want %q, %v", i+1, body, modified, err, s.wantBody, s.wantModified)
+				}
+				r := srv.last()
+				if inm, ims := r.Header.Get("If-None-Match"), r.Header.Get("If-Modified-Since"); inm != s.wantINM || ims != s.wantIMS {
+					t.Errorf("step %d: sent If-None-Match %q, If-Modified-Since %q, want %q, %q", i+1, inm, ims, s.wantINM, s.wantIMS)
+				}
+			}
+		})
+	}
+}
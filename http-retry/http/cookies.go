@@ -0,0 +1,33 @@
+package http
+
+import "net/http"
+
+// WithCookieJar keeps cookies in jar and sends them with every attempt. The
+// jar is updated after each attempt, including failed ones, so a cookie set
+// by a 503, such as a load balancer's session affinity cookie, is sent with
+// the retry. It replaces the Jar of the client given with WithHTTPClient.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(c *config) {
+		c.jar = jar
+	}
+}
+
+// addCookies adds the cookies of the jar for req's URL to req.
+func (c *config) addCookies(req *http.Request) {
+	if c.jar == nil {
+		return
+	}
+	for _, cookie := range c.jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+}
+
+// storeCookies saves the cookies set by resp, a response to req, in the jar.
+func (c *config) storeCookies(req *http.Request, resp *http.Response) {
+	if c.jar == nil || resp == nil {
+		return
+	}
+	if cookies := resp.Cookies(); len(cookies) > 0 {
+		c.jar.SetCookies(req.URL, cookies)
+	}
+}
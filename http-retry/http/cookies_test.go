@@ -0,0 +1,85 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// cookieStep is an answer of the server in TestWithCookieJar, with the cookie
+// it sets if any.
+type cookieStep struct {
+	status int
+	cookie string
+}
+
+func TestWithCookieJar(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []cookieStep
+		// want is the Cookie header of each attempt.
+		want []string
+	}{
+		{
+			name:  "set by the retried response",
+			steps: []cookieStep{{503, "affinity=b"}, {200, ""}},
+			want:  []string{"", "affinity=b"},
+		},
+		{
+			name:  "replaced",
+			steps: []cookieStep{{503, "affinity=a"}, {503, "affinity=b"}, {200, ""}},
+			want:  []string{"", "affinity=a", "affinity=b"},
+		},
+		{
+			name:  "none",
+			steps: []cookieStep{{503, ""}, {200, ""}},
+			want:  []string{"", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var got []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				n := len(got)
+				got = append(got, r.Header.Get("Cookie"))
+				mu.Unlock()
+				step := tt.steps[n]
+				if step.cookie != "" {
+					w.Header().Set("Set-Cookie", step.cookie)
+				}
+				w.WriteHeader(step.status)
+			}))
+			defer srv.Close()
+			jar, _ := cookiejar.New(nil)
+			c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0), WithCookieJar(jar))
+
+			if _, _, err := c.GetBytes(context.Background(), srv.URL); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("attempts sent cookies %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCookieJarKeptAcrossRequests(t *testing.T) {
+	srv := newScriptServer(t, 200)
+	jar, _ := cookiejar.New(nil)
+	u := mustParseURL(t, srv.URL)
+	jar.SetCookies(u, []*http.Cookie{{Name: "session", Value: "1"}})
+	c := NewRetryableClient(WithCookieJar(jar))
+
+	if _, _, err := c.GetBytes(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := srv.request(0); r.Header.Get("Cookie") != "session=1" {
+		t.Errorf("Cookie = %q, want the jar's", r.Header.Get("Cookie"))
+	}
+}
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"context"
+	"net/http"
+)
+
+// DefaultCorrelationIDHeader is the header used by WithCorrelationIDs.
+const DefaultCorrelationIDHeader = "X-Correlation-ID"
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a context whose requests carry id as their
+// correlation ID, e.g. the one of the incoming request being served, see
+// WithCorrelationIDs.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID set by
+// WithCorrelationID, "" if there is none.
+func CorrelationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// WithCorrelationIDs sends the correlation ID of every request in the
+// DefaultCorrelationIDHeader header, see WithCorrelationIDHeader.
+func WithCorrelationIDs() Option {
+	return WithCorrelationIDHeader(DefaultCorrelationIDHeader)
+}
+
+// WithCorrelationIDHeader sends the correlation ID of every request in the
+// header name: the one set on the request, else the one of its context, else
+// a new random one. It is chosen once per logical request, so every retry
+// carries the same ID and the attempts can be tied together across services.
+// An empty name disables it.
+func WithCorrelationIDHeader(name string) Option {
+	return func(c *config) {
+		c.correlationHeader = http.CanonicalHeaderKey(name)
+	}
+}
+
+// correlationID returns the correlation ID to send with every attempt of req,
+// or "" if req does not need one.
+func (c *config) correlationID(req *http.Request) (string, error) {
+	if c.correlationHeader == "" || req.Header.Get(c.correlationHeader) != "" {
+		return "", nil
+	}
+	if id := CorrelationIDFromContext(req.Context()); id != "" {
+		return id, nil
+	}
+
+	return newIdempotencyKey()
+}
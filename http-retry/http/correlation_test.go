@@ -0,0 +1,107 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestWithCorrelationIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		ctxID  string
+		header http.Header
+		// wantHeader is where the ID is sent, wantID the ID if known.
+		wantHeader string
+		wantID     string
+	}{
+		{name: "disabled", wantHeader: ""},
+		{name: "random", opts: []Option{WithCorrelationIDs()}, wantHeader: DefaultCorrelationIDHeader},
+		{name: "from the context", opts: []Option{WithCorrelationIDs()}, ctxID: "ctx-id", wantHeader: DefaultCorrelationIDHeader, wantID: "ctx-id"},
+		{
+			name:       "set on the request",
+			opts:       []Option{WithCorrelationIDs()},
+			ctxID:      "ctx-id",
+			header:     http.Header{DefaultCorrelationIDHeader: {"req-id"}},
+			wantHeader: DefaultCorrelationIDHeader,
+			wantID:     "req-id",
+		},
+		{name: "custom header", opts: []Option{WithCorrelationIDHeader("x-request-id")}, ctxID: "ctx-id", wantHeader: "X-Request-Id", wantID: "ctx-id"},
+		{name: "disabled again", opts: []Option{WithCorrelationIDs(), WithCorrelationIDHeader("")}, ctxID: "ctx-id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503, 503, 200)
+			c := NewRetryableClient(append([]Option{fastBackoff}, tt.opts...)...)
+			ctx := context.Background()
+			if tt.ctxID != "" {
+				ctx = WithCorrelationID(ctx, tt.ctxID)
+			}
+			req, _ := NewRequest(ctx, http.MethodGet, srv.URL, nil)
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+
+			resp, err := c.Do(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			drainBody(resp)
+
+			first, _ := srv.request(0)
+			if tt.wantHeader == "" {
+				if got := first.Header.Get(DefaultCorrelationIDHeader); got != "" {
+					t.Errorf("correlation ID %q sent", got)
+				}
+				return
+			}
+			id := first.Header.Get(tt.wantHeader)
+			if id == "" || (tt.wantID != "" && id != tt.wantID) {
+				t.Errorf("%s = %q, want %q", tt.wantHeader, id, tt.wantID)
+			}
+			for i := 1; i < srv.count(); i++ {
+				if r, _ := srv.request(i); r.Header.Get(tt.wantHeader) != id {
+					t.Errorf("attempt %d sent %q, want the ID of the first %q", i+1, r.Header.Get(tt.wantHeader), id)
+				}
+			}
+		})
+	}
+}
+
+func TestCorrelationIDsDiffer(t *testing.T) {
+	srv := newScriptServer(t, 200)
+	c := NewRetryableClient(WithCorrelationIDs())
+	for i := 0; i < 2; i++ {
+		resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		drainBody(resp)
+	}
+
+	a, _ := srv.request(0)
+	b, _ := srv.request(1)
+	if a.Header.Get(DefaultCorrelationIDHeader) == b.Header.Get(DefaultCorrelationIDHeader) {
+		t.Errorf("requests share the correlation ID %q", a.Header.Get(DefaultCorrelationIDHeader))
+	}
+}
+
+func TestCorrelationIDFromContext(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "none", ctx: context.Background()},
+		{name: "set", ctx: WithCorrelationID(context.Background(), "id"), want: "id"},
+		{name: "replaced", ctx: WithCorrelationID(WithCorrelationID(context.Background(), "a"), "b"), want: "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CorrelationIDFromContext(tt.ctx); got != tt.want {
+				t.Errorf("CorrelationIDFromContext() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ErrDeadlineWouldExceed is returned when the request context's deadline
+// would pass during the next backoff wait and attempt, so the client gives up
+// at once instead of sleeping only to fail. It matches
+// context.DeadlineExceeded with errors.Is.
+var ErrDeadlineWouldExceed error = deadlineError{}
+
+type deadlineError struct{}
+
+func (deadlineError) Error() string { return "rhttp: retry would exceed deadline" }
+
+func (deadlineError) Is(target error) bool { return target == context.DeadlineExceeded }
+
+// ewmaWeight is the weight of the latest attempt in the duration estimate.
+const ewmaWeight = 0.3
+
+// latencyEstimator learns how long attempts to each host take, as an
+// exponentially weighted moving average and a histogram of recent attempts.
+type latencyEstimator struct {
+	mu         sync.Mutex
+	hosts      map[string]time.Duration
+	histograms map[string]*latencyWindow
+}
+
+func newLatencyEstimator() *latencyEstimator {
+	return &latencyEstimator{
+		hosts:      make(map[string]time.Duration),
+		histograms: make(map[string]*latencyWindow),
+	}
+}
+
+func (e *latencyEstimator) observe(host string, d time.Duration, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	w, ok := e.histograms[host]
+	if !ok {
+		w = &latencyWindow{started: now}
+		e.histograms[host] = w
+	}
+	w.observe(d, now)
+
+	prev, ok := e.hosts[host]
+	if !ok {
+		e.hosts[host] = d
+		return
+	}
+	e.hosts[host] = time.Duration(ewmaWeight*float64(d) + (1-ewmaWeight)*float64(prev))
+}
+
+func (e *latencyEstimator) estimate(host string) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.hosts[host]
+}
+
+// wouldExceedDeadline reports whether waiting delay and then making a typical
+// attempt to host would run past ctx's deadline. The deadline is on the system
+// clock, whatever the client's clock, so the time left is measured on it.
+func (c *config) wouldExceedDeadline(ctx context.Context, host string, delay time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return false
+	}
+
+	attempt := c.latency.estimate(host)
+	if c.attemptTimeout > 0 && attempt > c.attemptTimeout {
+		attempt = c.attemptTimeout
+	}
+
+	return delay+attempt > time.Until(deadline)
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLatencyEstimator(t *testing.T) {
+	tests := []struct {
+		name     string
+		observed []time.Duration
+		want     time.Duration
+	}{
+		{name: "unknown host"},
+		{name: "first attempt", observed: []time.Duration{100 * time.Millisecond}, want: 100 * time.Millisecond},
+		{name: "moving average", observed: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, want: 130 * time.Millisecond},
+		{
+			name:     "steady",
+			observed: []time.Duration{50 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond},
+			want:     50 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newLatencyEstimator()
+			now := time.Now()
+			for _, d := range tt.observed {
+				e.observe("a", d, now)
+			}
+			if got := e.estimate("a"); got != tt.want {
+				t.Errorf("estimate() = %v, want %v", got, tt.want)
+			}
+			if got := e.estimate("b"); got != 0 {
+				t.Errorf("estimate() of another host = %v", got)
+			}
+		})
+	}
+}
+
+func TestWouldExceedDeadline(t *testing.T) {
+	tests := []struct {
+		name           string
+		timeout        time.Duration
+		attemptTimeout time.Duration
+		delay          time.Duration
+		latency        time.Duration
+		want           bool
+	}{
+		{name: "no deadline", delay: time.Hour},
+		{name: "time left", timeout: time.Hour, delay: time.Second},
+		{name: "backoff too long", timeout: time.Second, delay: time.Minute, want: true},
+		{name: "attempts too slow", timeout: time.Minute, delay: time.Second, latency: 2 * time.Minute, want: true},
+		{
+			name:           "estimate capped by the attempt timeout",
+			timeout:        time.Minute,
+			attemptTimeout: time.Second,
+			delay:          time.Second,
+			latency:        2 * time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(WithAttemptTimeout(tt.attemptTimeout))
+			if tt.latency > 0 {
+				cfg.latency.observe("example.com", tt.latency, time.Now())
+			}
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			if got := cfg.wouldExceedDeadline(ctx, "example.com", tt.delay); got != tt.want {
+				t.Errorf("wouldExceedDeadline() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGiveUpBeforeDeadline(t *testing.T) {
+	var count int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	c := NewRetryableClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.Do(ctx, mustNewRequest(t, srv.URL))
+	if !errors.Is(err, ErrDeadlineWouldExceed) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do() error = %v, want ErrDeadlineWouldExceed", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("gave up after %v, want at once", elapsed)
+	}
+	if count != 1 {
+		t.Errorf("server received %d requests, want 1", count)
+	}
+}
@@ -0,0 +1,326 @@
+package http
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// debugGiveUps is how many recent give-ups DebugStats keeps.
+const debugGiveUps = 50
+
+// DebugStats collects the live state of the clients using it, see
+// WithDebugStats, and serves it as an HTTP handler, in HTML for browsers and
+// in JSON with ?format=json or an Accept: application/json header:
+//
+//	stats := rhttp.NewDebugStats()
+//	client := rhttp.NewRetryableClient(rhttp.WithDebugStats(stats))
+//	http.Handle("/debug/http-retry", stats)
+type DebugStats struct {
+	mu        sync.Mutex
+	hosts     map[string]*HostDebugStats
+	giveUps   []GiveUpRecord
+	breakers  map[*CircuitBreaker]struct{}
+	throttles map[*RetryThrottle]struct{}
+	policies  map[PolicySource]*PolicyDebugStats
+	hedges    int64
+	active    int64
+}
+
+// DebugSnapshot is the state reported by DebugStats.
+type DebugSnapshot struct {
+	Hosts         []HostDebugStats   `json:"hosts"`
+	RetryBudgets  []RetryBudgetStats `json:"retry_budgets"`
+	RecentGiveUps []GiveUpRecord     `json:"recent_give_ups"`
+	Policies      []PolicyDebugStats `json:"policies"`
+	Hedges        int64              `json:"hedges"`
+	ActiveHedges  int64              `json:"active_hedges"`
+}
+
+// HostDebugStats counts the attempts sent to a host.
+type HostDebugStats struct {
+	Host     string `json:"host"`
+	Attempts int64  `json:"attempts"`
+	Retries  int64  `json:"retries"`
+	GiveUps  int64  `json:"give_ups"`
+	// Statuses counts attempts by status class, see MetricLabels.
+	Statuses    map[string]int64 `json:"statuses"`
+	Circuit     string           `json:"circuit,omitempty"`
+	LastAttempt time.Time        `json:"last_attempt"`
+}
+
+// RetryBudgetStats is the level of a RetryThrottle.
+type RetryBudgetStats struct {
+	Tokens    float64 `json:"tokens"`
+	MaxTokens float64 `json:"max_tokens"`
+}
+
+// PolicyDebugStats counts the requests sent under a policy, see WithPolicy.
+type PolicyDebugStats struct {
+	PolicySource
+	Requests int64     `json:"requests"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// GiveUpRecord describes a request the client stopped retrying. URL has its
+// query and credentials removed.
+type GiveUpRecord struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Attempts   int       `json:"attempts"`
+	Reason     string    `json:"reason"`
+	LastStatus int       `json:"last_status,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// NewDebugStats returns empty stats.
+func NewDebugStats() *DebugStats {
+	return &DebugStats{
+		hosts:     make(map[string]*HostDebugStats),
+		breakers:  make(map[*CircuitBreaker]struct{}),
+		throttles: make(map[*RetryThrottle]struct{}),
+		policies:  make(map[PolicySource]*PolicyDebugStats),
+	}
+}
+
+// WithDebugStats records the client's attempts, retries, give-ups, hedges,
+// circuit states and retry budget in d. Stats may be shared between clients.
+// Use it at the client level, not with WithHostOptions.
+func WithDebugStats(d *DebugStats) Option {
+	return func(c *config) {
+		if d == nil {
+			return
+		}
+		c.debug = d
+		WithHooks(Hooks{
+			OnResponse: d.onResponse,
+			OnRetry:    d.onRetry,
+			OnGiveUp:   d.onGiveUp,
+		})(c)
+	}
+}
+
+// host returns the stats of host. d.mu must be held.
+func (d *DebugStats) host(host string) *HostDebugStats {
+	h, ok := d.hosts[host]
+	if !ok {
+		h = &HostDebugStats{Host: host, Statuses: make(map[string]int64)}
+		d.hosts[host] = h
+	}
+
+	return h
+}
+
+func (d *DebugStats) onResponse(req *http.Request, resp *http.Response, err error, attempt int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h := d.host(req.URL.Host)
+	h.Attempts++
+	h.Statuses[statusClass(resp)]++
+	h.LastAttempt = time.Now()
+}
+
+func (d *DebugStats) onRetry(req *http.Request, resp *http.Response, err error, attempt int, delay time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.host(req.URL.Host).Retries++
+}
+
+func (d *DebugStats) onGiveUp(req *http.Request, err *RetryError) {
+	u := *req.URL
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+
+	last := err.Last()
+	rec := GiveUpRecord{
+		Time:       time.Now(),
+		Method:     req.Method,
+		URL:        u.String(),
+		Attempts:   len(err.Attempts),
+		Reason:     err.Reason.Error(),
+		LastStatus: last.StatusCode,
+	}
+	if last.Err != nil {
+		rec.LastError = last.Err.Error()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.host(req.URL.Host).GiveUps++
+	if len(d.giveUps) == debugGiveUps {
+		copy(d.giveUps, d.giveUps[1:])
+		d.giveUps = d.giveUps[:debugGiveUps-1]
+	}
+	d.giveUps = append(d.giveUps, rec)
+}
+
+// track remembers the circuit breaker, retry budget and policy of cfg.
+func (d *DebugStats) track(cfg *config) {
+	if d == nil || (cfg.circuitBreaker == nil && cfg.retryThrottle == nil && cfg.policySource == PolicySource{}) {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if src := cfg.policySource; src != (PolicySource{}) {
+		p, ok := d.policies[src]
+		if !ok {
+			p = &PolicyDebugStats{PolicySource: src}
+			d.policies[src] = p
+		}
+		p.Requests++
+		p.LastUsed = time.Now()
+	}
+	if cfg.circuitBreaker != nil {
+		d.breakers[cfg.circuitBreaker] = struct{}{}
+	}
+	if cfg.retryThrottle != nil {
+		d.throttles[cfg.retryThrottle] = struct{}{}
+	}
+}
+
+// hedge counts n more hedged attempts in flight.
+func (d *DebugStats) hedge(n int64) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if n > 0 {
+		d.hedges += n
+	}
+	d.active += n
+}
+
+// Snapshot returns the current stats, hosts sorted by name and give-ups most
+// recent first.
+func (d *DebugStats) Snapshot() DebugSnapshot {
+	d.mu.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(d.breakers))
+	for b := range d.breakers {
+		breakers = append(breakers, b)
+	}
+	throttles := make([]*RetryThrottle, 0, len(d.throttles))
+	for t := range d.throttles {
+		throttles = append(throttles, t)
+	}
+	snap := DebugSnapshot{
+		Hosts:         []HostDebugStats{},
+		RetryBudgets:  []RetryBudgetStats{},
+		RecentGiveUps: make([]GiveUpRecord, 0, len(d.giveUps)),
+		Hedges:        d.hedges,
+		ActiveHedges:  d.active,
+	}
+	hosts := make(map[string]HostDebugStats, len(d.hosts))
+	for host, h := range d.hosts {
+		hs := *h
+		hs.Statuses = make(map[string]int64, len(h.Statuses))
+		for k, v := range h.Statuses {
+			hs.Statuses[k] = v
+		}
+		hosts[host] = hs
+	}
+	for i := len(d.giveUps) - 1; i >= 0; i-- {
+		snap.RecentGiveUps = append(snap.RecentGiveUps, d.giveUps[i])
+	}
+	snap.Policies = make([]PolicyDebugStats, 0, len(d.policies))
+	for _, p := range d.policies {
+		snap.Policies = append(snap.Policies, *p)
+	}
+	d.mu.Unlock()
+	sort.Slice(snap.Policies, func(i, j int) bool {
+		a, b := snap.Policies[i], snap.Policies[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+
+	// Breakers have locks of their own, query them outside of d.mu
+	for _, b := range breakers {
+		for host, state := range b.States() {
+			hs, ok := hosts[host]
+			if !ok {
+				hs = HostDebugStats{Host: host, Statuses: map[string]int64{}}
+			}
+			// With several breakers, show the least healthy circuit
+			if hs.Circuit == "" || state != CircuitClosed {
+				hs.Circuit = state.String()
+			}
+			hosts[host] = hs
+		}
+	}
+	for _, t := range throttles {
+		snap.RetryBudgets = append(snap.RetryBudgets, RetryBudgetStats{Tokens: t.Tokens(), MaxTokens: t.MaxTokens()})
+	}
+
+	for _, hs := range hosts {
+		snap.Hosts = append(snap.Hosts, hs)
+	}
+	sort.Slice(snap.Hosts, func(i, j int) bool { return snap.Hosts[i].Host < snap.Hosts[j].Host })
+
+	return snap
+}
+
+func (d *DebugStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snap := d.Snapshot()
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(snap)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	debugPage.Execute(w, snap)
+}
+
+var debugPage = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>http-retry</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>http-retry</h1>
+<p>Hedges: {{.Hedges}}, {{.ActiveHedges}} in flight. <a href="?format=json">JSON</a></p>
+<h2>Hosts</h2>
+<table>
+<tr><th>Host</th><th>Attempts</th><th>Retries</th><th>Give-ups</th><th>Statuses</th><th>Circuit</th><th>Last attempt</th></tr>
+{{range .Hosts}}<tr><td>{{.Host}}</td><td>{{.Attempts}}</td><td>{{.Retries}}</td><td>{{.GiveUps}}</td><td>{{range $class, $n := .Statuses}}{{$class}}: {{$n}} {{end}}</td><td>{{.Circuit}}</td><td>{{if not .LastAttempt.IsZero}}{{.LastAttempt.Format "2006-01-02 15:04:05"}}{{end}}</td></tr>
+{{end}}</table>
+<h2>Retry budgets</h2>
+<table>
+<tr><th>Tokens</th><th>Max tokens</th></tr>
+{{range .RetryBudgets}}<tr><td>{{printf "%.1f" .Tokens}}</td><td>{{printf "%.1f" .MaxTokens}}</td></tr>
+{{end}}</table>
+<h2>Policies</h2>
+<table>
+<tr><th>Name</th><th>Fingerprint</th><th>Requests</th><th>Last used</th></tr>
+{{range .Policies}}<tr><td>{{.Name}}</td><td>{{.Fingerprint}}</td><td>{{.Requests}}</td><td>{{.LastUsed.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+<h2>Recent give-ups</h2>
+<table>
+<tr><th>Time</th><th>Request</th><th>Attempts</th><th>Reason</th><th>Last status</th><th>Last error</th></tr>
+{{range .RecentGiveUps}}<tr><td>{{.Time.Format "2006-01-02 15:04:05"}}</td><td>{{.Method}} {{.URL}}</td><td>{{.Attempts}}</td><td>{{.Reason}}</td><td>{{if .LastStatus}}{{.LastStatus}}{{end}}</td><td>{{.LastError}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,171 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		opts     []Option
+		// requests is how many requests are sent, 1 if zero.
+		requests    int
+		wantHost    HostDebugStats
+		wantGiveUps int
+		wantBudgets int
+	}{
+		{
+			name:     "delivered",
+			statuses: []int{200},
+			wantHost: HostDebugStats{Attempts: 1, Statuses: map[string]int64{"2xx": 1}},
+		},
+		{
+			name:     "retried",
+			statuses: []int{503, 429, 200},
+			wantHost: HostDebugStats{Attempts: 3, Retries: 2, Statuses: map[string]int64{"2xx": 1, "4xx": 1, "5xx": 1}},
+		},
+		{
+			name:        "given up",
+			statuses:    []int{503},
+			opts:        []Option{WithMaxRetries(1)},
+			wantHost:    HostDebugStats{Attempts: 2, Retries: 1, GiveUps: 1, Statuses: map[string]int64{"5xx": 2}},
+			wantGiveUps: 1,
+		},
+		{
+			name:     "circuit",
+			statuses: []int{503},
+			opts:     []Option{WithMaxRetries(0), WithCircuitBreaker(NewCircuitBreaker(CircuitSettings{FailureThreshold: 2, Cooldown: time.Hour}))},
+			requests: 2,
+			wantHost: HostDebugStats{Attempts: 2, Statuses: map[string]int64{"5xx": 2}, Circuit: "open"},
+		},
+		{
+			name:        "retry budget",
+			statuses:    []int{200},
+			opts:        []Option{WithRetryThrottle(NewRetryThrottle(10, 0.1))},
+			wantHost:    HostDebugStats{Attempts: 1, Statuses: map[string]int64{"2xx": 1}},
+			wantBudgets: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			stats := NewDebugStats()
+			c := NewRetryableClient(append([]Option{fastBackoff, WithDebugStats(stats)}, tt.opts...)...)
+			requests := tt.requests
+			if requests == 0 {
+				requests = 1
+			}
+			for i := 0; i < requests; i++ {
+				if resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL+"/path?token=secret")); err == nil {
+					drainBody(resp)
+				}
+			}
+
+			snap := stats.Snapshot()
+			if len(snap.Hosts) != 1 {
+				t.Fatalf("hosts = %+v, want the server", snap.Hosts)
+			}
+			got := snap.Hosts[0]
+			want := tt.wantHost
+			want.Host, want.LastAttempt = mustParseURL(t, srv.URL).Host, got.LastAttempt
+			if got.LastAttempt.IsZero() || !reflect.DeepEqual(got, want) {
+				t.Errorf("host = %+v, want %+v", got, want)
+			}
+			if len(snap.RecentGiveUps) != tt.wantGiveUps {
+				t.Errorf("give-ups = %+v, want %d", snap.RecentGiveUps, tt.wantGiveUps)
+			}
+			for _, g := range snap.RecentGiveUps {
+				if g.Method != http.MethodGet || g.URL != srv.URL+"/path" || g.Attempts != 2 || g.LastStatus != 503 || g.Reason == "" {
+					t.Errorf("give-up = %+v", g)
+				}
+			}
+			if len(snap.RetryBudgets) != tt.wantBudgets {
+				t.Errorf("retry budgets = %+v, want %d", snap.RetryBudgets, tt.wantBudgets)
+			}
+		})
+	}
+}
+
+func TestDebugStatsGiveUpsKept(t *testing.T) {
+	stats := NewDebugStats()
+	req := mustNewRequest(t, "http://example.com")
+	for i := 0; i < debugGiveUps+10; i++ {
+		stats.onGiveUp(req, &RetryError{Reason: ErrMaxRetriesExceeded, Attempts: make([]Attempt, i+1)})
+	}
+
+	giveUps := stats.Snapshot().RecentGiveUps
+	if len(giveUps) != debugGiveUps {
+		t.Fatalf("%d give-ups kept, want %d", len(giveUps), debugGiveUps)
+	}
+	if first, last := giveUps[0].Attempts, giveUps[len(giveUps)-1].Attempts; first != debugGiveUps+10 || last != 11 {
+		t.Errorf("give-ups from %d to %d attempts, want the most recent first", first, last)
+	}
+}
+
+func TestDebugStatsHedges(t *testing.T) {
+	stats := NewDebugStats()
+	stats.hedge(2)
+	stats.hedge(-1)
+
+	if snap := stats.Snapshot(); snap.Hedges != 2 || snap.ActiveHedges != 1 {
+		t.Errorf("hedges = %d, %d in flight, want 2, 1", snap.Hedges, snap.ActiveHedges)
+	}
+	// Clients without stats count nothing
+	(*DebugStats)(nil).hedge(1)
+}
+
+func TestDebugStatsServeHTTP(t *testing.T) {
+	stats := NewDebugStats()
+	stats.onResponse(mustNewRequest(t, "http://example.com"), nil, errors.New("refused"), 1)
+	stats.onGiveUp(mustNewRequest(t, "http://example.com/<script>"), &RetryError{Reason: ErrMaxRetriesExceeded, Attempts: []Attempt{{Err: errors.New("refused")}}})
+	tests := []struct {
+		name     string
+		target   string
+		accept   string
+		wantJSON bool
+	}{
+		{name: "html", target: "/debug"},
+		{name: "format", target: "/debug?format=json", wantJSON: true},
+		{name: "accept", target: "/debug", accept: "application/json", wantJSON: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			stats.ServeHTTP(w, req)
+
+			if w.Code != 200 || w.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("response = %d, Cache-Control %q", w.Code, w.Header().Get("Cache-Control"))
+			}
+			if tt.wantJSON {
+				var snap DebugSnapshot
+				if err := json.Unmarshal(w.Body.Bytes(), &snap); err != nil || len(snap.Hosts) != 1 || snap.Hosts[0].Statuses["error"] != 1 {
+					t.Errorf("JSON = %s, %v", w.Body, err)
+				}
+				return
+			}
+			body := w.Body.String()
+			if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") || !strings.Contains(body, "example.com") {
+				t.Errorf("HTML = %s", body)
+			}
+			if strings.Contains(body, "<script>") {
+				t.Error("URL not escaped in the HTML")
+			}
+			if !strings.Contains(body, "<td>1</td>") {
+				t.Errorf("attempts missing from the HTML: %s", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Decoder returns a reader decompressing r, for one content coding.
+type Decoder func(r io.Reader) (io.ReadCloser, error)
+
+// WithDecompression asks for compressed responses and decompresses them
+// within each attempt, gzip and deflate out of the box. The body is
+// decompressed in full before the response is returned, so a body truncated
+// mid-stream fails the attempt with a retryable error instead of handing a
+// corrupt partial read to the caller. Requests setting Accept-Encoding
+// themselves are left alone.
+func WithDecompression() Option {
+	return func(c *config) {
+		if c.decoders == nil {
+			c.decoders = map[string]Decoder{"gzip": decodeGzip, "deflate": decodeDeflate}
+		}
+	}
+}
+
+// WithDecoder adds a decoder for encoding, enabling WithDecompression. Brotli,
+// which the standard library lacks, can be added with e.g.
+// github.com/andybalholm/brotli:
+//
+//	rhttp.WithDecoder("br", func(r io.Reader) (io.ReadCloser, error) {
+//		return ioutil.NopCloser(brotli.NewReader(r)), nil
+//	})
+func WithDecoder(encoding string, d Decoder) Option {
+	return func(c *config) {
+		decoders := map[string]Decoder{"gzip": decodeGzip, "deflate": decodeDeflate}
+		for name, dec := range c.decoders {
+			decoders[name] = dec
+		}
+		decoders[strings.ToLower(encoding)] = d
+		c.decoders = decoders
+	}
+}
+
+func decodeGzip(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// decodeDeflate accepts zlib streams, as the HTTP deflate coding requires,
+// and raw deflate streams, which some servers send instead.
+func decodeDeflate(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err == nil && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+		return zlib.NewReader(br)
+	}
+
+	return flate.NewReader(br), nil
+}
+
+// acceptEncoding advertises the supported encodings on req, unless the caller
+// chose its own.
+func (c *config) acceptEncoding(req *http.Request) {
+	if c.decoders == nil || req.Header.Get("Accept-Encoding") != "" {
+		return
+	}
+
+	var extra []string
+	for name := range c.decoders {
+		if name != "gzip" && name != "deflate" {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	req.Header.Set("Accept-Encoding", strings.Join(append([]string{"gzip", "deflate"}, extra...), ", "))
+}
+
+// decompress replaces the body of resp with its decompressed content.
+func (c *config) decompress(resp *http.Response) (*http.Response, error) {
+	header := resp.Header.Get("Content-Encoding")
+	if c.decoders == nil || header == "" {
+		return resp, nil
+	}
+
+	// Codings are listed in the order they were applied
+	var encodings []string
+	for _, e := range strings.Split(header, ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" && e != "identity" {
+			encodings = append(encodings, e)
+		}
+	}
+	for _, e := range encodings {
+		if _, ok := c.decoders[e]; !ok {
+			// Leave what we cannot decode to the caller
+			return resp, nil
+		}
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	for i := len(encodings) - 1; i >= 0 && err == nil; i-- {
+		data, err = decode(c.decoders[encodings[i]], data, c.maxResponseBytes)
+		if err != nil && !errors.Is(err, ErrBodyTooLarge) {
+			err = fmt.Errorf("rhttp: decoding %s response: %w", encodings[i], err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	resp.ContentLength = int64(len(data))
+	resp.Uncompressed = true
+
+	return resp, nil
+}
+
+// decode decodes data, failing past limit bytes of output unless it is zero.
+func decode(d Decoder, data []byte, limit int64) ([]byte, error) {
+	r, err := d(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return readLimited(r, limit)
+}
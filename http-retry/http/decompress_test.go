@@ -0,0 +1,175 @@
+package http
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func gzipped(s string) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.Bytes()
+}
+
+func zlibbed(s string) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.Bytes()
+}
+
+func deflated(s string) []byte {
+	var b bytes.Buffer
+	w, _ := flate.NewWriter(&b, flate.DefaultCompression)
+	w.Write([]byte(s))
+	w.Close()
+	return b.Bytes()
+}
+
+// reversed is a toy content coding sending the body backwards.
+func reversed(s string) []byte {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b
+}
+
+func decodeReversed(r io.Reader) (io.ReadCloser, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(reversed(string(b)))), nil
+}
+
+func TestWithDecompression(t *testing.T) {
+	const text = "hello, compressed world"
+	tests := []struct {
+		name     string
+		opts     []Option
+		encoding string
+		body     []byte
+		want     string
+		// wantEncoding is the Content-Encoding left on the response.
+		wantEncoding string
+	}{
+		{name: "gzip", encoding: "gzip", body: gzipped(text), want: text},
+		{name: "zlib deflate", encoding: "deflate", body: zlibbed(text), want: text},
+		{name: "raw deflate", encoding: "deflate", body: deflated(text), want: text},
+		{name: "identity", encoding: "identity", body: []byte(text), want: text},
+		{name: "case", encoding: "GZIP", body: gzipped(text), want: text},
+		{name: "stacked", encoding: "gzip, gzip", body: gzipped(string(gzipped(text))), want: text},
+		{
+			name:     "custom decoder",
+			opts:     []Option{WithDecoder("rev", decodeReversed)},
+			encoding: "gzip, rev",
+			body:     reversed(string(gzipped(text))),
+			want:     text,
+		},
+		{name: "unknown coding left alone", encoding: "br", body: []byte("opaque"), want: "opaque", wantEncoding: "br"},
+		{name: "not encoded", body: []byte(text), want: text},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(tt.body)
+			}))
+			defer srv.Close()
+			c := NewRetryableClient(append([]Option{WithDecompression()}, tt.opts...)...)
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil || string(body) != tt.want {
+				t.Fatalf("body = %q, %v, want %q", body, err, tt.want)
+			}
+			if got := resp.Header.Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+		})
+	}
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		header string
+		want   string
+	}{
+		{name: "disabled"},
+		{name: "default", opts: []Option{WithDecompression()}, want: "gzip, deflate"},
+		{name: "custom decoders", opts: []Option{WithDecoder("zstd", decodeReversed), WithDecoder("br", decodeReversed)}, want: "gzip, deflate, br, zstd"},
+		{name: "set by the caller", opts: []Option{WithDecompression()}, header: "br", want: "br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := mustNewRequest(t, "http://example.com")
+			if tt.header != "" {
+				req.Header.Set("Accept-Encoding", tt.header)
+			}
+			newConfig(tt.opts...).acceptEncoding(req)
+			if got := req.Header.Get("Accept-Encoding"); got != tt.want {
+				t.Errorf("Accept-Encoding = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecompressionRetriesTruncatedBody(t *testing.T) {
+	full := gzipped(strings.Repeat("payload ", 100))
+	var count int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		if atomic.AddInt64(&count, 1) == 1 {
+			w.Write(full[:len(full)/2])
+			return
+		}
+		w.Write(full)
+	}))
+	defer srv.Close()
+	c := NewRetryableClient(fastBackoff, WithDecompression())
+
+	_, body, err := c.GetBytes(context.Background(), srv.URL)
+	if err != nil || string(body) != strings.Repeat("payload ", 100) {
+		t.Fatalf("GetBytes() = %d bytes, %v", len(body), err)
+	}
+	if count != 2 {
+		t.Errorf("server received %d requests, want 2", count)
+	}
+}
+
+func TestDecompressionLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		// About 1KB compressed, 1MB decompressed
+		w.Write(gzipped(strings.Repeat("a", 1<<20)))
+	}))
+	defer srv.Close()
+	c := NewRetryableClient(fastBackoff, WithDecompression(), WithMaxResponseBytes(64<<10))
+
+	if _, _, err := c.GetBytes(context.Background(), srv.URL); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("GetBytes() error = %v, want ErrBodyTooLarge", err)
+	}
+}
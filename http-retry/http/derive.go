@@ -0,0 +1,25 @@
+package http
+
+// With returns a client applying opts on top of c's current options, for a
+// part of a service needing another policy, e.g. more retries or other
+// headers. It shares c's transport, and thus its connection pool, and its
+// queue if any, so deriving a client is cheap. Client-level options such as
+// WithHTTPClient, WithMiddleware and the transport options have no effect
+// here. UpdatePolicy on either client leaves the other unchanged, while Close
+// on either closes both.
+func (c *RetryableClient) With(opts ...Option) *RetryableClient {
+	cfg := c.current().with(opts...)
+	if cfg.healthChecker != nil {
+		cfg.healthChecker.attach(cfg)
+	}
+	tunable := newTunable(cfg)
+
+	client := *c.client
+	parent := c.client.Transport.(*retryableTransport)
+	client.Transport = &retryableTransport{transport: parent.transport, config: cfg, tunable: tunable, life: parent.life}
+	if cfg.redirectPolicy != nil {
+		client.CheckRedirect = cfg.redirectPolicy.checkRedirect
+	}
+
+	return &RetryableClient{client: &client, config: cfg, tunable: tunable, queue: c.queue, life: c.life}
+}
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWith(t *testing.T) {
+	tests := []struct {
+		name        string
+		parent      []Option
+		derived     []Option
+		statuses    []int
+		wantParent  int
+		wantDerived int
+		wantHeader  map[string][2]string
+	}{
+		{
+			name:        "more retries",
+			parent:      []Option{WithMaxRetries(1)},
+			derived:     []Option{WithMaxRetries(3)},
+			statuses:    []int{503, 503, 503, 200},
+			wantParent:  2,
+			wantDerived: 4,
+		},
+		{
+			name:        "no retries",
+			derived:     []Option{WithMaxRetries(0)},
+			statuses:    []int{503, 200},
+			wantParent:  2,
+			wantDerived: 1,
+		},
+		{
+			name:        "inherited",
+			parent:      []Option{WithMaxRetries(0)},
+			statuses:    []int{503, 200},
+			wantParent:  1,
+			wantDerived: 1,
+		},
+		{
+			name:        "headers",
+			parent:      []Option{WithDefaultHeaders(http.Header{"X-Tenant": {"acme"}})},
+			derived:     []Option{WithDefaultHeaders(http.Header{"X-Team": {"billing"}})},
+			statuses:    []int{200},
+			wantParent:  1,
+			wantDerived: 1,
+			wantHeader:  map[string][2]string{"X-Tenant": {"acme", "acme"}, "X-Team": {"", "billing"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := NewRetryableClient(append([]Option{fastBackoff}, tt.parent...)...)
+			derived := parent.With(tt.derived...)
+
+			for i, c := range []*RetryableClient{parent, derived} {
+				srv := newScriptServer(t, tt.statuses...)
+				if resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL)); err == nil {
+					drainBody(resp)
+				}
+
+				want := []int{tt.wantParent, tt.wantDerived}[i]
+				if srv.count() != want {
+					t.Errorf("client %d sent %d requests, want %d", i, srv.count(), want)
+				}
+				r, _ := srv.request(0)
+				for name, values := range tt.wantHeader {
+					if got := r.Header.Get(name); got != values[i] {
+						t.Errorf("client %d sent %s %q, want %q", i, name, got, values[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWithSharesConnections(t *testing.T) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	parent := NewRetryableClient()
+
+	for _, c := range []*RetryableClient{parent, parent.With(WithMaxRetries(5)), parent} {
+		resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		drainBody(resp)
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("%d connections opened, want 1", n)
+	}
+}
+
+func TestWithUpdatePolicy(t *testing.T) {
+	parent := NewRetryableClient(fastBackoff)
+	derived := parent.With()
+	zero := 0
+	if err := derived.UpdatePolicy(&Settings{MaxRetries: &zero}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		c    *RetryableClient
+		want int
+	}{{c: parent, want: 2}, {c: derived, want: 1}} {
+		srv := newScriptServer(t, 503, 200)
+		if resp, err := tc.c.Do(context.Background(), mustNewRequest(t, srv.URL)); err == nil {
+			drainBody(resp)
+		}
+		if srv.count() != tc.want {
+			t.Errorf("%d requests sent, want %d", srv.count(), tc.want)
+		}
+	}
+}
+
+func TestWithClose(t *testing.T) {
+	srv := newScriptServer(t, 200)
+	parent := NewRetryableClient()
+	derived := parent.With()
+
+	if err := derived.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parent.Do(context.Background(), mustNewRequest(t, srv.URL)); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("parent Do() error = %v, want ErrClientClosed", err)
+	}
+}
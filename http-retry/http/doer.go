@@ -0,0 +1,23 @@
+package http
+
+import (
+	"context"
+	"net/http"
+)
+
+// Doer is the method set of *http.Client that most code needs, satisfied by
+// StandardClient. Accept a Doer to stay independent of how requests are sent.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// RetryableDoer is the interface of RetryableClient.Do. Code accepting one
+// can be unit tested against rhttptest.Mock instead of a real client.
+type RetryableDoer interface {
+	Do(ctx context.Context, req *http.Request, opts ...Option) (*http.Response, error)
+}
+
+var (
+	_ Doer          = (*http.Client)(nil)
+	_ RetryableDoer = (*RetryableClient)(nil)
+)
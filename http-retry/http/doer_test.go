@@ -0,0 +1,59 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestDoer(t *testing.T) {
+	tests := []struct {
+		name       string
+		doer       func() Doer
+		wantStatus int
+		wantSent   int
+	}{
+		{name: "http.Client", doer: func() Doer { return &http.Client{} }, wantStatus: 503, wantSent: 1},
+		{name: "StandardClient", doer: func() Doer { return NewRetryableClient(fastBackoff).StandardClient() }, wantStatus: 200, wantSent: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503, 200)
+
+			resp, err := tt.doer().Do(mustNewRequest(t, srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus || srv.count() != tt.wantSent {
+				t.Errorf("Do() = %d after %d requests, want %d after %d", resp.StatusCode, srv.count(), tt.wantStatus, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestRetryableDoer(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantSent int
+	}{
+		{name: "retried", wantSent: 2},
+		{name: "request options", opts: []Option{WithMaxRetries(0)}, wantSent: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503, 200)
+			var doer RetryableDoer = NewRetryableClient(fastBackoff)
+
+			resp, err := doer.Do(context.Background(), mustNewRequest(t, srv.URL), tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if srv.count() != tt.wantSent {
+				t.Errorf("%d requests sent, want %d", srv.count(), tt.wantSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DownloadOptions configures DownloadFile. Every field is optional.
+type DownloadOptions struct {
+	// SHA256 is the expected hex SHA-256 of the file.
+	SHA256 string
+	// ChecksumHeader names a response header holding the expected SHA-256,
+	// in hex or base64, e.g. "X-Checksum-Sha256", or "Content-Digest" or
+	// "Digest" with a sha-256 entry. It is ignored when SHA256 is set.
+	ChecksumHeader string
+	// Progress is called after every write with the bytes written so far and
+	// the total size, -1 when unknown.
+	Progress func(written, total int64)
+}
+
+// ChecksumError reports a downloaded file or a response body whose checksum
+// does not match the expected one. Both are hex encoded.
+type ChecksumError struct {
+	// Algorithm is "md5", "sha256" or "sha512", sha256 if empty.
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *ChecksumError) Error() string {
+	algorithm := e.Algorithm
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+
+	return fmt.Sprintf("rhttp: checksum mismatch: expected %s %s, got %s", algorithm, e.Expected, e.Actual)
+}
+
+// DownloadFile downloads url to path, resuming interrupted transfers like
+// GetResumable. The file is written to a temporary file next to path and
+// renamed once complete and verified, so path never holds a partial or
+// corrupt download.
+func (c *RetryableClient) DownloadFile(ctx context.Context, url, path string, opts DownloadOptions) error {
+	body, err := c.GetResumable(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	expected := strings.ToLower(opts.SHA256)
+	if expected == "" && opts.ChecksumHeader != "" {
+		if expected, err = headerChecksum(body.Response.Header.Get(opts.ChecksumHeader)); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	sum := sha256.New()
+	w := &progressWriter{w: io.MultiWriter(tmp, sum), total: body.Response.ContentLength, progress: opts.Progress}
+	if _, err := io.Copy(w, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Temporary files are private, give the download the usual permissions
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := verifyChecksum(expected, sum); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func verifyChecksum(expected string, sum hash.Hash) error {
+	if expected == "" {
+		return nil
+	}
+	if actual := hex.EncodeToString(sum.Sum(nil)); actual != expected {
+		return &ChecksumError{Expected: expected, Actual: actual}
+	}
+
+	return nil
+}
+
+// headerChecksum returns the hex SHA-256 held by a checksum header value.
+// Digest style values list several algorithms, the sha-256 one is used.
+func headerChecksum(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	if strings.Contains(strings.TrimRight(value, "=:"), "=") {
+		// Content-Digest: sha-256=:base64:, Digest: SHA-256=base64
+		found := false
+		for _, part := range strings.Split(value, ",") {
+			kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(kv[0], "sha-256") {
+				value, found = strings.Trim(kv[1], ":"), true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("rhttp: no sha-256 checksum in %q", value)
+		}
+	}
+
+	if b, err := hex.DecodeString(value); err == nil && len(b) == sha256.Size {
+		return strings.ToLower(value), nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(value); err == nil && len(b) == sha256.Size {
+		return hex.EncodeToString(b), nil
+	}
+
+	return "", fmt.Errorf("rhttp: malformed sha-256 checksum %q", value)
+}
+
+// progressWriter reports the bytes written through it.
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress func(written, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if p.progress != nil {
+		p.progress(p.written, p.total)
+	}
+
+	return n, err
+}
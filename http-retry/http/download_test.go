@@ -0,0 +1,147 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadFile(t *testing.T) {
+	const content = "the downloaded file"
+	sum := sha256.Sum256([]byte(content))
+	hexSum, b64Sum := hex.EncodeToString(sum[:]), base64.StdEncoding.EncodeToString(sum[:])
+	tests := []struct {
+		name    string
+		header  map[string]string
+		opts    DownloadOptions
+		wantErr func(error) bool
+	}{
+		{name: "no checksum"},
+		{name: "expected checksum", opts: DownloadOptions{SHA256: hexSum}},
+		{name: "expected checksum in upper case", opts: DownloadOptions{SHA256: strings.ToUpper(hexSum)}},
+		{
+			name:    "wrong checksum",
+			opts:    DownloadOptions{SHA256: hex.EncodeToString(make([]byte, 32))},
+			wantErr: func(err error) bool { var e *ChecksumError; return errors.As(err, &e) && e.Actual == hexSum },
+		},
+		{
+			name:   "hex checksum header",
+			header: map[string]string{"X-Checksum-Sha256": hexSum},
+			opts:   DownloadOptions{ChecksumHeader: "X-Checksum-Sha256"},
+		},
+		{
+			name:   "Content-Digest",
+			header: map[string]string{"Content-Digest": "sha-512=:abc=:, sha-256=:" + b64Sum + ":"},
+			opts:   DownloadOptions{ChecksumHeader: "Content-Digest"},
+		},
+		{
+			name:   "Digest",
+			header: map[string]string{"Digest": "SHA-256=" + b64Sum},
+			opts:   DownloadOptions{ChecksumHeader: "Digest"},
+		},
+		{
+			name:    "wrong checksum header",
+			header:  map[string]string{"X-Checksum-Sha256": hex.EncodeToString(make([]byte, 32))},
+			opts:    DownloadOptions{ChecksumHeader: "X-Checksum-Sha256"},
+			wantErr: func(err error) bool { var e *ChecksumError; return errors.As(err, &e) },
+		},
+		{
+			name:    "no sha-256 in the digest",
+			header:  map[string]string{"Digest": "MD5=abc="},
+			opts:    DownloadOptions{ChecksumHeader: "Digest"},
+			wantErr: func(err error) bool { return err != nil },
+		},
+		{
+			name:    "malformed checksum header",
+			header:  map[string]string{"X-Checksum-Sha256": "not a checksum"},
+			opts:    DownloadOptions{ChecksumHeader: "X-Checksum-Sha256"},
+			wantErr: func(err error) bool { return err != nil },
+		},
+		{name: "missing checksum header", opts: DownloadOptions{ChecksumHeader: "X-Checksum-Sha256"}},
+		{name: "SHA256 wins over the header", header: map[string]string{"X-Checksum-Sha256": "garbage"}, opts: DownloadOptions{SHA256: hexSum, ChecksumHeader: "X-Checksum-Sha256"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				w.Write([]byte(content))
+			}))
+			defer srv.Close()
+			dir := t.TempDir()
+			path := filepath.Join(dir, "file")
+			c := NewRetryableClient()
+
+			err := c.DownloadFile(context.Background(), srv.URL, path, tt.opts)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("DownloadFile() error = %v", err)
+				}
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Error("failed download left at its path")
+				}
+			} else if err != nil {
+				t.Fatalf("DownloadFile() error = %v", err)
+			} else if b, _ := ioutil.ReadFile(path); string(b) != content {
+				t.Errorf("file holds %q", b)
+			}
+			if files, _ := ioutil.ReadDir(dir); len(files) > 1 || (len(files) == 1 && files[0].Name() != "file") {
+				t.Errorf("files left behind: %v", files)
+			}
+		})
+	}
+}
+
+func TestDownloadFileResumes(t *testing.T) {
+	srv := &rangeServer{acceptRanges: true, etag: `"v1"`, ranges: "206", cuts: 1, cutAt: 10}
+	srv.start(t)
+	sum := sha256.Sum256([]byte(resumableContent))
+	path := filepath.Join(t.TempDir(), "file")
+	var progress []int64
+	c := NewRetryableClient(fastBackoff)
+
+	err := c.DownloadFile(context.Background(), srv.URL, path, DownloadOptions{
+		SHA256:   hex.EncodeToString(sum[:]),
+		Progress: func(written, total int64) { progress = append(progress, written) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != resumableContent {
+		t.Errorf("file holds %q", b)
+	}
+	if srv.count() != 2 {
+		t.Errorf("server received %d requests, want 2", srv.count())
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != int64(len(resumableContent)) {
+		t.Errorf("progress = %v, want up to %d", progress, len(resumableContent))
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("file mode = %v, %v", info.Mode(), err)
+	}
+}
+
+func TestChecksumError(t *testing.T) {
+	tests := []struct {
+		err  *ChecksumError
+		want string
+	}{
+		{err: &ChecksumError{Expected: "aa", Actual: "bb"}, want: "rhttp: checksum mismatch: expected sha256 aa, got bb"},
+		{err: &ChecksumError{Algorithm: "md5", Expected: "aa", Actual: "bb"}, want: "rhttp: checksum mismatch: expected md5 aa, got bb"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
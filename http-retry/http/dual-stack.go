@@ -0,0 +1,234 @@
+package http
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFallbackDelay is how long a connection to the preferred address
+	// family is given before the other family is tried alongside, as
+	// net.Dialer does.
+	DefaultFallbackDelay = 300 * time.Millisecond
+	// DefaultConnectTimeout bounds the connection to each address.
+	DefaultConnectTimeout = 10 * time.Second
+)
+
+// DualStackConfig tunes how connections are made to hosts with both IPv4
+// and IPv6 addresses.
+type DualStackConfig struct {
+	// FallbackDelay is how long the preferred family is tried alone before
+	// the other one races it. Zero means DefaultFallbackDelay, a negative
+	// value tries the families one after the other.
+	FallbackDelay time.Duration
+	// PreferIPv4 tries IPv4 addresses first. By default the family of the
+	// first address the resolver returned goes first, IPv6 on most systems.
+	PreferIPv4 bool
+	// ConnectTimeout bounds the connection to each address, so a blackholed
+	// address fails fast into the next one or a retry instead of taking the
+	// whole attempt timeout. Zero means DefaultConnectTimeout.
+	ConnectTimeout time.Duration
+}
+
+// WithDualStack dials hosts resolving to both IPv4 and IPv6 addresses as
+// configured by cfg. A family that failed to connect while the other one
+// succeeded is tried second for the host's next connections, so retries
+// after an IPv6 blackhole go straight to IPv4. It applies to an
+// *http.Transport, see WithTransport.
+func WithDualStack(cfg DualStackConfig) Option {
+	return func(c *config) {
+		c.dualStack = &cfg
+	}
+}
+
+// dualStackDialer races the address families of a host, see WithDualStack.
+type dualStackDialer struct {
+	dial     dialFunc
+	resolver *net.Resolver
+	cfg      DualStackConfig
+
+	mu      sync.Mutex
+	demoted map[string]demotion
+}
+
+// demotion records that a family of a host recently lost to the other one.
+type demotion struct {
+	ipv4  bool
+	until time.Time
+}
+
+func newDualStackDialer(dial dialFunc, cfg DualStackConfig) *dualStackDialer {
+	if dial == nil {
+		dial = (&net.Dialer{KeepAlive: 30 * time.Second}).DialContext
+	}
+	if cfg.FallbackDelay == 0 {
+		cfg.FallbackDelay = DefaultFallbackDelay
+	}
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = DefaultConnectTimeout
+	}
+
+	return &dualStackDialer{
+		dial:     dial,
+		resolver: net.DefaultResolver,
+		cfg:      cfg,
+		demoted:  make(map[string]demotion),
+	}
+}
+
+func (d *dualStackDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dialOne(ctx, network, addr)
+	}
+
+	ips, err := d.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	primary, fallback := d.partition(host, network, ips)
+	if len(primary) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+	if len(fallback) == 0 || d.cfg.FallbackDelay < 0 {
+		return d.dialSerial(ctx, network, append(primary, fallback...), port)
+	}
+
+	conn, primaryWon, err := d.race(ctx, network, primary, fallback, port)
+	if err == nil && !primaryWon {
+		d.demote(host, primary[0].To4() != nil)
+	}
+
+	return conn, err
+}
+
+type dialResult struct {
+	conn    net.Conn
+	err     error
+	primary bool
+}
+
+// race dials the primary addresses, and the fallback ones too once the
+// fallback delay passes or the primary ones failed, returning the first
+// connection made.
+func (d *dualStackDialer) race(ctx context.Context, network string, primary, fallback []net.IP, port string) (net.Conn, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult)
+	start := func(ips []net.IP, isPrimary bool) {
+		conn, err := d.dialSerial(ctx, network, ips, port)
+		select {
+		case results <- dialResult{conn: conn, err: err, primary: isPrimary}:
+		case <-ctx.Done():
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+	go start(primary, true)
+
+	timer := time.NewTimer(d.cfg.FallbackDelay)
+	defer timer.Stop()
+
+	var firstErr error
+	pending, fallbackStarted := 1, false
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go start(fallback, false)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				return res.conn, res.primary, nil
+			}
+			if firstErr == nil || res.primary {
+				firstErr = res.err
+			}
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				timer.Stop()
+				go start(fallback, false)
+			}
+			if pending == 0 {
+				return nil, false, firstErr
+			}
+		}
+	}
+}
+
+// dialSerial dials ips in order, each within the connect timeout.
+func (d *dualStackDialer) dialSerial(ctx context.Context, network string, ips []net.IP, port string) (net.Conn, error) {
+	var firstErr error
+	for _, ip := range ips {
+		conn, err := d.dialOne(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, firstErr
+}
+
+func (d *dualStackDialer) dialOne(ctx context.Context, network, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.ConnectTimeout)
+	defer cancel()
+
+	return d.dial(ctx, network, addr)
+}
+
+// partition splits the addresses of host usable on network into the family
+// to try first and the other one.
+func (d *dualStackDialer) partition(host, network string, ips []net.IPAddr) (primary, fallback []net.IP) {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		switch {
+		case ip.IP.To4() != nil && network != "tcp6":
+			v4 = append(v4, ip.IP)
+		case ip.IP.To4() == nil && network != "tcp4":
+			v6 = append(v6, ip.IP)
+		}
+	}
+	if len(v4) == 0 || len(v6) == 0 {
+		return append(v4, v6...), nil
+	}
+
+	preferV4 := d.cfg.PreferIPv4 || ips[0].IP.To4() != nil
+	d.mu.Lock()
+	if dm, ok := d.demoted[host]; ok {
+		if time.Now().Before(dm.until) {
+			preferV4 = !dm.ipv4
+		} else {
+			delete(d.demoted, host)
+		}
+	}
+	d.mu.Unlock()
+
+	if preferV4 {
+		return v4, v6
+	}
+
+	return v6, v4
+}
+
+// demote makes the given family of host go second until the cooldown
+// passes.
+func (d *dualStackDialer) demote(host string, ipv4 bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.demoted[host] = demotion{ipv4: ipv4, until: time.Now().Add(endpointCooldown)}
+}
@@ -0,0 +1,218 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedDialer connects to every address at once, except those it is told
+// to refuse or to never answer.
+type scriptedDialer struct {
+	refuse    map[string]bool
+	blackhole map[string]bool
+
+	mu     sync.Mutex
+	dialed []string
+}
+
+func (d *scriptedDialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	d.dialed = append(d.dialed, addr)
+	d.mu.Unlock()
+
+	switch {
+	case d.refuse[addr]:
+		return nil, errors.New("connection refused")
+	case d.blackhole[addr]:
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	client, server := net.Pipe()
+	server.Close()
+
+	return client, nil
+}
+
+func (d *scriptedDialer) dials() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]string(nil), d.dialed...)
+}
+
+func TestDualStackPartition(t *testing.T) {
+	mixed := ipAddrs("2001:db8::1", "192.0.2.1", "2001:db8::2")
+	tests := []struct {
+		name    string
+		network string
+		ips     []net.IPAddr
+		cfg     DualStackConfig
+		// demoted is the family of the host that lost its last race.
+		demoted      *demotion
+		wantPrimary  []string
+		wantFallback []string
+	}{
+		{name: "resolver order", network: "tcp", ips: mixed, wantPrimary: []string{"2001:db8::1", "2001:db8::2"}, wantFallback: []string{"192.0.2.1"}},
+		{name: "IPv4 first from the resolver", network: "tcp", ips: ipAddrs("192.0.2.1", "2001:db8::1"), wantPrimary: []string{"192.0.2.1"}, wantFallback: []string{"2001:db8::1"}},
+		{name: "IPv4 preferred", network: "tcp", ips: mixed, cfg: DualStackConfig{PreferIPv4: true}, wantPrimary: []string{"192.0.2.1"}, wantFallback: []string{"2001:db8::1", "2001:db8::2"}},
+		{name: "single family", network: "tcp", ips: ipAddrs("192.0.2.1", "192.0.2.2"), wantPrimary: []string{"192.0.2.1", "192.0.2.2"}},
+		{name: "tcp4", network: "tcp4", ips: mixed, wantPrimary: []string{"192.0.2.1"}},
+		{name: "tcp6", network: "tcp6", ips: mixed, wantPrimary: []string{"2001:db8::1", "2001:db8::2"}},
+		{
+			name:         "IPv6 demoted",
+			network:      "tcp",
+			ips:          mixed,
+			demoted:      &demotion{ipv4: false, until: time.Now().Add(time.Hour)},
+			wantPrimary:  []string{"192.0.2.1"},
+			wantFallback: []string{"2001:db8::1", "2001:db8::2"},
+		},
+		{
+			name:         "demotion over",
+			network:      "tcp",
+			ips:          mixed,
+			demoted:      &demotion{ipv4: false, until: time.Now().Add(-time.Second)},
+			wantPrimary:  []string{"2001:db8::1", "2001:db8::2"},
+			wantFallback: []string{"192.0.2.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDualStackDialer(nil, tt.cfg)
+			if tt.demoted != nil {
+				d.demoted["svc"] = *tt.demoted
+			}
+
+			primary, fallback := d.partition("svc", tt.network, tt.ips)
+			if got := ipStrings(primary); !reflect.DeepEqual(got, tt.wantPrimary) {
+				t.Errorf("primary = %v, want %v", got, tt.wantPrimary)
+			}
+			if got := ipStrings(fallback); !reflect.DeepEqual(got, tt.wantFallback) {
+				t.Errorf("fallback = %v, want %v", got, tt.wantFallback)
+			}
+		})
+	}
+}
+
+func ipStrings(ips []net.IP) []string {
+	var s []string
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return s
+}
+
+func TestDualStackRace(t *testing.T) {
+	const v6a, v6b, v4 = "[2001:db8::1]:443", "[2001:db8::2]:443", "192.0.2.1:443"
+	primary := []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")}
+	fallback := []net.IP{net.ParseIP("192.0.2.1")}
+	tests := []struct {
+		name      string
+		cfg       DualStackConfig
+		refuse    []string
+		blackhole []string
+		// wantDial are the addresses dialed in order, wantPrimary whether the
+		// connection is to a primary address.
+		wantDial    []string
+		wantPrimary bool
+		wantErr     bool
+	}{
+		{name: "primary connects", cfg: DualStackConfig{FallbackDelay: time.Hour}, wantDial: []string{v6a}, wantPrimary: true},
+		{name: "next primary", cfg: DualStackConfig{FallbackDelay: time.Hour}, refuse: []string{v6a}, wantDial: []string{v6a, v6b}, wantPrimary: true},
+		{name: "primary refused", cfg: DualStackConfig{FallbackDelay: time.Hour}, refuse: []string{v6a, v6b}, wantDial: []string{v6a, v6b, v4}},
+		{name: "primary blackholed", cfg: DualStackConfig{FallbackDelay: 10 * time.Millisecond}, blackhole: []string{v6a, v6b}, wantDial: []string{v6a, v4}},
+		{
+			name:      "connect timeout",
+			cfg:       DualStackConfig{FallbackDelay: time.Hour, ConnectTimeout: 10 * time.Millisecond},
+			blackhole: []string{v6a},
+			refuse:    []string{v6b},
+			wantDial:  []string{v6a, v6b, v4},
+		},
+		{name: "both refused", cfg: DualStackConfig{FallbackDelay: time.Hour}, refuse: []string{v6a, v6b, v4}, wantDial: []string{v6a, v6b, v4}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer := &scriptedDialer{refuse: make(map[string]bool), blackhole: make(map[string]bool)}
+			for _, addr := range tt.refuse {
+				dialer.refuse[addr] = true
+			}
+			for _, addr := range tt.blackhole {
+				dialer.blackhole[addr] = true
+			}
+			d := newDualStackDialer(dialer.dial, tt.cfg)
+
+			conn, primaryWon, err := d.race(context.Background(), "tcp", primary, fallback, "443")
+			if tt.wantErr {
+				if err == nil || err.Error() != "connection refused" {
+					t.Errorf("race() error = %v, want the primary's", err)
+				}
+			} else if err != nil || primaryWon != tt.wantPrimary {
+				t.Errorf("race() = %v, %v, want primary: %v", primaryWon, err, tt.wantPrimary)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+			if got := dialer.dials(); !reflect.DeepEqual(got, tt.wantDial) {
+				t.Errorf("dialed %v, want %v", got, tt.wantDial)
+			}
+		})
+	}
+}
+
+func TestDualStackDialContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		network  string
+		addr     string
+		wantDial []string
+	}{
+		{name: "IP address dialed as it is", network: "tcp", addr: "[2001:db8::1]:80", wantDial: []string{"[2001:db8::1]:80"}},
+		{name: "no port", network: "tcp", addr: "127.0.0.1", wantDial: []string{"127.0.0.1"}},
+		{name: "single family", network: "tcp4", addr: "localhost:80", wantDial: []string{"127.0.0.1:80"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer := &scriptedDialer{}
+			d := newDualStackDialer(dialer.dial, DualStackConfig{})
+
+			conn, err := d.DialContext(context.Background(), tt.network, tt.addr)
+			if err != nil {
+				t.Fatalf("DialContext() error = %v", err)
+			}
+			conn.Close()
+			if got := dialer.dials(); !reflect.DeepEqual(got, tt.wantDial) {
+				t.Errorf("dialed %v, want %v", got, tt.wantDial)
+			}
+		})
+	}
+}
+
+func TestDualStackDemote(t *testing.T) {
+	d := newDualStackDialer(nil, DualStackConfig{})
+	d.demote("svc", false)
+
+	primary, _ := d.partition("svc", "tcp", ipAddrs("2001:db8::1", "192.0.2.1"))
+	if got := ipStrings(primary); !reflect.DeepEqual(got, []string{"192.0.2.1"}) {
+		t.Errorf("primary = %v after IPv6 lost, want IPv4", got)
+	}
+	if until := d.demoted["svc"].until; time.Until(until) <= endpointCooldown-time.Second {
+		t.Errorf("demoted until %v, want for the endpoint cooldown", until)
+	}
+}
+
+func TestWithDualStack(t *testing.T) {
+	cfg := newConfig(WithDualStack(DualStackConfig{PreferIPv4: true}))
+	if cfg.dualStack == nil || !cfg.dualStack.PreferIPv4 {
+		t.Errorf("dual stack config = %+v", cfg.dualStack)
+	}
+	if d := newDualStackDialer(nil, DualStackConfig{}); d.cfg.FallbackDelay != DefaultFallbackDelay || d.cfg.ConnectTimeout != DefaultConnectTimeout {
+		t.Errorf("defaults = %+v", d.cfg)
+	}
+	if d := newDualStackDialer(nil, DualStackConfig{FallbackDelay: -1}); d.cfg.FallbackDelay >= 0 {
+		t.Error("negative fallback delay not kept")
+	}
+}
@@ -0,0 +1,134 @@
+package http
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// EndpointSelection controls which of the resolved addresses of a host new
+// connections are made to.
+type EndpointSelection int
+
+const (
+	// EndpointInOrder dials the addresses in the order the resolver returned
+	// them, as net.Dialer does, so every new connection tries the same one
+	// first.
+	EndpointInOrder EndpointSelection = iota
+	// EndpointRotate resolves the host again for every new connection and
+	// takes turns among its addresses, trying recently failed ones last, so a
+	// retry after a connection error goes to another instance instead of the
+	// same dead one.
+	EndpointRotate
+)
+
+// endpointCooldown is how long an address that failed is tried last.
+const endpointCooldown = 30 * time.Second
+
+// WithEndpointSelection sets how new connections pick among the addresses of
+// a host. It applies to an *http.Transport, see WithTransport.
+func WithEndpointSelection(s EndpointSelection) Option {
+	return func(c *config) {
+		c.endpointSelection = s
+	}
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// rotatingDialer dials the addresses of a host in turn, see EndpointRotate.
+type rotatingDialer struct {
+	dial     dialFunc
+	resolver *net.Resolver
+
+	mu     sync.Mutex
+	next   map[string]int
+	failed map[string]time.Time
+}
+
+func newRotatingDialer(dial dialFunc) *rotatingDialer {
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+
+	return &rotatingDialer{
+		dial:     dial,
+		resolver: net.DefaultResolver,
+		next:     make(map[string]int),
+		failed:   make(map[string]time.Time),
+	}
+}
+
+func (d *rotatingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dial(ctx, network, addr)
+	}
+
+	ips, err := d.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range d.order(host, network, ips) {
+		conn, err := d.dial(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+		d.markFailed(ip)
+	}
+	if lastErr == nil {
+		lastErr = &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+
+	return nil, lastErr
+}
+
+// order returns the addresses of host usable on network, starting from the
+// next one in turn, with the recently failed ones moved to the end.
+func (d *rotatingDialer) order(host, network string, ips []net.IPAddr) []string {
+	var candidates []string
+	for _, ip := range ips {
+		if (network == "tcp4" && ip.IP.To4() == nil) || (network == "tcp6" && ip.IP.To4() != nil) {
+			continue
+		}
+		candidates = append(candidates, ip.String())
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := len(candidates)
+	if n == 0 {
+		return nil
+	}
+	start := d.next[host] % n
+	d.next[host] = start + 1
+
+	now := time.Now()
+	healthy := make([]string, 0, n)
+	var failed []string
+	for i := 0; i < n; i++ {
+		ip := candidates[(start+i)%n]
+		if until, ok := d.failed[ip]; ok && now.Before(until) {
+			failed = append(failed, ip)
+			continue
+		}
+		delete(d.failed, ip)
+		healthy = append(healthy, ip)
+	}
+
+	return append(healthy, failed...)
+}
+
+func (d *rotatingDialer) markFailed(ip string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.failed[ip] = time.Now().Add(endpointCooldown)
+}
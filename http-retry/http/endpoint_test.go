@@ -0,0 +1,124 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ipAddrs(ips ...string) []net.IPAddr {
+	addrs := make([]net.IPAddr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.IPAddr{IP: net.ParseIP(ip)}
+	}
+	return addrs
+}
+
+func TestRotatingDialerOrder(t *testing.T) {
+	three := ipAddrs("10.0.0.1", "10.0.0.2", "10.0.0.3")
+	tests := []struct {
+		name    string
+		network string
+		ips     []net.IPAddr
+		// calls is the number of orders asked for before the one checked.
+		calls  int
+		failed []string
+		want   []string
+	}{
+		{name: "first", network: "tcp", ips: three, want: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{name: "takes turns", network: "tcp", ips: three, calls: 1, want: []string{"10.0.0.2", "10.0.0.3", "10.0.0.1"}},
+		{name: "wraps around", network: "tcp", ips: three, calls: 3, want: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{
+			name:    "failed tried last",
+			network: "tcp",
+			ips:     three,
+			failed:  []string{"10.0.0.1"},
+			want:    []string{"10.0.0.2", "10.0.0.3", "10.0.0.1"},
+		},
+		{name: "IPv4 only", network: "tcp4", ips: ipAddrs("10.0.0.1", "::1"), want: []string{"10.0.0.1"}},
+		{name: "IPv6 only", network: "tcp6", ips: ipAddrs("10.0.0.1", "::1"), want: []string{"::1"}},
+		{name: "no usable address", network: "tcp6", ips: ipAddrs("10.0.0.1")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newRotatingDialer(nil)
+			for i := 0; i < tt.calls; i++ {
+				d.order("svc", tt.network, tt.ips)
+			}
+			for _, ip := range tt.failed {
+				d.markFailed(ip)
+			}
+
+			if got := d.order("svc", tt.network, tt.ips); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotatingDialerCooldownOver(t *testing.T) {
+	d := newRotatingDialer(nil)
+	d.failed["10.0.0.1"] = time.Now().Add(-time.Second)
+
+	if got := d.order("svc", "tcp", ipAddrs("10.0.0.1", "10.0.0.2")); got[0] != "10.0.0.1" {
+		t.Errorf("order() = %v, want the address back in turn once its cooldown is over", got)
+	}
+	if _, ok := d.failed["10.0.0.1"]; ok {
+		t.Error("address still marked failed")
+	}
+}
+
+func TestRotatingDialerDialContext(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	tests := []struct {
+		name string
+		addr string
+		// refuse lists the addresses the dialer fails to connect to.
+		refuse   map[string]bool
+		wantErr  bool
+		wantDial []string
+	}{
+		{name: "IP address dialed as it is", addr: "127.0.0.1:80", wantDial: []string{"127.0.0.1:80"}},
+		{name: "host resolved", addr: "localhost:80", wantDial: []string{"127.0.0.1:80"}},
+		{
+			name:     "every address failed",
+			addr:     "localhost:80",
+			refuse:   map[string]bool{"127.0.0.1:80": true},
+			wantErr:  true,
+			wantDial: []string{"127.0.0.1:80"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dialed []string
+			d := newRotatingDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialed = append(dialed, addr)
+				if tt.refuse[addr] {
+					return nil, errRefused
+				}
+				client, server := net.Pipe()
+				server.Close()
+				return client, nil
+			})
+
+			conn, err := d.DialContext(context.Background(), "tcp4", tt.addr)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("DialContext() error = %v", err)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+			if !reflect.DeepEqual(dialed, tt.wantDial) {
+				t.Errorf("dialed %v, want %v", dialed, tt.wantDial)
+			}
+			if tt.wantErr {
+				if _, ok := d.failed["127.0.0.1"]; !ok {
+					t.Error("failed address not tried last by the next connection")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// ErrorClass is a coarse classification of transport errors.
+type ErrorClass int
+
+const (
+	// ErrorClassOther is any error not covered by another class.
+	ErrorClassOther ErrorClass = iota
+	// ErrorClassConnRefused means nothing was listening on the remote port.
+	ErrorClassConnRefused
+	// ErrorClassConnReset means the connection was reset or broken by the peer.
+	ErrorClassConnReset
+	// ErrorClassDNS means the host name could not be resolved.
+	ErrorClassDNS
+	// ErrorClassTLSHandshake means the TLS handshake failed.
+	ErrorClassTLSHandshake
+	// ErrorClassTLSCertificate means a certificate was rejected, the
+	// server's or our own, see CertificateError.
+	ErrorClassTLSCertificate
+	// ErrorClassTimeout means an attempt timed out.
+	ErrorClassTimeout
+	// ErrorClassEOF means the connection was closed before a full response.
+	ErrorClassEOF
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassOther:
+		return "other"
+	case ErrorClassConnRefused:
+		return "connection refused"
+	case ErrorClassConnReset:
+		return "connection reset"
+	case ErrorClassDNS:
+		return "dns"
+	case ErrorClassTLSHandshake:
+		return "tls handshake"
+	case ErrorClassTLSCertificate:
+		return "tls certificate"
+	case ErrorClassTimeout:
+		return "timeout"
+	case ErrorClassEOF:
+		return "eof"
+	default:
+		return fmt.Sprintf("ErrorClass(%d)", int(c))
+	}
+}
+
+// ClassifyError returns the class of a transport error.
+func ClassifyError(err error) ErrorClass {
+	var (
+		dnsErr       *net.DNSError
+		recordHeader tls.RecordHeaderError
+		netErr       net.Error
+	)
+
+	switch {
+	case certificateError(err) != nil:
+		return ErrorClassTLSCertificate
+	case errors.As(err, new(*TimeoutError)):
+		return ErrorClassTimeout
+	case errors.As(err, &recordHeader), strings.Contains(err.Error(), "tls: "):
+		return ErrorClassTLSHandshake
+	case errors.As(err, &dnsErr):
+		return ErrorClassDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorClassConnRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ErrorClassConnReset
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, ErrIncompleteBody):
+		return ErrorClassEOF
+	default:
+		return ErrorClassOther
+	}
+}
+
+// defaultRetryableError retries every error class except certificate errors,
+// which no retry can fix.
+func defaultRetryableError(err error) bool {
+	return ClassifyError(err) != ErrorClassTLSCertificate
+}
+
+// RetryOnErrors retries only transport errors of the given classes, e.g.
+// RetryOnErrors(ErrorClassConnReset, ErrorClassTimeout). By default every
+// class but ErrorClassTLSCertificate is retried.
+func RetryOnErrors(classes ...ErrorClass) Option {
+	return func(c *config) {
+		p := c.statusPolicy(defaultRetryStatuses)
+		p.Errors = append(p.Errors[:0:0], classes...)
+		c.policy = p
+	}
+}
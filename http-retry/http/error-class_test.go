@@ -0,0 +1,96 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	opErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)}}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{name: "refused", err: opErr(syscall.ECONNREFUSED), want: ErrorClassConnRefused},
+		{name: "reset", err: opErr(syscall.ECONNRESET), want: ErrorClassConnReset},
+		{name: "broken pipe", err: opErr(syscall.EPIPE), want: ErrorClassConnReset},
+		{name: "dns", err: &url.Error{Op: "Get", Err: &net.DNSError{Err: "no such host", Name: "nowhere.invalid"}}, want: ErrorClassDNS},
+		{name: "record header", err: tls.RecordHeaderError{Msg: "not TLS"}, want: ErrorClassTLSHandshake},
+		{name: "handshake alert", err: errors.New("remote error: tls: handshake failure"), want: ErrorClassTLSHandshake},
+		{name: "unknown authority", err: &url.Error{Op: "Get", Err: x509.UnknownAuthorityError{}}, want: ErrorClassTLSCertificate},
+		{name: "client certificate refused", err: errors.New("remote error: tls: bad certificate"), want: ErrorClassTLSCertificate},
+		{name: "certificate error", err: &CertificateError{Err: errors.New("x")}, want: ErrorClassTLSCertificate},
+		{name: "timeout error", err: &TimeoutError{Phase: TimeoutConnect, Err: errors.New("x")}, want: ErrorClassTimeout},
+		{name: "deadline", err: fmt.Errorf("attempt: %w", context.DeadlineExceeded), want: ErrorClassTimeout},
+		{name: "net timeout", err: &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, want: ErrorClassTimeout},
+		{name: "eof", err: &url.Error{Op: "Get", Err: io.EOF}, want: ErrorClassEOF},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, want: ErrorClassEOF},
+		{name: "incomplete body", err: fmt.Errorf("read: %w", ErrIncompleteBody), want: ErrorClassEOF},
+		{name: "other", err: errors.New("boom"), want: ErrorClassOther},
+		{name: "cancelled", err: context.Canceled, want: ErrorClassOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorClassString(t *testing.T) {
+	tests := []struct {
+		class ErrorClass
+		want  string
+	}{
+		{ErrorClassOther, "other"},
+		{ErrorClassConnRefused, "connection refused"},
+		{ErrorClassTLSCertificate, "tls certificate"},
+		{ErrorClassEOF, "eof"},
+		{ErrorClass(42), "ErrorClass(42)"},
+	}
+	for _, tt := range tests {
+		if got := tt.class.String(); got != tt.want {
+			t.Errorf("ErrorClass(%d).String() = %q, want %q", int(tt.class), got, tt.want)
+		}
+	}
+}
+
+func TestRetryOnErrors(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	reset := &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	tests := []struct {
+		name string
+		opts []Option
+		err  error
+		resp *http.Response
+		want bool
+	}{
+		{name: "default retries refused", err: refused, want: true},
+		{name: "listed class", opts: []Option{RetryOnErrors(ErrorClassConnRefused)}, err: refused, want: true},
+		{name: "unlisted class", opts: []Option{RetryOnErrors(ErrorClassConnRefused)}, err: reset},
+		{name: "statuses kept", opts: []Option{RetryOnErrors(ErrorClassConnRefused)}, resp: &http.Response{StatusCode: 503}, want: true},
+		{name: "status options kept", opts: []Option{RetryOn(500), RetryOnErrors(ErrorClassConnReset)}, resp: &http.Response{StatusCode: 500}, want: true},
+		{name: "replaced by a later call", opts: []Option{RetryOnErrors(ErrorClassConnRefused), RetryOnErrors(ErrorClassConnReset)}, err: refused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newConfig(tt.opts...).policy.ShouldRetry(tt.resp, tt.err, 1); got != tt.want {
+				t.Errorf("ShouldRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrMaxRetriesExceeded is returned when every allowed attempt failed.
+	ErrMaxRetriesExceeded = errors.New("rhttp: max retries exceeded")
+	// ErrMaxElapsedTimeExceeded is returned when another retry would run past
+	// the MaxElapsedTime budget.
+	ErrMaxElapsedTimeExceeded = errors.New("rhttp: max elapsed time exceeded")
+	// ErrCircuitOpen is returned without sending the request when the circuit
+	// breaker for its host is open.
+	ErrCircuitOpen = errors.New("rhttp: circuit breaker is open")
+	// ErrRetryThrottled is returned when the client's retry budget is
+	// exhausted, see WithRetryThrottle.
+	ErrRetryThrottled = errors.New("rhttp: retry budget exhausted")
+	// ErrNonRetryableStatus matches a *StatusError whose status the retry
+	// policy does not retry, e.g. a 404, as opposed to a 503 returned with
+	// retries disabled.
+	ErrNonRetryableStatus = errors.New("rhttp: non-retryable status")
+)
+
+// Attempt records the outcome of a single attempt of a request.
+type Attempt struct {
+	Start      time.Time
+	Duration   time.Duration
+	StatusCode int
+	Err        error
+	// Backoff is the wait applied before the next attempt, zero for the last one.
+	Backoff time.Duration
+	// Timings are only recorded with WithNetworkTimings.
+	Timings AttemptTimings
+}
+
+func newAttemptRecord(start, end time.Time, resp *http.Response, err error) Attempt {
+	a := Attempt{Start: start, Duration: end.Sub(start), Err: err}
+	if resp != nil {
+		a.StatusCode = resp.StatusCode
+	}
+
+	return a
+}
+
+// RetryError is returned when the client gives up on a request. Reason is
+// ErrMaxRetriesExceeded, ErrMaxElapsedTimeExceeded, ErrRetryThrottled or
+// ErrDeadlineWouldExceed, and Attempts holds the history of every attempt
+// made.
+type RetryError struct {
+	Reason   error
+	Attempts []Attempt
+}
+
+// Last returns the final attempt.
+func (e *RetryError) Last() Attempt {
+	if len(e.Attempts) == 0 {
+		return Attempt{}
+	}
+
+	return e.Attempts[len(e.Attempts)-1]
+}
+
+func (e *RetryError) Error() string {
+	msg := fmt.Sprintf("%v after %d attempts", e.Reason, len(e.Attempts))
+	if len(e.Attempts) == 1 {
+		msg = fmt.Sprintf("%v after 1 attempt", e.Reason)
+	}
+	if last := e.Last(); last.Err != nil {
+		return fmt.Sprintf("%s: %v", msg, last.Err)
+	}
+
+	return fmt.Sprintf("%s: last status %d", msg, e.Last().StatusCode)
+}
+
+// Is matches both the give-up reason and the last attempt's error.
+func (e *RetryError) Is(target error) bool {
+	if target == e.Reason {
+		return true
+	}
+	last := e.Last()
+
+	return last.Err != nil && errors.Is(last.Err, target)
+}
+
+// As lets errors.As reach the last attempt's error, e.g. a *net.DNSError, or
+// a *StatusError with the last attempt's status if it got a response.
+func (e *RetryError) As(target interface{}) bool {
+	last := e.Last()
+	if last.Err != nil {
+		return errors.As(last.Err, target)
+	}
+
+	// The response itself was released, only its status remains
+	if se, ok := target.(**StatusError); ok && last.StatusCode != 0 {
+		*se = &StatusError{Code: last.StatusCode, Retryable: true}
+		return true
+	}
+
+	return false
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Reason
+}
+
+// StatusError reports an unexpected response status. Body holds the start of
+// the response body. Retryable tells whether the retry policy would retry the
+// status, otherwise the error matches ErrNonRetryableStatus.
+type StatusError struct {
+	Code      int
+	Header    http.Header
+	Body      []byte
+	Retryable bool
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrNonRetryableStatus && !e.Retryable
+}
+
+func (e *StatusError) Error() string {
+	if len(e.Body) == 0 {
+		return fmt.Sprintf("rhttp: unexpected status %d %s", e.Code, http.StatusText(e.Code))
+	}
+
+	return fmt.Sprintf("rhttp: unexpected status %d %s: %s", e.Code, http.StatusText(e.Code), e.Body)
+}
+
+// permanentError marks an error that must not be retried, whatever the retry
+// policy says.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func isPermanent(err error) bool {
+	if err == nil {
+		return false
+	}
+	var p *permanentError
+	return errors.As(err, &p)
+}
@@ -0,0 +1,160 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRetryErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *RetryError
+		want string
+	}{
+		{
+			name: "last error",
+			err:  &RetryError{Reason: ErrMaxRetriesExceeded, Attempts: []Attempt{{StatusCode: 503}, {Err: io.EOF}}},
+			want: "rhttp: max retries exceeded after 2 attempts: EOF",
+		},
+		{
+			name: "last status",
+			err:  &RetryError{Reason: ErrMaxRetriesExceeded, Attempts: []Attempt{{StatusCode: 503}, {StatusCode: 502}}},
+			want: "rhttp: max retries exceeded after 2 attempts: last status 502",
+		},
+		{
+			name: "single attempt",
+			err:  &RetryError{Reason: ErrRetryThrottled, Attempts: []Attempt{{StatusCode: 503}}},
+			want: "rhttp: retry budget exhausted after 1 attempt: last status 503",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryErrorMatching(t *testing.T) {
+	dnsErr := &net.DNSError{Err: "no such host", Name: "nowhere.invalid"}
+	byError := &RetryError{Reason: ErrMaxRetriesExceeded, Attempts: []Attempt{{Err: dnsErr}}}
+	byStatus := &RetryError{Reason: ErrMaxElapsedTimeExceeded, Attempts: []Attempt{{StatusCode: 503}}}
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{name: "reason", err: byError, target: ErrMaxRetriesExceeded, want: true},
+		{name: "other reason", err: byError, target: ErrMaxElapsedTimeExceeded},
+		{name: "last error", err: byError, target: dnsErr, want: true},
+		{name: "status, not an error", err: byStatus, target: io.EOF},
+		{name: "retryable status", err: byStatus, target: ErrNonRetryableStatus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", tt.err, tt.target, got, tt.want)
+			}
+		})
+	}
+
+	var gotDNS *net.DNSError
+	if !errors.As(byError, &gotDNS) || gotDNS != dnsErr {
+		t.Error("errors.As did not reach the last attempt's error")
+	}
+	var statusErr *StatusError
+	if !errors.As(byStatus, &statusErr) || statusErr.Code != 503 || !statusErr.Retryable {
+		t.Errorf("errors.As(*StatusError) = %+v, want a retryable 503", statusErr)
+	}
+	if errors.As(&RetryError{Reason: ErrMaxRetriesExceeded}, &statusErr) {
+		t.Error("errors.As found a status without any attempt")
+	}
+	if (&RetryError{}).Last() != (Attempt{}) {
+		t.Error("Last() of no attempts is not the zero Attempt")
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          *StatusError
+		want         string
+		nonRetryable bool
+	}{
+		{name: "no body", err: &StatusError{Code: 404}, want: "rhttp: unexpected status 404 Not Found", nonRetryable: true},
+		{name: "body", err: &StatusError{Code: 400, Body: []byte("bad field")}, want: "rhttp: unexpected status 400 Bad Request: bad field", nonRetryable: true},
+		{name: "retryable", err: &StatusError{Code: 503, Retryable: true}, want: "rhttp: unexpected status 503 Service Unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+			if got := errors.Is(tt.err, ErrNonRetryableStatus); got != tt.nonRetryable {
+				t.Errorf("errors.Is(ErrNonRetryableStatus) = %v, want %v", got, tt.nonRetryable)
+			}
+		})
+	}
+}
+
+func TestGiveUpError(t *testing.T) {
+	srv := newScriptServer(t, 503)
+	c := NewRetryableClient(fastBackoff, WithMaxRetries(2), WithMaxRetryAfter(0))
+
+	_, _, err := c.GetBytes(context.Background(), srv.URL)
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("GetBytes() error = %v, want a *RetryError", err)
+	}
+	if len(retryErr.Attempts) != 3 || retryErr.Last().StatusCode != 503 || retryErr.Last().Backoff != 0 {
+		t.Errorf("attempts = %+v, want 3 ending with a 503 and no backoff", retryErr.Attempts)
+	}
+	for _, a := range retryErr.Attempts[:2] {
+		if a.Backoff <= 0 {
+			t.Errorf("attempt %+v has no backoff before the next one", a)
+		}
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	if isPermanent(nil) || isPermanent(io.EOF) {
+		t.Error("a plain error is permanent")
+	}
+	if err := (&permanentError{io.EOF}); !isPermanent(err) || !errors.Is(err, io.EOF) || err.Error() != "EOF" {
+		t.Error("a permanent error is not permanent or hides its cause")
+	}
+}
+
+func TestMaxElapsedTime(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []Option
+		want         error
+		wantAttempts int
+	}{
+		{name: "budget exhausted", opts: []Option{WithBackoff(ConstantBackoff(time.Hour)), WithMaxElapsedTime(50 * time.Millisecond)}, want: ErrMaxElapsedTimeExceeded, wantAttempts: 1},
+		{name: "attempts exhausted", opts: []Option{WithBackoff(ConstantBackoff(time.Millisecond)), WithMaxElapsedTime(time.Minute)}, want: ErrMaxRetriesExceeded, wantAttempts: RetryCount + 1},
+		{name: "no budget", opts: []Option{WithBackoff(ConstantBackoff(time.Millisecond))}, want: ErrMaxRetriesExceeded, wantAttempts: RetryCount + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503)
+			c := NewRetryableClient(tt.opts...)
+
+			_, err := c.GetContext(context.Background(), srv.URL)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("GetContext() error = %v, want %v", err, tt.want)
+			}
+			if srv.count() != tt.wantAttempts {
+				t.Errorf("server received %d requests, want %d", srv.count(), tt.wantAttempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package http
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+var (
+	expvarMu      sync.Mutex
+	expvarMetrics = make(map[string]*ExpvarMetrics)
+)
+
+// ExpvarMetrics is a MetricsRecorder publishing the client's counters with
+// the expvar package, so they show up on /debug/vars without running
+// Prometheus. Under its namespace it publishes attempts, retries and
+// give_ups counted by host, circuits with the state of every host's circuit,
+// and open_circuits, the number of open ones.
+type ExpvarMetrics struct {
+	attempts *expvar.Map
+	retries  *expvar.Map
+	giveUps  *expvar.Map
+	circuits *expvar.Map
+
+	mu     sync.Mutex
+	states map[string]CircuitState
+}
+
+// NewExpvarMetrics returns the recorder publishing under namespace. expvar
+// names are global, so every call with the same namespace returns the same
+// recorder, shared by the clients using it. Like expvar.Publish, it panics if
+// namespace is already used by another variable.
+func NewExpvarMetrics(namespace string) *ExpvarMetrics {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	if m, ok := expvarMetrics[namespace]; ok {
+		return m
+	}
+
+	m := &ExpvarMetrics{
+		attempts: new(expvar.Map).Init(),
+		retries:  new(expvar.Map).Init(),
+		giveUps:  new(expvar.Map).Init(),
+		circuits: new(expvar.Map).Init(),
+		states:   make(map[string]CircuitState),
+	}
+	vars := expvar.NewMap(namespace)
+	vars.Set("attempts", m.attempts)
+	vars.Set("retries", m.retries)
+	vars.Set("give_ups", m.giveUps)
+	vars.Set("circuits", m.circuits)
+	vars.Set("open_circuits", expvar.Func(func() interface{} { return m.openCircuits() }))
+	expvarMetrics[namespace] = m
+
+	return m
+}
+
+// WithExpvar publishes the client's counters under namespace with expvar, see
+// ExpvarMetrics, in addition to any MetricsRecorder set before it.
+func WithExpvar(namespace string) Option {
+	return func(c *config) {
+		m := NewExpvarMetrics(namespace)
+		if _, ok := c.metrics.(nopMetrics); ok {
+			c.metrics = m
+			return
+		}
+		c.metrics = multiMetrics{c.metrics, m}
+	}
+}
+
+func (m *ExpvarMetrics) Attempt(labels MetricLabels) {
+	m.attempts.Add(labels.Host, 1)
+}
+
+func (m *ExpvarMetrics) Retry(labels MetricLabels) {
+	m.retries.Add(labels.Host, 1)
+}
+
+func (m *ExpvarMetrics) RequestDuration(MetricLabels, time.Duration) {}
+
+func (m *ExpvarMetrics) GiveUp(labels MetricLabels) {
+	m.giveUps.Add(labels.Host, 1)
+}
+
+func (m *ExpvarMetrics) CircuitState(host string, state CircuitState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if prev, ok := m.states[host]; ok && prev == state {
+		return
+	}
+	m.states[host] = state
+	s := new(expvar.String)
+	s.Set(state.String())
+	m.circuits.Set(host, s)
+}
+
+func (m *ExpvarMetrics) openCircuits() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, state := range m.states {
+		if state == CircuitOpen {
+			n++
+		}
+	}
+
+	return n
+}
+
+// multiMetrics reports to several recorders.
+type multiMetrics []MetricsRecorder
+
+func (l multiMetrics) Attempt(labels MetricLabels) {
+	for _, r := range l {
+		r.Attempt(labels)
+	}
+}
+
+func (l multiMetrics) Retry(labels MetricLabels) {
+	for _, r := range l {
+		r.Retry(labels)
+	}
+}
+
+func (l multiMetrics) RequestDuration(labels MetricLabels, d time.Duration) {
+	for _, r := range l {
+		r.RequestDuration(labels, d)
+	}
+}
+
+func (l multiMetrics) GiveUp(labels MetricLabels) {
+	for _, r := range l {
+		r.GiveUp(labels)
+	}
+}
+
+func (l multiMetrics) CircuitState(host string, state CircuitState) {
+	for _, r := range l {
+		r.CircuitState(host, state)
+	}
+}
@@ -0,0 +1,108 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"testing"
+)
+
+// expvarValue returns what namespace publishes, decoded from its JSON.
+func expvarValue(t *testing.T, namespace string) map[string]interface{} {
+	t.Helper()
+	v := expvar.Get(namespace)
+	if v == nil {
+		t.Fatalf("nothing published under %s", namespace)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(v.String()), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	return got
+}
+
+func TestWithExpvar(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		statuses  []int
+		opts      []Option
+		// want counts attempts, retries and give-ups of the server's host.
+		want [3]float64
+	}{
+		{name: "delivered", namespace: "test_expvar_delivered", statuses: []int{200}, want: [3]float64{1, 0, 0}},
+		{name: "retried", namespace: "test_expvar_retried", statuses: []int{503, 503, 200}, want: [3]float64{3, 2, 0}},
+		{name: "given up", namespace: "test_expvar_given_up", statuses: []int{503}, opts: []Option{WithMaxRetries(1)}, want: [3]float64{2, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			host := mustParseURL(t, srv.URL).Host
+			c := NewRetryableClient(append([]Option{fastBackoff, WithExpvar(tt.namespace)}, tt.opts...)...)
+
+			if resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL)); err == nil {
+				drainBody(resp)
+			}
+
+			vars := expvarValue(t, tt.namespace)
+			var got [3]float64
+			for i, name := range []string{"attempts", "retries", "give_ups"} {
+				counts, _ := vars[name].(map[string]interface{})
+				got[i], _ = counts[host].(float64)
+			}
+			if got != tt.want {
+				t.Errorf("attempts, retries, give-ups = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithExpvarKeepsMetrics(t *testing.T) {
+	srv := newScriptServer(t, 200)
+	m := newCountingMetrics()
+	c := NewRetryableClient(WithMetrics(m), WithExpvar("test_expvar_kept"))
+
+	resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainBody(resp)
+	if m.counts["attempt GET 2xx"] != 1 {
+		t.Errorf("metrics = %v, want the attempt counted", m.counts)
+	}
+	counts, _ := expvarValue(t, "test_expvar_kept")["attempts"].(map[string]interface{})
+	if counts[mustParseURL(t, srv.URL).Host] != float64(1) {
+		t.Errorf("expvar attempts = %v, want the attempt counted", counts)
+	}
+}
+
+func TestExpvarMetricsCircuits(t *testing.T) {
+	m := NewExpvarMetrics("test_expvar_circuits")
+	if NewExpvarMetrics("test_expvar_circuits") != m {
+		t.Error("a second recorder for the namespace")
+	}
+	// The recorder outlives the test, the circuits end closed so that it
+	// runs again with -count
+	tests := []struct {
+		host     string
+		state    CircuitState
+		wantOpen float64
+	}{
+		{host: "a", state: CircuitOpen, wantOpen: 1},
+		{host: "b", state: CircuitOpen, wantOpen: 2},
+		{host: "a", state: CircuitHalfOpen, wantOpen: 1},
+		{host: "b", state: CircuitClosed, wantOpen: 0},
+		{host: "b", state: CircuitClosed, wantOpen: 0},
+		{host: "a", state: CircuitClosed, wantOpen: 0},
+	}
+	for _, tt := range tests {
+		m.CircuitState(tt.host, tt.state)
+
+		vars := expvarValue(t, "test_expvar_circuits")
+		circuits, _ := vars["circuits"].(map[string]interface{})
+		if circuits[tt.host] != tt.state.String() || vars["open_circuits"] != tt.wantOpen {
+			t.Errorf("after %s %v: circuits = %v, %v open, want %v open", tt.host, tt.state, circuits, vars["open_circuits"], tt.wantOpen)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// failover is a Picker sending requests to the next of several equivalent
+// base URLs once the current one keeps failing.
+type failover struct {
+	endpoints []*url.URL
+	threshold int
+
+	mu       sync.Mutex
+	current  int
+	failures int
+}
+
+// WithFailover sends requests to the next endpoint after threshold failed
+// attempts in a row against the current one, wrapping around after the last.
+// endpoints are base URLs, the primary first, e.g.
+// WithFailover(2, "https://api.example.com", "https://api-standby.example.com").
+// Requests under any of the endpoints are sent to the current one, keeping
+// the rest of their URL, and other requests are left alone. The current
+// endpoint is shared by all requests of the client, so once the primary is
+// down later requests go straight to the standby. Invalid endpoints are
+// ignored. It replaces any Picker set with WithPicker.
+func WithFailover(threshold int, endpoints ...string) Option {
+	f := &failover{threshold: threshold}
+	if f.threshold < 1 {
+		f.threshold = 1
+	}
+	for _, e := range endpoints {
+		u, err := url.Parse(e)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		f.endpoints = append(f.endpoints, u)
+	}
+
+	return WithPicker(f)
+}
+
+// index returns the endpoint u is under, or -1.
+func (f *failover) index(u *url.URL) int {
+	for i, e := range f.endpoints {
+		if strings.EqualFold(e.Scheme, u.Scheme) && strings.EqualFold(e.Host, u.Host) &&
+			(u.Path == e.Path || strings.HasPrefix(u.Path, e.Path+"/")) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (f *failover) Pick(req *http.Request) (*url.URL, error) {
+	from := f.index(req.URL)
+	if from < 0 {
+		return req.URL, nil
+	}
+
+	f.mu.Lock()
+	to := f.current
+	f.mu.Unlock()
+	if from == to {
+		return req.URL, nil
+	}
+
+	target := *req.URL
+	src, dst := f.endpoints[from], f.endpoints[to]
+	target.Scheme = dst.Scheme
+	target.Host = dst.Host
+	target.Path = dst.Path + strings.TrimPrefix(req.URL.Path, src.Path)
+	target.RawPath = ""
+
+	return &target, nil
+}
+
+// ObserveHealth fails over from an unhealthy current endpoint, and back to an
+// endpoint before the current one, such as the primary, once it is healthy.
+func (f *failover) ObserveHealth(u *url.URL, healthy bool) {
+	i := f.index(u)
+	if i < 0 {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case healthy && i < f.current:
+		f.current = i
+		f.failures = 0
+	case !healthy && i == f.current:
+		f.current = (f.current + 1) % len(f.endpoints)
+		f.failures = 0
+	}
+}
+
+// Mark counts the failures of the current endpoint, moving on to the next
+// one once the threshold is reached.
+func (f *failover) Mark(u *url.URL, success bool) {
+	i := f.index(u)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if i != f.current {
+		return
+	}
+	if success {
+		f.failures = 0
+		return
+	}
+
+	f.failures++
+	if f.failures >= f.threshold {
+		f.current = (f.current + 1) % len(f.endpoints)
+		f.failures = 0
+	}
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// failoverOf returns the failover picker set by WithFailover.
+func failoverOf(threshold int, endpoints ...string) *failover {
+	return newConfig(WithFailover(threshold, endpoints...)).picker.(*failover)
+}
+
+func TestFailoverPick(t *testing.T) {
+	tests := []struct {
+		name    string
+		current int
+		url     string
+		want    string
+	}{
+		{name: "current endpoint", url: "https://primary.example.com/v1/items?page=2", want: "https://primary.example.com/v1/items?page=2"},
+		{name: "failed over", current: 1, url: "https://primary.example.com/v1/items?page=2", want: "http://standby.example.com:8080/api/v1/items?page=2"},
+		{name: "back from the standby", url: "http://standby.example.com:8080/api/v1/items", want: "https://primary.example.com/v1/items"},
+		{name: "endpoint root", current: 1, url: "https://primary.example.com", want: "http://standby.example.com:8080/api"},
+		{name: "other host", current: 1, url: "https://other.example.com/v1", want: "https://other.example.com/v1"},
+		{name: "outside the base path", url: "http://standby.example.com:8080/apiv2", want: "http://standby.example.com:8080/apiv2"},
+		{name: "host case", current: 1, url: "https://PRIMARY.example.com/v1", want: "http://standby.example.com:8080/api/v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := failoverOf(1, "https://primary.example.com", "http://standby.example.com:8080/api/", "::invalid")
+			f.current = tt.current
+
+			got, err := f.Pick(mustNewRequest(t, tt.url))
+			if err != nil || got.String() != tt.want {
+				t.Errorf("Pick() = %v, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailoverMark(t *testing.T) {
+	const primary, standby = "https://primary.example.com/", "https://standby.example.com/"
+	type mark struct {
+		url     string
+		success bool
+	}
+	tests := []struct {
+		name      string
+		threshold int
+		marks     []mark
+		want      int
+	}{
+		{name: "below the threshold", threshold: 2, marks: []mark{{primary, false}}, want: 0},
+		{name: "threshold reached", threshold: 2, marks: []mark{{primary, false}, {primary, false}}, want: 1},
+		{name: "success resets the count", threshold: 2, marks: []mark{{primary, false}, {primary, true}, {primary, false}}, want: 0},
+		{name: "threshold of at least one", threshold: 0, marks: []mark{{primary, false}}, want: 1},
+		{name: "wraps around", threshold: 1, marks: []mark{{primary, false}, {standby, false}}, want: 0},
+		{name: "failures of another endpoint ignored", threshold: 1, marks: []mark{{standby, false}}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := failoverOf(tt.threshold, primary, standby)
+			for _, m := range tt.marks {
+				f.Mark(mustParseURL(t, m.url), m.success)
+			}
+			if f.current != tt.want {
+				t.Errorf("current endpoint = %d, want %d", f.current, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailoverObserveHealth(t *testing.T) {
+	const primary, standby = "https://primary.example.com/", "https://standby.example.com/"
+	f := failoverOf(5, primary, standby)
+
+	f.ObserveHealth(mustParseURL(t, standby), false)
+	if f.current != 0 {
+		t.Fatal("failed over because an endpoint not in use was unhealthy")
+	}
+	f.ObserveHealth(mustParseURL(t, primary), false)
+	if f.current != 1 {
+		t.Fatal("did not fail over from an unhealthy endpoint")
+	}
+	f.ObserveHealth(mustParseURL(t, primary), true)
+	if f.current != 0 {
+		t.Error("did not go back to the primary once healthy")
+	}
+}
+
+func TestWithFailover(t *testing.T) {
+	primary := newScriptServer(t, 503)
+	standby := newScriptServer(t, 200)
+	c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0), WithFailover(2, primary.URL, standby.URL))
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.Do(context.Background(), mustNewRequest(t, primary.URL+"/items"))
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d = %v, %v", i+1, resp, err)
+		}
+		drainBody(resp)
+	}
+	// The second request went straight to the standby
+	if primary.count() != 2 || standby.count() != 2 {
+		t.Errorf("primary received %d requests and standby %d, want 2 each", primary.count(), standby.count())
+	}
+	if r, _ := standby.request(0); r.URL.Path != "/items" {
+		t.Errorf("standby received %s, want /items", r.URL.Path)
+	}
+}
@@ -0,0 +1,395 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFlightRecorderSize is how many failed requests a FlightRecorder
+	// keeps by default.
+	DefaultFlightRecorderSize = 50
+	// DefaultFlightRecorderBody is how many bytes of every body a
+	// FlightRecorder keeps by default.
+	DefaultFlightRecorderBody = 4 << 10
+)
+
+// DefaultRedactedHeaders are the headers whose values a FlightRecorder
+// replaces by "[REDACTED]" by default.
+var DefaultRedactedHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key",
+}
+
+// FlightRecorderConfig configures a FlightRecorder. Every field is optional.
+type FlightRecorderConfig struct {
+	// Size is how many failed requests are kept, the oldest being dropped,
+	// DefaultFlightRecorderSize if zero.
+	Size int
+	// MaxBodyBytes is how many bytes of every request and response body are
+	// kept, DefaultFlightRecorderBody if zero. Negative keeps no body.
+	MaxBodyBytes int
+	// Redact lists the headers whose values are replaced by "[REDACTED]",
+	// DefaultRedactedHeaders if nil.
+	Redact []string
+}
+
+// FlightRecorder keeps the exchanges of the last requests that failed, every
+// attempt with its headers and the start of its bodies, so the evidence of a
+// give-up in production is at hand without enabling debug logging. Dump it
+// with WriteHAR or WriteJSON, or serve it as HAR over HTTP. A recorder may be
+// shared between clients.
+type FlightRecorder struct {
+	size    int
+	maxBody int
+	redact  []string
+
+	mu      sync.Mutex
+	records []FlightRecord
+}
+
+// FlightRecord is a request that failed, with every attempt made.
+type FlightRecord struct {
+	Time      time.Time        `json:"time"`
+	Method    string           `json:"method"`
+	URL       string           `json:"url"`
+	Error     string           `json:"error"`
+	Exchanges []FlightExchange `json:"exchanges"`
+}
+
+// FlightExchange is one attempt of a FlightRecord. Response is nil if the
+// attempt got no response.
+type FlightExchange struct {
+	Attempt  int               `json:"attempt"`
+	Start    time.Time         `json:"start"`
+	Duration time.Duration     `json:"duration"`
+	Request  RecordedRequest   `json:"request"`
+	Response *RecordedResponse `json:"response,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// RecordedRequest is a request as sent, redacted.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Proto  string      `json:"proto"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is a response as received, redacted.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Proto      string      `json:"proto"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// NewFlightRecorder returns an empty recorder.
+func NewFlightRecorder(cfg FlightRecorderConfig) *FlightRecorder {
+	r := &FlightRecorder{size: cfg.Size, maxBody: cfg.MaxBodyBytes, redact: cfg.Redact}
+	if r.size <= 0 {
+		r.size = DefaultFlightRecorderSize
+	}
+	if r.maxBody == 0 {
+		r.maxBody = DefaultFlightRecorderBody
+	}
+	if r.redact == nil {
+		r.redact = DefaultRedactedHeaders
+	}
+
+	return r
+}
+
+// WithFlightRecorder records in r the requests that fail with an error, such
+// as a *RetryError.
+func WithFlightRecorder(r *FlightRecorder) Option {
+	return func(c *config) {
+		c.recorder = r
+	}
+}
+
+// Records returns the recorded requests, oldest first.
+func (r *FlightRecorder) Records() []FlightRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]FlightRecord(nil), r.records...)
+}
+
+// WriteJSON writes the recorded requests to w as a JSON array.
+func (r *FlightRecorder) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r.Records())
+}
+
+// ServeHTTP serves the recorded requests as a HAR file.
+func (r *FlightRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	r.WriteHAR(w)
+}
+
+func (r *FlightRecorder) add(rec FlightRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.records) == r.size {
+		copy(r.records, r.records[1:])
+		r.records = r.records[:r.size-1]
+	}
+	r.records = append(r.records, rec)
+}
+
+// recording collects the attempts of one request until it is known whether
+// it failed.
+type recording struct {
+	recorder  *FlightRecorder
+	req       *http.Request
+	start     time.Time
+	exchanges []recordedAttempt
+}
+
+type recordedAttempt struct {
+	FlightExchange
+	request *http.Request
+	header  http.Header
+	resp    *http.Response
+	body    *bytes.Buffer
+}
+
+// start begins recording req, or returns nil without a recorder.
+func (r *FlightRecorder) start(req *http.Request, now time.Time) *recording {
+	if r == nil {
+		return nil
+	}
+
+	return &recording{recorder: r, req: req, start: now}
+}
+
+// attempt records an attempt and its outcome, returning resp with its body
+// copied as it is read.
+func (rec *recording) attempt(req *http.Request, getBody BodyFunc, a Attempt, n int, resp *http.Response) *http.Response {
+	if rec == nil {
+		return resp
+	}
+
+	ex := recordedAttempt{request: req, header: req.Header.Clone(), resp: resp}
+	ex.Attempt, ex.Start, ex.Duration = n, a.Start, a.Duration
+	if a.Err != nil {
+		ex.Error = a.Err.Error()
+	}
+	if rec.recorder.maxBody > 0 && getBody != nil {
+		if body, err := getBody(); err == nil && body != nil {
+			data, _ := ioutil.ReadAll(io.LimitReader(body, int64(rec.recorder.maxBody)))
+			body.Close()
+			ex.Request.Body = string(data)
+		}
+	}
+	// Upgraded connections must keep their body as is
+	if resp != nil && resp.Body != nil && resp.StatusCode != http.StatusSwitchingProtocols && rec.recorder.maxBody > 0 {
+		ex.body = &bytes.Buffer{}
+		resp.Body = &recordedBody{ReadCloser: resp.Body, buf: ex.body, remaining: rec.recorder.maxBody}
+	}
+	rec.exchanges = append(rec.exchanges, ex)
+
+	return resp
+}
+
+// finish stores the recording if the request failed with err.
+func (rec *recording) finish(err error) {
+	if rec == nil || err == nil {
+		return
+	}
+
+	r := rec.recorder
+	out := FlightRecord{
+		Time:      rec.start,
+		Method:    rec.req.Method,
+		URL:       rec.req.URL.String(),
+		Error:     err.Error(),
+		Exchanges: make([]FlightExchange, 0, len(rec.exchanges)),
+	}
+	for _, ex := range rec.exchanges {
+		e := ex.FlightExchange
+		e.Request.Method = ex.request.Method
+		e.Request.URL = ex.request.URL.String()
+		e.Request.Proto = ex.request.Proto
+		e.Request.Header = r.redacted(ex.header)
+		if resp := ex.resp; resp != nil {
+			e.Response = &RecordedResponse{StatusCode: resp.StatusCode, Proto: resp.Proto, Header: r.redacted(resp.Header)}
+			if ex.body != nil {
+				e.Response.Body = ex.body.String()
+			}
+		}
+		out.Exchanges = append(out.Exchanges, e)
+	}
+	r.add(out)
+}
+
+func (r *FlightRecorder) redacted(h http.Header) http.Header {
+	h = h.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	for _, name := range r.redact {
+		if values := h.Values(name); len(values) > 0 {
+			h[http.CanonicalHeaderKey(name)] = []string{"[REDACTED]"}
+		}
+	}
+
+	return h
+}
+
+// recordedBody copies up to remaining bytes of what is read from it to buf.
+type recordedBody struct {
+	io.ReadCloser
+	buf       *bytes.Buffer
+	remaining int
+}
+
+func (b *recordedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if keep := n; b.remaining > 0 {
+		if keep > b.remaining {
+			keep = b.remaining
+		}
+		b.buf.Write(p[:keep])
+		b.remaining -= keep
+	}
+
+	return n, err
+}
+
+// WriteHAR writes the recorded requests to w in the HAR 1.2 format read by
+// browsers' developer tools, an entry per attempt.
+func (r *FlightRecorder) WriteHAR(w io.Writer) error {
+	type nameValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type content struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text,omitempty"`
+	}
+	type postData struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	}
+	type request struct {
+		Method      string      `json:"method"`
+		URL         string      `json:"url"`
+		HTTPVersion string      `json:"httpVersion"`
+		Headers     []nameValue `json:"headers"`
+		QueryString []nameValue `json:"queryString"`
+		Cookies     []nameValue `json:"cookies"`
+		PostData    *postData   `json:"postData,omitempty"`
+		HeadersSize int         `json:"headersSize"`
+		BodySize    int         `json:"bodySize"`
+	}
+	type response struct {
+		Status      int         `json:"status"`
+		StatusText  string      `json:"statusText"`
+		HTTPVersion string      `json:"httpVersion"`
+		Headers     []nameValue `json:"headers"`
+		Cookies     []nameValue `json:"cookies"`
+		Content     content     `json:"content"`
+		RedirectURL string      `json:"redirectURL"`
+		HeadersSize int         `json:"headersSize"`
+		BodySize    int         `json:"bodySize"`
+		Error       string      `json:"_error,omitempty"`
+	}
+	type entry struct {
+		StartedDateTime time.Time          `json:"startedDateTime"`
+		Time            float64            `json:"time"`
+		Request         request            `json:"request"`
+		Response        response           `json:"response"`
+		Cache           struct{}           `json:"cache"`
+		Timings         map[string]float64 `json:"timings"`
+		Comment         string             `json:"comment,omitempty"`
+	}
+	headers := func(h http.Header) []nameValue {
+		names := make([]string, 0, len(h))
+		for name := range h {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := []nameValue{}
+		for _, name := range names {
+			for _, v := range h[name] {
+				list = append(list, nameValue{Name: name, Value: v})
+			}
+		}
+		return list
+	}
+
+	entries := []entry{}
+	for _, rec := range r.Records() {
+		for _, ex := range rec.Exchanges {
+			ms := float64(ex.Duration) / float64(time.Millisecond)
+			e := entry{
+				StartedDateTime: ex.Start,
+				Time:            ms,
+				Request: request{
+					Method:      ex.Request.Method,
+					URL:         ex.Request.URL,
+					HTTPVersion: ex.Request.Proto,
+					Headers:     headers(ex.Request.Header),
+					QueryString: []nameValue{},
+					Cookies:     []nameValue{},
+					HeadersSize: -1,
+					BodySize:    len(ex.Request.Body),
+				},
+				Response: response{
+					Headers:     []nameValue{},
+					Cookies:     []nameValue{},
+					HeadersSize: -1,
+					BodySize:    -1,
+					Error:       ex.Error,
+				},
+				Timings: map[string]float64{"send": 0, "wait": ms, "receive": 0},
+				Comment: "attempt " + strconv.Itoa(ex.Attempt) + " of " + rec.Method + " " + rec.URL + ": " + rec.Error,
+			}
+			if ex.Request.Body != "" {
+				e.Request.PostData = &postData{MimeType: ex.Request.Header.Get("Content-Type"), Text: ex.Request.Body}
+			}
+			if resp := ex.Response; resp != nil {
+				e.Response.Status = resp.StatusCode
+				e.Response.StatusText = http.StatusText(resp.StatusCode)
+				e.Response.HTTPVersion = resp.Proto
+				e.Response.Headers = headers(resp.Header)
+				e.Response.Content = content{Size: len(resp.Body), MimeType: resp.Header.Get("Content-Type"), Text: resp.Body}
+				e.Response.BodySize = len(resp.Body)
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	var har struct {
+		Log struct {
+			Version string `json:"version"`
+			Creator struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"creator"`
+			Entries []entry `json:"entries"`
+		} `json:"log"`
+	}
+	har.Log.Version = "1.2"
+	har.Log.Creator.Name = "rhttp"
+	har.Log.Creator.Version = "1"
+	har.Log.Entries = entries
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(har)
+}
@@ -0,0 +1,258 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithFlightRecorder(t *testing.T) {
+	unavailable := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("try again later"))
+	})
+	tests := []struct {
+		name    string
+		cfg     FlightRecorderConfig
+		handler http.Handler
+		url     string
+		method  string
+		retries int
+		// check is called with the only record if one is expected.
+		check func(t *testing.T, rec FlightRecord)
+	}{
+		{
+			name:    "succeeded",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		},
+		{
+			name:    "given up",
+			handler: unavailable,
+			retries: 2,
+			check: func(t *testing.T, rec FlightRecord) {
+				if rec.Method != http.MethodGet || !strings.Contains(rec.Error, "max retries") || len(rec.Exchanges) != 3 {
+					t.Fatalf("record = %+v", rec)
+				}
+				for i, ex := range rec.Exchanges {
+					if ex.Attempt != i+1 || ex.Response == nil || ex.Response.StatusCode != http.StatusServiceUnavailable {
+						t.Errorf("exchange %d = %+v", i+1, ex)
+						continue
+					}
+					if ex.Response.Body != "try again later" {
+						t.Errorf("exchange %d kept body %q", i+1, ex.Response.Body)
+					}
+				}
+			},
+		},
+		{
+			name:    "redacted",
+			handler: unavailable,
+			check: func(t *testing.T, rec FlightRecord) {
+				ex := rec.Exchanges[0]
+				if got := ex.Request.Header.Get("Authorization"); got != "[REDACTED]" {
+					t.Errorf("Authorization recorded as %q", got)
+				}
+				if got := ex.Request.Header.Get("X-Trace"); got != "trace" {
+					t.Errorf("X-Trace recorded as %q", got)
+				}
+				if got := ex.Response.Header.Get("Set-Cookie"); got != "[REDACTED]" {
+					t.Errorf("Set-Cookie recorded as %q", got)
+				}
+			},
+		},
+		{
+			name:    "custom redaction",
+			cfg:     FlightRecorderConfig{Redact: []string{"x-trace"}},
+			handler: unavailable,
+			check: func(t *testing.T, rec FlightRecord) {
+				ex := rec.Exchanges[0]
+				if ex.Request.Header.Get("X-Trace") != "[REDACTED]" || ex.Request.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("request headers recorded as %v", ex.Request.Header)
+				}
+			},
+		},
+		{
+			name:    "bodies cut",
+			cfg:     FlightRecorderConfig{MaxBodyBytes: 3},
+			handler: unavailable,
+			method:  http.MethodPut,
+			check: func(t *testing.T, rec FlightRecord) {
+				ex := rec.Exchanges[0]
+				if ex.Request.Body != "pay" || ex.Response.Body != "try" {
+					t.Errorf("bodies recorded as %q and %q", ex.Request.Body, ex.Response.Body)
+				}
+			},
+		},
+		{
+			name:    "no bodies",
+			cfg:     FlightRecorderConfig{MaxBodyBytes: -1},
+			handler: unavailable,
+			method:  http.MethodPut,
+			check: func(t *testing.T, rec FlightRecord) {
+				ex := rec.Exchanges[0]
+				if ex.Request.Body != "" || ex.Response.Body != "" {
+					t.Errorf("bodies recorded as %q and %q", ex.Request.Body, ex.Response.Body)
+				}
+			},
+		},
+		{
+			name: "no response",
+			url:  "http://127.0.0.1:1",
+			check: func(t *testing.T, rec FlightRecord) {
+				if len(rec.Exchanges) != 2 {
+					t.Fatalf("%d exchanges, want 2", len(rec.Exchanges))
+				}
+				for i, ex := range rec.Exchanges {
+					if ex.Response != nil || ex.Error == "" {
+						t.Errorf("exchange %d = %+v, want an error", i+1, ex)
+					}
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := tt.url
+			if tt.handler != nil {
+				srv := httptest.NewServer(tt.handler)
+				defer srv.Close()
+				url = srv.URL
+			}
+			method, retries := tt.method, tt.retries
+			if method == "" {
+				method = http.MethodGet
+			}
+			if retries == 0 {
+				retries = 1
+			}
+			recorder := NewFlightRecorder(tt.cfg)
+			c := NewRetryableClient(fastBackoff, WithMaxRetries(retries), WithFlightRecorder(recorder))
+			req, _ := NewRequest(context.Background(), method, url, "payload")
+			req.Header.Set("Authorization", "Bearer token")
+			req.Header.Set("X-Trace", "trace")
+
+			resp, err := c.Do(context.Background(), req)
+			if err == nil {
+				drainBody(resp)
+			}
+			records := recorder.Records()
+			if tt.check == nil {
+				if len(records) != 0 {
+					t.Errorf("%d requests recorded, want none", len(records))
+				}
+				return
+			}
+			if len(records) != 1 {
+				t.Fatalf("%d requests recorded, want 1", len(records))
+			}
+			// The client's error wraps the recorded one in a *url.Error
+			if records[0].URL != url || err == nil || !strings.HasSuffix(err.Error(), records[0].Error) {
+				t.Errorf("recorded %s failing with %q, want %s failing with %v", records[0].URL, records[0].Error, url, err)
+			}
+			tt.check(t, records[0])
+		})
+	}
+}
+
+func TestFlightRecorderSize(t *testing.T) {
+	srv := newScriptServer(t, 502)
+	recorder := NewFlightRecorder(FlightRecorderConfig{Size: 2})
+	c := NewRetryableClient(fastBackoff, WithMaxRetries(1), WithFlightRecorder(recorder))
+
+	for _, path := range []string{"/1", "/2", "/3"} {
+		if _, err := c.Do(context.Background(), mustNewRequest(t, srv.URL+path)); err == nil {
+			t.Fatalf("GET %s succeeded", path)
+		}
+	}
+
+	records := recorder.Records()
+	if len(records) != 2 || records[0].URL != srv.URL+"/2" || records[1].URL != srv.URL+"/3" {
+		t.Errorf("recorded %+v, want /2 and /3", records)
+	}
+}
+
+func TestFlightRecorderDumps(t *testing.T) {
+	srv := newScriptServer(t, 503)
+	recorder := NewFlightRecorder(FlightRecorderConfig{})
+	c := NewRetryableClient(fastBackoff, WithMaxRetries(1), WithFlightRecorder(recorder))
+	if _, err := c.Do(context.Background(), mustNewRequest(t, srv.URL)); err == nil {
+		t.Fatal("Do() succeeded")
+	}
+
+	tests := []struct {
+		name  string
+		write func(*bytes.Buffer) error
+		check func(t *testing.T, data []byte)
+	}{
+		{
+			name:  "JSON",
+			write: func(b *bytes.Buffer) error { return recorder.WriteJSON(b) },
+			check: func(t *testing.T, data []byte) {
+				var records []FlightRecord
+				if err := json.Unmarshal(data, &records); err != nil {
+					t.Fatal(err)
+				}
+				if len(records) != 1 || len(records[0].Exchanges) != 2 || records[0].Exchanges[1].Response.StatusCode != 503 {
+					t.Errorf("decoded %+v", records)
+				}
+			},
+		},
+		{
+			name: "HAR",
+			write: func(b *bytes.Buffer) error {
+				rec := httptest.NewRecorder()
+				recorder.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+				if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+					t.Errorf("served as %q", ct)
+				}
+				b.Write(rec.Body.Bytes())
+				return nil
+			},
+			check: func(t *testing.T, data []byte) {
+				var har struct {
+					Log struct {
+						Version string `json:"version"`
+						Entries []struct {
+							Request struct {
+								Method string `json:"method"`
+								URL    string `json:"url"`
+							} `json:"request"`
+							Response struct {
+								Status     int    `json:"status"`
+								StatusText string `json:"statusText"`
+							} `json:"response"`
+							Comment string `json:"comment"`
+						} `json:"entries"`
+					} `json:"log"`
+				}
+				if err := json.Unmarshal(data, &har); err != nil {
+					t.Fatal(err)
+				}
+				if har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+					t.Fatalf("HAR = %+v", har)
+				}
+				for i, e := range har.Log.Entries {
+					if e.Request.Method != http.MethodGet || e.Request.URL != srv.URL || e.Response.Status != 503 ||
+						e.Response.StatusText != "Service Unavailable" || !strings.HasPrefix(e.Comment, "attempt ") {
+						t.Errorf("entry %d = %+v", i+1, e)
+					}
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := tt.write(&b); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, b.Bytes())
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// DefaultGraphQLRetryCodes are the GraphQL error codes retried by default.
+var DefaultGraphQLRetryCodes = []string{"RATE_LIMITED", "THROTTLED", "SERVICE_UNAVAILABLE", "TIMEOUT"}
+
+// GraphQLError is an entry of the errors of a GraphQL response. The error
+// code, if any, is extensions.code.
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Code returns the error code in the extensions, or "".
+func (e GraphQLError) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// GraphQLErrors is the error of a GraphQL response listing errors.
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Message
+		if code := err.Code(); code != "" {
+			msgs[i] = code + ": " + msgs[i]
+		}
+	}
+
+	return "rhttp: graphql: " + strings.Join(msgs, "; ")
+}
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors GraphQLErrors   `json:"errors"`
+}
+
+// WithGraphQL sets the endpoint used by GraphQL and the error codes that are
+// retried like a failed attempt, DefaultGraphQLRetryCodes by default.
+func WithGraphQL(endpoint string, retryCodes ...string) Option {
+	if len(retryCodes) == 0 {
+		retryCodes = DefaultGraphQLRetryCodes
+	}
+
+	return func(c *config) {
+		c.graphQLEndpoint = endpoint
+		c.graphQLRetryCodes = retryCodes
+	}
+}
+
+// GraphQL sends query with vars to the endpoint set by WithGraphQL and
+// decodes the data of the response into out. Responses whose errors carry a
+// retryable code are retried; other errors, such as validation errors, are
+// returned right away as GraphQLErrors, with whatever data came along decoded
+// into out. Mutations are only retried with an idempotency key or
+// WithRetryUnsafeMethods.
+func (c *RetryableClient) GraphQL(ctx context.Context, query string, vars map[string]interface{}, out interface{}) error {
+	cfg := c.current().with(requestOptions(ctx)...)
+	if cfg.graphQLEndpoint == "" {
+		return errors.New("rhttp: no GraphQL endpoint, see WithGraphQL")
+	}
+
+	payload, err := json.Marshal(graphQLRequest{Query: query, Variables: vars})
+	if err != nil {
+		return err
+	}
+	req, err := NewRequest(ctx, http.MethodPost, cfg.graphQLEndpoint, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	opts := []Option{WithResponseValidator(retryableGraphQLErrors(cfg.graphQLRetryCodes))}
+	if !strings.HasPrefix(strings.TrimSpace(query), "mutation") {
+		// Queries are read-only even though they are POSTed
+		opts = append(opts, WithRetryUnsafeMethods())
+	}
+	resp, err := c.Do(ctx, req, opts...)
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return c.current().statusError(resp)
+	}
+
+	var gr graphQLResponse
+	if err := json.NewDecoder(resp.Body).Decode(&gr); err != nil {
+		return err
+	}
+	if out != nil && len(gr.Data) > 0 && string(gr.Data) != "null" {
+		if err := json.Unmarshal(gr.Data, out); err != nil {
+			return err
+		}
+	}
+	if len(gr.Errors) > 0 {
+		return gr.Errors
+	}
+
+	return nil
+}
+
+// retryableGraphQLErrors rejects the responses listing an error with one of
+// codes, so they are retried.
+func retryableGraphQLErrors(codes []string) ResponseValidator {
+	return func(resp *http.Response) error {
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+
+		var gr struct {
+			Errors GraphQLErrors `json:"errors"`
+		}
+		if json.Unmarshal(body, &gr) != nil {
+			// Leave malformed responses to GraphQL
+			return nil
+		}
+		for _, e := range gr.Errors {
+			for _, code := range codes {
+				if e.Code() == code {
+					return gr.Errors
+				}
+			}
+		}
+
+		return nil
+	}
+}
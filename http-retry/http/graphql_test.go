@@ -0,0 +1,203 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+const (
+	graphQLData        = `{"data":{"user":{"name":"Ada"}}}`
+	graphQLRateLimited = `{"data":null,"errors":[{"message":"slow down","extensions":{"code":"RATE_LIMITED"}}]}`
+	graphQLInvalid     = `{"data":{"user":null},"errors":[{"message":"no such field","path":["user","age"],"extensions":{"code":"GRAPHQL_VALIDATION_FAILED"}}]}`
+)
+
+// newGraphQLServer answers the requests with bodies in order, the last one
+// repeating, and records the payloads it receives.
+func newGraphQLServer(t *testing.T, bodies ...string) (*httptest.Server, func() []graphQLRequest) {
+	var mu sync.Mutex
+	var received []graphQLRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received = append(received, req)
+		body := bodies[len(bodies)-1]
+		if len(received) <= len(bodies) {
+			body = bodies[len(received)-1]
+		}
+		mu.Unlock()
+		if body == "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []graphQLRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]graphQLRequest(nil), received...)
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+	tests := []struct {
+		name  string
+		query string
+		// bodies are the responses in order, "" a 503.
+		bodies     []string
+		retryCodes []string
+		opts       []Option
+		want       *user
+		wantSent   int
+		wantErr    func(error) bool
+	}{
+		{name: "data", query: "{ user { name } }", bodies: []string{graphQLData}, want: &user{Name: "Ada"}, wantSent: 1},
+		{name: "retryable code", query: "{ user { name } }", bodies: []string{graphQLRateLimited, graphQLData}, want: &user{Name: "Ada"}, wantSent: 2},
+		{name: "unavailable", query: "{ user { name } }", bodies: []string{"", graphQLData}, want: &user{Name: "Ada"}, wantSent: 2},
+		{
+			name:     "code not retried",
+			query:    "{ user { age } }",
+			bodies:   []string{graphQLInvalid},
+			wantSent: 1,
+			wantErr: func(err error) bool {
+				var gqlErrs GraphQLErrors
+				return errors.As(err, &gqlErrs) && len(gqlErrs) == 1 && gqlErrs[0].Code() == "GRAPHQL_VALIDATION_FAILED"
+			},
+		},
+		{
+			name:       "retry codes",
+			query:      "{ user { age } }",
+			bodies:     []string{graphQLInvalid, graphQLData},
+			retryCodes: []string{"GRAPHQL_VALIDATION_FAILED"},
+			want:       &user{Name: "Ada"},
+			wantSent:   2,
+		},
+		{
+			name:     "retries exhausted",
+			query:    "{ user { name } }",
+			bodies:   []string{graphQLRateLimited},
+			opts:     []Option{WithMaxRetries(2)},
+			wantSent: 3,
+			wantErr:  func(err error) bool { return err != nil },
+		},
+		{
+			name:     "mutation not retried",
+			query:    `mutation { rename(name: "Ada") { name } }`,
+			bodies:   []string{graphQLRateLimited, graphQLData},
+			wantSent: 1,
+			wantErr:  func(err error) bool { var gqlErrs GraphQLErrors; return errors.As(err, &gqlErrs) },
+		},
+		{
+			name:     "mutation retried with unsafe methods",
+			query:    `mutation { rename(name: "Ada") { name } }`,
+			bodies:   []string{graphQLRateLimited, graphQLData},
+			opts:     []Option{WithRetryUnsafeMethods()},
+			want:     &user{Name: "Ada"},
+			wantSent: 2,
+		},
+		{
+			name:     "malformed response",
+			query:    "{ user { name } }",
+			bodies:   []string{"not json"},
+			wantSent: 1,
+			wantErr:  func(err error) bool { return err != nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, received := newGraphQLServer(t, tt.bodies...)
+			c := NewRetryableClient(append([]Option{fastBackoff, WithGraphQL(srv.URL, tt.retryCodes...)}, tt.opts...)...)
+			vars := map[string]interface{}{"id": "1"}
+
+			var out struct {
+				User *user `json:"user"`
+			}
+			err := c.GraphQL(context.Background(), tt.query, vars, &out)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("GraphQL() error = %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("GraphQL() error = %v", err)
+			}
+			if !reflect.DeepEqual(out.User, tt.want) {
+				t.Errorf("user = %+v, want %+v", out.User, tt.want)
+			}
+
+			got := received()
+			if len(got) != tt.wantSent {
+				t.Errorf("%d requests sent, want %d", len(got), tt.wantSent)
+			}
+			for i, req := range got {
+				if req.Query != tt.query || !reflect.DeepEqual(req.Variables, vars) {
+					t.Errorf("request %d = %+v", i+1, req)
+				}
+			}
+		})
+	}
+}
+
+func TestGraphQLPartialData(t *testing.T) {
+	srv, _ := newGraphQLServer(t, `{"data":{"user":{"name":"Ada"},"age":null},"errors":[{"message":"no access"}]}`)
+	c := NewRetryableClient(WithGraphQL(srv.URL))
+
+	var out struct {
+		User struct{ Name string } `json:"user"`
+	}
+	err := c.GraphQL(context.Background(), "{ user { name } age }", nil, &out)
+	if _, ok := err.(GraphQLErrors); !ok || out.User.Name != "Ada" {
+		t.Errorf("GraphQL() = %+v, %v, want the data and the errors", out, err)
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  GraphQLErrors
+		want string
+	}{
+		{name: "one", err: GraphQLErrors{{Message: "boom"}}, want: "rhttp: graphql: boom"},
+		{
+			name: "codes",
+			err:  GraphQLErrors{{Message: "slow down", Extensions: map[string]interface{}{"code": "RATE_LIMITED"}}, {Message: "boom"}},
+			want: "rhttp: graphql: RATE_LIMITED: slow down; boom",
+		},
+		{name: "code not a string", err: GraphQLErrors{{Message: "boom", Extensions: map[string]interface{}{"code": 42}}}, want: "rhttp: graphql: boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLWithoutEndpoint(t *testing.T) {
+	if err := NewRetryableClient().GraphQL(context.Background(), "{ user }", nil, nil); err == nil {
+		t.Error("GraphQL() succeeded without an endpoint")
+	}
+}
+
+func TestGraphQLStatusError(t *testing.T) {
+	srv := newScriptServer(t, http.StatusUnauthorized)
+
+	err := NewRetryableClient(WithGraphQL(srv.URL)).GraphQL(context.Background(), "{ user }", nil, nil)
+	if e, ok := err.(*StatusError); !ok || e.Code != http.StatusUnauthorized {
+		t.Errorf("GraphQL() error = %v, want a 401 StatusError", err)
+	}
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// Version is the version of this package, as AttemptInfo reports it.
+const Version = "0.1.0"
+
+// AttemptInfo describes an attempt to header templates, see
+// WithHeaderTemplate.
+type AttemptInfo struct {
+	// Version is the version of this package.
+	Version string
+	Method  string
+	Host    string
+	// Attempt is the attempt number, 1 for the first one.
+	Attempt int
+	// Retry tells a retried attempt from a first one.
+	Retry bool
+	// Hedge tells a hedged copy of an attempt, see WithHedging.
+	Hedge bool
+	// Reason is why the previous attempt failed, as in the X-Retry-Reason
+	// header: a status code such as "503" or an error class such as
+	// "timeout". It is empty for a first attempt.
+	Reason string
+}
+
+type headerTemplate struct {
+	name string
+	tmpl *template.Template
+}
+
+// WithHeaderTemplate sets header name on every attempt from tmpl, a
+// text/template executed with the AttemptInfo of the attempt, e.g.
+//
+//	rhttp.WithHeaderTemplate("X-Client", "billing/{{.Version}}{{if .Retry}} retry={{.Attempt}}{{end}}")
+//
+// so servers can measure how much of their traffic is retries and hedges. A
+// header set by the request itself is replaced. Hedged copies are rendered
+// again after the signer ran, so signers should leave templated headers out.
+// If tmpl is invalid, requests fail with the parse error.
+func WithHeaderTemplate(name, tmpl string) Option {
+	t, err := template.New(name).Parse(tmpl)
+	if err == nil {
+		// Catch references to unknown fields now rather than on every attempt
+		err = t.Execute(&strings.Builder{}, AttemptInfo{})
+	}
+
+	return func(c *config) {
+		if err != nil {
+			if c.optionErr == nil {
+				c.optionErr = fmt.Errorf("rhttp: invalid template for header %s: %w", name, err)
+			}
+			return
+		}
+		name := http.CanonicalHeaderKey(name)
+		templates := make([]headerTemplate, 0, len(c.headerTemplates)+1)
+		for _, ht := range c.headerTemplates {
+			if ht.name != name {
+				templates = append(templates, ht)
+			}
+		}
+		c.headerTemplates = append(templates, headerTemplate{name: name, tmpl: t})
+	}
+}
+
+// WithUserAgent sets the User-Agent of every attempt from tmpl, see
+// WithHeaderTemplate, e.g.
+// "billing/2.3 rhttp/{{.Version}} (attempt {{.Attempt}}{{if .Hedge}}; hedge{{end}})".
+func WithUserAgent(tmpl string) Option {
+	return WithHeaderTemplate("User-Agent", tmpl)
+}
+
+type attemptInfoKey struct{}
+
+// withAttemptInfo returns ctx carrying the AttemptInfo of attempt number
+// attempt of req, retried after resp and err, for setHeaderTemplates.
+func (c *config) withAttemptInfo(ctx context.Context, req *http.Request, attempt int, resp *http.Response, err error) context.Context {
+	if len(c.headerTemplates) == 0 {
+		return ctx
+	}
+
+	info := AttemptInfo{
+		Version: Version,
+		Method:  req.Method,
+		Host:    req.URL.Host,
+		Attempt: attempt,
+		Retry:   attempt > 1,
+	}
+	if attempt > 1 {
+		info.Reason = attemptReason(resp, err)
+	}
+
+	return context.WithValue(ctx, attemptInfoKey{}, info)
+}
+
+// setHeaderTemplates sets the templated headers of req from the AttemptInfo
+// of its context, marked as a hedged copy if hedge is set.
+func (c *config) setHeaderTemplates(req *http.Request, hedge bool) {
+	info, ok := req.Context().Value(attemptInfoKey{}).(AttemptInfo)
+	if !ok {
+		return
+	}
+
+	info.Hedge = hedge
+	for _, ht := range c.headerTemplates {
+		var b strings.Builder
+		if ht.tmpl.Execute(&b, info) == nil {
+			req.Header.Set(ht.name, b.String())
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithHeaderTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		statuses []int
+		// key is the templated header, X-Client if empty, and header its
+		// value set by the request itself.
+		key    string
+		header string
+		// want are the headers of each attempt.
+		want []string
+	}{
+		{
+			name: "first attempt",
+			opts: []Option{WithHeaderTemplate("X-Client", "billing/{{.Version}} {{.Method}} attempt={{.Attempt}}")},
+			want: []string{"billing/" + Version + " GET attempt=1"},
+		},
+		{
+			name:     "retries",
+			opts:     []Option{WithHeaderTemplate("x-client", "{{.Attempt}} retry={{.Retry}} reason={{.Reason}}")},
+			statuses: []int{503, 429, 200},
+			want:     []string{"1 retry=false reason=", "2 retry=true reason=503", "3 retry=true reason=429"},
+		},
+		{
+			name:     "hedge",
+			opts:     []Option{WithMaxRetries(0), WithHedging(time.Hour, 1), WithHeaderTemplate("X-Client", "{{.Attempt}}{{if .Hedge}} hedge{{end}}")},
+			statuses: []int{503, 200},
+			want:     []string{"1", "1 hedge"},
+		},
+		{
+			name:   "replaces the request's header",
+			opts:   []Option{WithHeaderTemplate("X-Client", "templated")},
+			header: "from the request",
+			want:   []string{"templated"},
+		},
+		{
+			name: "last template wins",
+			opts: []Option{WithHeaderTemplate("X-Client", "first"), WithHeaderTemplate("X-CLIENT", "second")},
+			want: []string{"second"},
+		},
+		{
+			name: "user agent",
+			key:  "User-Agent",
+			opts: []Option{WithUserAgent("billing/2.3 rhttp/{{.Version}} (attempt {{.Attempt}})")},
+			want: []string{"billing/2.3 rhttp/" + Version + " (attempt 1)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			c := NewRetryableClient(append([]Option{fastBackoff}, tt.opts...)...)
+			req := mustNewRequest(t, srv.URL)
+			if tt.header != "" {
+				req.Header.Set("X-Client", tt.header)
+			}
+
+			resp, err := c.Do(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			drainBody(resp)
+
+			name := tt.key
+			if name == "" {
+				name = "X-Client"
+			}
+			var got []string
+			for i := 0; i < srv.count(); i++ {
+				r, _ := srv.request(i)
+				got = append(got, r.Header.Get(name))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s headers = %q, want %q", name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithHeaderTemplateInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+	}{
+		{name: "parse error", tmpl: "{{.Attempt"},
+		{name: "unknown field", tmpl: "{{.Retries}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t)
+			c := NewRetryableClient(WithHeaderTemplate("X-Client", tt.tmpl))
+
+			_, err := c.Get(srv.URL)
+			if err == nil || !strings.Contains(err.Error(), "rhttp: invalid template for header X-Client") {
+				t.Errorf("Get() error = %v, want the template error", err)
+			}
+			if srv.count() != 0 {
+				t.Errorf("server received %d requests, want none", srv.count())
+			}
+		})
+	}
+}
+
+func TestHeaderTemplatesUnset(t *testing.T) {
+	cfg := newConfig()
+	ctx := context.Background()
+	if got := cfg.withAttemptInfo(ctx, mustNewRequest(t, "http://api.test"), 2, nil, nil); got != ctx {
+		t.Error("attempt info added without header templates")
+	}
+}
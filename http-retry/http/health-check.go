@@ -0,0 +1,218 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHealthCheckInterval is how often a HealthChecker probes its
+	// targets by default.
+	DefaultHealthCheckInterval = 10 * time.Second
+	// DefaultHealthCheckTimeout bounds every probe by default.
+	DefaultHealthCheckTimeout = 2 * time.Second
+)
+
+// ProbeFunc checks the health of target, returning an error if it is
+// unhealthy.
+type ProbeFunc func(ctx context.Context, target *url.URL) error
+
+// HealthCheckConfig configures a HealthChecker. Targets is required.
+type HealthCheckConfig struct {
+	// Targets are the URLs probed, e.g. "https://api.example.com/healthz".
+	Targets []string
+	// Interval is the time between probes, DefaultHealthCheckInterval if
+	// zero.
+	Interval time.Duration
+	// Timeout bounds every probe, DefaultHealthCheckTimeout if zero.
+	Timeout time.Duration
+	// Probe checks a target, by default with a HEAD request expecting a
+	// status below 400. Probes are not retried.
+	Probe ProbeFunc
+	// OnChange is called when a target becomes healthy or unhealthy.
+	OnChange func(target string, healthy bool)
+}
+
+// HealthObserver is implemented by Pickers that route by the health of their
+// endpoints, such as the one of WithFailover.
+type HealthObserver interface {
+	// ObserveHealth reports whether the endpoint u is under is healthy.
+	ObserveHealth(u *url.URL, healthy bool)
+}
+
+// HealthChecker probes endpoints in the background and reports their health
+// to the circuit breakers and pickers of the clients using it, see
+// WithHealthChecker. A circuit closes as soon as a probe of its host
+// succeeds, instead of waiting for live traffic to test it, and a failover
+// client moves back to its primary endpoint once it recovers.
+type HealthChecker struct {
+	targets  []*url.URL
+	interval time.Duration
+	timeout  time.Duration
+	probe    ProbeFunc
+	onChange func(string, bool)
+
+	mu        sync.Mutex
+	healthy   map[string]bool
+	breakers  map[*CircuitBreaker]struct{}
+	observers map[HealthObserver]struct{}
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewHealthChecker starts probing the targets of cfg, every interval, until
+// Close is called. Invalid targets are ignored.
+func NewHealthChecker(cfg HealthCheckConfig) *HealthChecker {
+	h := &HealthChecker{
+		interval:  cfg.Interval,
+		timeout:   cfg.Timeout,
+		probe:     cfg.Probe,
+		onChange:  cfg.OnChange,
+		healthy:   make(map[string]bool),
+		breakers:  make(map[*CircuitBreaker]struct{}),
+		observers: make(map[HealthObserver]struct{}),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if h.interval <= 0 {
+		h.interval = DefaultHealthCheckInterval
+	}
+	if h.timeout <= 0 {
+		h.timeout = DefaultHealthCheckTimeout
+	}
+	if h.probe == nil {
+		h.probe = headProbe
+	}
+	for _, t := range cfg.Targets {
+		if u, err := url.Parse(t); err == nil && u.Host != "" {
+			h.targets = append(h.targets, u)
+		}
+	}
+
+	go h.run()
+
+	return h
+}
+
+// WithHealthChecker reports the probes of h to the client's circuit breaker
+// and picker. A checker may be shared between clients.
+func WithHealthChecker(h *HealthChecker) Option {
+	return func(c *config) {
+		c.healthChecker = h
+	}
+}
+
+// Healthy reports whether the last probe of target succeeded. Targets not
+// probed yet are healthy.
+func (h *HealthChecker) Healthy(target string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	healthy, ok := h.healthy[target]
+	return healthy || !ok
+}
+
+// Close stops probing.
+func (h *HealthChecker) Close() {
+	h.once.Do(func() { close(h.stop) })
+	<-h.done
+}
+
+// attach reports the next probes to the breaker and picker of cfg.
+func (h *HealthChecker) attach(cfg *config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if cfg.circuitBreaker != nil {
+		h.breakers[cfg.circuitBreaker] = struct{}{}
+	}
+	if o, ok := cfg.picker.(HealthObserver); ok {
+		h.observers[o] = struct{}{}
+	}
+}
+
+func (h *HealthChecker) run() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		h.check()
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check probes every target at once and reports the results.
+func (h *HealthChecker) check() {
+	var wg sync.WaitGroup
+	for _, target := range h.targets {
+		wg.Add(1)
+		go func(target *url.URL) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+			defer cancel()
+			h.report(target, h.probe(ctx, target) == nil)
+		}(target)
+	}
+	wg.Wait()
+}
+
+func (h *HealthChecker) report(target *url.URL, healthy bool) {
+	key := target.String()
+
+	h.mu.Lock()
+	was, probed := h.healthy[key]
+	h.healthy[key] = healthy
+	breakers := make([]*CircuitBreaker, 0, len(h.breakers))
+	for b := range h.breakers {
+		breakers = append(breakers, b)
+	}
+	observers := make([]HealthObserver, 0, len(h.observers))
+	for o := range h.observers {
+		observers = append(observers, o)
+	}
+	h.mu.Unlock()
+
+	for _, b := range breakers {
+		// A success would reset the failures counted by live traffic to a
+		// closed circuit, only report it to close one
+		if !healthy || b.State(target.Host) != CircuitClosed {
+			b.Record(target.Host, healthy)
+		}
+	}
+	for _, o := range observers {
+		o.ObserveHealth(target, healthy)
+	}
+	if h.onChange != nil && (!probed || was != healthy) {
+		h.onChange(key, healthy)
+	}
+}
+
+// headProbe sends a HEAD request to target, expecting a status below 400.
+func headProbe(ctx context.Context, target *url.URL) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("rhttp: health check of %s: status %d", target.Redacted(), resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedProbe answers the probes of a target with the results given for it,
+// the last one repeating.
+type scriptedProbe struct {
+	mu      sync.Mutex
+	results map[string][]bool
+	probed  []string
+}
+
+func (p *scriptedProbe) probe(ctx context.Context, target *url.URL) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := target.String()
+	p.probed = append(p.probed, key)
+	results := p.results[key]
+	healthy := results[0]
+	if len(results) > 1 {
+		p.results[key] = results[1:]
+	}
+	if !healthy {
+		return errors.New("unhealthy")
+	}
+
+	return nil
+}
+
+// newCheckedHealthChecker returns a checker that already probed its targets
+// once and does not probe them again on its own.
+func newCheckedHealthChecker(cfg HealthCheckConfig) *HealthChecker {
+	cfg.Interval = time.Hour
+	h := NewHealthChecker(cfg)
+	h.Close()
+
+	return h
+}
+
+func TestHealthChecker(t *testing.T) {
+	const a, b = "http://a.test/healthz", "http://b.test/healthz"
+	type change struct {
+		target  string
+		healthy bool
+	}
+	tests := []struct {
+		name    string
+		results map[string][]bool
+		rounds  int
+		// wantHealthy is the health after the rounds.
+		wantHealthy map[string]bool
+		wantChanges []change
+	}{
+		{
+			name:        "healthy",
+			results:     map[string][]bool{a: {true}, b: {true}},
+			rounds:      3,
+			wantHealthy: map[string]bool{a: true, b: true},
+			wantChanges: []change{{a, true}, {b, true}},
+		},
+		{
+			name:        "unhealthy",
+			results:     map[string][]bool{a: {false}, b: {true}},
+			rounds:      2,
+			wantHealthy: map[string]bool{a: false, b: true},
+			wantChanges: []change{{a, false}, {b, true}},
+		},
+		{
+			name:        "recovers",
+			results:     map[string][]bool{a: {false, false, true}, b: {true}},
+			rounds:      3,
+			wantHealthy: map[string]bool{a: true, b: true},
+			wantChanges: []change{{a, false}, {a, true}, {b, true}},
+		},
+		{
+			name:        "flaps",
+			results:     map[string][]bool{a: {true, false, true}, b: {true, true, false}},
+			rounds:      3,
+			wantHealthy: map[string]bool{a: true, b: false},
+			wantChanges: []change{{a, true}, {a, false}, {a, true}, {b, true}, {b, false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe := &scriptedProbe{results: tt.results}
+			var mu sync.Mutex
+			var changes []change
+			h := newCheckedHealthChecker(HealthCheckConfig{
+				Targets: []string{a, b, "not a URL", "/relative"},
+				Probe:   probe.probe,
+				OnChange: func(target string, healthy bool) {
+					mu.Lock()
+					changes = append(changes, change{target, healthy})
+					mu.Unlock()
+				},
+			})
+			for i := 1; i < tt.rounds; i++ {
+				h.check()
+			}
+
+			for target, want := range tt.wantHealthy {
+				if got := h.Healthy(target); got != want {
+					t.Errorf("Healthy(%s) = %v, want %v", target, got, want)
+				}
+			}
+			// Targets are probed at once, so only the order per target holds
+			sort.SliceStable(changes, func(i, j int) bool { return changes[i].target < changes[j].target })
+			if !reflect.DeepEqual(changes, tt.wantChanges) {
+				t.Errorf("changes = %v, want %v", changes, tt.wantChanges)
+			}
+			if len(probe.probed) != 2*tt.rounds {
+				t.Errorf("probed %v, want %d probes of both targets", probe.probed, tt.rounds)
+			}
+		})
+	}
+}
+
+func TestHealthCheckerUnprobed(t *testing.T) {
+	h := newCheckedHealthChecker(HealthCheckConfig{Probe: func(context.Context, *url.URL) error { return errors.New("down") }})
+	if !h.Healthy("http://a.test/healthz") {
+		t.Error("target not probed is unhealthy")
+	}
+}
+
+func TestHealthCheckerCircuitBreaker(t *testing.T) {
+	const target = "http://a.test/healthz"
+	tests := []struct {
+		name string
+		// failures are recorded by live traffic before the probe.
+		failures  int
+		healthy   bool
+		wantState CircuitState
+		// wantOpenAfter is how many more failures open the circuit.
+		wantOpenAfter int
+	}{
+		{name: "closes an open circuit", failures: 3, healthy: true, wantState: CircuitClosed, wantOpenAfter: 3},
+		{name: "keeps the failures of a closed one", failures: 2, healthy: true, wantState: CircuitClosed, wantOpenAfter: 1},
+		{name: "counts a failure", failures: 1, healthy: false, wantState: CircuitClosed, wantOpenAfter: 1},
+		{name: "opens", failures: 2, healthy: false, wantState: CircuitOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker(CircuitSettings{FailureThreshold: 3, Cooldown: time.Hour})
+			for i := 0; i < tt.failures; i++ {
+				b.Record("a.test", false)
+			}
+			probe := &scriptedProbe{results: map[string][]bool{target: {true}}}
+			h := newCheckedHealthChecker(HealthCheckConfig{Targets: []string{target}, Probe: probe.probe})
+			NewRetryableClient(WithCircuitBreaker(b), WithHealthChecker(h))
+
+			h.report(mustParseURL(t, target), tt.healthy)
+			if got := b.State("a.test"); got != tt.wantState {
+				t.Fatalf("State() = %v, want %v", got, tt.wantState)
+			}
+			for i := 0; i < tt.wantOpenAfter; i++ {
+				if b.State("a.test") == CircuitOpen {
+					t.Fatalf("opened after %d failures, want %d", i, tt.wantOpenAfter)
+				}
+				b.Record("a.test", false)
+			}
+			if b.State("a.test") != CircuitOpen {
+				t.Errorf("still %v after %d failures", b.State("a.test"), tt.wantOpenAfter)
+			}
+		})
+	}
+}
+
+func TestHealthCheckerFailover(t *testing.T) {
+	const primary, standby = "https://primary.test", "https://standby.test"
+	probe := &scriptedProbe{results: map[string][]bool{primary + "/healthz": {true}}}
+	h := newCheckedHealthChecker(HealthCheckConfig{Targets: []string{primary + "/healthz"}, Probe: probe.probe})
+	cfg := newConfig(WithFailover(5, primary, standby), WithHealthChecker(h))
+	h.attach(cfg)
+	f := cfg.picker.(*failover)
+
+	h.report(mustParseURL(t, primary+"/healthz"), false)
+	if f.current != 1 {
+		t.Fatal("did not fail over from an unhealthy primary")
+	}
+	h.report(mustParseURL(t, primary+"/healthz"), true)
+	if f.current != 0 {
+		t.Error("did not go back to the primary once healthy")
+	}
+}
+
+func TestHeadProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "OK", status: http.StatusOK},
+		{name: "not modified", status: http.StatusNotModified},
+		{name: "not found", status: http.StatusNotFound, wantErr: true},
+		{name: "unavailable", status: http.StatusServiceUnavailable, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodHead {
+					t.Errorf("probed with %s", r.Method)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			if err := headProbe(context.Background(), mustParseURL(t, srv.URL)); (err != nil) != tt.wantErr {
+				t.Errorf("headProbe() error = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := headProbe(context.Background(), mustParseURL(t, "http://127.0.0.1:1")); err == nil {
+		t.Error("probe of an unreachable target succeeded")
+	}
+}
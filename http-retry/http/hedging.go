@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"net/http"
+)
+
+type hedgeResult struct {
+	resp *http.Response
+	err  error
+	id   int
+}
+
+// hedge sends req and, each time delay passes without an acceptable response,
+// another copy of it in parallel, up to maxHedges copies. The first response
+// the retry policy would not retry wins and the others are cancelled. If every
+// copy fails, the last failure is returned to the retry loop as usual.
+func (t *retryableTransport) hedge(req *http.Request, attempt int, getBody BodyFunc) (*http.Response, error) {
+	ctx := req.Context()
+	results := make(chan hedgeResult, t.config.maxHedges+1)
+	var cancels []context.CancelFunc
+
+	launch := func(r *http.Request) {
+		hctx, cancel := context.WithCancel(ctx)
+		id := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			if id > 0 {
+				t.config.debug.hedge(1)
+				defer t.config.debug.hedge(-1)
+			}
+			resp, err := t.roundTrip(r.WithContext(hctx), attempt)
+			results <- hedgeResult{resp: resp, err: err, id: id}
+		}()
+	}
+
+	launch(req)
+	inflight, hedges := 1, 0
+	hedgeAgain := func() bool {
+		if hedges >= t.config.maxHedges || ctx.Err() != nil {
+			return false
+		}
+		body, err := getBody()
+		if err != nil {
+			return false
+		}
+		hedged := newAttempt(req, req.Context(), body)
+		t.config.setHeaderTemplates(hedged, true)
+		launch(hedged)
+		inflight++
+		hedges++
+		return true
+	}
+
+	wait, stop := newTimer(t.config.clock, t.config.hedgeDelay)
+	defer func() { stop() }()
+
+	var last *hedgeResult
+	for {
+		select {
+		case <-wait:
+			wait = nil
+			if hedgeAgain() {
+				wait, stop = newTimer(t.config.clock, t.config.hedgeDelay)
+			}
+
+		case res := <-results:
+			inflight--
+			if !t.config.policy.ShouldRetry(res.resp, res.err, attempt) {
+				// We have a winner, release the copy that failed before it and
+				// stop the others
+				if last != nil {
+					drainBody(last.resp)
+				}
+				cancelOthers(cancels, res.id)
+				go discardHedges(results, inflight)
+				return cancelOnClose(res.resp, res.err, cancels[res.id])
+			}
+
+			if last != nil {
+				drainBody(last.resp)
+				cancels[last.id]()
+			}
+			last = &res
+
+			// A copy failed outright, no point waiting for the delay
+			if inflight == 0 && !hedgeAgain() {
+				cancelOthers(cancels, last.id)
+				return cancelOnClose(last.resp, last.err, cancels[last.id])
+			}
+		}
+	}
+}
+
+func cancelOthers(cancels []context.CancelFunc, keep int) {
+	for id, cancel := range cancels {
+		if id != keep {
+			cancel()
+		}
+	}
+}
+
+// discardHedges releases the responses of n cancelled hedges.
+func discardHedges(results <-chan hedgeResult, n int) {
+	for ; n > 0; n-- {
+		res := <-results
+		drainBody(res.resp)
+	}
+}
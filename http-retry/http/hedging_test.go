@@ -0,0 +1,204 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hedgeServer answers like a scriptServer, except that the requests listed
+// in hang never get an answer: they wait for the client to give up, which
+// is recorded in cancelled.
+type hedgeServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	statuses  []int
+	hang      map[int]bool
+	n         int
+	cancelled chan int
+}
+
+func newHedgeServer(t *testing.T, hang []int, statuses ...int) *hedgeServer {
+	s := &hedgeServer{statuses: statuses, hang: map[int]bool{}, cancelled: make(chan int, 8)}
+	for _, n := range hang {
+		s.hang[n] = true
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		n := s.n
+		s.n++
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status = s.statuses[len(s.statuses)-1]
+			if n < len(s.statuses) {
+				status = s.statuses[n]
+			}
+		}
+		s.mu.Unlock()
+
+		if s.hang[n] {
+			<-r.Context().Done()
+			s.cancelled <- n
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *hedgeServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.n
+}
+
+func TestHedging(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		hang       []int
+		statuses   []int
+		opts       []Option
+		wantStatus int
+		wantCount  int
+	}{
+		{
+			name:       "fast first copy",
+			statuses:   []int{200},
+			opts:       []Option{WithHedging(time.Hour, 2)},
+			wantStatus: 200,
+			wantCount:  1,
+		},
+		{
+			name:       "hedge beats a hung copy",
+			hang:       []int{0},
+			statuses:   []int{200},
+			opts:       []Option{WithClock(newStepClock()), WithHedging(time.Millisecond, 1)},
+			wantStatus: 200,
+			wantCount:  2,
+		},
+		{
+			name:       "failed copy hedged at once",
+			statuses:   []int{503, 200},
+			opts:       []Option{WithHedging(time.Hour, 1)},
+			wantStatus: 200,
+			wantCount:  2,
+		},
+		{
+			name:       "every copy fails",
+			statuses:   []int{503},
+			opts:       []Option{WithHedging(time.Hour, 2)},
+			wantStatus: 503,
+			wantCount:  3,
+		},
+		{
+			name:       "unsafe method not hedged",
+			method:     http.MethodPost,
+			statuses:   []int{503, 200},
+			opts:       []Option{WithHedging(time.Hour, 1)},
+			wantStatus: 503,
+			wantCount:  1,
+		},
+		{
+			name:       "hedging disabled",
+			statuses:   []int{503, 200},
+			opts:       []Option{WithHedging(time.Hour, 0)},
+			wantStatus: 503,
+			wantCount:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newHedgeServer(t, tt.hang, tt.statuses...)
+			c := NewRetryableClient(append([]Option{WithMaxRetries(0)}, tt.opts...)...)
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, _ := http.NewRequest(method, srv.URL, strings.NewReader(""))
+			resp, err := c.Do(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			drainBody(resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if srv.count() != tt.wantCount {
+				t.Errorf("server received %d requests, want %d", srv.count(), tt.wantCount)
+			}
+			for range tt.hang {
+				select {
+				case <-srv.cancelled:
+				case <-time.After(5 * time.Second):
+					t.Fatal("the losing copy was not cancelled")
+				}
+			}
+		})
+	}
+}
+
+// bodyTracker is a transport recording whether the body of each response it
+// returns was closed, by status.
+type bodyTracker struct {
+	mu     sync.Mutex
+	closed map[int]bool
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	tracker *bodyTracker
+	status  int
+}
+
+func (b trackedBody) Close() error {
+	b.tracker.mu.Lock()
+	b.tracker.closed[b.status] = true
+	b.tracker.mu.Unlock()
+
+	return b.ReadCloser.Close()
+}
+
+func (tr *bodyTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil {
+		tr.mu.Lock()
+		tr.closed[resp.StatusCode] = false
+		tr.mu.Unlock()
+		resp.Body = trackedBody{ReadCloser: resp.Body, tracker: tr, status: resp.StatusCode}
+	}
+
+	return resp, err
+}
+
+func TestHedgingClosesLosers(t *testing.T) {
+	srv := newHedgeServer(t, nil, 503, 200)
+	tracker := &bodyTracker{closed: map[int]bool{}}
+	c := NewRetryableClient(WithMaxRetries(0), WithHedging(time.Hour, 1), WithHTTPClient(&http.Client{Transport: tracker}))
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := c.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer drainBody(resp)
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if resp.StatusCode != http.StatusOK || tracker.closed[http.StatusOK] {
+		t.Errorf("status = %d, winning body closed: %v", resp.StatusCode, tracker.closed[http.StatusOK])
+	}
+	if closed, ok := tracker.closed[http.StatusServiceUnavailable]; !ok || !closed {
+		t.Error("body of the failed copy left open")
+	}
+}
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fastBackoff retries at once, so tests do not wait.
+var fastBackoff = WithBackoff(ExponentialBackoff{Base: time.Millisecond, Max: time.Millisecond, Jitter: NoJitter})
+
+// scriptServer answers the nth request with statuses[n], repeating the last
+// status, and counts the requests it received.
+type scriptServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func newScriptServer(t *testing.T, statuses ...int) *scriptServer {
+	t.Helper()
+
+	s := &scriptServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *scriptServer) serve(w http.ResponseWriter, r *http.Request) {
+	body := new(strings.Builder)
+	io.Copy(body, r.Body)
+
+	s.mu.Lock()
+	n := len(s.requests)
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, body.String())
+	status := http.StatusOK
+	if len(s.statuses) > 0 {
+		status = s.statuses[len(s.statuses)-1]
+		if n < len(s.statuses) {
+			status = s.statuses[n]
+		}
+	}
+	s.mu.Unlock()
+
+	w.WriteHeader(status)
+}
+
+// count returns how many requests the server received.
+func (s *scriptServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.requests)
+}
+
+// request returns the nth request received and its body.
+func (s *scriptServer) request(n int) (*http.Request, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[n], s.bodies[n]
+}
+
+// stepClock is a Clock whose waits return at once, moving its time forward
+// and recording how long they were. onWait, if set, is called with every
+// wait.
+type stepClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	waits  []time.Duration
+	onWait func(n int, d time.Duration)
+}
+
+func newStepClock() *stepClock {
+	return &stepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *stepClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *stepClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+	c.waits = append(c.waits, d)
+	n, now, onWait := len(c.waits), c.now, c.onWait
+	c.mu.Unlock()
+
+	if onWait != nil {
+		onWait(n, d)
+	}
+	ch := make(chan time.Time, 1)
+	ch <- now
+
+	return ch
+}
+
+// Advance moves the clock forward by d without waiting.
+func (c *stepClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Waits returns the durations waited so far.
+func (c *stepClock) Waits() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]time.Duration(nil), c.waits...)
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
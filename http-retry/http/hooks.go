@@ -0,0 +1,84 @@
+package http
+
+import (
+	"net/http"
+	"time"
+)
+
+// Hooks are callbacks invoked around the attempts of a request. Any field may
+// be nil. attempt is always 1-based.
+type Hooks struct {
+	// OnRequest is called before every attempt with the request about to be
+	// sent, which may be modified, e.g. to refresh headers.
+	OnRequest func(req *http.Request, attempt int)
+	// OnResponse is called after every attempt with its outcome.
+	OnResponse func(req *http.Request, resp *http.Response, err error, attempt int)
+	// OnRetry is called when an attempt failed and the next one will be sent
+	// after delay.
+	OnRetry func(req *http.Request, resp *http.Response, err error, attempt int, delay time.Duration)
+	// OnGiveUp is called when the client stops retrying.
+	OnGiveUp func(req *http.Request, err *RetryError)
+}
+
+// BeforeAttemptFunc prepares req for its attempt-th attempt, e.g. with a fresh
+// timestamp, nonce or trace ID. An error aborts the request.
+type BeforeAttemptFunc func(attempt int, req *http.Request) error
+
+// Middleware wraps the transport used for every single attempt.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// hookList runs several Hooks in the order they were registered.
+type hookList []Hooks
+
+func (l hookList) onRequest(req *http.Request, attempt int) {
+	for _, h := range l {
+		if h.OnRequest != nil {
+			h.OnRequest(req, attempt)
+		}
+	}
+}
+
+func (l hookList) onResponse(req *http.Request, resp *http.Response, err error, attempt int) {
+	for _, h := range l {
+		if h.OnResponse != nil {
+			h.OnResponse(req, resp, err, attempt)
+		}
+	}
+}
+
+func (l hookList) onRetry(req *http.Request, resp *http.Response, err error, attempt int, delay time.Duration) {
+	for _, h := range l {
+		if h.OnRetry != nil {
+			h.OnRetry(req, resp, err, attempt, delay)
+		}
+	}
+}
+
+func (l hookList) onGiveUp(req *http.Request, err *RetryError) {
+	for _, h := range l {
+		if h.OnGiveUp != nil {
+			h.OnGiveUp(req, err)
+		}
+	}
+}
+
+// beforeAttempt runs the BeforeAttemptFuncs on req, stopping at the first
+// error.
+func (c *config) beforeAttempt(req *http.Request, attempt int) error {
+	for _, f := range c.before {
+		if err := f(attempt, req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// chain wraps base with middleware, the first one ending up outermost.
+func chain(base http.RoundTripper, middleware []Middleware) http.RoundTripper {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		base = middleware[i](base)
+	}
+
+	return base
+}
@@ -0,0 +1,213 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventLog records hook calls and middleware passes as strings.
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, fmt.Sprintf(format, args...))
+}
+
+func (l *eventLog) hooks(name string) Hooks {
+	return Hooks{
+		OnRequest: func(req *http.Request, attempt int) { l.add("%s request %d", name, attempt) },
+		OnResponse: func(req *http.Request, resp *http.Response, err error, attempt int) {
+			if err != nil {
+				l.add("%s response %d error", name, attempt)
+				return
+			}
+			l.add("%s response %d %d", name, attempt, resp.StatusCode)
+		},
+		OnRetry: func(req *http.Request, resp *http.Response, err error, attempt int, delay time.Duration) {
+			l.add("%s retry %d", name, attempt)
+		},
+		OnGiveUp: func(req *http.Request, err *RetryError) { l.add("%s give up %d", name, len(err.Attempts)) },
+	}
+}
+
+func (l *eventLog) middleware(name string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			l.add("%s in", name)
+			resp, err := next.RoundTrip(req)
+			l.add("%s out", name)
+			return resp, err
+		})
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestHooks(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		opts     func(l *eventLog) []Option
+		want     []string
+	}{
+		{
+			name:     "success",
+			statuses: []int{200},
+			opts:     func(l *eventLog) []Option { return []Option{WithHooks(l.hooks("h"))} },
+			want:     []string{"h request 1", "h response 1 200"},
+		},
+		{
+			name:     "retried",
+			statuses: []int{503, 200},
+			opts:     func(l *eventLog) []Option { return []Option{WithHooks(l.hooks("h"))} },
+			want:     []string{"h request 1", "h response 1 503", "h retry 1", "h request 2", "h response 2 200"},
+		},
+		{
+			name:     "given up",
+			statuses: []int{503},
+			opts:     func(l *eventLog) []Option { return []Option{WithHooks(l.hooks("h")), WithMaxRetries(1)} },
+			want: []string{
+				"h request 1", "h response 1 503", "h retry 1",
+				"h request 2", "h response 2 503", "h give up 2",
+			},
+		},
+		{
+			name:     "hooks in registration order",
+			statuses: []int{200},
+			opts: func(l *eventLog) []Option {
+				return []Option{WithHooks(l.hooks("a")), WithHooks(l.hooks("b"))}
+			},
+			want: []string{"a request 1", "b request 1", "a response 1 200", "b response 1 200"},
+		},
+		{
+			name:     "empty hooks",
+			statuses: []int{503, 200},
+			opts:     func(l *eventLog) []Option { return []Option{WithHooks(Hooks{})} },
+		},
+		{
+			name:     "middleware around every attempt",
+			statuses: []int{503, 200},
+			opts: func(l *eventLog) []Option {
+				return []Option{WithMiddleware(l.middleware("outer"), l.middleware("inner"))}
+			},
+			want: []string{"outer in", "inner in", "inner out", "outer out", "outer in", "inner in", "inner out", "outer out"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			l := &eventLog{}
+			c := NewRetryableClient(append([]Option{fastBackoff, WithMaxRetryAfter(0)}, tt.opts(l)...)...)
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+			if err == nil {
+				drainBody(resp)
+			}
+			if !reflect.DeepEqual(l.events, tt.want) {
+				t.Errorf("events = %q, want %q", l.events, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnRequestModifiesAttempts(t *testing.T) {
+	srv := newScriptServer(t, 503, 200)
+	c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0), WithHooks(Hooks{
+		OnRequest: func(req *http.Request, attempt int) { req.Header.Set("X-Attempt", fmt.Sprint(attempt)) },
+	}))
+
+	resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainBody(resp)
+	for i := 0; i < 2; i++ {
+		if r, _ := srv.request(i); r.Header.Get("X-Attempt") != fmt.Sprint(i+1) {
+			t.Errorf("attempt %d X-Attempt = %q", i+1, r.Header.Get("X-Attempt"))
+		}
+	}
+}
+
+func TestWithBeforeAttempt(t *testing.T) {
+	errNonce := errors.New("no nonce")
+	tests := []struct {
+		name     string
+		statuses []int
+		// failAt is the attempt the second BeforeAttemptFunc fails, if any.
+		failAt    int
+		wantErr   bool
+		wantCount int
+	}{
+		{name: "every attempt", statuses: []int{503, 503, 200}, wantCount: 3},
+		{name: "error ends the request", statuses: []int{503, 200}, failAt: 2, wantErr: true, wantCount: 1},
+		{name: "error before the first attempt", statuses: []int{200}, failAt: 1, wantErr: true, wantCount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			var order []string
+			c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0),
+				WithBeforeAttempt(func(attempt int, req *http.Request) error {
+					order = append(order, "nonce")
+					req.Header.Set("X-Nonce", fmt.Sprint("n", attempt))
+					return nil
+				}),
+				WithBeforeAttempt(func(attempt int, req *http.Request) error {
+					order = append(order, "timestamp")
+					if attempt == tt.failAt {
+						return errNonce
+					}
+					req.Header.Set("X-Timestamp", fmt.Sprint(attempt))
+					return nil
+				}),
+				WithSigner(SignerFunc(func(req *http.Request) error {
+					// Signers see the fresh values
+					req.Header.Set("X-Signed", req.Header.Get("X-Nonce")+"/"+req.Header.Get("X-Timestamp"))
+					return nil
+				})),
+			)
+			req := mustNewRequest(t, srv.URL)
+
+			resp, err := c.Do(context.Background(), req)
+			if tt.wantErr {
+				if !errors.Is(err, errNonce) {
+					t.Errorf("Do() error = %v, want %v", err, errNonce)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				drainBody(resp)
+			}
+			if srv.count() != tt.wantCount {
+				t.Fatalf("server received %d requests, want %d", srv.count(), tt.wantCount)
+			}
+			for i := 0; i < srv.count(); i++ {
+				r, _ := srv.request(i)
+				if want := fmt.Sprint("n", i+1, "/", i+1); r.Header.Get("X-Signed") != want {
+					t.Errorf("attempt %d signed %q, want %q", i+1, r.Header.Get("X-Signed"), want)
+				}
+			}
+			if len(order) > 0 && order[0] != "nonce" {
+				t.Errorf("BeforeAttemptFuncs ran in the order %v", order)
+			}
+			if req.Header.Get("X-Nonce") != "" {
+				t.Error("the caller's request was modified")
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+)
+
+// hostProfile is a set of options applied to requests matching pattern.
+type hostProfile struct {
+	pattern string
+	opts    []Option
+}
+
+// WithHostOptions applies opts on top of the client's options for requests
+// whose URL matches pattern, so one client can use a different backoff, retry
+// count or timeout per upstream. pattern is a host such as "api.stripe.com",
+// optionally with a leading "*." to match its subdomains and a path prefix,
+// e.g. "*.internal.example.com/billing/". A port in pattern must match the
+// request's. When several profiles match they are applied in the order they
+// were added, and per-request options still take precedence. Client-level
+// options such as WithHTTPClient and WithMiddleware have no effect here.
+func WithHostOptions(pattern string, opts ...Option) Option {
+	return func(c *config) {
+		p := hostProfile{pattern: strings.ToLower(pattern), opts: opts}
+		c.hostProfiles = append(c.hostProfiles[:len(c.hostProfiles):len(c.hostProfiles)], p)
+	}
+}
+
+// matches reports whether req's URL falls under the profile's pattern.
+func (p hostProfile) matches(req *http.Request) bool {
+	host, prefix := p.pattern, ""
+	if i := strings.Index(host, "/"); i >= 0 {
+		host, prefix = host[:i], host[i:]
+	}
+	if !strings.HasPrefix(req.URL.Path, prefix) {
+		return false
+	}
+
+	reqHost := strings.ToLower(req.URL.Host)
+	if !strings.Contains(host, ":") {
+		reqHost = strings.ToLower(req.URL.Hostname())
+	}
+	if strings.HasPrefix(host, "*.") {
+		return strings.HasSuffix(reqHost, host[1:])
+	}
+
+	return reqHost == host
+}
+
+// forRequest returns the configuration for req: c with the matching host
+// profiles and the per-request options applied, or c itself when none apply.
+func (c *config) forRequest(req *http.Request) *config {
+	var opts []Option
+	for _, p := range c.hostProfiles {
+		if p.matches(req) {
+			opts = append(opts, p.opts...)
+		}
+	}
+	opts = append(opts, requestOptions(req.Context())...)
+	if len(opts) == 0 {
+		return c
+	}
+
+	return c.with(opts...)
+}
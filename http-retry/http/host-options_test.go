@@ -0,0 +1,105 @@
+package http
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHostProfileMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		url     string
+		want    bool
+	}{
+		{pattern: "api.example.com", url: "https://api.example.com/v1", want: true},
+		{pattern: "API.Example.com", url: "https://api.EXAMPLE.com/", want: true},
+		{pattern: "api.example.com", url: "https://other.example.com/", want: false},
+		{pattern: "api.example.com", url: "https://api.example.com:8443/", want: true},
+		{pattern: "api.example.com:8443", url: "https://api.example.com:8443/", want: true},
+		{pattern: "api.example.com:8443", url: "https://api.example.com:9443/", want: false},
+		{pattern: "*.example.com", url: "https://a.b.example.com/", want: true},
+		{pattern: "*.example.com", url: "https://example.com/", want: false},
+		{pattern: "*.example.com", url: "https://badexample.com/", want: false},
+		{pattern: "example.com/billing/", url: "https://example.com/billing/invoices", want: true},
+		{pattern: "example.com/billing/", url: "https://example.com/orders", want: false},
+		{pattern: "*.example.com/billing/", url: "https://eu.example.com/billing/", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.url, func(t *testing.T) {
+			cfg := newConfig(WithHostOptions(tt.pattern))
+			if got := cfg.hostProfiles[0].matches(mustNewRequest(t, tt.url)); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		reqOpts     []Option
+		url         string
+		wantRetries int
+	}{
+		{
+			name:        "no profile",
+			opts:        []Option{WithMaxRetries(1)},
+			url:         "https://api.example.com/",
+			wantRetries: 1,
+		},
+		{
+			name:        "matching profile",
+			opts:        []Option{WithMaxRetries(1), WithHostOptions("api.example.com", WithMaxRetries(5))},
+			url:         "https://api.example.com/",
+			wantRetries: 5,
+		},
+		{
+			name:        "profile for another host",
+			opts:        []Option{WithMaxRetries(1), WithHostOptions("other.example.com", WithMaxRetries(5))},
+			url:         "https://api.example.com/",
+			wantRetries: 1,
+		},
+		{
+			name: "later profile wins",
+			opts: []Option{
+				WithHostOptions("*.example.com", WithMaxRetries(5)),
+				WithHostOptions("api.example.com", WithMaxRetries(7)),
+			},
+			url:         "https://api.example.com/",
+			wantRetries: 7,
+		},
+		{
+			name:        "request options win",
+			opts:        []Option{WithHostOptions("api.example.com", WithMaxRetries(5))},
+			reqOpts:     []Option{WithMaxRetries(2)},
+			url:         "https://api.example.com/",
+			wantRetries: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(tt.opts...)
+			before := cfg.maxRetries
+			req := mustNewRequest(t, tt.url)
+			if tt.reqOpts != nil {
+				req = req.WithContext(WithRequestOptions(context.Background(), tt.reqOpts...))
+			}
+
+			got := cfg.forRequest(req)
+			if got.maxRetries != tt.wantRetries {
+				t.Errorf("maxRetries = %d, want %d", got.maxRetries, tt.wantRetries)
+			}
+			if cfg.maxRetries != before {
+				t.Error("forRequest() changed the client's configuration")
+			}
+		})
+	}
+}
+
+func TestForRequestWithoutOptions(t *testing.T) {
+	cfg := newConfig(WithHostOptions("other.example.com", WithMaxRetries(5)))
+	if cfg.forRequest(mustNewRequest(t, "https://api.example.com/")) != cfg {
+		t.Error("forRequest() copied the configuration with nothing to apply")
+	}
+}
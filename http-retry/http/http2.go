@@ -0,0 +1,35 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// WithHTTP2HealthCheck enables HTTP/2 and sends a ping on a connection that
+// received no frame for readIdleTimeout, closing it if no answer arrives
+// within pingTimeout. A stalled connection then fails its attempts into the
+// retry path instead of hanging until the request deadline. It applies to an
+// *http.Transport, see WithTransport.
+func WithHTTP2HealthCheck(readIdleTimeout, pingTimeout time.Duration) Option {
+	return func(c *config) {
+		c.http2ReadIdleTimeout = readIdleTimeout
+		c.http2PingTimeout = pingTimeout
+	}
+}
+
+// configureHTTP2 enables HTTP/2 on t with the health check settings. t is
+// left on the standard HTTP/2 support if it cannot be configured.
+func (c *config) configureHTTP2(t *http.Transport) {
+	// Start from a clean slate, t may be a copy of a transport already used
+	t.TLSNextProto = nil
+	t.ForceAttemptHTTP2 = true
+
+	h2, err := http2.ConfigureTransports(t)
+	if err != nil {
+		return
+	}
+	h2.ReadIdleTimeout = c.http2ReadIdleTimeout
+	h2.PingTimeout = c.http2PingTimeout
+}
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithHTTP2HealthCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantProto int
+	}{
+		{name: "HTTP/2", opts: []Option{WithHTTP2HealthCheck(time.Second, time.Second)}, wantProto: 2},
+		{name: "disabled", opts: []Option{WithHTTP2HealthCheck(0, time.Second)}, wantProto: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			srv.EnableHTTP2 = true
+			srv.StartTLS()
+			defer srv.Close()
+			// A transport without HTTP/2 set up, like one with a custom TLS configuration
+			base := &http.Transport{TLSClientConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig}
+			c := NewRetryableClient(append([]Option{WithTransport(base)}, tt.opts...)...)
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			drainBody(resp)
+			if resp.ProtoMajor != tt.wantProto {
+				t.Errorf("response over %s, want HTTP/%d", resp.Proto, tt.wantProto)
+			}
+		})
+	}
+}
+
+func TestConfigureHTTP2Clone(t *testing.T) {
+	// Configuring a copy of a transport with HTTP/2 already set up must not
+	// fail on the registered h2 protocol
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	tr := newConfig(WithHTTP2HealthCheck(time.Second, time.Second)).baseTransport(base).(*http.Transport)
+
+	if _, ok := tr.TLSNextProto["h2"]; !ok || !tr.ForceAttemptHTTP2 {
+		t.Error("HTTP/2 not configured")
+	}
+	if tr == base {
+		t.Error("base transport changed instead of a copy")
+	}
+}
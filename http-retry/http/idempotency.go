@@ -0,0 +1,75 @@
+package http
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// DefaultIdempotencyKeyHeader is the header used by WithIdempotencyKey.
+const DefaultIdempotencyKeyHeader = "Idempotency-Key"
+
+// newIdempotencyKey returns a random version 4 UUID.
+func newIdempotencyKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// idempotencyKey returns the key to send with every attempt of req, or "" if
+// req does not need one. A key already set by the caller is kept.
+func (c *config) idempotencyKey(req *http.Request) (string, error) {
+	if c.idempotencyHeader == "" ||
+		(req.Method != http.MethodPost && req.Method != http.MethodPatch) ||
+		req.Header.Get(c.idempotencyHeader) != "" {
+		return "", nil
+	}
+
+	return newIdempotencyKey()
+}
+
+// idempotentMethods are the methods of RFC 7231 whose requests may be sent
+// more than once with the same effect. "" is GET.
+var idempotentMethods = map[string]bool{
+	"":                 true,
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// WithRetryUnsafeMethods lets requests with a non-idempotent method, such as
+// POST and PATCH, be retried and hedged even without an idempotency key.
+// Only use it, e.g. per request, where a duplicated write is harmless.
+func WithRetryUnsafeMethods() Option {
+	return func(c *config) {
+		c.retryUnsafe = true
+	}
+}
+
+// mayResend tells whether req may be sent more than once: its method is
+// idempotent, it carries an idempotency key or unsafe retries are enabled.
+func (c *config) mayResend(req *http.Request) bool {
+	if c.retryUnsafe || idempotentMethods[req.Method] {
+		return true
+	}
+
+	return req.Header.Get(c.idempotencyKeyHeader()) != ""
+}
+
+// idempotencyKeyHeader returns the header holding idempotency keys, even when
+// the client does not generate them.
+func (c *config) idempotencyKeyHeader() string {
+	if c.idempotencyHeader == "" {
+		return DefaultIdempotencyKeyHeader
+	}
+
+	return c.idempotencyHeader
+}
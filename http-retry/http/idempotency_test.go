@@ -0,0 +1,163 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewIdempotencyKey(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		key, err := newIdempotencyKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !uuidV4.MatchString(key) {
+			t.Fatalf("key %q is not a version 4 UUID", key)
+		}
+		if seen[key] {
+			t.Fatalf("key %q generated twice", key)
+		}
+		seen[key] = true
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		header    http.Header
+		opts      []Option
+		wantCount int
+		// wantKey is the header expected to carry the same key on every
+		// attempt, wantValue the key itself when known.
+		wantKey   string
+		wantValue string
+	}{
+		{
+			name:      "POST keyed and retried",
+			method:    http.MethodPost,
+			opts:      []Option{WithIdempotencyKey()},
+			wantCount: 2,
+			wantKey:   DefaultIdempotencyKeyHeader,
+		},
+		{
+			name:      "PATCH keyed",
+			method:    http.MethodPatch,
+			opts:      []Option{WithIdempotencyKey()},
+			wantCount: 2,
+			wantKey:   DefaultIdempotencyKeyHeader,
+		},
+		{
+			name:      "custom header",
+			method:    http.MethodPost,
+			opts:      []Option{WithIdempotencyKeyHeader("X-Request-Key")},
+			wantCount: 2,
+			wantKey:   "X-Request-Key",
+		},
+		{
+			name:      "caller key kept",
+			method:    http.MethodPost,
+			header:    http.Header{DefaultIdempotencyKeyHeader: {"mine"}},
+			opts:      []Option{WithIdempotencyKey()},
+			wantCount: 2,
+			wantKey:   DefaultIdempotencyKeyHeader,
+			wantValue: "mine",
+		},
+		{
+			name:      "caller key retried without the option",
+			method:    http.MethodPost,
+			header:    http.Header{DefaultIdempotencyKeyHeader: {"mine"}},
+			wantCount: 2,
+			wantKey:   DefaultIdempotencyKeyHeader,
+			wantValue: "mine",
+		},
+		{
+			name:      "POST without a key not retried",
+			method:    http.MethodPost,
+			wantCount: 1,
+		},
+		{
+			name:      "disabled",
+			method:    http.MethodPost,
+			opts:      []Option{WithIdempotencyKey(), WithIdempotencyKeyHeader("")},
+			wantCount: 1,
+		},
+		{
+			name:      "unsafe retries",
+			method:    http.MethodPost,
+			opts:      []Option{WithRetryUnsafeMethods()},
+			wantCount: 2,
+		},
+		{
+			name:      "PUT not keyed",
+			method:    http.MethodPut,
+			opts:      []Option{WithIdempotencyKey()},
+			wantCount: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, http.StatusServiceUnavailable, http.StatusOK)
+			c := NewRetryableClient(append([]Option{fastBackoff, WithMaxRetryAfter(0)}, tt.opts...)...)
+
+			req, _ := http.NewRequest(tt.method, srv.URL, strings.NewReader("payload"))
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			resp, err := c.Do(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			drainBody(resp)
+			if srv.count() != tt.wantCount {
+				t.Fatalf("server received %d requests, want %d", srv.count(), tt.wantCount)
+			}
+
+			first, _ := srv.request(0)
+			for _, name := range []string{DefaultIdempotencyKeyHeader, "X-Request-Key"} {
+				if name != tt.wantKey && first.Header.Get(name) != "" {
+					t.Errorf("unexpected %s header %q", name, first.Header.Get(name))
+				}
+			}
+			if tt.wantKey == "" {
+				return
+			}
+			key := first.Header.Get(tt.wantKey)
+			if tt.wantValue != "" && key != tt.wantValue {
+				t.Errorf("%s = %q, want %q", tt.wantKey, key, tt.wantValue)
+			}
+			if tt.wantValue == "" && !uuidV4.MatchString(key) {
+				t.Errorf("%s = %q, want a generated key", tt.wantKey, key)
+			}
+			for i := 1; i < srv.count(); i++ {
+				if r, _ := srv.request(i); r.Header.Get(tt.wantKey) != key {
+					t.Errorf("attempt %d %s = %q, want %q", i+1, tt.wantKey, r.Header.Get(tt.wantKey), key)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyPerRequest(t *testing.T) {
+	srv := newScriptServer(t, http.StatusOK)
+	c := NewRetryableClient(WithIdempotencyKey())
+	for i := 0; i < 2; i++ {
+		resp, err := c.PostContext(context.Background(), srv.URL, "text/plain", "payload")
+		if err != nil {
+			t.Fatal(err)
+		}
+		drainBody(resp)
+	}
+
+	a, _ := srv.request(0)
+	b, _ := srv.request(1)
+	if a.Header.Get(DefaultIdempotencyKeyHeader) == b.Header.Get(DefaultIdempotencyKeyHeader) {
+		t.Error("two requests shared an idempotency key")
+	}
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxErrorBody bounds the part of an error response kept in a StatusError.
+const maxErrorBody = 4 << 10
+
+// GetJSON fetches url and decodes the JSON response into out.
+func (c *RetryableClient) GetJSON(ctx context.Context, url string, out interface{}) error {
+	return c.DoJSON(ctx, http.MethodGet, url, nil, out)
+}
+
+// PostJSON posts in encoded as JSON to url and decodes the response into out.
+// Like any POST, it is only retried with an idempotency key or unsafe retries,
+// see WithIdempotencyKey and WithRetryUnsafeMethods.
+func (c *RetryableClient) PostJSON(ctx context.Context, url string, in, out interface{}) error {
+	return c.DoJSON(ctx, http.MethodPost, url, in, out)
+}
+
+// DoJSON sends a request with in encoded as JSON, unless in is nil, and
+// decodes the JSON response into out, unless out is nil. The body is encoded
+// again for every attempt. Non-2xx responses are returned as *StatusError.
+func (c *RetryableClient) DoJSON(ctx context.Context, method, url string, in, out interface{}) error {
+	var body interface{}
+	if in != nil {
+		body = jsonBody(in)
+	}
+
+	req, err := NewRequest(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return c.current().decodeJSON(resp, out)
+}
+
+// jsonBody returns a body encoding in as JSON for every attempt.
+func jsonBody(in interface{}) BodyFunc {
+	return func() (io.ReadCloser, error) {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+}
+
+// decodeJSON decodes the JSON body of resp into out, unless out is nil, and
+// releases resp. Non-2xx responses are returned as *StatusError.
+func (c *config) decodeJSON(resp *http.Response, out interface{}) error {
+	defer drainBody(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return c.statusError(resp)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// statusError reads the start of resp's body into a *StatusError, telling
+// whether the retry policy considers its status retryable.
+func (c *config) statusError(resp *http.Response) *StatusError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	cfg := c
+	if resp.Request != nil {
+		cfg = c.forRequest(resp.Request)
+	}
+
+	return &StatusError{
+		Code:      resp.StatusCode,
+		Header:    resp.Header,
+		Body:      body,
+		Retryable: cfg.policy.ShouldRetry(resp, nil, 1),
+	}
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type jsonItem struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// jsonStep is an answer of the server in TestDoJSON, the last one repeating.
+type jsonStep struct {
+	status int
+	body   string
+}
+
+func TestDoJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		in        interface{}
+		steps     []jsonStep
+		want      jsonItem
+		wantErr   func(error) bool
+		wantCount int
+	}{
+		{
+			name:      "decoded",
+			method:    http.MethodGet,
+			steps:     []jsonStep{{200, `{"name":"a","count":2}`}},
+			want:      jsonItem{Name: "a", Count: 2},
+			wantCount: 1,
+		},
+		{
+			name:      "retried",
+			method:    http.MethodGet,
+			steps:     []jsonStep{{503, ""}, {200, `{"name":"b"}`}},
+			want:      jsonItem{Name: "b"},
+			wantCount: 2,
+		},
+		{
+			name:      "PUT body encoded for every attempt",
+			method:    http.MethodPut,
+			in:        jsonItem{Name: "sent", Count: 1},
+			steps:     []jsonStep{{503, ""}, {200, `{"name":"stored"}`}},
+			want:      jsonItem{Name: "stored"},
+			wantCount: 2,
+		},
+		{
+			name:      "no content",
+			method:    http.MethodDelete,
+			steps:     []jsonStep{{204, ""}},
+			wantCount: 1,
+		},
+		{
+			name:   "status error",
+			method: http.MethodGet,
+			steps:  []jsonStep{{404, `{"error":"missing"}`}},
+			wantErr: func(err error) bool {
+				var statusErr *StatusError
+				return errors.As(err, &statusErr) && statusErr.Code == 404 &&
+					string(statusErr.Body) == `{"error":"missing"}` && errors.Is(err, ErrNonRetryableStatus)
+			},
+			wantCount: 1,
+		},
+		{
+			name:      "invalid JSON",
+			method:    http.MethodGet,
+			steps:     []jsonStep{{200, `{"name":`}},
+			wantErr:   func(err error) bool { return err != nil },
+			wantCount: 1,
+		},
+		{
+			name:      "unencodable input",
+			method:    http.MethodPut,
+			in:        map[string]interface{}{"f": func() {}},
+			wantErr:   func(err error) bool { return err != nil },
+			wantCount: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []*http.Request
+			var bodies []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				mu.Lock()
+				n := len(requests)
+				requests = append(requests, r)
+				bodies = append(bodies, string(body))
+				mu.Unlock()
+
+				step := tt.steps[len(tt.steps)-1]
+				if n < len(tt.steps) {
+					step = tt.steps[n]
+				}
+				w.WriteHeader(step.status)
+				w.Write([]byte(step.body))
+			}))
+			defer srv.Close()
+			c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0))
+
+			var got jsonItem
+			err := c.DoJSON(context.Background(), tt.method, srv.URL, tt.in, &got)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("DoJSON() error = %v", err)
+				}
+			} else if err != nil || got != tt.want {
+				t.Errorf("DoJSON() = %+v, %v, want %+v", got, err, tt.want)
+			}
+
+			if len(requests) != tt.wantCount {
+				t.Fatalf("server received %d requests, want %d", len(requests), tt.wantCount)
+			}
+			for i, r := range requests {
+				if r.Header.Get("Accept") != "application/json" {
+					t.Errorf("attempt %d Accept = %q", i+1, r.Header.Get("Accept"))
+				}
+				wantType, wantBody := "", ""
+				if tt.in != nil {
+					wantType, wantBody = "application/json", `{"name":"sent","count":1}`
+				}
+				if r.Header.Get("Content-Type") != wantType || bodies[i] != wantBody {
+					t.Errorf("attempt %d sent %q as %q, want %q as %q", i+1, bodies[i], r.Header.Get("Content-Type"), wantBody, wantType)
+				}
+			}
+		})
+	}
+}
+
+func TestDoJSONWithoutOutput(t *testing.T) {
+	srv := newScriptServer(t, 200)
+	c := NewRetryableClient()
+	if err := c.DoJSON(context.Background(), http.MethodGet, srv.URL, nil, nil); err != nil {
+		t.Errorf("DoJSON() with a nil out error = %v", err)
+	}
+}
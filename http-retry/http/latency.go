@@ -0,0 +1,168 @@
+package http
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// Histogram buckets grow by a factor of sqrt(2) from minLatencyBucket,
+	// latencyBuckets of them covering up to about 17 minutes.
+	latencyBuckets   = 41
+	minLatencyBucket = time.Millisecond
+
+	// latencyWindowSize is how long an observation counts towards percentiles,
+	// between one and two windows, so they follow changes of the upstream.
+	latencyWindowSize = time.Minute
+)
+
+// latencyHistogram counts attempt durations in exponential buckets.
+type latencyHistogram struct {
+	counts [latencyBuckets]int64
+	total  int64
+}
+
+func latencyBucket(d time.Duration) int {
+	if d <= minLatencyBucket {
+		return 0
+	}
+	i := int(math.Ceil(2 * math.Log2(float64(d)/float64(minLatencyBucket))))
+	if i >= latencyBuckets {
+		return latencyBuckets - 1
+	}
+
+	return i
+}
+
+// bucketBound returns the upper bound of bucket i.
+func bucketBound(i int) time.Duration {
+	return time.Duration(float64(minLatencyBucket) * math.Pow(2, float64(i)/2))
+}
+
+// latencyWindow keeps the histograms of the current and the previous window.
+type latencyWindow struct {
+	started       time.Time
+	current, prev latencyHistogram
+}
+
+func (w *latencyWindow) rotate(now time.Time) {
+	switch age := now.Sub(w.started); {
+	case age >= 2*latencyWindowSize:
+		w.prev, w.current = latencyHistogram{}, latencyHistogram{}
+		w.started = now
+	case age >= latencyWindowSize:
+		w.prev, w.current = w.current, latencyHistogram{}
+		w.started = w.started.Add(latencyWindowSize)
+	}
+}
+
+func (w *latencyWindow) observe(d time.Duration, now time.Time) {
+	w.rotate(now)
+	w.current.counts[latencyBucket(d)]++
+	w.current.total++
+}
+
+// quantile returns the upper bound of the bucket holding the q-quantile of
+// the recent attempts, zero without any.
+func (w *latencyWindow) quantile(q float64, now time.Time) time.Duration {
+	w.rotate(now)
+	total := w.current.total + w.prev.total
+	if total == 0 {
+		return 0
+	}
+
+	rank := int64(math.Ceil(q * float64(total)))
+	var seen int64
+	for i := 0; i < latencyBuckets; i++ {
+		seen += w.current.counts[i] + w.prev.counts[i]
+		if seen >= rank {
+			return bucketBound(i)
+		}
+	}
+
+	return bucketBound(latencyBuckets - 1)
+}
+
+// LatencyStats summarizes the attempts recently made to a host, over the last
+// one to two minutes. Percentiles are approximate, rounded up to the bucket of
+// a histogram whose buckets grow by a factor of about 1.4.
+type LatencyStats struct {
+	Count         int64
+	P50, P90, P99 time.Duration
+}
+
+func (e *latencyEstimator) stats(host string, now time.Time) LatencyStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	w, ok := e.histograms[host]
+	if !ok {
+		return LatencyStats{}
+	}
+
+	stats := LatencyStats{
+		P50: w.quantile(0.5, now),
+		P90: w.quantile(0.9, now),
+		P99: w.quantile(0.99, now),
+	}
+	stats.Count = w.current.total + w.prev.total
+
+	return stats
+}
+
+// Latency returns the latency of the attempts recently made to host, as in
+// req.URL.Host.
+func (c *RetryableClient) Latency(host string) LatencyStats {
+	cfg := c.current()
+	return cfg.latency.stats(host, cfg.clock.Now())
+}
+
+// AdaptiveBackoff is an exponential backoff whose first wait is Factor times
+// the host's recent p99 latency, bounded by Min and Max, so a fast service is
+// retried quickly and a slow one is given time to recover. Until the client
+// has seen any attempt to the host it starts from Min. Multiplier and Jitter
+// work as for ExponentialBackoff.
+type AdaptiveBackoff struct {
+	// Factor scales the p99 latency, default 1.
+	Factor     float64
+	Min        time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     Jitter
+}
+
+// Backoff waits as if no latency had been observed yet.
+func (b AdaptiveBackoff) Backoff(retries int, prev time.Duration) time.Duration {
+	return b.backoffFor(0, retries, prev)
+}
+
+func (b AdaptiveBackoff) backoffFor(p99 time.Duration, retries int, prev time.Duration) time.Duration {
+	factor := b.Factor
+	if factor <= 0 {
+		factor = 1
+	}
+
+	base := time.Duration(factor * float64(p99))
+	if base < b.Min {
+		base = b.Min
+	}
+	if b.Max > 0 && base > b.Max {
+		base = b.Max
+	}
+
+	return ExponentialBackoff{Base: base, Max: b.Max, Multiplier: b.Multiplier, Jitter: b.Jitter}.Backoff(retries, prev)
+}
+
+// latencyBackoff is a Backoff depending on the host's latency.
+type latencyBackoff interface {
+	backoffFor(p99 time.Duration, retries int, prev time.Duration) time.Duration
+}
+
+// nextBackoff returns the wait before the next retry of a request to host.
+func (c *config) nextBackoff(host string, retries int, prev time.Duration) time.Duration {
+	if b, ok := c.backoff.(latencyBackoff); ok {
+		return nonNegative(b.backoffFor(c.latency.stats(host, c.clock.Now()).P99, retries, prev))
+	}
+
+	return backoffDelay(c.backoff, retries, prev)
+}
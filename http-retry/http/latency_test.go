@@ -0,0 +1,141 @@
+package http
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLatencyBucket(t *testing.T) {
+	tests := []struct {
+		d         time.Duration
+		want      int
+		wantBound time.Duration
+	}{
+		{d: 0, want: 0, wantBound: time.Millisecond},
+		{d: time.Millisecond, want: 0, wantBound: time.Millisecond},
+		{d: 2 * time.Millisecond, want: 2, wantBound: 2 * time.Millisecond},
+		{d: 3 * time.Millisecond, want: 4, wantBound: 4 * time.Millisecond},
+		{d: time.Second, want: 20, wantBound: 1024 * time.Millisecond},
+		{d: time.Hour, want: latencyBuckets - 1, wantBound: 1048576 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		got := latencyBucket(tt.d)
+		if got != tt.want || bucketBound(got) != tt.wantBound {
+			t.Errorf("latencyBucket(%v) = %d, bound %v, want %d, bound %v", tt.d, got, bucketBound(got), tt.want, tt.wantBound)
+		}
+	}
+}
+
+func TestLatencyStats(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type observation struct {
+		d     time.Duration
+		n     int
+		after time.Duration
+	}
+	tests := []struct {
+		name         string
+		observations []observation
+		// at is when the stats are read, after start.
+		at   time.Duration
+		want LatencyStats
+	}{
+		{name: "none"},
+		{
+			name:         "steady",
+			observations: []observation{{d: 2 * time.Millisecond, n: 100}},
+			want:         LatencyStats{Count: 100, P50: 2 * time.Millisecond, P90: 2 * time.Millisecond, P99: 2 * time.Millisecond},
+		},
+		{
+			name:         "slow tail",
+			observations: []observation{{d: 2 * time.Millisecond, n: 95}, {d: time.Second, n: 5}},
+			want:         LatencyStats{Count: 100, P50: 2 * time.Millisecond, P90: 2 * time.Millisecond, P99: 1024 * time.Millisecond},
+		},
+		{
+			name:         "previous window",
+			observations: []observation{{d: 2 * time.Millisecond, n: 10}, {d: 4 * time.Millisecond, n: 10, after: 90 * time.Second}},
+			at:           90 * time.Second,
+			want:         LatencyStats{Count: 20, P50: 2 * time.Millisecond, P90: 4 * time.Millisecond, P99: 4 * time.Millisecond},
+		},
+		{
+			name:         "expired",
+			observations: []observation{{d: 2 * time.Millisecond, n: 10}, {d: 4 * time.Millisecond, n: 10, after: 130 * time.Second}},
+			at:           130 * time.Second,
+			want:         LatencyStats{Count: 10, P50: 4 * time.Millisecond, P90: 4 * time.Millisecond, P99: 4 * time.Millisecond},
+		},
+		{
+			name:         "all expired",
+			observations: []observation{{d: 2 * time.Millisecond, n: 10}},
+			at:           2 * time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newLatencyEstimator()
+			for _, o := range tt.observations {
+				for i := 0; i < o.n; i++ {
+					e.observe("example.com", o.d, start.Add(o.after))
+				}
+			}
+
+			if got := e.stats("example.com", start.Add(tt.at)); got != tt.want {
+				t.Errorf("stats = %+v, want %+v", got, tt.want)
+			}
+			if got := e.stats("other.example.com", start.Add(tt.at)); got != (LatencyStats{}) {
+				t.Errorf("stats of another host = %+v", got)
+			}
+		})
+	}
+}
+
+func TestAdaptiveBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff AdaptiveBackoff
+		p99     time.Duration
+		retries int
+		want    time.Duration
+	}{
+		{name: "no latency", backoff: AdaptiveBackoff{Min: 10 * time.Millisecond, Max: time.Second, Jitter: NoJitter}, want: 10 * time.Millisecond},
+		{name: "p99", backoff: AdaptiveBackoff{Min: 10 * time.Millisecond, Max: time.Second, Jitter: NoJitter}, p99: 100 * time.Millisecond, want: 100 * time.Millisecond},
+		{name: "factor", backoff: AdaptiveBackoff{Factor: 3, Min: 10 * time.Millisecond, Max: time.Second, Jitter: NoJitter}, p99: 100 * time.Millisecond, want: 300 * time.Millisecond},
+		{name: "min", backoff: AdaptiveBackoff{Min: 10 * time.Millisecond, Max: time.Second, Jitter: NoJitter}, p99: time.Millisecond, want: 10 * time.Millisecond},
+		{name: "max", backoff: AdaptiveBackoff{Min: 10 * time.Millisecond, Max: time.Second, Jitter: NoJitter}, p99: time.Minute, want: time.Second},
+		{name: "grows", backoff: AdaptiveBackoff{Min: 10 * time.Millisecond, Max: time.Second, Jitter: NoJitter}, p99: 100 * time.Millisecond, retries: 2, want: 400 * time.Millisecond},
+		{name: "grows to max", backoff: AdaptiveBackoff{Min: 10 * time.Millisecond, Max: time.Second, Jitter: NoJitter}, p99: 100 * time.Millisecond, retries: 5, want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backoff.backoffFor(tt.p99, tt.retries, 0); got != tt.want {
+				t.Errorf("backoffFor(%v, %d) = %v, want %v", tt.p99, tt.retries, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveBackoffFollowsLatency(t *testing.T) {
+	srv := newScriptServer(t, 503, 503, 200)
+	host := mustParseURL(t, srv.URL).Host
+	clock := newStepClock()
+	c := NewRetryableClient(WithClock(clock), WithBackoff(AdaptiveBackoff{Factor: 2, Min: time.Millisecond, Max: time.Minute, Jitter: NoJitter}))
+	cfg := c.current()
+	for i := 0; i < 10; i++ {
+		cfg.latency.observe(host, 512*time.Millisecond, clock.Now())
+	}
+
+	resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainBody(resp)
+	// The attempts themselves take no time on the clock, the p99 stays that
+	// of the slow ones
+	if want := []time.Duration{1024 * time.Millisecond, 2048 * time.Millisecond}; !reflect.DeepEqual(clock.Waits(), want) {
+		t.Errorf("waits = %v, want %v", clock.Waits(), want)
+	}
+	if stats := c.Latency(host); stats.Count != 13 || stats.P99 != 512*time.Millisecond {
+		t.Errorf("Latency() = %+v, want the attempts counted", stats)
+	}
+}
@@ -0,0 +1,126 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+
+	rhttp "github.com/kdkumawat/golang/http-retry/http"
+	"github.com/kdkumawat/golang/http-retry/http/rhttptest"
+)
+
+// checkNoLeaks fails t if more goroutines than baseline are still running
+// once the stragglers had time to exit.
+func checkNoLeaks(t *testing.T, baseline int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines running, want at most %d:\n%s", runtime.NumGoroutine(), baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCancelLeavesNothingBehind(t *testing.T) {
+	tests := []struct {
+		name   string
+		script func(*rhttptest.Server)
+		opts   []rhttp.Option
+	}{
+		{
+			name:   "mid-backoff",
+			script: func(s *rhttptest.Server) { s.Respond(http.StatusServiceUnavailable) },
+			opts:   []rhttp.Option{rhttp.WithBackoff(rhttp.ConstantBackoff(time.Hour)), rhttp.WithMaxRetries(5)},
+		},
+		{
+			name:   "mid-Retry-After",
+			script: func(s *rhttptest.Server) { s.Respond(http.StatusTooManyRequests).Header("Retry-After", "30") },
+			opts:   []rhttp.Option{rhttp.WithMaxRetries(5)},
+		},
+		{
+			name:   "mid-hedge-delay",
+			script: func(s *rhttptest.Server) { s.Respond(http.StatusOK).Delay(time.Hour) },
+			opts:   []rhttp.Option{rhttp.WithHedging(time.Hour, 2)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline := runtime.NumGoroutine()
+
+			srv := rhttptest.NewServer()
+			tt.script(srv)
+			clock := rhttptest.NewFakeClock(time.Now())
+			c := rhttp.NewRetryableClient(append([]rhttp.Option{rhttp.WithClock(clock)}, tt.opts...)...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				_, _, err := c.GetBytes(ctx, srv.URL)
+				done <- err
+			}()
+			clock.BlockUntil(1)
+			cancel()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("GetBytes() error = %v, want context.Canceled", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the request did not return once cancelled")
+			}
+			if n := clock.Waiters(); n != 0 {
+				t.Errorf("%d waits left on the clock", n)
+			}
+
+			if err := c.Close(context.Background()); err != nil {
+				t.Errorf("Close() error = %v", err)
+			}
+			srv.Close()
+			checkNoLeaks(t, baseline)
+		})
+	}
+}
+
+func TestCloseCancelsSleepingRetries(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	srv := rhttptest.NewServer()
+	srv.Respond(http.StatusServiceUnavailable)
+	clock := rhttptest.NewFakeClock(time.Now())
+	c := rhttp.NewRetryableClient(rhttp.WithClock(clock), rhttp.WithBackoff(rhttp.ConstantBackoff(time.Hour)))
+
+	const requests = 3
+	done := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			_, _, err := c.GetBytes(context.Background(), srv.URL)
+			done <- err
+		}()
+	}
+	clock.BlockUntil(requests)
+
+	// Give up waiting at once: every sleeping retry is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Close(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Close() error = %v, want context.Canceled", err)
+	}
+	for i := 0; i < requests; i++ {
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("request error = %v, want context.Canceled", err)
+		}
+	}
+	if n := clock.Waiters(); n != 0 {
+		t.Errorf("%d waits left on the clock", n)
+	}
+
+	srv.Close()
+	checkNoLeaks(t, baseline)
+}
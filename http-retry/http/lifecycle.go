@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ErrClientClosed is returned for the requests made once Close was called.
+var ErrClientClosed = errors.New("rhttp: client is closed")
+
+// lifecycle tracks the requests in flight through a client, so Close can
+// wait for them or cancel them.
+type lifecycle struct {
+	mu       sync.Mutex
+	closed   bool
+	seq      uint64
+	inflight map[uint64]context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{inflight: make(map[uint64]context.CancelFunc)}
+}
+
+// enter registers a request, returning its context, cancelled by Close if it
+// gives up waiting, and the function to call once the request is over.
+func (l *lifecycle) enter(ctx context.Context) (context.Context, func(), error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		cancel()
+		return nil, nil, ErrClientClosed
+	}
+	l.seq++
+	id := l.seq
+	l.inflight[id] = cancel
+	l.wg.Add(1)
+
+	var once sync.Once
+	leave := func() {
+		once.Do(func() {
+			l.mu.Lock()
+			delete(l.inflight, id)
+			l.mu.Unlock()
+			cancel()
+			l.wg.Done()
+		})
+	}
+
+	return ctx, leave, nil
+}
+
+// Close stops accepting requests and closes the queue, if any, then waits for
+// the requests in flight, up to reading and closing their response bodies.
+// Once ctx is done, the requests still in flight are cancelled, sleeping
+// retries included, and ctx's error is returned. Idle connections are closed
+// in any case. A client derived with With shares the lifecycle of its parent,
+// closing either closes both. Requests sent through StandardClient are not
+// tracked.
+func (c *RetryableClient) Close(ctx context.Context) error {
+	var err error
+	if c.queue != nil {
+		// The queue delivers through the client, it has to stop first
+		err = c.queue.Close(ctx)
+	}
+
+	l := c.life
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		l.mu.Lock()
+		for _, cancel := range l.inflight {
+			cancel()
+		}
+		l.mu.Unlock()
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+	c.client.CloseIdleConnections()
+
+	return err
+}
+
+// track ties the end of a request to resp, whose body is still read after Do
+// returns. A protocol switch hands the connection over to the caller.
+func track(resp *http.Response, err error, leave func()) (*http.Response, error) {
+	if resp != nil && resp.StatusCode == http.StatusSwitchingProtocols {
+		leave()
+		return resp, err
+	}
+
+	return cancelOnClose(resp, err, leave)
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClose(t *testing.T) {
+	tests := []struct {
+		name string
+		// path is the request in flight when Close is called, none if
+		// empty: /block answers once released, /unavailable asks to retry in
+		// an hour and /ok answers at once.
+		path string
+		// holdBody keeps the response body open until released.
+		holdBody bool
+		timeout  time.Duration
+		// wantWait is set when Close should wait for the release.
+		wantWait     bool
+		wantCloseErr error
+		wantDoErr    bool
+	}{
+		{name: "idle", timeout: time.Second},
+		{name: "waits for the request", path: "/block", timeout: 5 * time.Second, wantWait: true},
+		{name: "waits for the body", path: "/ok", holdBody: true, timeout: 5 * time.Second, wantWait: true},
+		{name: "cancels the request", path: "/block", timeout: 20 * time.Millisecond, wantCloseErr: context.DeadlineExceeded, wantDoErr: true},
+		{name: "cancels the retry wait", path: "/unavailable", timeout: 20 * time.Millisecond, wantCloseErr: context.DeadlineExceeded, wantDoErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan struct{}, 10)
+			release := make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received <- struct{}{}
+				switch r.URL.Path {
+				case "/block":
+					select {
+					case <-release:
+					case <-r.Context().Done():
+					}
+				case "/unavailable":
+					w.Header().Set("Retry-After", "3600")
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+				w.Write([]byte("body"))
+			}))
+			defer srv.Close()
+			c := NewRetryableClient(WithMaxRetryAfter(time.Hour))
+
+			doErr := make(chan error, 1)
+			if tt.path != "" {
+				go func() {
+					resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL+tt.path))
+					if err == nil {
+						if tt.holdBody {
+							<-release
+						}
+						_, err = ioutil.ReadAll(resp.Body)
+						resp.Body.Close()
+					}
+					doErr <- err
+				}()
+				<-received
+			}
+
+			closed := make(chan error, 1)
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+				defer cancel()
+				closed <- c.Close(ctx)
+			}()
+			var err error
+			if tt.wantWait {
+				select {
+				case err := <-closed:
+					t.Fatalf("Close() = %v before the request was over", err)
+				case <-time.After(20 * time.Millisecond):
+				}
+				close(release)
+				err = <-closed
+			} else {
+				err = <-closed
+				close(release)
+			}
+			if !errors.Is(err, tt.wantCloseErr) || (tt.wantCloseErr == nil && err != nil) {
+				t.Errorf("Close() error = %v, want %v", err, tt.wantCloseErr)
+			}
+			if tt.path != "" {
+				if err := <-doErr; (err != nil) != tt.wantDoErr {
+					t.Errorf("request error = %v, want an error: %v", err, tt.wantDoErr)
+				}
+			}
+			if _, err := c.Do(context.Background(), mustNewRequest(t, srv.URL+"/ok")); !errors.Is(err, ErrClientClosed) {
+				t.Errorf("Do() after Close error = %v, want ErrClientClosed", err)
+			}
+		})
+	}
+}
+
+func TestCloseAfterProtocolSwitch(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		rw.Flush()
+		<-done
+	}))
+	defer srv.Close()
+	c := NewRetryableClient()
+	req := mustNewRequest(t, srv.URL)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "test")
+
+	resp, err := c.Do(context.Background(), req)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Do() = %v, %v, want a protocol switch", resp, err)
+	}
+	defer resp.Body.Close()
+
+	// The connection belongs to the caller, Close does not wait for it
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Close(ctx); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestLifecycleLeaveOnce(t *testing.T) {
+	l := newLifecycle()
+	ctx, leave, err := l.enter(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	leave()
+	leave()
+
+	if ctx.Err() == nil {
+		t.Error("request context not cancelled once the request is over")
+	}
+	if len(l.inflight) != 0 {
+		t.Errorf("%d requests still in flight", len(l.inflight))
+	}
+	l.wg.Wait()
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Logger receives structured log records: a message followed by alternating
+// keys and values. *slog.Logger satisfies it as is.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// NewLogfLogger adapts a Printf-style function, such as log.Printf, to Logger.
+// Records are formatted as "level msg key=value ...".
+func NewLogfLogger(logf func(format string, args ...interface{})) Logger {
+	return logfLogger(logf)
+}
+
+type logfLogger func(format string, args ...interface{})
+
+func (l logfLogger) Debug(msg string, args ...interface{}) { l.log("DEBUG", msg, args) }
+func (l logfLogger) Info(msg string, args ...interface{})  { l.log("INFO", msg, args) }
+func (l logfLogger) Warn(msg string, args ...interface{})  { l.log("WARN", msg, args) }
+func (l logfLogger) Error(msg string, args ...interface{}) { l.log("ERROR", msg, args) }
+
+func (l logfLogger) log(level, msg string, args []interface{}) {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i])
+		}
+	}
+
+	l("%s", b.String())
+}
+
+// loggingHooks logs every attempt outcome, retry and give-up to l.
+func loggingHooks(l Logger) Hooks {
+	return Hooks{
+		OnResponse: func(req *http.Request, resp *http.Response, err error, attempt int) {
+			args := []interface{}{"method", req.Method, "url", req.URL.String(), "attempt", attempt}
+			if err != nil {
+				l.Debug("rhttp: attempt failed", append(args, "error", err)...)
+				return
+			}
+			l.Debug("rhttp: attempt completed", append(args, "status", resp.StatusCode)...)
+		},
+		OnRetry: func(req *http.Request, resp *http.Response, err error, attempt int, delay time.Duration) {
+			l.Info("rhttp: retrying request",
+				"method", req.Method,
+				"url", req.URL.String(),
+				"attempt", attempt,
+				"reason", retryReason(resp, err),
+				"backoff", delay,
+			)
+		},
+		OnGiveUp: func(req *http.Request, err *RetryError) {
+			l.Warn("rhttp: giving up",
+				"method", req.Method,
+				"url", req.URL.String(),
+				"attempts", len(err.Attempts),
+				"error", err,
+			)
+		},
+	}
+}
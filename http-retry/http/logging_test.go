@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLogfLogger(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(Logger)
+		want string
+	}{
+		{name: "debug", log: func(l Logger) { l.Debug("msg") }, want: "DEBUG msg"},
+		{name: "info with pairs", log: func(l Logger) { l.Info("msg", "a", 1, "b", "x") }, want: "INFO msg a=1 b=x"},
+		{name: "warn with a dangling key", log: func(l Logger) { l.Warn("msg", "a", 1, "b") }, want: "WARN msg a=1 b"},
+		{name: "error", log: func(l Logger) { l.Error("msg", "err", fmt.Errorf("boom")) }, want: "ERROR msg err=boom"},
+		{name: "percent kept", log: func(l Logger) { l.Info("100%", "k", "%d") }, want: "INFO 100% k=%d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			tt.log(NewLogfLogger(func(format string, args ...interface{}) { got = fmt.Sprintf(format, args...) }))
+			if got != tt.want {
+				t.Errorf("logged %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// levelLogger records the level and message of every record.
+type levelLogger struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (l *levelLogger) add(level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records = append(l.records, level+" "+strings.TrimPrefix(msg, "rhttp: "))
+}
+
+func (l *levelLogger) Debug(msg string, args ...interface{}) { l.add("DEBUG", msg) }
+func (l *levelLogger) Info(msg string, args ...interface{})  { l.add("INFO", msg) }
+func (l *levelLogger) Warn(msg string, args ...interface{})  { l.add("WARN", msg) }
+func (l *levelLogger) Error(msg string, args ...interface{}) { l.add("ERROR", msg) }
+
+func TestWithLogger(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		opts     []Option
+		want     []string
+	}{
+		{
+			name:     "success",
+			statuses: []int{200},
+			want:     []string{"DEBUG attempt completed"},
+		},
+		{
+			name:     "retried",
+			statuses: []int{503, 200},
+			want:     []string{"DEBUG attempt completed", "INFO retrying request", "DEBUG attempt completed"},
+		},
+		{
+			name:     "given up",
+			statuses: []int{503},
+			opts:     []Option{WithMaxRetries(1)},
+			want:     []string{"DEBUG attempt completed", "INFO retrying request", "DEBUG attempt completed", "WARN giving up"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			l := &levelLogger{}
+			c := NewRetryableClient(append([]Option{fastBackoff, WithMaxRetryAfter(0), WithLogger(l)}, tt.opts...)...)
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+			if err == nil {
+				drainBody(resp)
+			}
+			if !reflect.DeepEqual(l.records, tt.want) {
+				t.Errorf("records = %q, want %q", l.records, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggedRetryFields(t *testing.T) {
+	srv := newScriptServer(t, 503, 200)
+	var lines []string
+	l := NewLogfLogger(func(format string, args ...interface{}) { lines = append(lines, fmt.Sprintf(format, args...)) })
+	c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0), WithLogger(l))
+
+	if _, _, err := c.GetBytes(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("logged %q, want 3 lines", lines)
+	}
+	for _, field := range []string{"method=GET", "url=" + srv.URL, "attempt=1", "reason=503", "backoff=1ms"} {
+		if !strings.Contains(lines[1], field) {
+			t.Errorf("retry line %q lacks %s", lines[1], field)
+		}
+	}
+}
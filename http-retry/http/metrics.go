@@ -0,0 +1,60 @@
+package http
+
+import (
+	"net/http"
+	"time"
+)
+
+// MetricLabels identifies the series a measurement belongs to.
+type MetricLabels struct {
+	Method string
+	Host   string
+	// StatusClass is "1xx" to "5xx", or "error" when no response was received.
+	StatusClass string
+}
+
+// MetricsRecorder receives the client's measurements. Implement it on top of
+// Prometheus, StatsD or anything else; the package depends on none of them.
+type MetricsRecorder interface {
+	// Attempt counts every attempt sent (attempts_total).
+	Attempt(labels MetricLabels)
+	// Retry counts attempts that are going to be retried (retries_total).
+	Retry(labels MetricLabels)
+	// RequestDuration observes the time taken by a whole request, retries
+	// included (request_duration_seconds).
+	RequestDuration(labels MetricLabels, d time.Duration)
+	// GiveUp counts requests the client stopped retrying (give_ups_total).
+	GiveUp(labels MetricLabels)
+	// CircuitState reports the state of the circuit for host (circuit_state).
+	CircuitState(host string, state CircuitState)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Attempt(MetricLabels)                        {}
+func (nopMetrics) Retry(MetricLabels)                          {}
+func (nopMetrics) RequestDuration(MetricLabels, time.Duration) {}
+func (nopMetrics) GiveUp(MetricLabels)                         {}
+func (nopMetrics) CircuitState(string, CircuitState)           {}
+
+func metricLabels(req *http.Request, resp *http.Response) MetricLabels {
+	return MetricLabels{
+		Method:      req.Method,
+		Host:        req.URL.Host,
+		StatusClass: statusClass(resp),
+	}
+}
+
+func statusClass(resp *http.Response) string {
+	if resp == nil {
+		return "error"
+	}
+
+	if resp.StatusCode < 100 || resp.StatusCode > 599 {
+		return "unknown"
+	}
+
+	return statusClasses[resp.StatusCode/100-1]
+}
+
+var statusClasses = [...]string{"1xx", "2xx", "3xx", "4xx", "5xx"}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingMetrics counts every measurement by kind and status class.
+type countingMetrics struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newCountingMetrics() *countingMetrics {
+	return &countingMetrics{counts: make(map[string]int)}
+}
+
+func (m *countingMetrics) add(kind string, labels MetricLabels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.counts[kind+" "+labels.Method+" "+labels.StatusClass]++
+}
+
+func (m *countingMetrics) Attempt(labels MetricLabels) { m.add("attempt", labels) }
+func (m *countingMetrics) Retry(labels MetricLabels)   { m.add("retry", labels) }
+func (m *countingMetrics) GiveUp(labels MetricLabels)  { m.add("give up", labels) }
+
+func (m *countingMetrics) RequestDuration(labels MetricLabels, d time.Duration) {
+	m.add("request", labels)
+}
+
+func (m *countingMetrics) CircuitState(host string, state CircuitState) {}
+
+func TestMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		opts     []Option
+		want     map[string]int
+	}{
+		{
+			name:     "success",
+			statuses: []int{200},
+			want:     map[string]int{"attempt GET 2xx": 1, "request GET 2xx": 1},
+		},
+		{
+			name:     "retried",
+			statuses: []int{503, 503, 200},
+			want:     map[string]int{"attempt GET 5xx": 2, "retry GET 5xx": 2, "attempt GET 2xx": 1, "request GET 2xx": 1},
+		},
+		{
+			name:     "given up",
+			statuses: []int{503},
+			opts:     []Option{WithMaxRetries(1)},
+			want:     map[string]int{"attempt GET 5xx": 2, "retry GET 5xx": 1, "give up GET 5xx": 1, "request GET error": 1},
+		},
+		{
+			name:     "not retried",
+			statuses: []int{404},
+			want:     map[string]int{"attempt GET 4xx": 1, "request GET 4xx": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			m := newCountingMetrics()
+			c := NewRetryableClient(append([]Option{fastBackoff, WithMaxRetryAfter(0), WithMetrics(m)}, tt.opts...)...)
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+			if err == nil {
+				drainBody(resp)
+			}
+			if !reflect.DeepEqual(m.counts, tt.want) {
+				t.Errorf("metrics = %v, want %v", m.counts, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := []struct {
+		resp *http.Response
+		want string
+	}{
+		{resp: nil, want: "error"},
+		{resp: &http.Response{StatusCode: 100}, want: "1xx"},
+		{resp: &http.Response{StatusCode: 204}, want: "2xx"},
+		{resp: &http.Response{StatusCode: 304}, want: "3xx"},
+		{resp: &http.Response{StatusCode: 499}, want: "4xx"},
+		{resp: &http.Response{StatusCode: 599}, want: "5xx"},
+		{resp: &http.Response{StatusCode: 99}, want: "unknown"},
+		{resp: &http.Response{StatusCode: 600}, want: "unknown"},
+	}
+	for _, tt := range tests {
+		if got := statusClass(tt.resp); got != tt.want {
+			t.Errorf("statusClass(%v) = %q, want %q", tt.resp, got, tt.want)
+		}
+	}
+}
+
+func TestWithMetricsNil(t *testing.T) {
+	if _, ok := newConfig(WithMetrics(nil)).metrics.(nopMetrics); !ok {
+		t.Error("WithMetrics(nil) replaced the no-op recorder")
+	}
+}
@@ -0,0 +1,166 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMirrorTimeout bounds a mirrored request.
+	DefaultMirrorTimeout = 10 * time.Second
+	// DefaultMirrorInFlight is how many mirrored requests may be in flight
+	// at once, see MirrorConfig.
+	DefaultMirrorInFlight = 100
+)
+
+// MirrorConfig describes shadow traffic, see WithMirror.
+type MirrorConfig struct {
+	// BaseURL replaces the scheme and host of mirrored requests, and prefixes
+	// their path with its own. If it is invalid nothing is mirrored.
+	BaseURL string
+	// Fraction of the requests mirrored, from 0 to 1.
+	Fraction float64
+	// Timeout bounds each mirrored request, DefaultMirrorTimeout if zero.
+	Timeout time.Duration
+	// MaxInFlight is how many mirrored requests may be in flight at once,
+	// DefaultMirrorInFlight if zero. Requests that would exceed it are not
+	// mirrored, so a slow shadow backend never piles up goroutines.
+	MaxInFlight int
+	// OnResponse, if set, is called with the outcome of every mirrored
+	// request, e.g. to compare it with the primary one. The body is closed
+	// once it returns.
+	OnResponse func(req *http.Request, resp *http.Response, err error)
+}
+
+// WithMirror copies a share of the requests sent upstream to a secondary
+// backend, to dark-launch it with real traffic. Copies are sent in the
+// background, once per request however many attempts it takes, and never
+// retried; their responses are ignored. Requests whose body cannot be
+// replayed are not mirrored.
+func WithMirror(cfg MirrorConfig) Option {
+	m := newMirror(cfg)
+
+	return func(c *config) {
+		c.mirror = m
+	}
+}
+
+type mirror struct {
+	cfg    MirrorConfig
+	base   *url.URL
+	slots  chan struct{}
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+func newMirror(cfg MirrorConfig) *mirror {
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" || cfg.Fraction <= 0 {
+		return nil
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultMirrorTimeout
+	}
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = DefaultMirrorInFlight
+	}
+
+	return &mirror{
+		cfg:    cfg,
+		base:   u,
+		slots:  make(chan struct{}, cfg.MaxInFlight),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// sampled reports whether the next request is mirrored.
+func (m *mirror) sampled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.random.Float64() < m.cfg.Fraction
+}
+
+// mirrorRequest mirrors req through rt in the background if the mirror
+// samples it. The body is read before returning, since getBody may not
+// outlive the request.
+func (c *config) mirrorRequest(req *http.Request, getBody BodyFunc, rt http.RoundTripper) {
+	m := c.mirror
+	if m == nil || getBody == nil || !m.sampled() {
+		return
+	}
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		return
+	}
+
+	shadow, err := m.request(req, getBody)
+	if err != nil {
+		<-m.slots
+		return
+	}
+	c.setDefaultHeaders(shadow)
+	go func() {
+		defer func() { <-m.slots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeout)
+		defer cancel()
+
+		shadow = shadow.WithContext(ctx)
+		resp, err := rt.RoundTrip(shadow)
+		if m.cfg.OnResponse != nil {
+			m.cfg.OnResponse(shadow, resp, err)
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+}
+
+// request returns a copy of req aimed at the mirror's base URL, with a copy
+// of the body.
+func (m *mirror) request(req *http.Request, getBody BodyFunc) (*http.Request, error) {
+	var data []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := getBody()
+		if err != nil {
+			return nil, err
+		}
+		data, err = ioutil.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	u := *req.URL
+	u.Scheme, u.Host, u.User = m.base.Scheme, m.base.Host, m.base.User
+	if p := strings.TrimSuffix(m.base.Path, "/"); p != "" {
+		u.Path = p + "/" + strings.TrimPrefix(u.Path, "/")
+		u.RawPath = ""
+	}
+
+	shadow := req.Clone(context.Background())
+	shadow.URL, shadow.Host = &u, ""
+	shadow.Body, shadow.GetBody = nil, nil
+	if req.Body != nil {
+		shadow.Body = http.NoBody
+	}
+	if len(data) > 0 {
+		shadow.Body = ioutil.NopCloser(bytes.NewReader(data))
+		shadow.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}
+	}
+
+	return shadow, nil
+}
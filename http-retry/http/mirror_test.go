@@ -0,0 +1,252 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewMirror(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          MirrorConfig
+		wantNil      bool
+		wantTimeout  time.Duration
+		wantInFlight int
+	}{
+		{name: "defaults", cfg: MirrorConfig{BaseURL: "http://shadow.test", Fraction: 0.5}, wantTimeout: DefaultMirrorTimeout, wantInFlight: DefaultMirrorInFlight},
+		{name: "set", cfg: MirrorConfig{BaseURL: "http://shadow.test", Fraction: 1, Timeout: time.Second, MaxInFlight: 3}, wantTimeout: time.Second, wantInFlight: 3},
+		{name: "no fraction", cfg: MirrorConfig{BaseURL: "http://shadow.test"}, wantNil: true},
+		{name: "no scheme", cfg: MirrorConfig{BaseURL: "shadow.test", Fraction: 1}, wantNil: true},
+		{name: "invalid", cfg: MirrorConfig{BaseURL: "http://[::1", Fraction: 1}, wantNil: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMirror(tt.cfg)
+			if tt.wantNil {
+				if m != nil {
+					t.Errorf("newMirror() = %+v, want nothing mirrored", m.cfg)
+				}
+				return
+			}
+			if m == nil || m.cfg.Timeout != tt.wantTimeout || cap(m.slots) != tt.wantInFlight {
+				t.Errorf("newMirror() = %+v, want timeout %v and %d in flight", m, tt.wantTimeout, tt.wantInFlight)
+			}
+		})
+	}
+}
+
+func TestMirrorShadowRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		url      string
+		body     string
+		wantURL  string
+		wantBody string
+	}{
+		{name: "host replaced", base: "https://shadow.test", url: "http://api.test/v1/items?page=2", wantURL: "https://shadow.test/v1/items?page=2"},
+		{name: "path prefixed", base: "http://shadow.test/canary/", url: "http://api.test/v1/items", wantURL: "http://shadow.test/canary/v1/items"},
+		{name: "user replaced", base: "http://u:p@shadow.test", url: "http://api.test/", wantURL: "http://u:p@shadow.test/"},
+		{name: "body copied", base: "http://shadow.test", url: "http://api.test/items", body: "payload", wantURL: "http://shadow.test/items", wantBody: "payload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMirror(MirrorConfig{BaseURL: tt.base, Fraction: 1})
+			req, err := NewRequest(context.Background(), http.MethodPost, tt.url, tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Request", "1")
+
+			shadow, err := m.request(req, req.GetBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if shadow.URL.String() != tt.wantURL || shadow.Host != "" {
+				t.Errorf("shadow sent to %s (host %q), want %s", shadow.URL, shadow.Host, tt.wantURL)
+			}
+			if shadow.Header.Get("X-Request") != "1" {
+				t.Error("headers not copied")
+			}
+			body, _ := ioutil.ReadAll(shadow.Body)
+			if string(body) != tt.wantBody {
+				t.Errorf("shadow body %q, want %q", body, tt.wantBody)
+			}
+			if req.URL.Host != "api.test" {
+				t.Errorf("request changed to %s", req.URL)
+			}
+		})
+	}
+}
+
+// shadowServer records the requests mirrored to it.
+type shadowServer struct {
+	*httptest.Server
+	status int
+	// release, if set, holds every request until it is closed.
+	release chan struct{}
+
+	mu     sync.Mutex
+	paths  []string
+	bodies []string
+}
+
+func newShadowServer(t *testing.T, status int, release chan struct{}) *shadowServer {
+	t.Helper()
+
+	s := &shadowServer{status: status, release: release}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		s.paths = append(s.paths, r.URL.Path)
+		s.bodies = append(s.bodies, string(body))
+		s.mu.Unlock()
+		if s.release != nil {
+			<-s.release
+		}
+		w.WriteHeader(s.status)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *shadowServer) received() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.paths...), append([]string(nil), s.bodies...)
+}
+
+func TestWithMirror(t *testing.T) {
+	tests := []struct {
+		name     string
+		fraction float64
+		// statuses are the primary's, shadowStatus the mirror's.
+		statuses     []int
+		shadowStatus int
+		requests     int
+		wantPrimary  int
+		wantMirrored int
+	}{
+		{name: "mirrored", fraction: 1, shadowStatus: http.StatusOK, requests: 3, wantPrimary: 3, wantMirrored: 3},
+		{name: "once however many attempts", fraction: 1, statuses: []int{503, 503, 200}, shadowStatus: http.StatusOK, requests: 1, wantPrimary: 3, wantMirrored: 1},
+		{name: "shadow failure not retried", fraction: 1, shadowStatus: http.StatusServiceUnavailable, requests: 2, wantPrimary: 2, wantMirrored: 2},
+		{name: "none sampled", fraction: 0, shadowStatus: http.StatusOK, requests: 3, wantPrimary: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := newScriptServer(t, tt.statuses...)
+			shadow := newShadowServer(t, tt.shadowStatus, nil)
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			var statuses []int
+			c := NewRetryableClient(fastBackoff, WithMirror(MirrorConfig{
+				BaseURL:  shadow.URL + "/shadow",
+				Fraction: tt.fraction,
+				OnResponse: func(req *http.Request, resp *http.Response, err error) {
+					defer wg.Done()
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						t.Errorf("mirrored request failed: %v", err)
+						return
+					}
+					statuses = append(statuses, resp.StatusCode)
+				},
+			}))
+
+			wg.Add(tt.wantMirrored)
+			for i := 0; i < tt.requests; i++ {
+				resp, err := c.PutContext(context.Background(), primary.URL+"/items", "text/plain", "payload")
+				if err != nil {
+					t.Fatal(err)
+				}
+				drainBody(resp)
+			}
+			wg.Wait()
+
+			if n := primary.count(); n != tt.wantPrimary {
+				t.Errorf("primary received %d requests, want %d", n, tt.wantPrimary)
+			}
+			paths, bodies := shadow.received()
+			if len(paths) != tt.wantMirrored {
+				t.Fatalf("shadow received %d requests, want %d", len(paths), tt.wantMirrored)
+			}
+			for i := range paths {
+				if paths[i] != "/shadow/items" || bodies[i] != "payload" {
+					t.Errorf("shadow request %d = %s %q", i+1, paths[i], bodies[i])
+				}
+				if statuses[i] != tt.shadowStatus {
+					t.Errorf("shadow response %d = %d, want %d", i+1, statuses[i], tt.shadowStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestMirrorMaxInFlight(t *testing.T) {
+	primary := newScriptServer(t)
+	release := make(chan struct{})
+	shadow := newShadowServer(t, http.StatusOK, release)
+	done := make(chan struct{}, 1)
+	c := NewRetryableClient(WithMirror(MirrorConfig{
+		BaseURL:     shadow.URL,
+		Fraction:    1,
+		MaxInFlight: 1,
+		OnResponse:  func(*http.Request, *http.Response, error) { done <- struct{}{} },
+	}))
+	send := func() {
+		resp, err := c.Get(primary.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		drainBody(resp)
+	}
+
+	send()
+	for i := 0; i < 3; i++ {
+		// The first copy is still in flight, so these are not mirrored
+		send()
+	}
+	close(release)
+	<-done
+	send()
+	for {
+		if paths, _ := shadow.received(); len(paths) == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-done
+
+	if n := primary.count(); n != 5 {
+		t.Errorf("primary received %d requests, want 5", n)
+	}
+	if paths, _ := shadow.received(); len(paths) != 2 {
+		t.Errorf("shadow received %d requests, want 2", len(paths))
+	}
+}
+
+func TestMirrorUnreplayableBody(t *testing.T) {
+	primary := newScriptServer(t)
+	shadow := newShadowServer(t, http.StatusOK, nil)
+	c := NewRetryableClient(WithMirror(MirrorConfig{BaseURL: shadow.URL, Fraction: 1}), WithMaxBufferedBody(4))
+
+	resp, err := c.PostContext(context.Background(), primary.URL, "text/plain", ioutil.NopCloser(strings.NewReader("too large to buffer")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainBody(resp)
+	time.Sleep(20 * time.Millisecond)
+
+	if paths, _ := shadow.received(); len(paths) != 0 {
+		t.Errorf("shadow received %d requests, want none", len(paths))
+	}
+}
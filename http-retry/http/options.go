@@ -0,0 +1,396 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option configures a retryable client. NewRetryableClient without options
+// retries requests with an idempotent method up to RetryCount times on network
+// errors and 429, 502, 503 and 504 responses, with an exponential backoff
+// starting at one second and full jitter, so clients failing together do not
+// retry in lockstep.
+type Option func(*config)
+
+type config struct {
+	httpClient     *http.Client
+	redirectPolicy *RedirectPolicy
+	transport      http.RoundTripper
+	proxy          func(*http.Request) (*url.URL, error)
+	proxyFailover  *proxyFailover
+	tlsConfig      *tls.Config
+	dialContext    dialFunc
+	dualStack      *DualStackConfig
+	connectTimeout time.Duration
+
+	tlsHandshakeTimeout   time.Duration
+	responseHeaderTimeout time.Duration
+
+	getClientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+	endpointSelection    EndpointSelection
+	http2ReadIdleTimeout time.Duration
+	http2PingTimeout     time.Duration
+
+	maxRetries      int
+	backoff         Backoff
+	policy          RetryPolicy
+	maxElapsedTime  time.Duration
+	maxRetryAfter   time.Duration
+	timeout         time.Duration
+	attemptTimeout  time.Duration
+	bodyReadTimeout time.Duration
+	retriedTimeouts []TimeoutPhase
+	hedgeDelay      time.Duration
+	maxHedges       int
+
+	maxBufferedBody    int64
+	maxResponseBytes   int64
+	maxPooledBuffer    int
+	baseURL            *url.URL
+	baseURLErr         error
+	defaultHeaders     http.Header
+	correlationHeader  string
+	networkTimings     bool
+	idempotencyHeader  string
+	retryAttemptHeader string
+	retryReasonHeader  string
+	headerTemplates    []headerTemplate
+	policySource       PolicySource
+	optionErr          error
+	noPanicRecovery    bool
+	retryUnsafe        bool
+	verifyBodies       bool
+
+	requestCompression *requestCompression
+
+	circuitBreaker *CircuitBreaker
+	healthChecker  *HealthChecker
+	retryThrottle  *RetryThrottle
+	fallback       FallbackFunc
+	jar            http.CookieJar
+	picker         Picker
+	reauthorizer   *reauthorizer
+	signer         Signer
+	cache          *Cache
+	singleflight   *flightGroup
+	writeDedupe    *writeDedupe
+	mirror         *mirror
+	limiter        func(host string) Limiter
+	rateLimits     *RateLimitTracker
+	concurrency    *AdaptiveLimiter
+	bulkhead       *Bulkhead
+	queue          *QueueConfig
+
+	deliverySchedule  []time.Duration
+	graphQLEndpoint   string
+	graphQLRetryCodes []string
+
+	hostProfiles []hostProfile
+
+	hooks      hookList
+	before     []BeforeAttemptFunc
+	validators []ResponseValidator
+	decoders   map[string]Decoder
+	middleware []Middleware
+	metrics    MetricsRecorder
+	debug      *DebugStats
+	recorder   *FlightRecorder
+	tracer     Tracer
+	clock      Clock
+	latency    *latencyEstimator
+}
+
+func defaultConfig() *config {
+	return &config{
+		maxRetries: RetryCount,
+		backoff:    ExponentialBackoff{Base: time.Second, Jitter: FullJitter},
+		policy:     DefaultRetryPolicy,
+
+		maxRetryAfter:   DefaultMaxRetryAfter,
+		maxBufferedBody: DefaultMaxBufferedBody,
+		maxPooledBuffer: DefaultMaxPooledBuffer,
+
+		metrics: nopMetrics{},
+		tracer:  nopTracer{},
+		clock:   systemClock{},
+		latency: newLatencyEstimator(),
+	}
+}
+
+// with returns a copy of c with opts applied on top.
+func (c *config) with(opts ...Option) *config {
+	cfg := *c
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &cfg
+}
+
+type optionsKey struct{}
+
+// WithRequestOptions returns a context overriding the client's options for
+// the requests made with it, e.g. WithMaxRetries(0) for a non-idempotent
+// write. Client-level options such as WithHTTPClient and WithMiddleware have
+// no effect per request.
+func WithRequestOptions(ctx context.Context, opts ...Option) context.Context {
+	if prev, ok := ctx.Value(optionsKey{}).([]Option); ok {
+		opts = append(prev[:len(prev):len(prev)], opts...)
+	}
+
+	return context.WithValue(ctx, optionsKey{}, opts)
+}
+
+func requestOptions(ctx context.Context) []Option {
+	opts, _ := ctx.Value(optionsKey{}).([]Option)
+	return opts
+}
+
+func newConfig(opts ...Option) *config {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+// WithMaxRetries sets how many times a request is retried after the first
+// attempt. Zero disables retries.
+func WithMaxRetries(n int) Option {
+	return func(c *config) {
+		if n >= 0 {
+			c.maxRetries = n
+		}
+	}
+}
+
+// WithHTTPClient builds the retryable client on top of a copy of hc, keeping
+// its timeout, cookie jar and redirect policy. The retry logic wraps
+// hc.Transport, or http.DefaultTransport if it is nil. It has no effect on
+// NewRetryTransport.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *config) {
+		c.httpClient = hc
+	}
+}
+
+// WithBackoff sets the strategy used to wait between retries.
+func WithBackoff(b Backoff) Option {
+	return func(c *config) {
+		if b != nil {
+			c.backoff = b
+		}
+	}
+}
+
+// WithRetryPolicy sets the policy that decides which outcomes are retried.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *config) {
+		if p != nil {
+			c.policy = p
+		}
+	}
+}
+
+// WithMaxElapsedTime caps the total time spent on a request, including backoff
+// waits. Once the next retry would run past d the client gives up with
+// ErrMaxElapsedTimeExceeded. Zero means no limit.
+func WithMaxElapsedTime(d time.Duration) Option {
+	return func(c *config) {
+		c.maxElapsedTime = d
+	}
+}
+
+// WithTimeout bounds a whole request, every attempt and backoff wait included.
+// Zero means no limit beyond the request context.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithAttemptTimeout bounds each individual attempt, so a single slow attempt
+// fails into a retry instead of consuming the whole request deadline.
+func WithAttemptTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.attemptTimeout = d
+	}
+}
+
+// WithHedging sends another copy of an attempt whenever delay passes without
+// a response, up to maxHedges extra copies, and uses whichever acceptable
+// response arrives first. Set delay around the upstream's p95 latency to cut
+// tail latency. Only requests with a replayable body are hedged.
+func WithHedging(delay time.Duration, maxHedges int) Option {
+	return func(c *config) {
+		c.hedgeDelay = delay
+		c.maxHedges = maxHedges
+	}
+}
+
+// WithMaxRetryAfter caps the wait requested by a Retry-After header on 429 and
+// 503 responses, which otherwise replaces the backoff. Zero ignores the header.
+func WithMaxRetryAfter(d time.Duration) Option {
+	return func(c *config) {
+		c.maxRetryAfter = d
+	}
+}
+
+// WithMaxBufferedBody sets how many bytes of a request body without GetBody
+// are buffered for replay. Larger bodies are sent once and not retried.
+func WithMaxBufferedBody(n int64) Option {
+	return func(c *config) {
+		c.maxBufferedBody = n
+	}
+}
+
+// WithIdempotencyKey adds an Idempotency-Key header to POST and PATCH
+// requests. The key is generated once per logical request and sent unchanged
+// with every retry, so servers supporting idempotency keys never process a
+// retried write twice.
+func WithIdempotencyKey() Option {
+	return WithIdempotencyKeyHeader(DefaultIdempotencyKeyHeader)
+}
+
+// WithIdempotencyKeyHeader is like WithIdempotencyKey with a custom header
+// name. An empty name disables idempotency keys.
+func WithIdempotencyKeyHeader(name string) Option {
+	return func(c *config) {
+		c.idempotencyHeader = name
+	}
+}
+
+// WithRateLimiter makes every attempt, retries included, wait for l, so the
+// client as a whole stays within an upstream's request rate.
+func WithRateLimiter(l Limiter) Option {
+	return func(c *config) {
+		c.limiter = func(string) Limiter { return l }
+	}
+}
+
+// WithHostRateLimiter is like WithRateLimiter with a separate bucket per host,
+// e.g. WithHostRateLimiter(NewHostLimiter(func(string) Limiter {
+// return NewTokenBucket(10, 5) })).
+func WithHostRateLimiter(h *HostLimiter) Option {
+	return func(c *config) {
+		c.limiter = h.Limiter
+	}
+}
+
+// WithRateLimitTracking delays new attempts to a host that recently answered
+// 429 or reported an exhausted quota until its limit resets, as learned by t.
+// Learned waits are capped like Retry-After, see WithMaxRetryAfter.
+func WithRateLimitTracking(t *RateLimitTracker) Option {
+	return func(c *config) {
+		c.rateLimits = t
+	}
+}
+
+// FallbackFunc produces a response for a request the client gave up on.
+// lastErr is the *RetryError describing the attempts.
+type FallbackFunc func(req *http.Request, lastErr error) (*http.Response, error)
+
+// WithFallback calls f once retries are exhausted, so callers can serve cached
+// or degraded responses instead of an error.
+func WithFallback(f FallbackFunc) Option {
+	return func(c *config) {
+		c.fallback = f
+	}
+}
+
+// WithCache answers GET requests from c when possible and stores cacheable
+// responses in it. A cache may be shared between clients.
+func WithCache(c *Cache) Option {
+	return func(cfg *config) {
+		cfg.cache = c
+	}
+}
+
+// WithCircuitBreaker guards every host with b, so requests to a host that
+// keeps failing are rejected with ErrCircuitOpen instead of being retried.
+// A breaker may be shared between clients.
+func WithCircuitBreaker(b *CircuitBreaker) Option {
+	return func(c *config) {
+		c.circuitBreaker = b
+	}
+}
+
+// WithRetryThrottle stops retrying, with ErrRetryThrottled, whenever t's
+// retry budget runs low. Share a throttle between clients to budget them
+// together.
+func WithRetryThrottle(t *RetryThrottle) Option {
+	return func(c *config) {
+		c.retryThrottle = t
+	}
+}
+
+// WithHooks registers callbacks run around every attempt. It may be used
+// several times; hooks run in the order they were added.
+func WithHooks(h Hooks) Option {
+	return func(c *config) {
+		c.hooks = append(c.hooks[:len(c.hooks):len(c.hooks)], h)
+	}
+}
+
+// WithBeforeAttempt calls f before every attempt, before the request is
+// signed, so values that must differ between attempts are regenerated instead
+// of being resent stale. It may be used several times.
+func WithBeforeAttempt(f BeforeAttemptFunc) Option {
+	return func(c *config) {
+		c.before = append(c.before[:len(c.before):len(c.before)], f)
+	}
+}
+
+// WithMiddleware wraps the transport used for each attempt, so every retry
+// passes through the middleware too. The first middleware is the outermost.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(c *config) {
+		c.middleware = append(c.middleware[:len(c.middleware):len(c.middleware)], mw...)
+	}
+}
+
+// WithMetrics reports attempts, retries, durations, give-ups and circuit
+// states to r.
+func WithMetrics(r MetricsRecorder) Option {
+	return func(c *config) {
+		if r != nil {
+			c.metrics = r
+		}
+	}
+}
+
+// WithTracer traces every request with a parent span and a child span per
+// attempt.
+func WithTracer(t Tracer) Option {
+	return func(c *config) {
+		if t != nil {
+			c.tracer = t
+		}
+	}
+}
+
+// WithClock makes the retry loop read the time and wait between attempts
+// with c, e.g. a fake clock from the rhttptest package in tests. Circuit
+// cooldowns, cache freshness, body read timeouts, priority aging and
+// signature times follow c too, while context deadlines stay on the system
+// clock.
+func WithClock(c Clock) Option {
+	return func(cfg *config) {
+		if c != nil {
+			cfg.clock = c
+		}
+	}
+}
+
+// WithLogger logs every attempt, retry decision, backoff wait and give-up to l.
+func WithLogger(l Logger) Option {
+	return func(c *config) {
+		if l != nil {
+			WithHooks(loggingHooks(l))(c)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultBackoffHasFullJitter(t *testing.T) {
+	b, ok := defaultConfig().backoff.(ExponentialBackoff)
+	if !ok {
+		t.Fatalf("default backoff is %T, want ExponentialBackoff", defaultConfig().backoff)
+	}
+	if b.Jitter != FullJitter || b.Base != time.Second {
+		t.Fatalf("default backoff = %+v, want a one second base with full jitter", b)
+	}
+
+	// Clients failing together spread their retries out
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		d := b.Backoff(2, 0)
+		if d < 0 || d >= 4*time.Second {
+			t.Fatalf("Backoff(2) = %v, want within [0, 4s)", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("20 default backoffs were all %v, want them spread out", b.Backoff(2, 0))
+	}
+}
+
+func TestWithFallback(t *testing.T) {
+	errFallback := errors.New("fallback")
+	cached := func(req *http.Request, lastErr error) (*http.Response, error) {
+		var re *RetryError
+		if !errors.As(lastErr, &re) {
+			t.Errorf("fallback error = %v, want a *RetryError", lastErr)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader("cached")),
+			Request:    req,
+		}, nil
+	}
+	failing := func(*http.Request, error) (*http.Response, error) { return nil, errFallback }
+
+	tests := []struct {
+		name     string
+		statuses []int
+		fallback FallbackFunc
+		wantBody string
+		wantErr  error
+	}{
+		{name: "serves the fallback response", statuses: []int{503}, fallback: cached, wantBody: "cached"},
+		{name: "returns the fallback error", statuses: []int{503}, fallback: failing, wantErr: errFallback},
+		{name: "not called on success", statuses: []int{503, 200}, fallback: failing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0), WithMaxRetries(1), WithFallback(tt.fallback))
+
+			resp, err := c.Get(srv.URL)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || string(body) != tt.wantBody {
+				t.Errorf("response = %d %q, want 200 %q", resp.StatusCode, body, tt.wantBody)
+			}
+			if srv.count() != 2 {
+				t.Errorf("server received %d requests, want 2", srv.count())
+			}
+		})
+	}
+}
+
+func TestWithMaxRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []Option
+		wantRequests int
+	}{
+		{name: "default", wantRequests: RetryCount + 1},
+		{name: "set", opts: []Option{WithMaxRetries(1)}, wantRequests: 2},
+		{name: "disabled", opts: []Option{WithMaxRetries(0)}, wantRequests: 1},
+		{name: "negative ignored", opts: []Option{WithMaxRetries(-1)}, wantRequests: RetryCount + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503)
+			c := NewRetryableClient(append([]Option{fastBackoff, WithMaxRetryAfter(0)}, tt.opts...)...)
+
+			if resp, err := c.Get(srv.URL); err == nil {
+				drainBody(resp)
+			}
+			if srv.count() != tt.wantRequests {
+				t.Errorf("server received %d requests, want %d", srv.count(), tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	srv := newScriptServer(t, 503, 200)
+	jar, _ := cookiejar.New(nil)
+	var trips int
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		trips++
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	hc := &http.Client{Transport: base, Timeout: time.Minute, Jar: jar}
+	c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0), WithHTTPClient(hc))
+
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainBody(resp)
+
+	if resp.StatusCode != http.StatusOK || trips != 2 {
+		t.Errorf("status %d after %d round trips, want 200 after 2", resp.StatusCode, trips)
+	}
+	std := c.StandardClient()
+	if std == hc || std.Timeout != time.Minute || std.Jar != jar {
+		t.Errorf("client %+v does not copy %+v", std, hc)
+	}
+	if _, ok := hc.Transport.(roundTripperFunc); !ok {
+		t.Errorf("WithHTTPClient changed the transport of its client to %T", hc.Transport)
+	}
+}
+
+func TestRequestOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		ctx          func() context.Context
+		opts         []Option
+		wantRequests int
+		wantStatus   int
+	}{
+		{name: "client options", ctx: context.Background, wantRequests: 3, wantStatus: 200},
+		{name: "overridden in Do", ctx: context.Background, opts: []Option{WithMaxRetries(0)}, wantRequests: 1, wantStatus: 503},
+		{
+			name:         "overridden by the context",
+			ctx:          func() context.Context { return WithRequestOptions(context.Background(), WithMaxRetries(1)) },
+			wantRequests: 2,
+			wantStatus:   503,
+		},
+		{
+			name: "later overrides win",
+			ctx: func() context.Context {
+				return WithRequestOptions(WithRequestOptions(context.Background(), WithMaxRetries(1)), WithMaxRetries(0))
+			},
+			wantRequests: 1,
+			wantStatus:   503,
+		},
+		{
+			name:         "Do on top of the context",
+			ctx:          func() context.Context { return WithRequestOptions(context.Background(), WithMaxRetries(0)) },
+			opts:         []Option{WithMaxRetries(1)},
+			wantRequests: 2,
+			wantStatus:   503,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503, 503, 200)
+			c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0))
+
+			resp, err := c.Do(tt.ctx(), mustNewRequest(t, srv.URL), tt.opts...)
+			if err == nil {
+				drainBody(resp)
+			}
+			if err == nil && resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if srv.count() != tt.wantRequests {
+				t.Errorf("server received %d requests, want %d", srv.count(), tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRequestOptionsLeaveTheClient(t *testing.T) {
+	srv := newScriptServer(t, 503, 503, 200)
+	c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0))
+
+	resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL), WithMaxRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainBody(resp)
+	resp, err = c.Do(context.Background(), mustNewRequest(t, srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainBody(resp)
+
+	if resp.StatusCode != http.StatusOK || srv.count() != 3 {
+		t.Errorf("status %d after %d requests, want 200 after 3", resp.StatusCode, srv.count())
+	}
+}
@@ -0,0 +1,155 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Page is one page of a paginated resource, its body read into memory. Err
+// is set on the last page sent when fetching failed, the other fields are
+// then empty.
+type Page struct {
+	URL        *url.URL
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Err        error
+}
+
+// NextPageFunc returns the URL of the page after p, or "" after the last
+// one. Relative URLs are resolved against p.URL.
+type NextPageFunc func(p *Page) (string, error)
+
+// Paginator walks the pages of a resource. A paginator may be walked several
+// times.
+type Paginator struct {
+	client *RetryableClient
+	url    string
+	next   NextPageFunc
+}
+
+// Paginate returns a paginator starting at url and finding the next pages
+// with next, or LinkNext if next is nil. Every page is fetched with its own
+// retries.
+func (c *RetryableClient) Paginate(url string, next NextPageFunc) *Paginator {
+	if next == nil {
+		next = LinkNext
+	}
+
+	return &Paginator{client: c, url: url, next: next}
+}
+
+// Pages fetches the pages one at a time, as they are received:
+//
+//	for page := range it.Pages(ctx) {
+//		if page.Err != nil {
+//			return page.Err
+//		}
+//		...
+//	}
+//
+// The channel is closed after the last page or a page with Err. Cancel ctx to
+// stop early. Non-2xx responses end the walk with a *StatusError.
+func (p *Paginator) Pages(ctx context.Context) <-chan Page {
+	pages := make(chan Page)
+	go func() {
+		defer close(pages)
+		send := func(page Page) bool {
+			select {
+			case pages <- page:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for next := p.url; next != ""; {
+			page, err := p.fetch(ctx, next)
+			if err != nil {
+				send(Page{Err: err})
+				return
+			}
+			if next, err = p.following(page); !send(*page) {
+				return
+			}
+			if err != nil {
+				send(Page{Err: err})
+				return
+			}
+		}
+	}()
+
+	return pages
+}
+
+func (p *Paginator) fetch(ctx context.Context, rawURL string) (*Page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, p.client.current().statusError(resp)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Links are relative to where redirects led
+	u := req.URL
+	if resp.Request != nil {
+		u = resp.Request.URL
+	}
+
+	return &Page{URL: u, StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// following returns the absolute URL of the page after page, or "".
+func (p *Paginator) following(page *Page) (string, error) {
+	next, err := p.next(page)
+	if err != nil || next == "" {
+		return "", err
+	}
+	u, err := page.URL.Parse(next)
+	if err != nil {
+		return "", err
+	}
+
+	return u.String(), nil
+}
+
+// LinkNext finds the next page in the Link header of p, the target of
+// rel="next".
+func LinkNext(p *Page) (string, error) {
+	for _, header := range p.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(kv[0], "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(kv[1], `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1], nil
+					}
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,166 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestLinkNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		links []string
+		want  string
+	}{
+		{name: "no links"},
+		{name: "next", links: []string{`<https://example.com/items?page=2>; rel="next"`}, want: "https://example.com/items?page=2"},
+		{name: "unquoted", links: []string{`</items?page=2>; rel=next`}, want: "/items?page=2"},
+		{
+			name:  "among others",
+			links: []string{`</items?page=1>; rel="first", </items?page=2>; rel="next", </items?page=9>; rel="last"`},
+			want:  "/items?page=2",
+		},
+		{name: "in a second header", links: []string{`</items?page=1>; rel="prev"`, `</items?page=3>; rel="next"`}, want: "/items?page=3"},
+		{name: "several relations", links: []string{`</items?page=2>; rel="next last"`}, want: "/items?page=2"},
+		{name: "case", links: []string{`</items?page=2>; REL="Next"`}, want: "/items?page=2"},
+		{name: "last page", links: []string{`</items?page=1>; rel="prev"`}},
+		{name: "malformed target", links: []string{`/items?page=2; rel="next"`}},
+		{name: "other params", links: []string{`</items?page=2>; title="next"; rel="next"`}, want: "/items?page=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LinkNext(&Page{Header: http.Header{"Link": tt.links}})
+			if err != nil || got != tt.want {
+				t.Errorf("LinkNext() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// newPagesServer serves pages 1 to last of /items, linking each to the next
+// with a relative URL. fail maps a page to the statuses of its first
+// requests.
+func newPagesServer(t *testing.T, last int, fail map[int][]int) *httptest.Server {
+	var mu sync.Mutex
+	requests := make(map[int]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		mu.Lock()
+		n := requests[page]
+		requests[page]++
+		mu.Unlock()
+		if n < len(fail[page]) {
+			w.WriteHeader(fail[page][n])
+			return
+		}
+		if page < last {
+			w.Header().Set("Link", `</items?page=`+strconv.Itoa(page+1)+`>; rel="next"`)
+		}
+		w.Write([]byte("page " + strconv.Itoa(page)))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestPaginatorPages(t *testing.T) {
+	errNext := errors.New("no cursor")
+	tests := []struct {
+		name      string
+		last      int
+		fail      map[int][]int
+		next      NextPageFunc
+		wantPages []string
+		wantErr   func(error) bool
+	}{
+		{name: "one page", last: 1, wantPages: []string{"page 1"}},
+		{name: "linked", last: 3, wantPages: []string{"page 1", "page 2", "page 3"}},
+		{name: "page retried", last: 2, fail: map[int][]int{2: {503}}, wantPages: []string{"page 1", "page 2"}},
+		{
+			name:      "page refused",
+			last:      3,
+			fail:      map[int][]int{2: {404}},
+			wantPages: []string{"page 1"},
+			wantErr:   func(err error) bool { var e *StatusError; return errors.As(err, &e) && e.Code == 404 },
+		},
+		{
+			name: "custom next",
+			last: 1,
+			next: func(p *Page) (string, error) {
+				if string(p.Body) == "page 3" {
+					return "", nil
+				}
+				return "items?page=3", nil
+			},
+			wantPages: []string{"page 1", "page 3"},
+		},
+		{
+			name:      "next failed",
+			last:      3,
+			next:      func(p *Page) (string, error) { return "", errNext },
+			wantPages: []string{"page 1"},
+			wantErr:   func(err error) bool { return err == errNext },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newPagesServer(t, tt.last, tt.fail)
+			p := NewRetryableClient(fastBackoff).Paginate(srv.URL+"/items?page=1", tt.next)
+
+			var pages []string
+			var err error
+			for page := range p.Pages(context.Background()) {
+				if page.Err != nil {
+					err = page.Err
+					continue
+				}
+				if page.StatusCode != 200 || page.URL.Path != "/items" {
+					t.Errorf("page %d from %v", page.StatusCode, page.URL)
+				}
+				pages = append(pages, string(page.Body))
+			}
+			if !reflect.DeepEqual(pages, tt.wantPages) {
+				t.Errorf("pages = %q, want %q", pages, tt.wantPages)
+			}
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !tt.wantErr(err) {
+				t.Errorf("walk ended with %v", err)
+			}
+		})
+	}
+}
+
+func TestPaginatorWalkedAgain(t *testing.T) {
+	srv := newPagesServer(t, 2, nil)
+	p := NewRetryableClient().Paginate(srv.URL+"/items?page=1", nil)
+
+	for i := 0; i < 2; i++ {
+		n := 0
+		for range p.Pages(context.Background()) {
+			n++
+		}
+		if n != 2 {
+			t.Errorf("walk %d got %d pages, want 2", i+1, n)
+		}
+	}
+}
+
+func TestPaginatorCancelled(t *testing.T) {
+	srv := newPagesServer(t, 100, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	pages := NewRetryableClient().Paginate(srv.URL+"/items?page=1", nil).Pages(ctx)
+
+	<-pages
+	cancel()
+	n := 0
+	for range pages {
+		n++
+	}
+	if n > 2 {
+		t.Errorf("%d pages after cancelling", n)
+	}
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// PanicError is returned when an attempt panicked, e.g. in a hook, a response
+// validator or a middleware. It is not retried.
+type PanicError struct {
+	Value interface{}
+	// Stack is the stack trace of the goroutine that panicked.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("rhttp: panic during request: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// WithPanicRecovery sets whether a panic during a request is recovered and
+// returned as a *PanicError, the default, or crashes the program as usual.
+func WithPanicRecovery(enabled bool) Option {
+	return func(c *config) {
+		c.noPanicRecovery = !enabled
+	}
+}
+
+// catchPanic turns a panic into a *PanicError in *err, releasing and clearing
+// *resp if resp is not nil. It must be deferred directly.
+func (c *config) catchPanic(resp **http.Response, err *error) {
+	if c.noPanicRecovery {
+		return
+	}
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	if resp != nil {
+		drainBody(*resp)
+		*resp = nil
+	}
+	*err = &permanentError{err: &PanicError{Value: v, Stack: debug.Stack()}}
+}
+
+// safely calls f, returning a *PanicError if it panics.
+func (c *config) safely(f func()) (err error) {
+	defer c.catchPanic(nil, &err)
+	f()
+
+	return nil
+}
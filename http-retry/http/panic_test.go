@@ -0,0 +1,114 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name      string
+		statuses  []int
+		opts      []Option
+		wantValue interface{}
+		wantSent  int
+	}{
+		{
+			name:      "hook",
+			statuses:  []int{200},
+			opts:      []Option{WithHooks(Hooks{OnRequest: func(*http.Request, int) { panic("in the hook") }})},
+			wantValue: "in the hook",
+		},
+		{
+			name:      "before the attempt",
+			statuses:  []int{200},
+			opts:      []Option{WithBeforeAttempt(func(int, *http.Request) error { panic(errBoom) })},
+			wantValue: errBoom,
+		},
+		{
+			name:      "validator",
+			statuses:  []int{200},
+			opts:      []Option{WithResponseValidator(func(*http.Response) error { panic("in the validator") })},
+			wantValue: "in the validator",
+			wantSent:  1,
+		},
+		{
+			name:     "middleware",
+			statuses: []int{200},
+			opts: []Option{WithMiddleware(func(next http.RoundTripper) http.RoundTripper {
+				return roundTripperFunc(func(req *http.Request) (*http.Response, error) { panic("in the middleware") })
+			})},
+			wantValue: "in the middleware",
+		},
+		{
+			name:     "not retried",
+			statuses: []int{503, 200},
+			opts: []Option{WithHooks(Hooks{OnRetry: func(*http.Request, *http.Response, error, int, time.Duration) {
+				panic("in the retry hook")
+			}})},
+			wantValue: "in the retry hook",
+			wantSent:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			c := NewRetryableClient(append([]Option{fastBackoff}, tt.opts...)...)
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+			if resp != nil {
+				t.Errorf("response %d returned along with the panic", resp.StatusCode)
+			}
+			var panicErr *PanicError
+			if !errors.As(err, &panicErr) || panicErr.Value != tt.wantValue {
+				t.Fatalf("Do() error = %v, want a PanicError of %v", err, tt.wantValue)
+			}
+			if !strings.Contains(string(panicErr.Stack), "panic_test.go") {
+				t.Errorf("stack does not lead to the panic:\n%s", panicErr.Stack)
+			}
+			if srv.count() != tt.wantSent {
+				t.Errorf("%d requests sent, want %d", srv.count(), tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestPanicRecoveryDisabled(t *testing.T) {
+	srv := newScriptServer(t, 200)
+	c := NewRetryableClient(WithPanicRecovery(false), WithHooks(Hooks{OnRequest: func(*http.Request, int) { panic("in the hook") }}))
+
+	defer func() {
+		if v := recover(); v != "in the hook" {
+			t.Errorf("recovered %v, want the hook's panic", v)
+		}
+	}()
+	c.Do(context.Background(), mustNewRequest(t, srv.URL))
+	t.Error("Do() returned after the panic")
+}
+
+func TestPanicError(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name       string
+		value      interface{}
+		want       string
+		wantUnwrap error
+	}{
+		{name: "string", value: "oops", want: "rhttp: panic during request: oops"},
+		{name: "error", value: errBoom, want: "rhttp: panic during request: boom", wantUnwrap: errBoom},
+		{name: "other", value: 42, want: "rhttp: panic during request: 42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &PanicError{Value: tt.value}
+			if err.Error() != tt.want || err.Unwrap() != tt.wantUnwrap {
+				t.Errorf("PanicError = %q unwrapping to %v, want %q unwrapping to %v", err, err.Unwrap(), tt.want, tt.wantUnwrap)
+			}
+		})
+	}
+}
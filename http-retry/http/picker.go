@@ -0,0 +1,155 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Picker chooses where each attempt is sent, so retries and hedges can go to
+// other backend instances. It is told the outcome of every attempt it routed.
+type Picker interface {
+	// Pick returns the URL to send an attempt of req to.
+	Pick(req *http.Request) (*url.URL, error)
+	// Mark reports whether the attempt sent to u succeeded, as judged by the
+	// retry policy.
+	Mark(u *url.URL, success bool)
+}
+
+// Resolver lists the instances behind a host, as host or host:port
+// addresses.
+type Resolver interface {
+	Resolve(ctx context.Context, host string) ([]string, error)
+}
+
+// ResolverFunc adapts a plain function to the Resolver interface.
+type ResolverFunc func(ctx context.Context, host string) ([]string, error)
+
+func (f ResolverFunc) Resolve(ctx context.Context, host string) ([]string, error) {
+	return f(ctx, host)
+}
+
+// StaticResolver resolves every host to addrs.
+func StaticResolver(addrs ...string) Resolver {
+	return ResolverFunc(func(context.Context, string) ([]string, error) {
+		return addrs, nil
+	})
+}
+
+// DNSResolver looks the host up on every attempt, which suits a headless
+// Kubernetes service resolving to the addresses of its pods.
+func DNSResolver() Resolver {
+	return ResolverFunc(func(ctx context.Context, host string) ([]string, error) {
+		return net.DefaultResolver.LookupHost(ctx, host)
+	})
+}
+
+// WithPicker routes every attempt through p. Combine it with WithHostOptions
+// to balance the requests to one host only.
+func WithPicker(p Picker) Option {
+	return func(c *config) {
+		c.picker = p
+	}
+}
+
+// pick returns req routed by the picker, if any.
+func (c *config) pick(req *http.Request) (*http.Request, error) {
+	if c.picker == nil {
+		return req, nil
+	}
+
+	u, err := c.picker.Pick(req)
+	if err != nil || u == req.URL {
+		return req, err
+	}
+
+	picked := req.WithContext(req.Context())
+	picked.URL = u
+	if u.Host != req.URL.Host {
+		picked.Host = ""
+	}
+
+	return picked, nil
+}
+
+// balancer is the base of the pickers spreading attempts over the instances
+// of a host.
+type balancer struct {
+	resolver Resolver
+	choose   func(b *balancer, addrs []string) string
+
+	mu       sync.Mutex
+	next     int
+	failures map[string]int
+}
+
+// NewRoundRobinPicker sends each attempt to the next instance of the host in
+// turn, as listed by r.
+func NewRoundRobinPicker(r Resolver) Picker {
+	return &balancer{resolver: r, choose: (*balancer).roundRobin, failures: make(map[string]int)}
+}
+
+// NewLeastFailuresPicker sends each attempt to the instance of the host with
+// the fewest consecutive failures, taking turns among equals, so unhealthy
+// instances are avoided until the others fail too.
+func NewLeastFailuresPicker(r Resolver) Picker {
+	return &balancer{resolver: r, choose: (*balancer).leastFailures, failures: make(map[string]int)}
+}
+
+func (b *balancer) Pick(req *http.Request) (*url.URL, error) {
+	addrs, err := b.resolver.Resolve(req.Context(), req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no instances found", Name: req.URL.Hostname(), IsNotFound: true}
+	}
+	port := req.URL.Port()
+	for i, addr := range addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil && port != "" {
+			addrs[i] = net.JoinHostPort(addr, port)
+		}
+	}
+
+	b.mu.Lock()
+	addr := b.choose(b, addrs)
+	b.mu.Unlock()
+
+	u := *req.URL
+	u.Host = addr
+
+	return &u, nil
+}
+
+func (b *balancer) Mark(u *url.URL, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		delete(b.failures, u.Host)
+		return
+	}
+	b.failures[u.Host]++
+}
+
+func (b *balancer) roundRobin(addrs []string) string {
+	addr := addrs[b.next%len(addrs)]
+	b.next++
+
+	return addr
+}
+
+func (b *balancer) leastFailures(addrs []string) string {
+	best := ""
+	for i := range addrs {
+		addr := addrs[(b.next+i)%len(addrs)]
+		if best == "" || b.failures[addr] < b.failures[best] {
+			best = addr
+		}
+	}
+	b.next++
+
+	return best
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestPickers(t *testing.T) {
+	type mark struct {
+		host    string
+		success bool
+	}
+	tests := []struct {
+		name   string
+		picker func(Resolver) Picker
+		// marks are reported before the picks.
+		marks []mark
+		want  []string
+	}{
+		{
+			name:   "round robin",
+			picker: NewRoundRobinPicker,
+			want:   []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080", "10.0.0.1:8080"},
+		},
+		{
+			name:   "round robin ignores failures",
+			picker: NewRoundRobinPicker,
+			marks:  []mark{{"10.0.0.1:8080", false}},
+			want:   []string{"10.0.0.1:8080", "10.0.0.2:8080"},
+		},
+		{
+			name:   "least failures takes turns among equals",
+			picker: NewLeastFailuresPicker,
+			want:   []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080"},
+		},
+		{
+			name:   "least failures avoids failing instances",
+			picker: NewLeastFailuresPicker,
+			marks:  []mark{{"10.0.0.1:8080", false}, {"10.0.0.2:8080", false}, {"10.0.0.2:8080", false}},
+			want:   []string{"10.0.0.3:8080", "10.0.0.3:8080", "10.0.0.3:8080"},
+		},
+		{
+			name:   "success clears the failures",
+			picker: NewLeastFailuresPicker,
+			marks:  []mark{{"10.0.0.1:8080", false}, {"10.0.0.1:8080", true}},
+			want:   []string{"10.0.0.1:8080", "10.0.0.2:8080"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.picker(StaticResolver("10.0.0.1", "10.0.0.2", "10.0.0.3:8080"))
+			for _, m := range tt.marks {
+				p.Mark(&url.URL{Host: m.host}, m.success)
+			}
+
+			var got []string
+			for range tt.want {
+				u, err := p.Pick(mustNewRequest(t, "http://svc.internal:8080/items?id=1"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if u.Path != "/items" || u.RawQuery != "id=1" {
+					t.Errorf("Pick() = %v, want the path and query kept", u)
+				}
+				got = append(got, u.Host)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("picked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickerResolveErrors(t *testing.T) {
+	errLookup := errors.New("lookup failed")
+	tests := []struct {
+		name     string
+		resolver Resolver
+		check    func(error) bool
+	}{
+		{
+			name:     "resolver error",
+			resolver: ResolverFunc(func(context.Context, string) ([]string, error) { return nil, errLookup }),
+			check:    func(err error) bool { return errors.Is(err, errLookup) },
+		},
+		{
+			name:     "no instances",
+			resolver: StaticResolver(),
+			check:    func(err error) bool { return ClassifyError(err) == ErrorClassDNS },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRoundRobinPicker(tt.resolver).Pick(mustNewRequest(t, "http://svc.internal/"))
+			if !tt.check(err) {
+				t.Errorf("Pick() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithPicker(t *testing.T) {
+	bad := newScriptServer(t, 503)
+	good := newScriptServer(t, 200)
+	p := NewLeastFailuresPicker(StaticResolver(mustParseURL(t, bad.URL).Host, mustParseURL(t, good.URL).Host))
+	c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0), WithPicker(p))
+
+	for i := 0; i < 3; i++ {
+		resp, err := c.Do(context.Background(), mustNewRequest(t, "http://svc.internal/items"))
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d = %v, %v", i+1, resp, err)
+		}
+		drainBody(resp)
+	}
+	// The retry of the first request went to the other instance, and the
+	// later requests avoided the failing one
+	if bad.count() != 1 || good.count() != 3 {
+		t.Errorf("failing instance received %d requests and healthy one %d, want 1 and 3", bad.count(), good.count())
+	}
+	if r, _ := good.request(0); r.Host != mustParseURL(t, good.URL).Host {
+		t.Errorf("Host = %q, want the instance's", r.Host)
+	}
+}
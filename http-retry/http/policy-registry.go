@@ -0,0 +1,200 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// PolicySchema identifies the JSON encoding of EncodePolicy.
+const PolicySchema = "rhttp.policy/v1"
+
+// encodedPolicy is the JSON document of a policy: the fields of Settings
+// along with the schema.
+type encodedPolicy struct {
+	Schema string `json:"schema"`
+	*Settings
+}
+
+// EncodePolicy encodes s in the canonical JSON form of PolicySchema: fields
+// in a fixed order, status lists sorted and defaults spelled out, so equal
+// policies encode to the same bytes and can be distributed, diffed and
+// fingerprinted.
+func EncodePolicy(s *Settings) ([]byte, error) {
+	if err := s.validate(true); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(encodedPolicy{Schema: PolicySchema, Settings: s.canonical()}, "", "  ")
+}
+
+// DecodePolicy decodes a policy encoded by EncodePolicy. Unknown fields and
+// other schemas are rejected.
+func DecodePolicy(b []byte) (*Settings, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	p := encodedPolicy{Settings: &Settings{}}
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("rhttp: parsing policy: %w", err)
+	}
+	if p.Schema != PolicySchema {
+		return nil, fmt.Errorf("rhttp: unsupported policy schema %q, want %q", p.Schema, PolicySchema)
+	}
+	if err := p.Settings.validate(true); err != nil {
+		return nil, err
+	}
+
+	return p.Settings.canonical(), nil
+}
+
+// PolicyFingerprint returns a short hash of the canonical encoding of s, to
+// tell at a glance whether two clients run the same policy.
+func PolicyFingerprint(s *Settings) string {
+	if s == nil {
+		return ""
+	}
+	b, err := json.Marshal(s.canonical())
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:6])
+}
+
+// canonical returns a deep copy of s in canonical form.
+func (s *Settings) canonical() *Settings {
+	c := *s
+	if s.MaxRetries != nil {
+		n := *s.MaxRetries
+		c.MaxRetries = &n
+	}
+	if s.Backoff != nil {
+		b := *s.Backoff
+		if b.Type == "" {
+			b.Type = "exponential"
+		}
+		if b.Jitter == "" {
+			b.Jitter = "full"
+		}
+		c.Backoff = &b
+	}
+	c.RetryOn, c.NeverRetry = sortedCodes(s.RetryOn), sortedCodes(s.NeverRetry)
+	if s.Circuit != nil {
+		cb := *s.Circuit
+		c.Circuit = &cb
+	}
+	c.Hosts = nil
+	for pattern, hs := range s.Hosts {
+		if hs == nil {
+			continue
+		}
+		if c.Hosts == nil {
+			c.Hosts = make(map[string]*Settings, len(s.Hosts))
+		}
+		c.Hosts[pattern] = hs.canonical()
+	}
+
+	return &c
+}
+
+// sortedCodes returns a sorted copy of codes without duplicates.
+func sortedCodes(codes []int) []int {
+	if codes == nil {
+		return nil
+	}
+
+	sorted := make([]int, 0, len(codes))
+	seen := make(map[int]bool, len(codes))
+	for _, code := range codes {
+		if !seen[code] {
+			seen[code] = true
+			sorted = append(sorted, code)
+		}
+	}
+	sort.Ints(sorted)
+
+	return sorted
+}
+
+var policies = struct {
+	sync.RWMutex
+	byName map[string]*Settings
+}{byName: make(map[string]*Settings)}
+
+// RegisterPolicy makes p available under name to WithPolicy, replacing any
+// policy registered under that name, so a platform team can ship vetted
+// policies to many services in a shared package. p is copied, later changes
+// to it have no effect.
+func RegisterPolicy(name string, p *Settings) error {
+	if name == "" || p == nil {
+		return fmt.Errorf("rhttp: policy needs a name and settings")
+	}
+	if err := p.validate(true); err != nil {
+		return fmt.Errorf("rhttp: policy %q: %w", name, err)
+	}
+
+	policies.Lock()
+	defer policies.Unlock()
+
+	policies.byName[name] = p.canonical()
+
+	return nil
+}
+
+// LookupPolicy returns a copy of the policy registered under name.
+func LookupPolicy(name string) (*Settings, bool) {
+	policies.RLock()
+	defer policies.RUnlock()
+
+	p, ok := policies.byName[name]
+	if !ok {
+		return nil, false
+	}
+
+	return p.canonical(), true
+}
+
+// RegisteredPolicies returns the names of the registered policies, sorted.
+func RegisteredPolicies() []string {
+	policies.RLock()
+	defer policies.RUnlock()
+
+	names := make([]string, 0, len(policies.byName))
+	for name := range policies.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// PolicySource tells which policy a client runs, as reported by DebugStats:
+// the name given to WithPolicy, empty for settings applied otherwise, and the
+// PolicyFingerprint of the settings.
+type PolicySource struct {
+	Name        string `json:"name,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// WithPolicy applies the policy registered under name, like WithSettings,
+// and reports it to the debug endpoint, see WithDebugStats. The policy is
+// looked up when the option is applied; if there is none, requests fail.
+func WithPolicy(name string) Option {
+	return func(c *config) {
+		p, ok := LookupPolicy(name)
+		if !ok {
+			if c.optionErr == nil {
+				c.optionErr = fmt.Errorf("rhttp: no policy registered as %q", name)
+			}
+			return
+		}
+		WithSettings(p)(c)
+		c.policySource.Name = name
+	}
+}
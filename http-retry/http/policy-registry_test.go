@@ -0,0 +1,141 @@
+package http
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestPolicyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Settings
+	}{
+		{name: "empty", policy: &Settings{}},
+		{name: "retry on nothing", policy: &Settings{RetryOn: []int{}}},
+		{name: "never retry nothing", policy: &Settings{NeverRetry: []int{}}},
+		{
+			name: "full",
+			policy: &Settings{
+				MaxRetries: intPtr(3),
+				Backoff:    &BackoffSettings{Type: "constant", Base: Duration(time.Second), Jitter: "none"},
+				RetryOn:    []int{429, 503},
+				NeverRetry: []int{501},
+				Timeout:    Duration(30 * time.Second),
+				Circuit:    &CircuitBreakerSettings{FailureThreshold: 5, Cooldown: Duration(time.Minute)},
+				Hosts: map[string]*Settings{
+					"api.example.com": {MaxRetries: intPtr(0), RetryOn: []int{}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := EncodePolicy(tt.policy)
+			if err != nil {
+				t.Fatalf("EncodePolicy() error = %v", err)
+			}
+			got, err := DecodePolicy(b)
+			if err != nil {
+				t.Fatalf("DecodePolicy(%s) error = %v", b, err)
+			}
+			if want := tt.policy.canonical(); !reflect.DeepEqual(got, want) {
+				t.Errorf("DecodePolicy(EncodePolicy()) = %+v, want %+v", got, want)
+			}
+			if (got.RetryOn == nil) != (tt.policy.RetryOn == nil) {
+				t.Errorf("RetryOn = %#v after the round trip, want %#v", got.RetryOn, tt.policy.RetryOn)
+			}
+			again, err := EncodePolicy(got)
+			if err != nil || string(again) != string(b) {
+				t.Errorf("encoding again = %s, %v, want %s", again, err, b)
+			}
+		})
+	}
+}
+
+func TestEncodePolicyKeepsEmptyRetryOn(t *testing.T) {
+	b, err := EncodePolicy(&Settings{RetryOn: []int{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"retry_on": []`) {
+		t.Errorf("EncodePolicy() = %s, want an empty retry_on", b)
+	}
+	if PolicyFingerprint(&Settings{RetryOn: []int{}}) == PolicyFingerprint(&Settings{}) {
+		t.Error("an empty retry_on has the fingerprint of a missing one")
+	}
+}
+
+func TestPolicyCanonicalForm(t *testing.T) {
+	a := &Settings{RetryOn: []int{503, 429, 503}, Backoff: &BackoffSettings{Base: Duration(time.Second)}}
+	b := &Settings{RetryOn: []int{429, 503}, Backoff: &BackoffSettings{Type: "exponential", Base: Duration(time.Second), Jitter: "full"}}
+
+	if PolicyFingerprint(a) != PolicyFingerprint(b) {
+		t.Errorf("PolicyFingerprint() differs for equal policies: %s, %s", PolicyFingerprint(a), PolicyFingerprint(b))
+	}
+	ea, _ := EncodePolicy(a)
+	eb, _ := EncodePolicy(b)
+	if string(ea) != string(eb) {
+		t.Errorf("EncodePolicy() differs for equal policies:\n%s\n%s", ea, eb)
+	}
+	if PolicyFingerprint(a) == PolicyFingerprint(&Settings{RetryOn: []int{429}}) {
+		t.Error("PolicyFingerprint() is the same for different policies")
+	}
+}
+
+func TestDecodePolicyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{name: "not JSON", in: `retry_on: []`},
+		{name: "no schema", in: `{"max_retries": 1}`},
+		{name: "other schema", in: `{"schema": "rhttp.policy/v2"}`},
+		{name: "unknown field", in: `{"schema": "rhttp.policy/v1", "retries": 1}`},
+		{name: "invalid settings", in: `{"schema": "rhttp.policy/v1", "max_retries": -1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodePolicy([]byte(tt.in)); err == nil {
+				t.Errorf("DecodePolicy(%s) error = nil", tt.in)
+			}
+		})
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	if err := RegisterPolicy("test/no-status", &Settings{MaxRetries: intPtr(2), RetryOn: []int{}}); err != nil {
+		t.Fatalf("RegisterPolicy() error = %v", err)
+	}
+	if err := RegisterPolicy("", &Settings{}); err == nil {
+		t.Error("RegisterPolicy() without a name error = nil")
+	}
+
+	tests := []struct {
+		name      string
+		policy    string
+		wantCount int
+		wantErr   bool
+	}{
+		{name: "registered", policy: "test/no-status", wantCount: 1},
+		{name: "unknown", policy: "test/missing", wantCount: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503, 200)
+			c := NewRetryableClient(fastBackoff, WithPolicy(tt.policy))
+
+			status, _, err := c.GetBytes(context.Background(), srv.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetBytes() = %d, %v, want an error: %v", status, err, tt.wantErr)
+			}
+			if srv.count() != tt.wantCount {
+				t.Errorf("server received %d requests, want %d", srv.count(), tt.wantCount)
+			}
+		})
+	}
+}
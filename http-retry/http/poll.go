@@ -0,0 +1,51 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Poll consumes a long-poll API until ctx is done, handle fails or a request
+// fails with an error that is not retried. Every response goes to handle,
+// which returns the cursor the next request is built with; the next poll is
+// sent right away. Requests failing once the client's retries are exhausted
+// are sent again after a backoff that grows while the failures last, so an
+// outage does not end the loop. The first request is built with an empty
+// cursor. Poll closes the response bodies.
+func (c *RetryableClient) Poll(ctx context.Context, buildReq func(cursor string) *http.Request,
+	handle func(*http.Response) (nextCursor string, err error)) error {
+	var cursor string
+	var failures int
+	var delay time.Duration
+	for {
+		resp, err := c.Do(ctx, buildReq(cursor))
+		if ctx.Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return ctx.Err()
+		}
+		if err != nil {
+			var retryErr *RetryError
+			if !errors.As(err, &retryErr) && (isPermanent(err) || !c.current().policy.ShouldRetry(nil, err, 1)) {
+				return err
+			}
+			delay = backoffDelay(c.current().backoff, failures, delay)
+			failures++
+			if err := sleep(ctx, c.config.clock, delay); err != nil {
+				return err
+			}
+			continue
+		}
+		failures, delay = 0, 0
+
+		next, err := handle(resp)
+		drainBody(resp)
+		if err != nil {
+			return err
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPoll(t *testing.T) {
+	errStop := errors.New("stop")
+	tests := []struct {
+		name     string
+		statuses []int
+		// polls is how many responses handle takes before it stops the
+		// loop.
+		polls       int
+		wantCursors []string
+		wantStatus  []int
+		wantWaits   []time.Duration
+	}{
+		{
+			name:        "cursors",
+			statuses:    []int{200},
+			polls:       3,
+			wantCursors: []string{"", "1", "2"},
+			wantStatus:  []int{200, 200, 200},
+		},
+		{
+			// Every poll is tried twice, a second apart, before Poll backs
+			// off
+			name:        "outage",
+			statuses:    []int{503, 503, 503, 503, 200},
+			polls:       1,
+			wantCursors: []string{"", "", "", "", ""},
+			wantStatus:  []int{200},
+			wantWaits:   []time.Duration{time.Second, time.Second, time.Second, 2 * time.Second},
+		},
+		{
+			name:        "backoff reset after a response",
+			statuses:    []int{503, 503, 200, 503, 503, 200},
+			polls:       2,
+			wantCursors: []string{"", "", "", "1", "1", "1"},
+			wantStatus:  []int{200, 200},
+			wantWaits:   []time.Duration{time.Second, time.Second, time.Second, time.Second},
+		},
+		{
+			name:        "responses not retried are handled",
+			statuses:    []int{404, 200},
+			polls:       2,
+			wantCursors: []string{"", "1"},
+			wantStatus:  []int{404, 200},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			clock := newStepClock()
+			c := NewRetryableClient(
+				WithClock(clock),
+				WithMaxRetries(1),
+				WithBackoff(ExponentialBackoff{Base: time.Second, Max: time.Minute, Jitter: NoJitter}),
+			)
+			var status []int
+
+			err := c.Poll(context.Background(), func(cursor string) *http.Request {
+				return mustNewRequest(t, srv.URL+"?cursor="+cursor)
+			}, func(resp *http.Response) (string, error) {
+				status = append(status, resp.StatusCode)
+				if len(status) == tt.polls {
+					return "", errStop
+				}
+				return strconv.Itoa(len(status)), nil
+			})
+			if err != errStop {
+				t.Errorf("Poll() error = %v, want the handler's", err)
+			}
+
+			var cursors []string
+			for i := 0; i < srv.count(); i++ {
+				r, _ := srv.request(i)
+				cursors = append(cursors, r.URL.Query().Get("cursor"))
+			}
+			if !reflect.DeepEqual(cursors, tt.wantCursors) {
+				t.Errorf("cursors = %q, want %q", cursors, tt.wantCursors)
+			}
+			if !reflect.DeepEqual(status, tt.wantStatus) {
+				t.Errorf("handled %v, want %v", status, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(clock.Waits(), tt.wantWaits) {
+				t.Errorf("waits = %v, want %v", clock.Waits(), tt.wantWaits)
+			}
+		})
+	}
+}
+
+func TestPollErrors(t *testing.T) {
+	srv := newScriptServer(t, 200)
+	never := RetryPolicyFunc(func(resp *http.Response, err error, attempt int) bool { return false })
+	tests := []struct {
+		name    string
+		url     string
+		opts    []Option
+		handle  func(cancel context.CancelFunc) error
+		wantErr func(error) bool
+	}{
+		{
+			name:    "transport error not retried",
+			url:     "http://127.0.0.1:1",
+			opts:    []Option{WithRetryPolicy(never)},
+			wantErr: func(err error) bool { return err != nil && !errors.As(err, new(*RetryError)) },
+		},
+		{
+			name:    "cancelled",
+			url:     srv.URL,
+			handle:  func(cancel context.CancelFunc) error { cancel(); return nil },
+			wantErr: func(err error) bool { return err == context.Canceled },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			c := NewRetryableClient(append([]Option{WithClock(newStepClock()), WithMaxRetries(0)}, tt.opts...)...)
+
+			err := c.Poll(ctx, func(string) *http.Request {
+				return mustNewRequest(t, tt.url)
+			}, func(*http.Response) (string, error) {
+				return "", tt.handle(cancel)
+			})
+			if !tt.wantErr(err) {
+				t.Errorf("Poll() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package http
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ErrExpiredInQueue is returned, in earliest-deadline-first order, for a
+// request whose context deadline passed while it waited for a slot or a
+// token: it is dropped from the queue without being sent. It matches
+// context.DeadlineExceeded with errors.Is.
+var ErrExpiredInQueue error = queueDeadlineError{}
+
+type queueDeadlineError struct{}
+
+func (queueDeadlineError) Error() string { return "rhttp: deadline expired while queued" }
+
+func (queueDeadlineError) Is(target error) bool { return target == context.DeadlineExceeded }
+
+// Priority orders requests waiting in a Bulkhead queue or a PriorityLimiter.
+// Higher priorities go first.
+type Priority int
+
+const (
+	// PriorityLow is for batch and background traffic.
+	PriorityLow Priority = -1
+	// PriorityNormal is the priority of requests without one.
+	PriorityNormal Priority = 0
+	// PriorityHigh is for latency-critical requests.
+	PriorityHigh Priority = 1
+)
+
+// DefaultPriorityAging is how long a request waits before it is promoted by
+// one priority, so low-priority work is delayed under saturation but never
+// starved.
+const DefaultPriorityAging = time.Second
+
+type priorityKey struct{}
+
+// WithPriority returns a context giving the requests made with it priority p
+// when they have to wait for a slot or a token.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority set by WithPriority, PriorityNormal
+// by default.
+func PriorityFromContext(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+// priorityWaiter is a request waiting its turn. ready is closed when it gets
+// it.
+type priorityWaiter struct {
+	ctx      context.Context
+	priority Priority
+	since    time.Time
+	deadline time.Time
+	seq      uint64
+	ready    chan struct{}
+	granted  bool
+	// expired tells a waiter dropped for its deadline, see priorityQueue.edf.
+	expired bool
+}
+
+// priorityQueue orders waiters by priority, raised by one for every aging
+// period waited, then by arrival, or by deadline if edf is set. It is not
+// safe for concurrent use.
+type priorityQueue struct {
+	aging time.Duration
+	// edf orders waiters of the same priority by deadline, those without one
+	// last, and drops the waiters whose deadline passed.
+	edf     bool
+	seq     uint64
+	waiters []*priorityWaiter
+}
+
+func (q *priorityQueue) len() int {
+	return len(q.waiters)
+}
+
+func (q *priorityQueue) push(ctx context.Context, now time.Time) *priorityWaiter {
+	q.seq++
+	w := &priorityWaiter{ctx: ctx, priority: PriorityFromContext(ctx), since: now, seq: q.seq, ready: make(chan struct{})}
+	w.deadline, _ = ctx.Deadline()
+	q.waiters = append(q.waiters, w)
+
+	return w
+}
+
+// remove takes w out of the queue, e.g. when it gave up waiting.
+func (q *priorityQueue) remove(w *priorityWaiter) {
+	for i, x := range q.waiters {
+		if x == w {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// expired reports whether a waiter giving up with err, its context's error,
+// is dropped for its deadline.
+func (q *priorityQueue) expired(err error) bool {
+	return q.edf && err == context.DeadlineExceeded
+}
+
+// grant gives the turn to the first waiter, returning false if there is none.
+// In edf order the waiters whose deadline passed are dropped first, as told
+// by their context since deadlines are on the system clock, unlike now.
+func (q *priorityQueue) grant(now time.Time) bool {
+	if q.edf {
+		waiting := q.waiters[:0]
+		for _, w := range q.waiters {
+			if !q.expired(w.ctx.Err()) {
+				waiting = append(waiting, w)
+				continue
+			}
+			w.expired = true
+			close(w.ready)
+		}
+		q.waiters = waiting
+	}
+	if len(q.waiters) == 0 {
+		return false
+	}
+
+	best := 0
+	for i := 1; i < len(q.waiters); i++ {
+		if q.before(q.waiters[i], q.waiters[best], now) {
+			best = i
+		}
+	}
+	w := q.waiters[best]
+	q.waiters = append(q.waiters[:best], q.waiters[best+1:]...)
+	w.granted = true
+	close(w.ready)
+
+	return true
+}
+
+func (q *priorityQueue) before(a, b *priorityWaiter, now time.Time) bool {
+	pa, pb := q.effective(a, now), q.effective(b, now)
+	if pa != pb {
+		return pa > pb
+	}
+	if q.edf && !a.deadline.Equal(b.deadline) {
+		if a.deadline.IsZero() || b.deadline.IsZero() {
+			return b.deadline.IsZero()
+		}
+		return a.deadline.Before(b.deadline)
+	}
+
+	return a.seq < b.seq
+}
+
+func (q *priorityQueue) effective(w *priorityWaiter, now time.Time) Priority {
+	aging := q.aging
+	if aging <= 0 {
+		aging = DefaultPriorityAging
+	}
+
+	return w.priority + Priority(now.Sub(w.since)/aging)
+}
+
+// PriorityLimiter lets the requests waiting for a Limiter through in order of
+// priority, see WithPriority, instead of in order of arrival.
+type PriorityLimiter struct {
+	limiter Limiter
+
+	mu    sync.Mutex
+	busy  bool
+	queue priorityQueue
+}
+
+// NewPriorityLimiter wraps l. Waiting requests are promoted by one priority
+// every aging period, DefaultPriorityAging if zero.
+func NewPriorityLimiter(l Limiter, aging time.Duration) *PriorityLimiter {
+	return &PriorityLimiter{limiter: l, queue: priorityQueue{aging: aging}}
+}
+
+// NewDeadlineLimiter is like NewPriorityLimiter, but lets the waiting
+// requests of the same priority through earliest deadline first, those
+// without a deadline last. Requests whose deadline passes while they wait
+// fail with ErrExpiredInQueue.
+func NewDeadlineLimiter(l Limiter, aging time.Duration) *PriorityLimiter {
+	return &PriorityLimiter{limiter: l, queue: priorityQueue{aging: aging, edf: true}}
+}
+
+// Wait waits for the turn of ctx's request, then for the wrapped limiter.
+// Waiting time is measured with the clock of the client, see WithClock.
+func (l *PriorityLimiter) Wait(ctx context.Context) error {
+	clock := clockFromContext(ctx)
+
+	l.mu.Lock()
+	if l.busy {
+		if l.queue.expired(ctx.Err()) {
+			l.mu.Unlock()
+			return ErrExpiredInQueue
+		}
+		w := l.queue.push(ctx, clock.Now())
+		l.mu.Unlock()
+
+		select {
+		case <-w.ready:
+			if w.expired {
+				return ErrExpiredInQueue
+			}
+		case <-ctx.Done():
+			l.mu.Lock()
+			err := ctx.Err()
+			if l.queue.expired(err) {
+				err = ErrExpiredInQueue
+			}
+			if !w.granted {
+				l.queue.remove(w)
+				l.mu.Unlock()
+				return err
+			}
+			l.mu.Unlock()
+			// The turn came anyway, pass it on
+			l.next(clock)
+			return err
+		}
+	} else {
+		l.busy = true
+		l.mu.Unlock()
+	}
+
+	defer l.next(clock)
+
+	return l.limiter.Wait(ctx)
+}
+
+// next hands the turn to the first waiter, if any.
+func (l *PriorityLimiter) next(clock Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.queue.grant(clock.Now()) {
+		l.busy = false
+	}
+}
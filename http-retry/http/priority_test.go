@@ -0,0 +1,305 @@
+package http
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+var priorityEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type queued struct {
+	priority Priority
+	// waited is how long before now the waiter was queued.
+	waited time.Duration
+}
+
+// grantOrder pushes waiters into q in order, with contexts if set, and
+// returns the indexes of the waiters in the order q lets them go at now, and
+// those q dropped for their deadline.
+func grantOrder(q *priorityQueue, waiters []queued, contexts []context.Context, now time.Time) (order, expired []int) {
+	pushed := make([]*priorityWaiter, len(waiters))
+	for i, w := range waiters {
+		ctx := context.Background()
+		if contexts != nil && contexts[i] != nil {
+			ctx = contexts[i]
+		}
+		pushed[i] = q.push(WithPriority(ctx, w.priority), now.Add(-w.waited))
+	}
+
+	done := make([]bool, len(pushed))
+	for q.grant(now) {
+		for i, w := range pushed {
+			if !done[i] && w.granted {
+				done[i] = true
+				order = append(order, i)
+			}
+		}
+	}
+	for i, w := range pushed {
+		if w.expired {
+			expired = append(expired, i)
+		}
+	}
+
+	return order, expired
+}
+
+func TestPriorityQueueOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		aging   time.Duration
+		waiters []queued
+		want    []int
+	}{
+		{
+			name:    "arrival order",
+			waiters: []queued{{}, {}, {}},
+			want:    []int{0, 1, 2},
+		},
+		{
+			name:    "higher first",
+			waiters: []queued{{priority: PriorityLow}, {priority: PriorityNormal}, {priority: PriorityHigh}},
+			want:    []int{2, 1, 0},
+		},
+		{
+			name:    "same priority in arrival order",
+			waiters: []queued{{priority: PriorityHigh}, {priority: PriorityLow}, {priority: PriorityHigh}},
+			want:    []int{0, 2, 1},
+		},
+		{
+			name:    "aged low overtakes normal",
+			waiters: []queued{{priority: PriorityNormal}, {priority: PriorityLow, waited: 2 * DefaultPriorityAging}},
+			want:    []int{1, 0},
+		},
+		{
+			name:    "aging under one period",
+			waiters: []queued{{priority: PriorityNormal}, {priority: PriorityLow, waited: DefaultPriorityAging / 2}},
+			want:    []int{0, 1},
+		},
+		{
+			name:    "custom aging",
+			aging:   time.Minute,
+			waiters: []queued{{priority: PriorityNormal}, {priority: PriorityLow, waited: 2 * DefaultPriorityAging}},
+			want:    []int{0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &priorityQueue{aging: tt.aging}
+			got, _ := grantOrder(q, tt.waiters, nil, priorityEpoch)
+			if !equalInts(got, tt.want) {
+				t.Errorf("grant order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestPriorityQueueRemove(t *testing.T) {
+	q := &priorityQueue{}
+	a := q.push(context.Background(), priorityEpoch)
+	b := q.push(context.Background(), priorityEpoch)
+	q.remove(a)
+	q.remove(a)
+	if q.len() != 1 || !q.grant(priorityEpoch) || !b.granted || a.granted {
+		t.Error("a removed waiter was granted its turn")
+	}
+	if q.grant(priorityEpoch) {
+		t.Error("grant on an empty queue = true")
+	}
+}
+
+// gateLimiter blocks every Wait until release is closed.
+type gateLimiter struct {
+	release chan struct{}
+}
+
+func (l gateLimiter) Wait(ctx context.Context) error {
+	select {
+	case <-l.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestPriorityLimiterOrder(t *testing.T) {
+	gate := gateLimiter{release: make(chan struct{})}
+	l := NewPriorityLimiter(gate, 0)
+
+	first := make(chan error, 1)
+	go func() { first <- l.Wait(context.Background()) }()
+	waitPriorityQueue(t, l, 0, true)
+
+	var mu sync.Mutex
+	var order []Priority
+	var wg sync.WaitGroup
+	for i, p := range []Priority{PriorityLow, PriorityHigh, PriorityNormal} {
+		wg.Add(1)
+		go func(p Priority) {
+			defer wg.Done()
+			if err := l.Wait(WithPriority(context.Background(), p)); err != nil {
+				t.Errorf("Wait(%d) error = %v", p, err)
+			}
+			mu.Lock()
+			order = append(order, p)
+			mu.Unlock()
+		}(p)
+		waitPriorityQueue(t, l, i+1, true)
+	}
+
+	close(gate.release)
+	if err := <-first; err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	wg.Wait()
+
+	want := []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+	waitPriorityQueue(t, l, 0, false)
+}
+
+func TestPriorityLimiterCancel(t *testing.T) {
+	gate := gateLimiter{release: make(chan struct{})}
+	l := NewPriorityLimiter(gate, 0)
+	go l.Wait(context.Background())
+	waitPriorityQueue(t, l, 0, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.Wait(ctx) }()
+	waitPriorityQueue(t, l, 1, true)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Wait() error = %v, want context.Canceled", err)
+	}
+	waitPriorityQueue(t, l, 0, true)
+	close(gate.release)
+	waitPriorityQueue(t, l, 0, false)
+}
+
+// waitPriorityQueue waits until l has n waiters queued and is busy or not.
+func waitPriorityQueue(t *testing.T, l *PriorityLimiter, n int, busy bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		l.mu.Lock()
+		gotN, gotBusy := l.queue.len(), l.busy
+		l.mu.Unlock()
+		if gotN == n && gotBusy == busy {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("limiter has %d waiters, busy: %v, want %d, %v", gotN, gotBusy, n, busy)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPriorityQueueEarliestDeadlineFirst(t *testing.T) {
+	const none = time.Duration(0)
+	tests := []struct {
+		name        string
+		edf         bool
+		waiters     []queued
+		deadlines   []time.Duration
+		want        []int
+		wantExpired []int
+	}{
+		{
+			name:      "earliest first",
+			edf:       true,
+			waiters:   []queued{{}, {}, {}},
+			deadlines: []time.Duration{3 * time.Hour, time.Hour, 2 * time.Hour},
+			want:      []int{1, 2, 0},
+		},
+		{
+			name:      "no deadline last",
+			edf:       true,
+			waiters:   []queued{{}, {}},
+			deadlines: []time.Duration{none, time.Hour},
+			want:      []int{1, 0},
+		},
+		{
+			name:      "priority before deadline",
+			edf:       true,
+			waiters:   []queued{{priority: PriorityHigh}, {}},
+			deadlines: []time.Duration{3 * time.Hour, time.Hour},
+			want:      []int{0, 1},
+		},
+		{
+			name:        "expired dropped",
+			edf:         true,
+			waiters:     []queued{{}, {}},
+			deadlines:   []time.Duration{-time.Second, time.Hour},
+			want:        []int{1},
+			wantExpired: []int{0},
+		},
+		{
+			name:      "arrival order without edf",
+			waiters:   []queued{{}, {}, {}},
+			deadlines: []time.Duration{-time.Second, 2 * time.Hour, time.Hour},
+			want:      []int{0, 1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contexts := make([]context.Context, len(tt.deadlines))
+			for i, d := range tt.deadlines {
+				if d == none {
+					continue
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), d)
+				defer cancel()
+				contexts[i] = ctx
+			}
+
+			q := &priorityQueue{edf: tt.edf}
+			got, expired := grantOrder(q, tt.waiters, contexts, priorityEpoch)
+			if !equalInts(got, tt.want) {
+				t.Errorf("grant order = %v, want %v", got, tt.want)
+			}
+			if !equalInts(expired, tt.wantExpired) {
+				t.Errorf("expired = %v, want %v", expired, tt.wantExpired)
+			}
+			if q.len() != 0 {
+				t.Errorf("%d waiters left in the queue", q.len())
+			}
+		})
+	}
+}
+
+func TestDeadlineLimiterDropsExpiredWaiters(t *testing.T) {
+	gate := gateLimiter{release: make(chan struct{})}
+	l := NewDeadlineLimiter(gate, 0)
+	go l.Wait(context.Background())
+	waitPriorityQueue(t, l, 0, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != ErrExpiredInQueue {
+		t.Errorf("Wait() error = %v, want ErrExpiredInQueue", err)
+	}
+	waitPriorityQueue(t, l, 0, true)
+	close(gate.release)
+	waitPriorityQueue(t, l, 0, false)
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestWithProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		// want are the proxies kept, none leaves the proxy unset.
+		want []string
+	}{
+		{name: "none"},
+		{
+			name:    "schemes",
+			proxies: []string{"http://a:3128", "HTTPS://b:3129", "socks5://user:secret@c:1080"},
+			want:    []string{"http://a:3128", "https://b:3129", "socks5://user:secret@c:1080"},
+		},
+		{
+			name:    "invalid ignored",
+			proxies: []string{"ftp://a:21", "b:3128", "http://%zz", "", "http://c:3128"},
+			want:    []string{"http://c:3128"},
+		},
+		{name: "all invalid", proxies: []string{"ftp://a:21", "/relative"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(WithProxies(tt.proxies...))
+			if tt.want == nil {
+				if cfg.proxyFailover != nil || cfg.proxy != nil {
+					t.Error("proxy set")
+				}
+				return
+			}
+			var got []string
+			for _, u := range cfg.proxyFailover.proxies {
+				got = append(got, u.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("proxies = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithProxyReplacesProxies(t *testing.T) {
+	cfg := newConfig(WithProxies("http://a:3128"), WithProxy(http.ProxyFromEnvironment))
+	if cfg.proxyFailover != nil {
+		t.Error("WithProxy kept the proxies of WithProxies")
+	}
+}
+
+func TestProxyFailover(t *testing.T) {
+	f := newConfig(WithProxies("http://a:1", "http://b:2", "http://c:3")).proxyFailover
+	a, b, c := f.proxies[0], f.proxies[1], f.proxies[2]
+	tests := []struct {
+		name   string
+		failed *url.URL
+		want   *url.URL
+	}{
+		{name: "first", want: a},
+		{name: "current failed", failed: a, want: b},
+		{name: "stale failure", failed: a, want: b},
+		{name: "next failed", failed: b, want: c},
+		{name: "wraps around", failed: c, want: a},
+	}
+	for _, tt := range tests {
+		if tt.failed != nil {
+			f.failed(tt.failed)
+		}
+		if got := f.pick(); got != tt.want {
+			t.Errorf("%s: pick() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsProxyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "proxy connect", err: &net.OpError{Op: "proxyconnect", Net: "tcp", Err: syscall.ECONNREFUSED}, want: true},
+		{name: "socks", err: &net.OpError{Op: "socks connect", Net: "tcp", Err: errors.New("general failure")}, want: true},
+		{name: "wrapped", err: &url.Error{Op: "Get", URL: "http://a", Err: &net.OpError{Op: "proxyconnect", Err: syscall.ECONNRESET}}, want: true},
+		{name: "upstream dial", err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}},
+		{name: "other", err: errors.New("boom")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isProxyError(tt.err); got != tt.want {
+				t.Errorf("isProxyError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithProxiesFailover(t *testing.T) {
+	// proxy answers the requests it forwards itself
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := parseProxyAuthorization(r.Header.Get("Proxy-Authorization"))
+		w.Write([]byte(r.URL.String() + " as " + user + ":" + pass))
+	}))
+	defer proxy.Close()
+	working := mustParseURL(t, proxy.URL)
+	working.User = url.UserPassword("user", "secret")
+	c := NewRetryableClient(fastBackoff, WithProxies("http://127.0.0.1:1", working.String()))
+
+	tests := []struct {
+		name    string
+		retries int
+	}{
+		{name: "moves on from the dead proxy", retries: 1},
+		// The next requests go straight to the proxy that works
+		{name: "stays on the working proxy", retries: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := c.Do(context.Background(), mustNewRequest(t, "http://upstream.test/path"), WithMaxRetries(tt.retries))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if want := "http://upstream.test/path as user:secret"; string(body) != want {
+				t.Errorf("proxy answered %q, want %q", body, want)
+			}
+		})
+	}
+}
+
+// parseProxyAuthorization decodes basic proxy credentials.
+func parseProxyAuthorization(auth string) (user, pass string, ok bool) {
+	r := &http.Request{Header: http.Header{"Authorization": {auth}}}
+	return r.BasicAuth()
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// QueuedRequest is the persisted form of a request in a Queue.
+type QueuedRequest struct {
+	ID         string        `json:"id"`
+	Method     string        `json:"method"`
+	URL        string        `json:"url"`
+	Header     http.Header   `json:"header,omitempty"`
+	Body       []byte        `json:"body,omitempty"`
+	Deliveries int           `json:"deliveries"`
+	Delay      time.Duration `json:"delay"`
+	Next       time.Time     `json:"next"`
+
+	Attempts []DeliveryAttempt `json:"attempts,omitempty"`
+}
+
+// QueueStore persists queued requests, e.g. in files, a Bolt bucket or a SQL
+// table. Save inserts or replaces the request with the same ID. A store must
+// be safe for concurrent use.
+//
+// The queue saves a request when it is enqueued and after every delivery, and
+// deletes it once done. Errors after a delivery are ignored: at worst a
+// request is delivered again after a restart.
+type QueueStore interface {
+	Save(r QueuedRequest) error
+	Delete(id string) error
+	Load() ([]QueuedRequest, error)
+}
+
+// FileStore is a QueueStore keeping every request in a JSON file of its own
+// in a directory. Files are replaced atomically, so a crash never leaves a
+// request half written.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a store in dir, creating the directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Save(r QueuedRequest) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(r.ID))
+}
+
+func (s *FileStore) Delete(id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Load returns the stored requests in no particular order.
+func (s *FileStore) Load() ([]QueuedRequest, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]QueuedRequest, 0, len(names))
+	for _, name := range names {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		var r QueuedRequest
+		if err := json.Unmarshal(b, &r); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+
+	return records, nil
+}
+
+// path returns the file holding the request id. IDs are made safe to use as
+// file names.
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, strings.NewReplacer("/", "_", "\\", "_", ".", "_").Replace(id)+".json")
+}
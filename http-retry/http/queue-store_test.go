@@ -0,0 +1,154 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	next := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := QueuedRequest{ID: "a", Method: http.MethodPost, URL: "http://example.com/a", Header: http.Header{"X-A": {"1"}}, Body: []byte("body"), Next: next}
+	b := QueuedRequest{ID: "b", Method: http.MethodGet, URL: "http://example.com/b", Deliveries: 2, Delay: time.Minute, Next: next}
+	b2 := b
+	b2.Deliveries = 3
+	tests := []struct {
+		name string
+		// ops runs against the store before it is loaded.
+		ops  func(s *FileStore) error
+		want []QueuedRequest
+	}{
+		{name: "empty", ops: func(s *FileStore) error { return nil }, want: []QueuedRequest{}},
+		{
+			name: "saved",
+			ops: func(s *FileStore) error {
+				if err := s.Save(a); err != nil {
+					return err
+				}
+				return s.Save(b)
+			},
+			want: []QueuedRequest{a, b},
+		},
+		{
+			name: "replaced",
+			ops: func(s *FileStore) error {
+				if err := s.Save(b); err != nil {
+					return err
+				}
+				return s.Save(b2)
+			},
+			want: []QueuedRequest{b2},
+		},
+		{
+			name: "deleted",
+			ops: func(s *FileStore) error {
+				if err := s.Save(a); err != nil {
+					return err
+				}
+				if err := s.Save(b); err != nil {
+					return err
+				}
+				return s.Delete("a")
+			},
+			want: []QueuedRequest{b},
+		},
+		{name: "deleting a missing request", ops: func(s *FileStore) error { return s.Delete("missing") }, want: []QueuedRequest{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewFileStore(filepath.Join(t.TempDir(), "queue"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.ops(s); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i].ID < got[j].ID })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileStorePath(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(QueuedRequest{ID: "../escape/id.x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 || files[0].Name() != "___escape_id_x.json" {
+		t.Errorf("files in the store = %v, want one file in it", files)
+	}
+}
+
+func TestQueueResume(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A first run delivers the request once and stops before it is done
+	down := newScriptServer(t, 503)
+	first := NewRetryableClient(WithMaxRetries(0), WithQueue(QueueConfig{Store: store, Backoff: ConstantBackoff(time.Hour)}))
+	req, _ := NewRequest(context.Background(), http.MethodPut, down.URL, "payload")
+	id, err := first.Enqueue(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for down.count() == 0 || first.Queue().Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	first.Queue().Close(context.Background())
+
+	records, err := store.Load()
+	if err != nil || len(records) != 1 || records[0].ID != id || records[0].Deliveries != 1 {
+		t.Fatalf("stored requests = %+v, %v, want the request delivered once", records, err)
+	}
+
+	// The next run delivers it again, to a server that is up, though it
+	// refuses the request
+	up := newScriptServer(t, 400)
+	records[0].URL = up.URL
+	records[0].Next = time.Time{}
+	store.Save(records[0])
+	done := make(chan Delivery, 1)
+	second := NewRetryableClient(WithMaxRetries(0), WithQueue(QueueConfig{Store: store, DeadLetters: dead, Done: done}))
+	defer second.Queue().Close(context.Background())
+	if n, err := second.Queue().Resume(); err != nil || n != 1 {
+		t.Fatalf("Resume() = %d, %v, want 1", n, err)
+	}
+
+	d := <-done
+	if d.ID != id || d.Deliveries != 2 || len(d.Attempts) != 2 || !d.Failed() {
+		t.Errorf("delivery = %+v, want the second, failed", d)
+	}
+	if _, body := up.request(0); body != "payload" {
+		t.Errorf("resumed delivery sent %q", body)
+	}
+	if records, _ := store.Load(); len(records) != 0 {
+		t.Errorf("%d requests left in the store", len(records))
+	}
+	if records, _ := dead.Load(); len(records) != 1 || records[0].ID != id {
+		t.Errorf("dead letters = %+v, want the request", records)
+	}
+}
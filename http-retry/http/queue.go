@@ -0,0 +1,554 @@
+package http
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned by Enqueue when the queue holds QueueConfig.Size
+	// requests already.
+	ErrQueueFull = errors.New("rhttp: queue is full")
+	// ErrQueueClosed is returned by Enqueue once the queue is closed.
+	ErrQueueClosed = errors.New("rhttp: queue is closed")
+	// ErrNoQueue is returned by RetryableClient.Enqueue on a client created
+	// without WithQueue.
+	ErrNoQueue = errors.New("rhttp: client has no queue, see WithQueue")
+)
+
+// DefaultQueueMaxDeliveries is the default number of times a queued request
+// is sent before it is given up on.
+const DefaultQueueMaxDeliveries = 5
+
+// QueueConfig configures a Queue. Every field is optional.
+type QueueConfig struct {
+	// Workers is the number of requests delivered at once, one by default.
+	Workers int
+	// Size caps the number of requests waiting in the queue. Zero means no
+	// limit.
+	Size int
+	// MaxDeliveries is how many times a request is sent, each time with the
+	// client's own retries, before it is given up on. It defaults to
+	// DefaultQueueMaxDeliveries.
+	MaxDeliveries int
+	// Backoff is the wait between two deliveries of a request, an exponential
+	// backoff starting at 30 seconds and capped at an hour by default.
+	Backoff Backoff
+	// OnDone is called with the final outcome of every request.
+	OnDone func(Delivery)
+	// Done, if set, receives the final outcome of every request. The queue
+	// blocks until it is received.
+	Done chan<- Delivery
+	// Store, if set, persists queued requests until they are done, so that
+	// Resume picks them up after a restart.
+	Store QueueStore
+	// DeadLetters, if set, keeps the requests given up on without a
+	// successful response, see Delivery.Failed.
+	DeadLetters QueueStore
+}
+
+// Delivery is the final outcome of a queued request, sent Deliveries times.
+// Response and Err are those of the last delivery as returned by
+// RetryableClient.Do, with the response body already read into memory.
+type Delivery struct {
+	ID         string
+	Request    *http.Request
+	Response   *http.Response
+	Err        error
+	Deliveries int
+	// Attempts records every delivery, including those before a restart.
+	Attempts []DeliveryAttempt
+}
+
+// Failed reports whether the request was given up on without a successful
+// response.
+func (d Delivery) Failed() bool {
+	return d.Err != nil || d.Response.StatusCode >= 300
+}
+
+// DeliveryAttempt records one delivery of a queued request, retries
+// included. Error is the text of its error, if any.
+type DeliveryAttempt struct {
+	Start      time.Time     `json:"start"`
+	Duration   time.Duration `json:"duration"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+func newDeliveryAttempt(start, end time.Time, resp *http.Response, err error) DeliveryAttempt {
+	a := DeliveryAttempt{Start: start, Duration: end.Sub(start)}
+	if resp != nil {
+		a.StatusCode = resp.StatusCode
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+
+	return a
+}
+
+// Queue delivers requests in the background. A delivery runs the client's
+// usual retries; when they are exhausted the request goes back to the queue
+// and is delivered again after a longer backoff, up to MaxDeliveries times.
+type Queue struct {
+	client *RetryableClient
+	cfg    QueueConfig
+	clock  Clock
+
+	mu      sync.Mutex
+	pending queueHeap
+	closed  bool
+	wake    chan struct{}
+	closing chan struct{}
+	ready   chan *queuedRequest
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// queuedRequest is a request waiting in a Queue with a buffered body.
+type queuedRequest struct {
+	id         string
+	req        *http.Request
+	body       []byte
+	opts       []Option
+	deliveries int
+	attempts   []DeliveryAttempt
+	delay      time.Duration
+	next       time.Time
+}
+
+// WithQueue gives the client a Queue configured by cfg, used by
+// RetryableClient.Enqueue.
+func WithQueue(cfg QueueConfig) Option {
+	return func(c *config) {
+		c.queue = &cfg
+	}
+}
+
+// WithDeliverySchedule sets the waits between the deliveries of a queued
+// request, e.g. 1m, 5m, 30m and 2h, in place of QueueConfig.Backoff: the
+// request is delivered at most len(waits)+1 times. Combined with
+// WithHostOptions it sets a schedule per destination.
+func WithDeliverySchedule(waits ...time.Duration) Option {
+	return func(c *config) {
+		c.deliverySchedule = waits
+	}
+}
+
+// scheduleBackoff waits schedule[n] before retry n, repeating the last wait.
+func scheduleBackoff(schedule []time.Duration) Backoff {
+	return BackoffFunc(func(retries int, _ time.Duration) time.Duration {
+		if retries >= len(schedule) {
+			retries = len(schedule) - 1
+		}
+
+		return schedule[retries]
+	})
+}
+
+// NewQueue returns a queue delivering requests with c and starts its workers.
+// Close stops them.
+func NewQueue(c *RetryableClient, cfg QueueConfig) *Queue {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxDeliveries < 1 {
+		cfg.MaxDeliveries = DefaultQueueMaxDeliveries
+	}
+	if cfg.Backoff == nil {
+		cfg.Backoff = ExponentialBackoff{Base: 30 * time.Second, Max: time.Hour}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		client:  c,
+		cfg:     cfg,
+		clock:   c.config.clock,
+		wake:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		ready:   make(chan *queuedRequest),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	q.wg.Add(1 + cfg.Workers)
+	go q.schedule()
+	for i := 0; i < cfg.Workers; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+// Enqueue queues req for delivery with the client's Queue and returns the ID
+// its Delivery will carry.
+func (c *RetryableClient) Enqueue(req *http.Request) (string, error) {
+	if c.queue == nil {
+		return "", ErrNoQueue
+	}
+
+	return c.queue.Enqueue(req)
+}
+
+// Queue returns the queue set up by WithQueue, or nil.
+func (c *RetryableClient) Queue() *Queue {
+	return c.queue
+}
+
+// Enqueue queues req for delivery and returns the ID its Delivery will carry.
+// The body is read into memory right away. With WithIdempotencyKey, every
+// delivery of a POST or PATCH uses the ID as its idempotency key. The
+// request's context only provides its request options: cancelling it does not
+// cancel the delivery.
+func (q *Queue) Enqueue(req *http.Request) (string, error) {
+	body, err := queuedBody(req, q.client.config.maxBufferedBody)
+	if err != nil {
+		return "", err
+	}
+	// The idempotency key, if the request needs one, doubles as its ID
+	key, err := q.client.config.idempotencyKey(req)
+	if err != nil {
+		return "", err
+	}
+	id := key
+	if id == "" {
+		if id, err = newIdempotencyKey(); err != nil {
+			return "", err
+		}
+	}
+
+	item := &queuedRequest{
+		id:   id,
+		req:  req.Clone(context.Background()),
+		body: body,
+		opts: requestOptions(req.Context()),
+		next: q.clock.Now(),
+	}
+	item.req.Body, item.req.GetBody = nil, nil
+	if key != "" {
+		item.req.Header.Set(q.client.config.idempotencyHeader, key)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return "", ErrQueueClosed
+	}
+	if q.cfg.Size > 0 && q.pending.Len() >= q.cfg.Size {
+		return "", ErrQueueFull
+	}
+	if q.cfg.Store != nil {
+		if err := q.cfg.Store.Save(item.record()); err != nil {
+			return "", err
+		}
+	}
+	heap.Push(&q.pending, item)
+	q.notify()
+
+	return id, nil
+}
+
+// Len returns the number of requests waiting for their next delivery.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pending.Len()
+}
+
+// Resume queues the requests left in QueueConfig.Store by a previous run,
+// keeping their delivery count and backoff schedule, and returns how many
+// there were. Call it once, before enqueuing new requests.
+func (q *Queue) Resume() (int, error) {
+	if q.cfg.Store == nil {
+		return 0, nil
+	}
+	records, err := q.cfg.Store.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	items := make([]*queuedRequest, 0, len(records))
+	for _, r := range records {
+		item, err := restoredRequest(r)
+		if err != nil {
+			return 0, err
+		}
+		items = append(items, item)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, ErrQueueClosed
+	}
+	for _, item := range items {
+		heap.Push(&q.pending, item)
+	}
+	q.notify()
+
+	return len(items), nil
+}
+
+// Close stops accepting requests and waits for the deliveries in progress.
+// Requests still waiting are dropped, though they stay in QueueConfig.Store.
+// If ctx is done first, the deliveries in progress are cancelled and its
+// error is returned.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.closing)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// notify wakes the scheduler up. q.mu must be held.
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule hands every request to a worker once its delivery is due.
+func (q *Queue) schedule() {
+	defer q.wg.Done()
+	defer close(q.ready)
+
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		var wait <-chan time.Time
+		stop := func() {}
+		if q.pending.Len() > 0 {
+			item := q.pending[0]
+			if d := item.next.Sub(q.clock.Now()); d > 0 {
+				wait, stop = newTimer(q.clock, d)
+			} else {
+				heap.Pop(&q.pending)
+				q.mu.Unlock()
+				select {
+				case q.ready <- item:
+				case <-q.closing:
+					return
+				}
+				continue
+			}
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-q.wake:
+		case <-q.closing:
+		}
+		stop()
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for item := range q.ready {
+		q.deliver(item)
+	}
+}
+
+// deliver sends item once, then either reports its outcome or puts it back
+// in the queue for another delivery.
+func (q *Queue) deliver(item *queuedRequest) {
+	req := item.request(q.ctx)
+	start := q.clock.Now()
+	resp, err := q.client.Do(q.ctx, req, item.opts...)
+	item.deliveries++
+	item.attempts = append(item.attempts, newDeliveryAttempt(start, q.clock.Now(), resp, err))
+
+	maxDeliveries, backoff := q.cfg.MaxDeliveries, q.cfg.Backoff
+	if schedule := q.client.current().forRequest(req).with(item.opts...).deliverySchedule; len(schedule) > 0 {
+		maxDeliveries, backoff = len(schedule)+1, scheduleBackoff(schedule)
+	}
+	if q.ctx.Err() != nil || (item.deliveries < maxDeliveries && q.redeliver(resp, err)) {
+		if resp != nil {
+			drainBody(resp)
+		}
+		if q.ctx.Err() != nil {
+			// Cancelled by Close: the request is dropped with the others, and
+			// delivered again after a restart if it was stored
+			return
+		}
+		item.delay = backoffDelay(backoff, item.deliveries-1, item.delay)
+		item.next = q.clock.Now().Add(item.delay)
+		if q.cfg.Store != nil {
+			// On failure the stored copy is just one delivery behind
+			q.cfg.Store.Save(item.record())
+		}
+		q.requeue(item)
+		return
+	}
+
+	if resp != nil {
+		buf, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(buf))
+		if readErr != nil {
+			resp, err = nil, readErr
+		}
+	}
+	d := Delivery{ID: item.id, Request: req, Response: resp, Err: err, Deliveries: item.deliveries, Attempts: item.attempts}
+	if q.cfg.DeadLetters != nil && d.Failed() {
+		q.cfg.DeadLetters.Save(item.record())
+	}
+	if q.cfg.Store != nil {
+		q.cfg.Store.Delete(item.id)
+	}
+	q.done(d)
+}
+
+// redeliver reports whether a delivery ending with resp and err is worth
+// another one later: the client gave up retrying, or would have retried
+// without its retries disabled.
+func (q *Queue) redeliver(resp *http.Response, err error) bool {
+	var retryErr *RetryError
+	if errors.As(err, &retryErr) || errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+
+	return !isPermanent(err) && q.client.current().policy.ShouldRetry(resp, err, 1)
+}
+
+// requeue puts item back in the queue, unless it was closed meanwhile.
+func (q *Queue) requeue(item *queuedRequest) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	heap.Push(&q.pending, item)
+	q.notify()
+}
+
+func (q *Queue) done(d Delivery) {
+	if q.cfg.OnDone != nil {
+		q.cfg.OnDone(d)
+	}
+	if q.cfg.Done != nil {
+		select {
+		case q.cfg.Done <- d:
+		case <-q.ctx.Done():
+		}
+	}
+}
+
+// request returns a copy of the queued request for one delivery.
+func (r *queuedRequest) request(ctx context.Context) *http.Request {
+	req := r.req.Clone(ctx)
+	if r.body != nil {
+		body := r.body
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.Body, _ = req.GetBody()
+		req.ContentLength = int64(len(body))
+	}
+
+	return req
+}
+
+// record returns the persisted form of r.
+func (r *queuedRequest) record() QueuedRequest {
+	return QueuedRequest{
+		ID:         r.id,
+		Method:     r.req.Method,
+		URL:        r.req.URL.String(),
+		Header:     r.req.Header,
+		Body:       r.body,
+		Deliveries: r.deliveries,
+		Attempts:   r.attempts,
+		Delay:      r.delay,
+		Next:       r.next,
+	}
+}
+
+// restoredRequest rebuilds a queued request from its persisted form. Its
+// request options are lost, it is delivered with the client's own.
+func restoredRequest(r QueuedRequest) (*queuedRequest, error) {
+	req, err := http.NewRequest(r.Method, r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.Header != nil {
+		req.Header = r.Header
+	}
+
+	return &queuedRequest{
+		id:         r.ID,
+		req:        req,
+		body:       r.Body,
+		deliveries: r.Deliveries,
+		attempts:   r.Attempts,
+		delay:      r.Delay,
+		next:       r.Next,
+	}, nil
+}
+
+// queuedBody reads the body of req, which must not exceed limit bytes.
+func queuedBody(req *http.Request, limit int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer req.Body.Close()
+
+	buf, err := ioutil.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > limit {
+		return nil, errors.New("rhttp: request body too large to queue")
+	}
+
+	return buf, nil
+}
+
+// queueHeap orders queued requests by their next delivery.
+type queueHeap []*queuedRequest
+
+func (h queueHeap) Len() int            { return len(h) }
+func (h queueHeap) Less(i, j int) bool  { return h[i].next.Before(h[j].next) }
+func (h queueHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *queueHeap) Push(x interface{}) { *h = append(*h, x.(*queuedRequest)) }
+
+func (h *queueHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return item
+}
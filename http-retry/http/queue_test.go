@@ -0,0 +1,215 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newQueueClient returns a client whose queue reports to done, on a clock
+// whose waits return at once.
+func newQueueClient(cfg QueueConfig, opts ...Option) (*RetryableClient, *stepClock, chan Delivery) {
+	done := make(chan Delivery, 1)
+	cfg.Done = done
+	clock := newStepClock()
+	c := NewRetryableClient(append([]Option{WithClock(clock), WithMaxRetries(0), WithQueue(cfg)}, opts...)...)
+
+	return c, clock, done
+}
+
+func TestQueueDeliveries(t *testing.T) {
+	tests := []struct {
+		name           string
+		statuses       []int
+		maxDeliveries  int
+		opts           []Option
+		wantDeliveries int
+		wantStatus     int
+		wantFailed     bool
+		// wantWaits are the waits between deliveries, if checked.
+		wantWaits []time.Duration
+	}{
+		{name: "delivered", statuses: []int{200}, wantDeliveries: 1, wantStatus: 200},
+		{name: "delivered again", statuses: []int{503, 503, 200}, wantDeliveries: 3, wantStatus: 200},
+		{name: "given up", statuses: []int{503}, maxDeliveries: 2, wantDeliveries: 2, wantStatus: 503, wantFailed: true},
+		{name: "not worth delivering again", statuses: []int{404}, wantDeliveries: 1, wantStatus: 404, wantFailed: true},
+		{
+			name:           "delivery schedule",
+			statuses:       []int{503},
+			opts:           []Option{WithDeliverySchedule(time.Minute, 5*time.Minute)},
+			wantDeliveries: 3,
+			wantStatus:     503,
+			wantFailed:     true,
+			wantWaits:      []time.Duration{time.Minute, 5 * time.Minute},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			c, clock, done := newQueueClient(QueueConfig{MaxDeliveries: tt.maxDeliveries}, tt.opts...)
+			defer c.Queue().Close(context.Background())
+			req, _ := NewRequest(context.Background(), http.MethodPut, srv.URL, "payload")
+
+			id, err := c.Enqueue(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := <-done
+			if d.ID != id || d.Err != nil || d.Response.StatusCode != tt.wantStatus || d.Failed() != tt.wantFailed {
+				t.Errorf("delivery = %s %v %v, failed %v, want %s %d, failed %v", d.ID, d.Response, d.Err, d.Failed(), id, tt.wantStatus, tt.wantFailed)
+			}
+			if d.Deliveries != tt.wantDeliveries || len(d.Attempts) != tt.wantDeliveries || srv.count() != tt.wantDeliveries {
+				t.Errorf("%d deliveries, %d recorded, %d requests, want %d", d.Deliveries, len(d.Attempts), srv.count(), tt.wantDeliveries)
+			}
+			for i := 0; i < srv.count(); i++ {
+				if _, body := srv.request(i); body != "payload" {
+					t.Errorf("delivery %d sent %q", i+1, body)
+				}
+			}
+			if tt.wantWaits != nil && !reflect.DeepEqual(clock.Waits(), tt.wantWaits) {
+				t.Errorf("waits = %v, want %v", clock.Waits(), tt.wantWaits)
+			}
+		})
+	}
+}
+
+func TestQueueDeliveryBodyRead(t *testing.T) {
+	srv := newScriptServer(t, 200)
+	c, _, done := newQueueClient(QueueConfig{})
+	defer c.Queue().Close(context.Background())
+
+	if _, err := c.Enqueue(mustNewRequest(t, srv.URL)); err != nil {
+		t.Fatal(err)
+	}
+	d := <-done
+	// The client is done with the response, the body is kept in memory
+	if b, err := ioutil.ReadAll(d.Response.Body); err != nil || len(b) != 0 {
+		t.Errorf("body = %q, %v", b, err)
+	}
+}
+
+func TestQueueIdempotencyKey(t *testing.T) {
+	srv := newScriptServer(t, 503, 200)
+	c, _, done := newQueueClient(QueueConfig{}, WithIdempotencyKey())
+	defer c.Queue().Close(context.Background())
+	req, _ := NewRequest(context.Background(), http.MethodPost, srv.URL, "payload")
+
+	id, err := c.Enqueue(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	for i := 0; i < 2; i++ {
+		if r, _ := srv.request(i); r.Header.Get(DefaultIdempotencyKeyHeader) != id {
+			t.Errorf("delivery %d key = %q, want the ID %q", i+1, r.Header.Get(DefaultIdempotencyKeyHeader), id)
+		}
+	}
+}
+
+func TestEnqueueErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		enqueue func(t *testing.T) error
+		want    func(error) bool
+	}{
+		{
+			name: "no queue",
+			enqueue: func(t *testing.T) error {
+				_, err := NewRetryableClient().Enqueue(mustNewRequest(t, "http://example.com"))
+				return err
+			},
+			want: func(err error) bool { return err == ErrNoQueue },
+		},
+		{
+			name: "closed",
+			enqueue: func(t *testing.T) error {
+				c, _, _ := newQueueClient(QueueConfig{})
+				c.Queue().Close(context.Background())
+				_, err := c.Enqueue(mustNewRequest(t, "http://example.com"))
+				return err
+			},
+			want: func(err error) bool { return err == ErrQueueClosed },
+		},
+		{
+			name: "body too large",
+			enqueue: func(t *testing.T) error {
+				c, _, _ := newQueueClient(QueueConfig{}, WithMaxBufferedBody(4))
+				defer c.Queue().Close(context.Background())
+				req, _ := http.NewRequest(http.MethodPost, "http://example.com", strings.NewReader("too large"))
+				_, err := c.Enqueue(req)
+				return err
+			},
+			want: func(err error) bool { return err != nil && strings.Contains(err.Error(), "too large") },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.enqueue(t); !tt.want(err) {
+				t.Errorf("Enqueue() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+	q := NewRetryableClient(WithMaxRetries(0), WithQueue(QueueConfig{Size: 1})).Queue()
+
+	// The first request is delivered, the second waits for the busy worker
+	// out of the queue, the third waits in the queue and fills it
+	enqueue := func() error {
+		_, err := q.Enqueue(mustNewRequest(t, srv.URL))
+		return err
+	}
+	if err := enqueue(); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+	if err := enqueue(); err != nil {
+		t.Fatal(err)
+	}
+	for q.Len() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := enqueue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueue(); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Enqueue() error = %v, want ErrQueueFull", err)
+	}
+
+	close(release)
+	q.Close(context.Background())
+}
+
+func TestQueueCloseCancelsDeliveries(t *testing.T) {
+	received := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	c, _, _ := newQueueClient(QueueConfig{})
+	if _, err := c.Enqueue(mustNewRequest(t, srv.URL)); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Queue().Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close() error = %v, want context.DeadlineExceeded", err)
+	}
+}
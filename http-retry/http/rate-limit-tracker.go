@@ -0,0 +1,103 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitTracker learns from the responses of each host when it is
+// throttling the client, and holds back new attempts to that host until the
+// limit should have been lifted, rather than paying a rejected attempt first.
+// It reads Retry-After on 429 and 503 responses, and X-RateLimit-Reset (or
+// RateLimit-Reset) once X-RateLimit-Remaining (or RateLimit-Remaining) drops
+// to zero. A tracker may be shared between clients.
+type RateLimitTracker struct {
+	mu    sync.Mutex
+	hosts map[string]time.Time
+}
+
+// NewRateLimitTracker returns a tracker that knows of no limits yet.
+func NewRateLimitTracker() *RateLimitTracker {
+	return &RateLimitTracker{hosts: make(map[string]time.Time)}
+}
+
+// Until returns when host is expected to accept requests again, or the zero
+// time if it is not known to be throttling.
+func (t *RateLimitTracker) Until(host string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	until := t.hosts[host]
+	if !until.After(time.Now()) {
+		delete(t.hosts, host)
+		return time.Time{}
+	}
+
+	return until
+}
+
+// Wait blocks until host is expected to accept requests again or ctx is done.
+func (t *RateLimitTracker) Wait(ctx context.Context, host string) error {
+	until := t.Until(host)
+	if until.IsZero() {
+		return nil
+	}
+
+	return sleep(ctx, systemClock{}, time.Until(until))
+}
+
+// Observe records the limits advertised by resp, a response from host. Waits
+// longer than max are capped to max, and a max of zero ignores the headers.
+func (t *RateLimitTracker) Observe(host string, resp *http.Response, max time.Duration) {
+	if resp == nil || max <= 0 {
+		return
+	}
+
+	now := time.Now()
+	wait, ok := retryAfter(resp, now)
+	if !ok {
+		wait, ok = rateLimitReset(resp.Header, now)
+	}
+	if !ok || wait <= 0 {
+		return
+	}
+	if wait > max {
+		wait = max
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if until := now.Add(wait); until.After(t.hosts[host]) {
+		t.hosts[host] = until
+	}
+}
+
+// rateLimitReset returns the wait until the quota advertised by header resets,
+// if it is exhausted. The reset is either a number of seconds or, for large
+// values, a Unix timestamp as sent by GitHub and others.
+func rateLimitReset(header http.Header, now time.Time) (time.Duration, bool) {
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		if strings.TrimSpace(header.Get(prefix+"Remaining")) != "0" {
+			continue
+		}
+
+		reset, err := strconv.ParseInt(strings.TrimSpace(header.Get(prefix+"Reset")), 10, 64)
+		if err != nil || reset < 0 {
+			continue
+		}
+		if reset >= 1e9 {
+			return time.Unix(reset, 0).Sub(now), true
+		}
+		if reset > int64(maxDuration/time.Second) {
+			return maxDuration, true
+		}
+		return time.Duration(reset) * time.Second, true
+	}
+
+	return 0, false
+}
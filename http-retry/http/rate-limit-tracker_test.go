@@ -0,0 +1,145 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimitTrackerObserve(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		status int
+		header map[string]string
+		max    time.Duration
+		// want is the expected wait, zero when no limit is learned.
+		want time.Duration
+	}{
+		{name: "Retry-After on 429", status: 429, header: map[string]string{"Retry-After": "30"}, max: time.Minute, want: 30 * time.Second},
+		{name: "Retry-After on 503", status: 503, header: map[string]string{"Retry-After": "5"}, max: time.Minute, want: 5 * time.Second},
+		{name: "Retry-After on 200 ignored", status: 200, header: map[string]string{"Retry-After": "5"}, max: time.Minute},
+		{name: "capped", status: 429, header: map[string]string{"Retry-After": "3600"}, max: time.Minute, want: time.Minute},
+		{name: "disabled", status: 429, header: map[string]string{"Retry-After": "30"}},
+		{
+			name:   "exhausted quota in seconds",
+			status: 200,
+			header: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "20"},
+			max:    time.Minute,
+			want:   20 * time.Second,
+		},
+		{
+			name:   "exhausted quota as a timestamp",
+			status: 200,
+			header: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(now.Add(40*time.Second).Unix(), 10)},
+			max:    time.Minute,
+			want:   40 * time.Second,
+		},
+		{
+			name:   "standard headers",
+			status: 200,
+			header: map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": "10"},
+			max:    time.Minute,
+			want:   10 * time.Second,
+		},
+		{
+			name:   "quota left",
+			status: 200,
+			header: map[string]string{"X-RateLimit-Remaining": "3", "X-RateLimit-Reset": "20"},
+			max:    time.Minute,
+		},
+		{
+			name:   "invalid reset",
+			status: 200,
+			header: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "soon"},
+			max:    time.Minute,
+		},
+		{name: "no headers", status: 429, max: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			for k, v := range tt.header {
+				resp.Header.Set(k, v)
+			}
+			tr := NewRateLimitTracker()
+			tr.Observe("api.example.com", resp, tt.max)
+
+			until := tr.Until("api.example.com")
+			if tt.want == 0 {
+				if !until.IsZero() {
+					t.Errorf("Until() = %v, want no limit", until)
+				}
+				return
+			}
+			// Timestamps have a precision of one second
+			if got := until.Sub(now); got > tt.want+time.Second || got < tt.want-time.Second {
+				t.Errorf("limited for %v, want %v", got, tt.want)
+			}
+			if !tr.Until("other.example.com").IsZero() {
+				t.Error("limit applied to another host")
+			}
+		})
+	}
+}
+
+func TestRateLimitTrackerKeepsLongestLimit(t *testing.T) {
+	tr := NewRateLimitTracker()
+	long := &http.Response{StatusCode: 429, Header: http.Header{"Retry-After": {"30"}}}
+	short := &http.Response{StatusCode: 429, Header: http.Header{"Retry-After": {"1"}}}
+
+	tr.Observe("h", long, time.Minute)
+	until := tr.Until("h")
+	tr.Observe("h", short, time.Minute)
+	if got := tr.Until("h"); !got.Equal(until) {
+		t.Errorf("Until() = %v after a shorter limit, want %v", got, until)
+	}
+}
+
+func TestRateLimitTrackerWait(t *testing.T) {
+	tr := NewRateLimitTracker()
+	if err := tr.Wait(context.Background(), "h"); err != nil {
+		t.Fatalf("Wait() without a limit error = %v", err)
+	}
+
+	tr.Observe("h", &http.Response{StatusCode: 429, Header: http.Header{"Retry-After": {"30"}}}, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tr.Wait(ctx, "h"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWithRateLimitTracking(t *testing.T) {
+	var count int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&count, 1) == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "30")
+		}
+	}))
+	defer srv.Close()
+	tr := NewRateLimitTracker()
+	c := NewRetryableClient(WithRateLimitTracking(tr))
+
+	if _, _, err := c.GetBytes(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Until(mustParseURL(t, srv.URL).Host).IsZero() {
+		t.Fatal("exhausted quota not learned")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := c.GetBytes(ctx, srv.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetBytes() error = %v, want context.DeadlineExceeded", err)
+	}
+	if count != 1 {
+		t.Errorf("server received %d requests, want the second held back", count)
+	}
+}
@@ -0,0 +1,108 @@
+package http
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter delays requests to respect a request rate. *rate.Limiter from
+// golang.org/x/time/rate satisfies it.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// TokenBucket is a Limiter allowing rate requests per second on average, with
+// bursts of up to burst requests.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	delay := b.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	if err := sleep(ctx, systemClock{}, delay); err != nil {
+		// Give the token back, we are not going to use it
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// reserve takes a token, possibly borrowing from the future, and returns how
+// long to wait before it may be used.
+func (b *TokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 || b.rate <= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// HostLimiter keeps a separate Limiter for every host.
+type HostLimiter struct {
+	newLimiter func(host string) Limiter
+
+	mu       sync.Mutex
+	limiters map[string]Limiter
+}
+
+// NewHostLimiter returns a HostLimiter creating the limiter of each host on
+// first use with newLimiter.
+func NewHostLimiter(newLimiter func(host string) Limiter) *HostLimiter {
+	return &HostLimiter{
+		newLimiter: newLimiter,
+		limiters:   make(map[string]Limiter),
+	}
+}
+
+// Limiter returns the limiter for host.
+func (h *HostLimiter) Limiter(host string) Limiter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	l, ok := h.limiters[host]
+	if !ok {
+		l = h.newLimiter(host)
+		h.limiters[host] = l
+	}
+
+	return l
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		// idle is how long the bucket was left alone before the reserves.
+		idle time.Duration
+		want []time.Duration
+	}{
+		{name: "burst", rate: 10, burst: 3, want: []time.Duration{0, 0, 0}},
+		{name: "past the burst", rate: 10, burst: 2, want: []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond}},
+		{name: "burst of at least one", rate: 10, burst: 0, want: []time.Duration{0, 100 * time.Millisecond}},
+		{name: "capped at the burst while idle", rate: 10, burst: 2, idle: 150 * time.Millisecond, want: []time.Duration{0, 0, 100 * time.Millisecond}},
+		{name: "no rate", rate: 0, burst: 1, want: []time.Duration{0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewTokenBucket(tt.rate, tt.burst)
+			b.last = b.last.Add(-tt.idle)
+			for i, want := range tt.want {
+				got := b.reserve()
+				// Allow for the time passing between reserves
+				if got > want || got < want-10*time.Millisecond {
+					t.Errorf("reserve %d = %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenBucketWaitGivesTokenBack(t *testing.T) {
+	b := NewTokenBucket(1, 1)
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait() error = %v, want context.Canceled", err)
+	}
+	// The cancelled wait did not push the next one further back
+	if d := b.reserve(); d > time.Second || d < 900*time.Millisecond {
+		t.Errorf("next reserve = %v, want about a second", d)
+	}
+}
+
+// countingLimiter counts its waits.
+type countingLimiter struct {
+	waits int64
+	err   error
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	atomic.AddInt64(&l.waits, 1)
+	return l.err
+}
+
+func TestWithRateLimiter(t *testing.T) {
+	errLimited := errors.New("limited")
+	tests := []struct {
+		name      string
+		statuses  []int
+		err       error
+		wantWaits int64
+		wantCount int
+	}{
+		{name: "every attempt waits", statuses: []int{503, 503, 200}, wantWaits: 3, wantCount: 3},
+		{name: "limiter error ends the request", statuses: []int{200}, err: errLimited, wantWaits: 1, wantCount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			l := &countingLimiter{err: tt.err}
+			c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0), WithRateLimiter(l))
+
+			_, _, err := c.GetBytes(context.Background(), srv.URL)
+			if (tt.err == nil) != (err == nil) || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Errorf("GetBytes() error = %v, want %v", err, tt.err)
+			}
+			if l.waits != tt.wantWaits || srv.count() != tt.wantCount {
+				t.Errorf("%d waits for %d requests, want %d for %d", l.waits, srv.count(), tt.wantWaits, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	created := map[string]int{}
+	h := NewHostLimiter(func(host string) Limiter {
+		created[host]++
+		return NewTokenBucket(1, 1)
+	})
+
+	a := h.Limiter("a")
+	if h.Limiter("a") != a || h.Limiter("b") == a {
+		t.Error("hosts do not get a limiter each")
+	}
+	if created["a"] != 1 || created["b"] != 1 {
+		t.Errorf("limiters created = %v, want one per host", created)
+	}
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RedirectPolicy controls how the retryable client follows redirects.
+type RedirectPolicy struct {
+	// MaxRedirects bounds the redirects followed by a request. Zero means 10,
+	// as for http.Client, and a negative value returns redirect responses to
+	// the caller without following them.
+	MaxRedirects int
+	// RetryTargets retries the requests to redirect targets like the original
+	// request. When false they are sent once.
+	RetryTargets bool
+	// StripAuthCrossHost removes the Authorization, Proxy-Authorization and
+	// Cookie headers when a redirect leaves the original host, even for a
+	// subdomain, which http.Client would let through.
+	StripAuthCrossHost bool
+}
+
+// DefaultRedirectPolicy follows up to 10 redirects, retries their targets and
+// strips credentials when the host changes.
+var DefaultRedirectPolicy = RedirectPolicy{
+	MaxRedirects:       10,
+	RetryTargets:       true,
+	StripAuthCrossHost: true,
+}
+
+// sensitiveHeaders are the headers StripAuthCrossHost removes.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// WithRedirectPolicy makes the retryable client follow redirects according to
+// p, in place of the CheckRedirect of the client given with WithHTTPClient.
+// 307 and 308 redirects keep the method and body of the original request,
+// which the client makes replayable for that purpose. It has no effect on
+// NewRetryTransport or per request.
+func WithRedirectPolicy(p RedirectPolicy) Option {
+	return func(c *config) {
+		c.redirectPolicy = &p
+	}
+}
+
+func (p *RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	max := p.MaxRedirects
+	if max == 0 {
+		max = 10
+	}
+	if max < 0 {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > max {
+		return fmt.Errorf("rhttp: stopped after %d redirects", max)
+	}
+
+	if p.StripAuthCrossHost && !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+		for _, name := range sensitiveHeaders {
+			req.Header.Del(name)
+		}
+	}
+	if !p.RetryTargets {
+		*req = *req.WithContext(WithRequestOptions(req.Context(), WithMaxRetries(0)))
+	}
+
+	return nil
+}
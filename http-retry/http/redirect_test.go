@@ -0,0 +1,172 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newRedirectServer redirects /hop/n to /hop/n-1 down to /hop/0, which
+// redirects to /target on target, or answers 200 when there is none.
+func newRedirectServer(t *testing.T, status int, target string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		switch {
+		case n > 0:
+			http.Redirect(w, r, "/hop/"+strconv.Itoa(n-1), status)
+		case target != "":
+			http.Redirect(w, r, target+"/target", status)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestRedirectPolicyMaxRedirects(t *testing.T) {
+	tests := []struct {
+		name       string
+		max        int
+		hops       int
+		wantStatus int
+		wantErr    bool
+	}{
+		{name: "followed", max: 3, hops: 3, wantStatus: 200},
+		{name: "too many", max: 2, hops: 3, wantErr: true},
+		{name: "default of 10", hops: 10, wantStatus: 200},
+		{name: "past the default", hops: 11, wantErr: true},
+		{name: "not followed", max: -1, hops: 1, wantStatus: http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newRedirectServer(t, http.StatusFound, "")
+			c := NewRetryableClient(fastBackoff, WithRedirectPolicy(RedirectPolicy{MaxRedirects: tt.max}))
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL+"/hop/"+strconv.Itoa(tt.hops)))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "stopped after") {
+					t.Errorf("Do() error = %v, want too many redirects", err)
+				}
+				return
+			}
+			if err != nil || resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Do() = %v, %v, want %d", resp, err, tt.wantStatus)
+			}
+			drainBody(resp)
+		})
+	}
+}
+
+func TestRedirectPolicyCrossHost(t *testing.T) {
+	tests := []struct {
+		name       string
+		strip      bool
+		sameHost   bool
+		wantAuth   string
+		wantCookie string
+	}{
+		{name: "stripped", strip: true},
+		{name: "kept on the same host", strip: true, sameHost: true, wantAuth: "Bearer token", wantCookie: "session=1"},
+		{name: "kept when not stripping", wantAuth: "Bearer token", wantCookie: "session=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var auth, cookie string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/target" {
+					http.Redirect(w, r, r.URL.Query().Get("to")+"/target", http.StatusFound)
+					return
+				}
+				mu.Lock()
+				auth, cookie = r.Header.Get("Authorization"), r.Header.Get("Cookie")
+				mu.Unlock()
+			}))
+			defer srv.Close()
+			// Both servers are on 127.0.0.1, but on different ports
+			other := httptest.NewServer(srv.Config.Handler)
+			defer other.Close()
+			to := other.URL
+			if tt.sameHost {
+				to = ""
+			}
+			c := NewRetryableClient(WithRedirectPolicy(RedirectPolicy{StripAuthCrossHost: tt.strip}))
+			req := mustNewRequest(t, srv.URL+"/?to="+to)
+			req.Header.Set("Authorization", "Bearer token")
+			req.Header.Set("Cookie", "session=1")
+
+			resp, err := c.Do(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			drainBody(resp)
+			if auth != tt.wantAuth || cookie != tt.wantCookie {
+				t.Errorf("target received Authorization %q and Cookie %q, want %q and %q", auth, cookie, tt.wantAuth, tt.wantCookie)
+			}
+		})
+	}
+}
+
+func TestRedirectPolicyRetryTargets(t *testing.T) {
+	tests := []struct {
+		name      string
+		retry     bool
+		wantCount int
+	}{
+		{name: "retried", retry: true, wantCount: 3},
+		{name: "sent once", wantCount: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := newScriptServer(t, 503, 503, 200)
+			srv := newRedirectServer(t, http.StatusFound, target.URL)
+			c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0), WithRedirectPolicy(RedirectPolicy{RetryTargets: tt.retry}))
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL+"/hop/0"))
+			if err == nil {
+				drainBody(resp)
+			}
+			if target.count() != tt.wantCount {
+				t.Errorf("target received %d requests, want %d", target.count(), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestRedirectKeepsBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantMethod string
+		wantBody   string
+	}{
+		{name: "307", status: http.StatusTemporaryRedirect, wantMethod: http.MethodPost, wantBody: "payload"},
+		{name: "308", status: http.StatusPermanentRedirect, wantMethod: http.MethodPost, wantBody: "payload"},
+		{name: "303", status: http.StatusSeeOther, wantMethod: http.MethodGet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := newScriptServer(t, 200)
+			srv := newRedirectServer(t, tt.status, target.URL)
+			c := NewRetryableClient(WithRedirectPolicy(DefaultRedirectPolicy))
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/hop/0", ioutil.NopCloser(strings.NewReader("payload")))
+
+			resp, err := c.Do(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			drainBody(resp)
+			r, body := target.request(0)
+			if r.Method != tt.wantMethod || body != tt.wantBody {
+				t.Errorf("target received %s %q, want %s %q", r.Method, body, tt.wantMethod, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RequestBuilder builds and sends a request step by step:
+//
+//	resp, err := client.NewRequest(http.MethodPost, "https://example.com/users").
+//		Header("X-Tenant", tenant).
+//		Query("notify", "true").
+//		JSONBody(user).
+//		Retry(5).
+//		Do(ctx)
+//
+// Errors, such as an invalid URL, are reported by Do.
+type RequestBuilder struct {
+	client *RetryableClient
+	method string
+	url    string
+	header http.Header
+	query  url.Values
+	body   interface{}
+	json   bool
+	retry  bool
+	opts   []Option
+}
+
+// NewRequest starts building a request to rawURL.
+func (c *RetryableClient) NewRequest(method, rawURL string) *RequestBuilder {
+	return &RequestBuilder{
+		client: c,
+		method: method,
+		url:    rawURL,
+		header: make(http.Header),
+		query:  make(url.Values),
+	}
+}
+
+// Header adds a header value.
+func (b *RequestBuilder) Header(name, value string) *RequestBuilder {
+	b.header.Add(name, value)
+	return b
+}
+
+// Query adds a query parameter to those already in the URL.
+func (b *RequestBuilder) Query(name, value string) *RequestBuilder {
+	b.query.Add(name, value)
+	return b
+}
+
+// Body sets the body, anything accepted by NewRequest.
+func (b *RequestBuilder) Body(body interface{}) *RequestBuilder {
+	b.body, b.json = body, false
+	return b
+}
+
+// JSONBody sets the body to v encoded as JSON, again for every attempt.
+func (b *RequestBuilder) JSONBody(v interface{}) *RequestBuilder {
+	b.body, b.json = jsonBody(v), true
+	return b
+}
+
+// Retry sets how many times this request is retried, see WithMaxRetries. A
+// POST or PATCH asked to retry gets an idempotency key, as with
+// WithIdempotencyKey, unless the client already sends them, so that it is
+// actually retried.
+func (b *RequestBuilder) Retry(n int) *RequestBuilder {
+	b.retry = n > 0
+	return b.Options(WithMaxRetries(n))
+}
+
+// Timeout bounds this request, retries included, see WithTimeout.
+func (b *RequestBuilder) Timeout(d time.Duration) *RequestBuilder {
+	return b.Options(WithTimeout(d))
+}
+
+// Options overrides the client's options for this request.
+func (b *RequestBuilder) Options(opts ...Option) *RequestBuilder {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+// Request returns the built request.
+func (b *RequestBuilder) Request(ctx context.Context) (*http.Request, error) {
+	req, err := NewRequest(ctx, b.method, b.url, b.body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range b.header {
+		req.Header[name] = append(req.Header[name], values...)
+	}
+	if b.json {
+		if req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if req.Header.Get("Accept") == "" {
+			req.Header.Set("Accept", "application/json")
+		}
+	}
+	if len(b.query) > 0 {
+		q := req.URL.Query()
+		for name, values := range b.query {
+			q[name] = append(q[name], values...)
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+
+	return req, nil
+}
+
+// Do sends the request.
+func (b *RequestBuilder) Do(ctx context.Context) (*http.Response, error) {
+	req, err := b.Request(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := b.opts
+	if b.retry {
+		opts = append(opts[:len(opts):len(opts)], withIdempotencyKeyDefault())
+	}
+
+	return b.client.Do(ctx, req, opts...)
+}
+
+// withIdempotencyKeyDefault turns on idempotency keys with the default header
+// unless the client already sends them.
+func withIdempotencyKeyDefault() Option {
+	return func(c *config) {
+		if c.idempotencyHeader == "" {
+			c.idempotencyHeader = DefaultIdempotencyKeyHeader
+		}
+	}
+}
+
+// DecodeJSON sends the request and decodes the JSON response into out, like
+// DoJSON.
+func (b *RequestBuilder) DecodeJSON(ctx context.Context, out interface{}) error {
+	resp, err := b.Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	return b.client.current().decodeJSON(resp, out)
+}
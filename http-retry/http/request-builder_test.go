@@ -0,0 +1,136 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestRequestBuilderRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		retry     int
+		opts      []Option
+		header    string
+		wantCount int
+		wantKey   bool
+	}{
+		{name: "POST with Retry", method: http.MethodPost, retry: 2, header: DefaultIdempotencyKeyHeader, wantCount: 3, wantKey: true},
+		{name: "PATCH with Retry", method: http.MethodPatch, retry: 2, header: DefaultIdempotencyKeyHeader, wantCount: 3, wantKey: true},
+		{name: "POST without Retry", method: http.MethodPost, header: DefaultIdempotencyKeyHeader, wantCount: 1},
+		{name: "GET with Retry", method: http.MethodGet, retry: 2, header: DefaultIdempotencyKeyHeader, wantCount: 3},
+		{
+			name:      "client header kept",
+			method:    http.MethodPost,
+			retry:     2,
+			opts:      []Option{WithIdempotencyKeyHeader("X-Request-Key")},
+			header:    "X-Request-Key",
+			wantCount: 3,
+			wantKey:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503, 503, 200)
+			c := NewRetryableClient(append([]Option{fastBackoff, WithMaxRetryAfter(0)}, tt.opts...)...)
+
+			b := c.NewRequest(tt.method, srv.URL).JSONBody(map[string]string{"name": "gopher"})
+			if tt.retry > 0 {
+				b = b.Retry(tt.retry)
+			}
+			resp, err := b.Do(context.Background())
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			resp.Body.Close()
+
+			if srv.count() != tt.wantCount {
+				t.Fatalf("server received %d requests, want %d", srv.count(), tt.wantCount)
+			}
+			first, _ := srv.request(0)
+			key := first.Header.Get(tt.header)
+			if (key != "") != tt.wantKey {
+				t.Fatalf("%s = %q, want a key: %v", tt.header, key, tt.wantKey)
+			}
+			for i := 1; i < srv.count(); i++ {
+				req, body := srv.request(i)
+				if got := req.Header.Get(tt.header); got != key {
+					t.Errorf("attempt %d %s = %q, want %q", i+1, tt.header, got, key)
+				}
+				if body != `{"name":"gopher"}` {
+					t.Errorf("attempt %d body = %q", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestPostJSONRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantCount int
+	}{
+		{name: "not retried by default", wantCount: 1},
+		{name: "idempotency key", opts: []Option{WithIdempotencyKey()}, wantCount: 2},
+		{name: "unsafe retries", opts: []Option{WithRetryUnsafeMethods()}, wantCount: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503, 204)
+			c := NewRetryableClient(append([]Option{fastBackoff, WithMaxRetryAfter(0)}, tt.opts...)...)
+
+			c.PostJSON(context.Background(), srv.URL, map[string]int{"n": 1}, nil)
+			if srv.count() != tt.wantCount {
+				t.Errorf("server received %d requests, want %d", srv.count(), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestRequestBuilder(t *testing.T) {
+	srv := newScriptServer(t, 503, 200)
+	c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0), WithMaxRetries(0))
+
+	resp, err := c.NewRequest(http.MethodPut, srv.URL+"/users?page=2").
+		Header("X-Tenant", "acme").
+		Query("notify", "true").
+		JSONBody(map[string]string{"name": "gopher"}).
+		Retry(1).
+		Do(context.Background())
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if srv.count() != 2 {
+		t.Fatalf("server received %d requests, want 2", srv.count())
+	}
+	for i := 0; i < 2; i++ {
+		req, body := srv.request(i)
+		tests := []struct {
+			name string
+			got  string
+			want string
+		}{
+			{name: "method", got: req.Method, want: http.MethodPut},
+			{name: "query", got: req.URL.RawQuery, want: "notify=true&page=2"},
+			{name: "header", got: req.Header.Get("X-Tenant"), want: "acme"},
+			{name: "content type", got: req.Header.Get("Content-Type"), want: "application/json"},
+			{name: "body", got: body, want: `{"name":"gopher"}`},
+		}
+		for _, tt := range tests {
+			if tt.got != tt.want {
+				t.Errorf("attempt %d %s = %q, want %q", i+1, tt.name, tt.got, tt.want)
+			}
+		}
+	}
+}
+
+func TestRequestBuilderInvalidURL(t *testing.T) {
+	c := NewRetryableClient()
+	if _, err := c.NewRequest(http.MethodGet, "://bad").Do(context.Background()); err == nil {
+		t.Error("Do() error = nil, want an invalid URL error")
+	}
+}
@@ -0,0 +1,148 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Encoder returns a writer compressing into w, for one content coding.
+type Encoder func(w io.Writer) (io.WriteCloser, error)
+
+var encoders = map[string]Encoder{
+	"gzip": func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+	"deflate": func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriter(w), nil
+	},
+}
+
+// WithRequestCompression compresses request bodies with encoding, "gzip" or
+// "deflate", and sets Content-Encoding. Every attempt compresses the body
+// anew from its source. Bodies that would not shrink, that cannot be
+// replayed or that are already encoded are sent as they are. When a server
+// answers 415 Unsupported Media Type to a compressed body, the request is
+// sent again uncompressed without counting a retry, and so are the later
+// requests to that host. Any other encoding fails every request, see
+// WithRequestEncoder for custom ones.
+func WithRequestCompression(encoding string) Option {
+	e, ok := encoders[strings.ToLower(encoding)]
+	if !ok {
+		return func(c *config) {
+			if c.optionErr == nil {
+				c.optionErr = fmt.Errorf("rhttp: unsupported request compression %q", encoding)
+			}
+		}
+	}
+
+	return WithRequestEncoder(encoding, e)
+}
+
+// WithRequestEncoder is like WithRequestCompression with a custom encoder,
+// e.g. for Brotli or zstd. A nil encoder disables request compression.
+func WithRequestEncoder(encoding string, e Encoder) Option {
+	return func(c *config) {
+		c.requestCompression = nil
+		if e != nil {
+			c.requestCompression = &requestCompression{
+				encoding: strings.ToLower(encoding),
+				encoder:  e,
+				rejected: make(map[string]bool),
+			}
+		}
+	}
+}
+
+type requestCompression struct {
+	encoding string
+	encoder  Encoder
+
+	mu       sync.Mutex
+	rejected map[string]bool
+}
+
+// reject records that host does not accept compressed bodies.
+func (rc *requestCompression) reject(host string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.rejected[host] = true
+}
+
+func (rc *requestCompression) accepted(host string) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return !rc.rejected[host]
+}
+
+// compressRequest returns a copy of req whose body, the first one read from
+// body and the later ones from getBody, is compressed. req is returned as is
+// when it is not to be compressed, and then body is left unread.
+func (c *config) compressRequest(req *http.Request, body io.ReadCloser, getBody BodyFunc) (*http.Request, bool, error) {
+	rc := c.requestCompression
+	if rc == nil || getBody == nil || body == nil || body == http.NoBody ||
+		req.Header.Get("Content-Encoding") != "" || !rc.accepted(req.URL.Host) {
+		return req, false, nil
+	}
+
+	original, err := ioutil.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := rc.compress(bytes.NewReader(original))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) >= len(original) {
+		// Not worth it: send the bytes already read
+		req = req.Clone(req.Context())
+		req.Body, req.GetBody = ioutil.NopCloser(bytes.NewReader(original)), getBody
+		return req, false, nil
+	}
+
+	compressed := req.Clone(req.Context())
+	compressed.Header.Set("Content-Encoding", rc.encoding)
+	compressed.Header.Del("Content-Length")
+	compressed.ContentLength = int64(len(data))
+	compressed.Body = ioutil.NopCloser(bytes.NewReader(data))
+	compressed.GetBody = func() (io.ReadCloser, error) {
+		src, err := getBody()
+		if err != nil {
+			return nil, err
+		}
+		defer src.Close()
+
+		data, err := rc.compress(src)
+		if err != nil {
+			return nil, err
+		}
+
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	return compressed, true, nil
+}
+
+func (rc *requestCompression) compress(src io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := rc.encoder(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
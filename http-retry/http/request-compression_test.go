@@ -0,0 +1,111 @@
+package http
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func decodeBody(t *testing.T, encoding, body string) string {
+	t.Helper()
+
+	var r io.Reader = strings.NewReader(body)
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(r)
+	case "deflate":
+		r, err = zlib.NewReader(r)
+	}
+	if err != nil {
+		t.Fatalf("decoding %s body: %v", encoding, err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decoding %s body: %v", encoding, err)
+	}
+
+	return string(data)
+}
+
+func TestRequestCompression(t *testing.T) {
+	large := strings.Repeat("compressible ", 100)
+	tests := []struct {
+		name         string
+		encoding     string
+		body         string
+		statuses     []int
+		wantEncoding []string
+		wantErr      bool
+	}{
+		{name: "gzip", encoding: "gzip", body: large, wantEncoding: []string{"gzip"}},
+		{name: "deflate", encoding: "DEFLATE", body: large, wantEncoding: []string{"deflate"}},
+		{name: "retry recompresses", encoding: "gzip", body: large, statuses: []int{503, 200}, wantEncoding: []string{"gzip", "gzip"}},
+		{name: "small body sent as is", encoding: "gzip", body: "tiny", wantEncoding: []string{""}},
+		{name: "415 falls back", encoding: "gzip", body: large, statuses: []int{415, 200}, wantEncoding: []string{"gzip", ""}},
+		{name: "unsupported coding", encoding: "br", body: large, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			c := NewRetryableClient(WithRequestCompression(tt.encoding), WithMaxRetries(1), fastBackoff)
+
+			resp, err := c.PutContext(context.Background(), srv.URL, "text/plain", tt.body)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "unsupported request compression") {
+					t.Fatalf("PutContext() error = %v, want unsupported request compression", err)
+				}
+				if srv.count() != 0 {
+					t.Errorf("server received %d requests, want none", srv.count())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PutContext() error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("status = %d, want 200", resp.StatusCode)
+			}
+
+			if srv.count() != len(tt.wantEncoding) {
+				t.Fatalf("server received %d requests, want %d", srv.count(), len(tt.wantEncoding))
+			}
+			for i, want := range tt.wantEncoding {
+				req, body := srv.request(i)
+				if got := req.Header.Get("Content-Encoding"); got != want {
+					t.Errorf("attempt %d Content-Encoding = %q, want %q", i+1, got, want)
+				}
+				if got := decodeBody(t, want, body); got != tt.body {
+					t.Errorf("attempt %d body = %q, want %q", i+1, got, tt.body)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestCompressionRemembersRejectingHosts(t *testing.T) {
+	srv := newScriptServer(t, 415, 200, 200)
+	c := NewRetryableClient(WithRequestCompression("gzip"))
+	body := strings.Repeat("compressible ", 100)
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.PutContext(context.Background(), srv.URL, "text/plain", body)
+		if err != nil {
+			t.Fatalf("PutContext() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if srv.count() != 3 {
+		t.Fatalf("server received %d requests, want 3", srv.count())
+	}
+	if req, _ := srv.request(2); req.Header.Get("Content-Encoding") != "" {
+		t.Errorf("request after a 415 was compressed, want it sent as is")
+	}
+}
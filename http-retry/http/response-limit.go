@@ -0,0 +1,83 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// ErrBodyTooLarge is returned when a response body is larger than allowed by
+// WithMaxResponseBytes. A response announcing a larger Content-Length is
+// rejected without reading it and is not retried.
+var ErrBodyTooLarge = errors.New("rhttp: response body too large")
+
+// WithMaxResponseBytes caps response bodies at n bytes, after decompression.
+// Reading past the cap fails with ErrBodyTooLarge, whether in the JSON
+// helpers, the cache or the caller's own code, so a misbehaving upstream
+// cannot exhaust memory. Zero, the default, leaves bodies unbounded.
+func WithMaxResponseBytes(n int64) Option {
+	return func(c *config) {
+		c.maxResponseBytes = n
+	}
+}
+
+// limitResponse caps the body of resp, rejecting it at once if its length is
+// known to exceed the cap.
+func (c *config) limitResponse(resp *http.Response) (*http.Response, error) {
+	n := c.maxResponseBytes
+	if n <= 0 || resp.Body == nil {
+		return resp, nil
+	}
+	if resp.ContentLength > n {
+		resp.Body.Close()
+		return nil, &permanentError{err: bodyTooLarge(n)}
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, limit: n, remaining: n}
+
+	return resp, nil
+}
+
+// readLimited reads r in full, failing with ErrBodyTooLarge past n bytes
+// unless n is zero.
+func readLimited(r io.Reader, n int64) ([]byte, error) {
+	if n <= 0 {
+		return ioutil.ReadAll(r)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, n+1))
+	if err == nil && int64(len(data)) > n {
+		err = bodyTooLarge(n)
+	}
+
+	return data, err
+}
+
+func bodyTooLarge(n int64) error {
+	return fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, n)
+}
+
+// limitedBody fails with ErrBodyTooLarge once more than limit bytes are read.
+type limitedBody struct {
+	io.ReadCloser
+	limit, remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, bodyTooLarge(b.limit)
+	}
+	// Read one byte past the limit to tell a body of exactly limit bytes
+	// from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), bodyTooLarge(b.limit)
+	}
+
+	return n, err
+}
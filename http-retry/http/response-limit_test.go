@@ -0,0 +1,95 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithMaxResponseBytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int64
+		size  int
+		// chunked sends the body without a Content-Length.
+		chunked     bool
+		wantRead    int
+		wantErr     bool
+		wantRefused bool
+	}{
+		{name: "unbounded", size: 100000, wantRead: 100000},
+		{name: "under the limit", limit: 100, size: 50, wantRead: 50},
+		{name: "at the limit", limit: 100, size: 100, wantRead: 100},
+		{name: "announced too large", limit: 100, size: 101, wantRefused: true, wantErr: true},
+		{name: "chunked at the limit", limit: 100, size: 100, chunked: true, wantRead: 100},
+		{name: "chunked too large", limit: 100, size: 100000, chunked: true, wantRead: 100, wantErr: true},
+		{name: "empty", limit: 100, wantRead: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				if tt.chunked {
+					w.(http.Flusher).Flush()
+				}
+				w.Write([]byte(strings.Repeat("x", tt.size)))
+			}))
+			defer srv.Close()
+			c := NewRetryableClient(fastBackoff, WithMaxResponseBytes(tt.limit))
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+			if tt.wantRefused {
+				if !errors.Is(err, ErrBodyTooLarge) || resp != nil {
+					t.Errorf("Do() = %v, %v, want ErrBodyTooLarge", resp, err)
+				}
+				if n := atomic.LoadInt32(&requests); n != 1 {
+					t.Errorf("%d requests sent, want 1", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if len(b) != tt.wantRead || errors.Is(err, ErrBodyTooLarge) != tt.wantErr || (!tt.wantErr && err != nil) {
+				t.Errorf("read %d bytes, %v, want %d, too large: %v", len(b), err, tt.wantRead, tt.wantErr)
+			}
+			// The body stays too large once the limit is hit
+			if _, err := resp.Body.Read(make([]byte, 1)); tt.wantErr && !errors.Is(err, ErrBodyTooLarge) {
+				t.Errorf("next Read() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		limit   int64
+		want    string
+		wantErr bool
+	}{
+		{name: "unbounded", body: "payload", want: "payload"},
+		{name: "under", body: "payload", limit: 10, want: "payload"},
+		{name: "exact", body: "payload", limit: 7, want: "payload"},
+		{name: "over", body: "payload", limit: 6, want: "payload", wantErr: true},
+		{name: "far over", body: strings.Repeat("x", 1000), limit: 6, want: "xxxxxxx", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readLimited(strings.NewReader(tt.body), tt.limit)
+			if string(got) != tt.want || errors.Is(err, ErrBodyTooLarge) != tt.wantErr {
+				t.Errorf("readLimited() = %q, %v, want %q, too large: %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ResumableBody is the body of a download that survives interrupted reads.
+// When reading fails midway and the server advertised Accept-Ranges: bytes,
+// the rest is requested again with a Range header and the pieces are stitched
+// together transparently.
+type ResumableBody struct {
+	// Response is the response that started the download.
+	Response *http.Response
+
+	ctx        context.Context
+	client     *RetryableClient
+	url        string
+	header     http.Header
+	validator  string
+	body       io.ReadCloser
+	offset     int64
+	total      int64
+	resumes    int
+	maxResumes int
+}
+
+// GetResumable starts a GET download of url whose body resumes after
+// interrupted reads, up to the client's max retries times. Non-2xx responses
+// are returned as *StatusError.
+func (c *RetryableClient) GetResumable(ctx context.Context, url string) (*ResumableBody, error) {
+	b := &ResumableBody{
+		ctx:        ctx,
+		client:     c,
+		url:        url,
+		header:     make(http.Header),
+		total:      -1,
+		maxResumes: c.current().maxRetries,
+	}
+	// Ranges are offsets into the encoded body, keep it unencoded
+	b.header.Set("Accept-Encoding", "identity")
+
+	resp, err := b.request(nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer drainBody(resp)
+		return nil, c.current().statusError(resp)
+	}
+
+	b.Response = resp
+	b.body = resp.Body
+	b.total = resp.ContentLength
+	if resp.Header.Get("Accept-Ranges") == "bytes" {
+		// If-Range only accepts a strong ETag or a date
+		if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			b.validator = etag
+		} else {
+			b.validator = resp.Header.Get("Last-Modified")
+		}
+	} else {
+		b.maxResumes = 0
+	}
+
+	return b, nil
+}
+
+func (b *ResumableBody) request(header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(b.ctx, http.MethodGet, b.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range b.header {
+		req.Header[name] = values
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	return b.client.Do(b.ctx, req)
+}
+
+func (b *ResumableBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.body.Read(p)
+		b.offset += int64(n)
+
+		if err == io.EOF && b.total >= 0 && b.offset < b.total {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil || err == io.EOF || b.ctx.Err() != nil || b.resumes >= b.maxResumes {
+			return n, err
+		}
+
+		if rerr := b.resume(); rerr != nil {
+			return n, fmt.Errorf("rhttp: resuming download at byte %d: %w (after %v)", b.offset, rerr, err)
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume requests the rest of the body, starting at the current offset.
+func (b *ResumableBody) resume() error {
+	b.resumes++
+	b.body.Close()
+	b.body = ioutil.NopCloser(strings.NewReader(""))
+
+	header := make(http.Header)
+	header.Set("Range", "bytes="+strconv.FormatInt(b.offset, 10)+"-")
+	if b.validator != "" {
+		header.Set("If-Range", b.validator)
+	}
+
+	resp, err := b.request(header)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != b.offset {
+			drainBody(resp)
+			return errors.New("unexpected Content-Range " + resp.Header.Get("Content-Range"))
+		}
+	case http.StatusOK:
+		// The range was ignored or the resource changed: skip what we have
+		// if it is the same resource, give up otherwise
+		if resp.ContentLength != b.total || (b.validator != "" &&
+			resp.Header.Get("ETag") != b.validator && resp.Header.Get("Last-Modified") != b.validator) {
+			drainBody(resp)
+			return errors.New("resource changed during download")
+		}
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, b.offset); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	default:
+		defer drainBody(resp)
+		return b.client.current().statusError(resp)
+	}
+
+	b.body = resp.Body
+	return nil
+}
+
+func (b *ResumableBody) Close() error {
+	return b.body.Close()
+}
+
+// contentRangeStart returns the first byte of a "bytes start-end/total" range.
+func contentRangeStart(value string) (int64, bool) {
+	value = strings.TrimPrefix(value, "bytes ")
+	i := strings.IndexByte(value, '-')
+	if i < 0 {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(value[:i], 10, 64)
+
+	return start, err == nil
+}
@@ -0,0 +1,230 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const resumableContent = "0123456789abcdef"
+
+// rangeServer serves resumableContent, hanging up after cutAt bytes of its
+// first cuts responses. ranges is how it answers a Range request: "206",
+// "wrong start" for a 206 of the wrong range, "ignore" for a 200 of the whole
+// content and "changed" for a 200 of other content.
+type rangeServer struct {
+	*httptest.Server
+
+	acceptRanges bool
+	etag         string
+	ranges       string
+	cuts         int
+	cutAt        int
+
+	mu      sync.Mutex
+	headers []http.Header
+}
+
+func (s *rangeServer) start(t *testing.T) {
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+}
+
+func (s *rangeServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	n := len(s.headers)
+	s.headers = append(s.headers, r.Header.Clone())
+	s.mu.Unlock()
+
+	if s.acceptRanges {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+	w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+
+	content, status := resumableContent, http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		start, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		switch s.ranges {
+		case "206", "wrong start":
+			from := start
+			if s.ranges == "wrong start" {
+				from = 0
+			}
+			w.Header().Set("Content-Range", "bytes "+strconv.Itoa(from)+"-"+strconv.Itoa(len(content)-1)+"/"+strconv.Itoa(len(content)))
+			content, status = content[start:], http.StatusPartialContent
+		case "changed":
+			content += "!"
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(status)
+	if n >= s.cuts || s.cutAt >= len(content) {
+		w.Write([]byte(content))
+		return
+	}
+	w.Write([]byte(content[:s.cutAt]))
+	w.(http.Flusher).Flush()
+	conn, buf, _ := w.(http.Hijacker).Hijack()
+	buf.Flush()
+	conn.Close()
+}
+
+func (s *rangeServer) header(n int) http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.headers[n]
+}
+
+func (s *rangeServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.headers)
+}
+
+func TestGetResumable(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      *rangeServer
+		opts        []Option
+		wantErr     string
+		wantCount   int
+		wantRange   string
+		wantIfRange string
+	}{
+		{
+			name:      "not interrupted",
+			server:    &rangeServer{acceptRanges: true, ranges: "206"},
+			wantCount: 1,
+		},
+		{
+			name:        "resumed",
+			server:      &rangeServer{acceptRanges: true, etag: `"v1"`, ranges: "206", cuts: 1, cutAt: 4},
+			wantCount:   2,
+			wantRange:   "bytes=4-",
+			wantIfRange: `"v1"`,
+		},
+		{
+			name:      "resumed twice",
+			server:    &rangeServer{acceptRanges: true, ranges: "206", cuts: 2, cutAt: 4},
+			wantCount: 3,
+		},
+		{
+			name:        "weak ETag",
+			server:      &rangeServer{acceptRanges: true, etag: `W/"v1"`, ranges: "206", cuts: 1, cutAt: 4},
+			wantCount:   2,
+			wantRange:   "bytes=4-",
+			wantIfRange: "Mon, 01 Jan 2024 00:00:00 GMT",
+		},
+		{
+			name:      "range ignored",
+			server:    &rangeServer{acceptRanges: true, ranges: "ignore", cuts: 1, cutAt: 4},
+			wantCount: 2,
+		},
+		{
+			name:      "resource changed",
+			server:    &rangeServer{acceptRanges: true, ranges: "changed", cuts: 1, cutAt: 4},
+			wantErr:   "resource changed",
+			wantCount: 2,
+		},
+		{
+			name:      "wrong range",
+			server:    &rangeServer{acceptRanges: true, ranges: "wrong start", cuts: 1, cutAt: 4},
+			wantErr:   "unexpected Content-Range",
+			wantCount: 2,
+		},
+		{
+			name:      "ranges not accepted",
+			server:    &rangeServer{cuts: 1, cutAt: 4},
+			wantErr:   "unexpected EOF",
+			wantCount: 1,
+		},
+		{
+			name:      "resumes capped by max retries",
+			server:    &rangeServer{acceptRanges: true, ranges: "206", cuts: 3, cutAt: 4},
+			opts:      []Option{WithMaxRetries(2)},
+			wantErr:   "unexpected EOF",
+			wantCount: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := tt.server
+			srv.start(t)
+			c := NewRetryableClient(append([]Option{fastBackoff}, tt.opts...)...)
+
+			body, err := c.GetResumable(context.Background(), srv.URL)
+			if err != nil {
+				t.Fatalf("GetResumable() error = %v", err)
+			}
+			got, err := ioutil.ReadAll(body)
+			body.Close()
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("read error = %v, want %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Errorf("read error = %v", err)
+			case string(got) != resumableContent:
+				t.Errorf("body = %q, want %q", got, resumableContent)
+			}
+
+			if srv.count() != tt.wantCount {
+				t.Fatalf("server received %d requests, want %d", srv.count(), tt.wantCount)
+			}
+			if h := srv.header(0); h.Get("Range") != "" || h.Get("Accept-Encoding") != "identity" {
+				t.Errorf("first request Range = %q, Accept-Encoding = %q", h.Get("Range"), h.Get("Accept-Encoding"))
+			}
+			if tt.wantRange != "" {
+				h := srv.header(1)
+				if h.Get("Range") != tt.wantRange || h.Get("If-Range") != tt.wantIfRange {
+					t.Errorf("resume Range = %q, If-Range = %q, want %q, %q", h.Get("Range"), h.Get("If-Range"), tt.wantRange, tt.wantIfRange)
+				}
+			}
+		})
+	}
+}
+
+func TestGetResumableStatusError(t *testing.T) {
+	srv := newScriptServer(t, http.StatusNotFound)
+	c := NewRetryableClient(fastBackoff)
+
+	_, err := c.GetResumable(context.Background(), srv.URL)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusNotFound {
+		t.Errorf("GetResumable() error = %v, want a 404 *StatusError", err)
+	}
+}
+
+func TestContentRangeStart(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   int64
+		wantOK bool
+	}{
+		{value: "bytes 4-15/16", want: 4, wantOK: true},
+		{value: "bytes 0-0/1", want: 0, wantOK: true},
+		{value: "4-15/16", want: 4, wantOK: true},
+		{value: "bytes */16"},
+		{value: ""},
+		{value: "bytes x-15/16"},
+	}
+	for _, tt := range tests {
+		got, ok := contentRangeStart(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("contentRangeStart(%q) = %d, %v, want %d, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxRetryAfter caps how long the client waits when told to by a
+// Retry-After header.
+const DefaultMaxRetryAfter = time.Minute
+
+// retryAfter returns the wait requested by a 429 or 503 response's
+// Retry-After header, which holds either a number of seconds or an HTTP date.
+// A malformed header, or a number of seconds too large for a time.Duration,
+// is ignored so the backoff applies.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil ||
+		(resp.StatusCode != http.StatusTooManyRequests &&
+			resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if digits(value) {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds > int64(maxDuration/time.Second) {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		d := date.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// digits reports whether s is a non-empty run of ASCII digits, the only form
+// of delay-seconds; signs and fractions are malformed.
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return s != ""
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var retryAfterNow = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "seconds", status: 503, value: "120", want: 2 * time.Minute, wantOK: true},
+		{name: "zero", status: 429, value: "0", want: 0, wantOK: true},
+		{name: "spaces", status: 429, value: " 5 ", want: 5 * time.Second, wantOK: true},
+		{name: "future date", status: 503, value: retryAfterNow.Add(90 * time.Second).Format(http.TimeFormat), want: 90 * time.Second, wantOK: true},
+		{name: "past date", status: 503, value: retryAfterNow.Add(-time.Hour).Format(http.TimeFormat), want: 0, wantOK: true},
+		{name: "other status", status: 500, value: "120"},
+		{name: "missing", status: 503, value: ""},
+		{name: "plus sign", status: 503, value: "+5"},
+		{name: "negative", status: 503, value: "-1"},
+		{name: "fraction", status: 503, value: "1.5"},
+		{name: "words", status: 503, value: "soon"},
+		{name: "too many digits", status: 503, value: "99999999999999999999"},
+		{name: "too many seconds", status: 503, value: strconv.FormatInt(int64(maxDuration/time.Second)+1, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.value != "" {
+				resp.Header.Set("Retry-After", tt.value)
+			}
+			got, ok := retryAfter(resp, retryAfterNow)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRetryAfterFallsBackToBackoff(t *testing.T) {
+	const backoff = 7 * time.Second
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "honored", value: "3", want: 3 * time.Second},
+		{name: "capped", value: "3600", want: time.Minute},
+		{name: "far date capped", value: "Fri, 31 Dec 9999 23:59:59 GMT", want: time.Minute},
+		{name: "malformed", value: "in a bit", want: backoff},
+		{name: "negative", value: "-10", want: backoff},
+		{name: "overflowing", value: "99999999999999999999", want: backoff},
+		{name: "too many seconds", value: strconv.FormatInt(int64(maxDuration/time.Second)+1, 10), want: backoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) == 1 {
+					w.Header().Set("Retry-After", tt.value)
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer srv.Close()
+
+			clock := newStepClock()
+			c := NewRetryableClient(WithClock(clock), WithBackoff(ConstantBackoff(backoff)), WithMaxRetryAfter(time.Minute))
+			if _, _, err := c.GetBytes(context.Background(), srv.URL); err != nil {
+				t.Fatalf("GetBytes() error = %v", err)
+			}
+			if waits := clock.Waits(); len(waits) != 1 || waits[0] != tt.want {
+				t.Errorf("waits = %v, want [%v]", waits, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzParseRetryAfter(f *testing.F) {
+	for _, seed := range []string{"0", "120", "+5", "-1", "1.5", "99999999999999999999", "Wed, 21 Oct 2015 07:28:00 GMT", " 7 ", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {value}}}
+		got, ok := retryAfter(resp, retryAfterNow)
+		if got < 0 {
+			t.Fatalf("retryAfter(%q) = %v, a negative wait", value, got)
+		}
+		if !ok && got != 0 {
+			t.Fatalf("retryAfter(%q) = %v without a wait", value, got)
+		}
+		if trimmed := strings.TrimSpace(value); ok && digits(trimmed) {
+			seconds, err := strconv.ParseInt(trimmed, 10, 64)
+			if err != nil || got != time.Duration(seconds)*time.Second {
+				t.Fatalf("retryAfter(%q) = %v, want %v seconds", value, got, seconds)
+			}
+		}
+	})
+}
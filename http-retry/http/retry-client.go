@@ -1,86 +1,187 @@
 package http
 
 import (
-	"bytes"
-	"io"
+	"context"
 	"io/ioutil"
-	"math"
 	"net/http"
-	"time"
 )
 
-const RetryCount = 3
-
-type retryableTransport struct {
-	transport http.RoundTripper
+// RetryableClient is an HTTP client that retries failed requests.
+type RetryableClient struct {
+	client  *http.Client
+	config  *config
+	tunable *tunable
+	queue   *Queue
+	life    *lifecycle
 }
 
-func backoff(retries int) time.Duration {
-	return time.Duration(math.Pow(2, float64(retries))) * time.Second
-}
+// NewRetryableClient returns a client configured by opts. Without options it
+// uses sensible defaults, see Option.
+func NewRetryableClient(opts ...Option) *RetryableClient {
+	cfg := newConfig(opts...)
 
-func shouldRetry(err error, resp *http.Response) bool {
-	if err != nil {
-		return true
+	client := &http.Client{Transport: &http.Transport{}}
+	if cfg.httpClient != nil {
+		hc := *cfg.httpClient
+		client = &hc
+	}
+	if cfg.healthChecker != nil {
+		cfg.healthChecker.attach(cfg)
+	}
+	tunable := newTunable(cfg)
+	transport := newRetryableTransport(client.Transport, cfg)
+	transport.tunable = tunable
+	transport.life = newLifecycle()
+	client.Transport = transport
+	if cfg.redirectPolicy != nil {
+		client.CheckRedirect = cfg.redirectPolicy.checkRedirect
+	}
+	if cfg.jar != nil {
+		// The transport handles cookies for every attempt
+		client.Jar = nil
 	}
 
-	if resp.StatusCode == http.StatusBadGateway ||
-		resp.StatusCode == http.StatusServiceUnavailable ||
-		resp.StatusCode == http.StatusGatewayTimeout {
-		return true
+	c := &RetryableClient{client: client, config: cfg, tunable: tunable, life: transport.life}
+	if cfg.queue != nil {
+		c.queue = NewQueue(c, *cfg.queue)
 	}
 
-	return false
+	return c
 }
 
-func drainBody(resp *http.Response) {
-	if resp.Body != nil {
-		io.Copy(ioutil.Discard, resp.Body)
-		resp.Body.Close()
-	}
+// StandardClient returns the underlying *http.Client, for APIs that need one.
+func (c *RetryableClient) StandardClient() *http.Client {
+	return c.client
 }
 
-func (t *retryableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Clone the request body
-	var bodyBytes []byte
-	if req.Body != nil {
-		bodyBytes, _ = ioutil.ReadAll(req.Body)
-		req.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+// Do sends req with ctx attached. Cancelling ctx stops any pending retry.
+// opts override the client's options for this request only. A relative URL
+// is resolved against the base URL, see WithBaseURL. When err is not nil the
+// response is always nil, there is no body to close. Once the client is
+// closed, Do fails with ErrClientClosed.
+func (c *RetryableClient) Do(ctx context.Context, req *http.Request, opts ...Option) (*http.Response, error) {
+	ctx, leave, err := c.life.enter(ctx)
+	if err != nil {
+		return nil, err
 	}
+	resp, err := c.send(ctx, req, opts...)
+
+	return track(resp, err, leave)
+}
 
-	// Send the request
-	resp, err := t.transport.RoundTrip(req)
+// send sends req as Do, with ctx tracked by the client's lifecycle.
+func (c *RetryableClient) send(ctx context.Context, req *http.Request, opts ...Option) (*http.Response, error) {
+	if len(opts) > 0 {
+		ctx = WithRequestOptions(ctx, opts...)
+	}
+	req = req.WithContext(ctx)
+	if !req.URL.IsAbs() {
+		cfg := c.current()
+		if opts := requestOptions(ctx); len(opts) > 0 {
+			cfg = cfg.with(opts...)
+		}
+		u, err := cfg.resolveURL(req.URL)
+		if err != nil {
+			return nil, err
+		}
+		req.URL = u
+	}
 
-	// Retry logic
-	retries := 0
-	for shouldRetry(err, resp) && retries < RetryCount {
-		// Wait for the specified backoff period
-		time.Sleep(backoff(retries))
+	// A replayable body lets http.Client follow 307 and 308 redirects with it
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		body, getBody, release, err := replayableBody(req, c.config.maxBufferedBody, c.config.maxPooledBuffer)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		req.Body, req.GetBody = body, getBody
+	}
 
-		// We're going to retry, consume any response to reuse the connection.
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// http.Client returns the response of a rejected redirect too
 		drainBody(resp)
+		return nil, err
+	}
 
-		// Clone the request body again
-		if req.Body != nil {
-			req.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
-		}
+	return resp, nil
+}
 
-		// Retry the request
-		resp, err = t.transport.RoundTrip(req)
+// DoAndRead sends req like Do and reads the whole response body, so callers
+// never have a body to close. Any status is returned with its body; err only
+// reports a request the client gave up on or a body that could not be read,
+// in which case status is zero.
+func (c *RetryableClient) DoAndRead(ctx context.Context, req *http.Request, opts ...Option) (status int, body []byte, err error) {
+	resp, err := c.Do(ctx, req, opts...)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer drainBody(resp)
 
-		retries++
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
 	}
 
-	// Return the response
-	return resp, err
+	return resp.StatusCode, body, nil
 }
 
-func NewRetryableClient() *http.Client {
-	transport := &retryableTransport{
-		transport: &http.Transport{},
+func (c *RetryableClient) do(ctx context.Context, method, url, contentType string, body interface{}) (*http.Response, error) {
+	req, err := NewRequest(ctx, method, url, body)
+	if err != nil {
+		return nil, err
 	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	return c.Do(ctx, req)
+}
+
+func (c *RetryableClient) Get(url string) (*http.Response, error) {
+	return c.GetContext(context.Background(), url)
+}
+
+func (c *RetryableClient) GetContext(ctx context.Context, url string) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, url, "", nil)
+}
 
-	return &http.Client{
-		Transport: transport,
+// GetBytes fetches url and returns the status and body of the response, see
+// DoAndRead.
+func (c *RetryableClient) GetBytes(ctx context.Context, url string) (status int, body []byte, err error) {
+	req, err := NewRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, nil, err
 	}
+
+	return c.DoAndRead(ctx, req)
+}
+
+func (c *RetryableClient) Head(url string) (*http.Response, error) {
+	return c.HeadContext(context.Background(), url)
+}
+
+func (c *RetryableClient) HeadContext(ctx context.Context, url string) (*http.Response, error) {
+	return c.do(ctx, http.MethodHead, url, "", nil)
+}
+
+// Post sends a POST request. body may be anything accepted by NewRequest.
+func (c *RetryableClient) Post(url, contentType string, body interface{}) (*http.Response, error) {
+	return c.PostContext(context.Background(), url, contentType, body)
+}
+
+func (c *RetryableClient) PostContext(ctx context.Context, url, contentType string, body interface{}) (*http.Response, error) {
+	return c.do(ctx, http.MethodPost, url, contentType, body)
+}
+
+func (c *RetryableClient) PutContext(ctx context.Context, url, contentType string, body interface{}) (*http.Response, error) {
+	return c.do(ctx, http.MethodPut, url, contentType, body)
+}
+
+func (c *RetryableClient) PatchContext(ctx context.Context, url, contentType string, body interface{}) (*http.Response, error) {
+	return c.do(ctx, http.MethodPatch, url, contentType, body)
+}
+
+func (c *RetryableClient) DeleteContext(ctx context.Context, url string) (*http.Response, error) {
+	return c.do(ctx, http.MethodDelete, url, "", nil)
 }
@@ -0,0 +1,232 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchmarkPaths are the server behaviors benchmarked: every request
+// succeeding, or every other one failing with a 503 first.
+var benchmarkPaths = []struct {
+	name    string
+	failing bool
+}{
+	{name: "no retry"},
+	{name: "one retry", failing: true},
+}
+
+func newBenchmarkServer(b *testing.B, failing bool) *httptest.Server {
+	var n int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing && atomic.AddInt64(&n, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	b.Cleanup(srv.Close)
+
+	return srv
+}
+
+func BenchmarkRetryableClient(b *testing.B) {
+	for _, path := range benchmarkPaths {
+		b.Run(path.name, func(b *testing.B) {
+			srv := newBenchmarkServer(b, path.failing)
+			c := NewRetryableClient(WithBackoff(ConstantBackoff(0)), WithMaxRetryAfter(0))
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				resp, err := c.Do(ctx, req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if resp.StatusCode != http.StatusOK {
+					b.Fatalf("status = %d", resp.StatusCode)
+				}
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkRetryTransport(b *testing.B) {
+	for _, path := range benchmarkPaths {
+		b.Run(path.name, func(b *testing.B) {
+			srv := newBenchmarkServer(b, path.failing)
+			c := &http.Client{Transport: NewRetryTransport(&http.Transport{}, WithBackoff(ConstantBackoff(0)), WithMaxRetryAfter(0))}
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				resp, err := c.Do(req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if resp.StatusCode != http.StatusOK {
+					b.Fatalf("status = %d", resp.StatusCode)
+				}
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkPlainHTTPClient(b *testing.B) {
+	for _, path := range benchmarkPaths {
+		b.Run(path.name, func(b *testing.B) {
+			srv := newBenchmarkServer(b, path.failing)
+			c := &http.Client{Transport: &http.Transport{}}
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// The retry a plain client leaves to its caller
+				for {
+					resp, err := c.Do(req)
+					if err != nil {
+						b.Fatal(err)
+					}
+					io.Copy(ioutil.Discard, resp.Body)
+					resp.Body.Close()
+					if resp.StatusCode == http.StatusOK {
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRetryableClientDo(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		opts       []Option
+		wantStatus int
+		wantCount  int
+		wantErr    bool
+	}{
+		{name: "success", statuses: []int{200}, wantStatus: 200, wantCount: 1},
+		{name: "retried 503", statuses: []int{503, 503, 200}, wantStatus: 200, wantCount: 3},
+		{name: "not retried 404", statuses: []int{404, 200}, wantStatus: 404, wantCount: 1},
+		{name: "no retries", statuses: []int{503, 200}, opts: []Option{WithMaxRetries(0)}, wantStatus: 503, wantCount: 1},
+		{name: "gives up", statuses: []int{503}, opts: []Option{WithMaxRetries(2)}, wantCount: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			c := NewRetryableClient(append([]Option{fastBackoff, WithMaxRetryAfter(0)}, tt.opts...)...)
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			resp, err := c.Do(context.Background(), req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do() error = %v, want an error: %v", err, tt.wantErr)
+			}
+			if err == nil {
+				drainBody(resp)
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+				}
+			}
+			if srv.count() != tt.wantCount {
+				t.Errorf("server received %d requests, want %d", srv.count(), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestContextStopsRetries(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		want error
+	}{
+		{
+			name: "cancelled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(20*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			want: context.Canceled,
+		},
+		{
+			name: "deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			want: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503)
+			c := NewRetryableClient(WithBackoff(ConstantBackoff(time.Hour)))
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			start := time.Now()
+			_, err := c.GetContext(ctx, srv.URL)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("GetContext() error = %v, want %v", err, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("GetContext() returned after %v, want the backoff cut short", elapsed)
+			}
+			if srv.count() != 1 {
+				t.Errorf("server received %d requests, want 1", srv.count())
+			}
+		})
+	}
+}
+
+func TestGetBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("not found"))
+		case "/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+	c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0), WithMaxRetries(1))
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+		wantErr    bool
+	}{
+		{name: "success", path: "/", wantStatus: http.StatusOK, wantBody: "ok"},
+		{name: "error status with its body", path: "/missing", wantStatus: http.StatusNotFound, wantBody: "not found"},
+		{name: "gave up", path: "/down", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body, err := c.GetBytes(context.Background(), srv.URL+tt.path)
+			if (err != nil) != tt.wantErr || status != tt.wantStatus || string(body) != tt.wantBody {
+				t.Errorf("GetBytes() = %d, %q, %v, want %d, %q, error: %v", status, body, err, tt.wantStatus, tt.wantBody, tt.wantErr)
+			}
+		})
+	}
+}
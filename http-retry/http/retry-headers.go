@@ -0,0 +1,53 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Conventional headers marking retried attempts, see WithRetryHeaders.
+const (
+	DefaultRetryAttemptHeader = "X-Retry-Attempt"
+	DefaultRetryReasonHeader  = "X-Retry-Reason"
+)
+
+// WithRetryHeaders adds headers to every retried attempt: the attempt number
+// under attemptHeader, e.g. "2" for the first retry, and why the previous
+// attempt failed under reasonHeader, as a status code such as "503" or an
+// error class such as "timeout". Servers can then tell retries from first
+// attempts and spot retry amplification. No header is added by default, since
+// they reveal client internals to the upstream; an empty name leaves that
+// header out. Services calling their own backends typically use
+//
+//	rhttp.WithRetryHeaders(rhttp.DefaultRetryAttemptHeader, rhttp.DefaultRetryReasonHeader)
+func WithRetryHeaders(attemptHeader, reasonHeader string) Option {
+	return func(c *config) {
+		c.retryAttemptHeader = attemptHeader
+		c.retryReasonHeader = reasonHeader
+	}
+}
+
+// setRetryHeaders marks req as attempt number attempt, retried after resp and
+// err. First attempts are left untouched.
+func (c *config) setRetryHeaders(req *http.Request, attempt int, resp *http.Response, err error) {
+	if attempt <= 1 {
+		return
+	}
+	if c.retryAttemptHeader != "" {
+		req.Header.Set(c.retryAttemptHeader, strconv.Itoa(attempt))
+	}
+	if c.retryReasonHeader != "" {
+		req.Header.Set(c.retryReasonHeader, attemptReason(resp, err))
+	}
+}
+
+// attemptReason is why an attempt with resp and err failed.
+func attemptReason(resp *http.Response, err error) string {
+	if err != nil {
+		return ClassifyError(err).String()
+	} else if resp != nil {
+		return strconv.Itoa(resp.StatusCode)
+	}
+
+	return ""
+}
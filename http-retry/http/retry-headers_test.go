@@ -0,0 +1,55 @@
+package http
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRetryHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		wantAttempt []string
+		wantReason  []string
+	}{
+		{
+			name:        "off by default",
+			wantAttempt: []string{"", "", ""},
+			wantReason:  []string{"", "", ""},
+		},
+		{
+			name:        "conventional names",
+			opts:        []Option{WithRetryHeaders(DefaultRetryAttemptHeader, DefaultRetryReasonHeader)},
+			wantAttempt: []string{"", "2", "3"},
+			wantReason:  []string{"", "503", "429"},
+		},
+		{
+			name:        "attempt only",
+			opts:        []Option{WithRetryHeaders(DefaultRetryAttemptHeader, "")},
+			wantAttempt: []string{"", "2", "3"},
+			wantReason:  []string{"", "", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503, 429, 200)
+			c := NewRetryableClient(append([]Option{fastBackoff, WithMaxRetryAfter(0)}, tt.opts...)...)
+
+			if _, _, err := c.GetBytes(context.Background(), srv.URL); err != nil {
+				t.Fatalf("GetBytes() error = %v", err)
+			}
+			if srv.count() != 3 {
+				t.Fatalf("server received %d requests, want 3", srv.count())
+			}
+			for i := range tt.wantAttempt {
+				req, _ := srv.request(i)
+				if got := req.Header.Get(DefaultRetryAttemptHeader); got != tt.wantAttempt[i] {
+					t.Errorf("attempt %d %s = %q, want %q", i+1, DefaultRetryAttemptHeader, got, tt.wantAttempt[i])
+				}
+				if got := req.Header.Get(DefaultRetryReasonHeader); got != tt.wantReason[i] {
+					t.Errorf("attempt %d %s = %q, want %q", i+1, DefaultRetryReasonHeader, got, tt.wantReason[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package http
+
+import "net/http"
+
+// RetryPolicy decides whether the outcome of an attempt should be retried.
+// attempt is the 1-based number of the attempt that produced resp and err.
+type RetryPolicy interface {
+	ShouldRetry(resp *http.Response, err error, attempt int) bool
+}
+
+// RetryPolicyFunc adapts a plain function to the RetryPolicy interface.
+type RetryPolicyFunc func(resp *http.Response, err error, attempt int) bool
+
+func (f RetryPolicyFunc) ShouldRetry(resp *http.Response, err error, attempt int) bool {
+	return f(resp, err, attempt)
+}
+
+// defaultRetryStatuses are the statuses retried by DefaultRetryPolicy.
+var defaultRetryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultRetryPolicy retries transport errors, except certificate errors, and
+// 429, 502, 503 and 504 responses.
+var DefaultRetryPolicy RetryPolicy = RetryPolicyFunc(defaultShouldRetry)
+
+func defaultShouldRetry(resp *http.Response, err error, attempt int) bool {
+	if err != nil {
+		return defaultRetryableError(err)
+	}
+
+	return containsInt(defaultRetryStatuses, resp.StatusCode)
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+		err  error
+		want bool
+	}{
+		{name: "200", code: 200},
+		{name: "404", code: 404},
+		{name: "429", code: 429, want: true},
+		{name: "500", code: 500},
+		{name: "501", code: 501},
+		{name: "502", code: 502, want: true},
+		{name: "503", code: 503, want: true},
+		{name: "504", code: 504, want: true},
+		{name: "transport error", err: errors.New("connection reset"), want: true},
+		{name: "certificate error", err: &CertificateError{Err: errors.New("expired")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp *http.Response
+			if tt.err == nil {
+				resp = &http.Response{StatusCode: tt.code}
+			}
+			if got := DefaultRetryPolicy.ShouldRetry(resp, tt.err, 1); got != tt.want {
+				t.Errorf("ShouldRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRetryPolicy(t *testing.T) {
+	srv := newScriptServer(t, 500, 500, 500, 200)
+	var attempts []int
+	policy := RetryPolicyFunc(func(resp *http.Response, err error, attempt int) bool {
+		attempts = append(attempts, attempt)
+		return err == nil && resp.StatusCode == 500 && attempt < 2
+	})
+	c := NewRetryableClient(fastBackoff, WithRetryPolicy(policy))
+
+	resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	drainBody(resp)
+	if resp.StatusCode != 500 || srv.count() != 2 {
+		t.Errorf("status = %d after %d requests, want 500 after 2", resp.StatusCode, srv.count())
+	}
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Errorf("policy saw attempts %v, want [1 2]", attempts)
+	}
+}
+
+func mustNewRequest(t *testing.T, url string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return req
+}
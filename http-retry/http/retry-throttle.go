@@ -0,0 +1,85 @@
+package http
+
+import "sync"
+
+// RetryThrottle is a retry budget shared by every request of a client, in the
+// style of gRPC retry throttling. Each failed attempt costs a token and each
+// success earns back TokenRatio tokens, and retries are only allowed while
+// more than half of the tokens are left. During a full outage the client
+// thus stops retrying altogether instead of multiplying the load on the
+// upstream by the retry count, and resumes once requests succeed again.
+type RetryThrottle struct {
+	maxTokens  float64
+	tokenRatio float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// Defaults of NewRetryThrottle.
+const (
+	DefaultRetryTokens     = 10
+	DefaultRetryTokenRatio = 0.1
+)
+
+// NewRetryThrottle returns a full budget of maxTokens tokens, earning back
+// tokenRatio tokens per success. Once retries are throttled, it takes
+// maxTokens/2/tokenRatio successes more than failures to allow them again:
+// from an empty budget, NewRetryThrottle(10, 0.1) resumes retries after more
+// than 50 successes. Values that are not positive are DefaultRetryTokens and
+// DefaultRetryTokenRatio.
+func NewRetryThrottle(maxTokens, tokenRatio float64) *RetryThrottle {
+	if maxTokens <= 0 {
+		maxTokens = DefaultRetryTokens
+	}
+	if tokenRatio <= 0 {
+		tokenRatio = DefaultRetryTokenRatio
+	}
+
+	return &RetryThrottle{
+		maxTokens:  maxTokens,
+		tokenRatio: tokenRatio,
+		tokens:     maxTokens,
+	}
+}
+
+// Tokens returns the tokens left in the budget.
+func (t *RetryThrottle) Tokens() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.tokens
+}
+
+// MaxTokens returns the size of the budget.
+func (t *RetryThrottle) MaxTokens() float64 {
+	return t.maxTokens
+}
+
+// Allow reports whether the budget allows another retry.
+func (t *RetryThrottle) Allow() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.tokens > t.maxTokens/2
+}
+
+// Record debits the budget for a failed attempt and credits it for a
+// successful one.
+func (t *RetryThrottle) Record(success bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if success {
+		t.tokens += t.tokenRatio
+		if t.tokens > t.maxTokens {
+			t.tokens = t.maxTokens
+		}
+		return
+	}
+
+	t.tokens--
+	if t.tokens < 0 {
+		t.tokens = 0
+	}
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRetryThrottleRecovery(t *testing.T) {
+	tests := []struct {
+		name              string
+		maxTokens, ratio  float64
+		wantMax           float64
+		wantSuccessesToGo int
+	}{
+		{name: "ten tokens", maxTokens: 10, ratio: 0.1, wantMax: 10, wantSuccessesToGo: 51},
+		{name: "hundred tokens", maxTokens: 100, ratio: 1, wantMax: 100, wantSuccessesToGo: 51},
+		{name: "defaults", maxTokens: 0, ratio: -1, wantMax: DefaultRetryTokens, wantSuccessesToGo: 51},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := NewRetryThrottle(tt.maxTokens, tt.ratio)
+			if th.MaxTokens() != tt.wantMax {
+				t.Errorf("MaxTokens() = %v, want %v", th.MaxTokens(), tt.wantMax)
+			}
+			if !th.Allow() {
+				t.Fatal("a full budget does not allow retries")
+			}
+
+			for i := 0; i < int(tt.wantMax)*2; i++ {
+				th.Record(false)
+			}
+			if th.Tokens() != 0 || th.Allow() {
+				t.Fatalf("after an outage Tokens() = %v, Allow() = %v, want an empty budget", th.Tokens(), th.Allow())
+			}
+
+			successes := 0
+			for !th.Allow() {
+				th.Record(true)
+				successes++
+				if successes > 10000 {
+					t.Fatal("the budget never recovered")
+				}
+			}
+			if successes != tt.wantSuccessesToGo {
+				t.Errorf("retries resumed after %d successes, want %d", successes, tt.wantSuccessesToGo)
+			}
+		})
+	}
+}
+
+func TestRetryThrottleStopsRetries(t *testing.T) {
+	srv := newScriptServer(t, 503)
+	th := NewRetryThrottle(4, 0.1)
+	c := NewRetryableClient(WithRetryThrottle(th), WithMaxRetries(10), fastBackoff)
+
+	_, _, err := c.GetBytes(context.Background(), srv.URL)
+	if !errors.Is(err, ErrRetryThrottled) {
+		t.Fatalf("GetBytes() error = %v, want ErrRetryThrottled", err)
+	}
+	// Retries stop once half of the budget is spent
+	if srv.count() != 2 {
+		t.Errorf("server received %d requests, want 2", srv.count())
+	}
+}
@@ -0,0 +1,546 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// RetryCount is the default number of retries after the first attempt.
+const RetryCount = 3
+
+type retryableTransport struct {
+	transport http.RoundTripper
+	config    *config
+	tunable   *tunable
+	// life is that of the client, nil for a bare transport.
+	life *lifecycle
+}
+
+// NewRetryTransport wraps base with the retry logic, so it can be plugged
+// under any http.Client. A nil base uses http.DefaultTransport.
+func NewRetryTransport(base http.RoundTripper, opts ...Option) http.RoundTripper {
+	return newRetryableTransport(base, newConfig(opts...))
+}
+
+func newRetryableTransport(base http.RoundTripper, cfg *config) *retryableTransport {
+	return &retryableTransport{
+		transport: chain(cfg.baseTransport(base), cfg.middleware),
+		config:    cfg,
+	}
+}
+
+func (t *retryableTransport) shouldRetry(ctx context.Context, resp *http.Response, err error, attempt int) bool {
+	// The caller gave up, another attempt would only fail the same way.
+	if ctx.Err() != nil || errors.Is(err, ErrCircuitOpen) || isPermanent(err) || !t.config.timeoutRetryable(err) {
+		return false
+	}
+
+	return t.config.policy.ShouldRetry(resp, err, attempt)
+}
+
+// maxDrainBytes bounds how much of a discarded response is read. Draining lets
+// the transport reuse the connection for the retry, but past this size opening
+// a new connection is cheaper than reading the rest.
+const maxDrainBytes = 64 << 10
+
+// drainBody consumes and closes the body of a response we are not going to
+// return, so its connection goes back to the pool instead of being torn down.
+func drainBody(resp *http.Response) {
+	if resp != nil && resp.Body != nil {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+		resp.Body.Close()
+	}
+}
+
+func (t *retryableTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	cfg := t.config
+	if t.tunable != nil {
+		cfg = t.tunable.load().config
+	}
+	if cfg = cfg.forRequest(req); cfg != t.config {
+		t = &retryableTransport{transport: t.transport, config: cfg, life: t.life}
+	}
+	defer t.config.catchPanic(&resp, &err)
+
+	t.config.debug.track(t.config)
+
+	span := Span(nopSpan{})
+	traced := req
+	if t.config.tracing() {
+		var ctx context.Context
+		ctx, span = t.config.tracer.Start(req.Context(), "HTTP "+req.Method)
+		span.SetAttributes(
+			Attribute{Key: "http.method", Value: req.Method},
+			Attribute{Key: "http.url", Value: req.URL.String()},
+		)
+		traced = req.WithContext(ctx)
+	}
+
+	start := t.config.clock.Now()
+	switch key := t.config.dedupeKey(traced); {
+	case key != "":
+		resp, err = t.config.writeDedupe.do(traced, key, t.config.clock, t.cachedRoundTrip)
+	case t.config.singleflight != nil:
+		resp, err = t.config.singleflight.do(traced, t.cachedRoundTrip)
+	default:
+		resp, err = t.cachedRoundTrip(traced)
+	}
+	t.config.metrics.RequestDuration(metricLabels(req, resp), t.config.clock.Now().Sub(start))
+	endSpan(span, resp, err)
+
+	return resp, err
+}
+
+// cachedRoundTrip answers req from the cache when possible.
+func (t *retryableTransport) cachedRoundTrip(req *http.Request) (*http.Response, error) {
+	if t.config.cache != nil {
+		return t.config.cache.roundTrip(req, t.config.clock, t.life, t.retryWithTimeout)
+	}
+
+	return t.retryWithTimeout(req)
+}
+
+// retryWithTimeout bounds the whole request, retries included.
+func (t *retryableTransport) retryWithTimeout(req *http.Request) (*http.Response, error) {
+	if t.config.timeout <= 0 {
+		return t.retry(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.config.timeout)
+	resp, err := t.retry(req.WithContext(ctx))
+
+	return cancelOnClose(resp, err, cancel)
+}
+
+// retry sends req until it succeeds or the client gives up, recording it to
+// the flight recorder if it fails.
+func (t *retryableTransport) retry(req *http.Request) (*http.Response, error) {
+	if t.config.recorder == nil {
+		return t.retryLoop(req, nil)
+	}
+
+	rec := t.config.recorder.start(req, t.config.clock.Now())
+	resp, err := t.retryLoop(req, rec)
+	rec.finish(err)
+
+	return resp, err
+}
+
+func (t *retryableTransport) retryLoop(req *http.Request, rec *recording) (*http.Response, error) {
+	ctx := req.Context()
+	if err := t.config.optionErr; err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	// Make the body replayable, so every retry sends it in full
+	body, getBody, release, err := replayableBody(req, t.config.maxBufferedBody, t.config.maxPooledBuffer)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	uncompressed, uncompressedBody := req, getBody
+	req, compressed, err := t.config.compressRequest(req, body, getBody)
+	if err != nil {
+		return nil, err
+	}
+	if req != uncompressed {
+		body, getBody = req.Body, req.GetBody
+	}
+
+	// Every attempt carries the same key, so the server can deduplicate them,
+	// and the same correlation ID
+	idempotencyKey, err := t.config.idempotencyKey(req)
+	var correlationID string
+	if err == nil {
+		correlationID, err = t.config.correlationID(req)
+	}
+	if err != nil {
+		if body != nil {
+			body.Close()
+		}
+		return nil, err
+	}
+	t.config.mirrorRequest(req, getBody, t.transport)
+
+	var attempts []Attempt
+	var delay time.Duration
+	var lastResp *http.Response
+	var lastErr error
+	var authorization string
+	reauthorized := false
+	for retries := 0; ; retries++ {
+		// Send the request, with a fresh copy of the body after the first attempt
+		if len(attempts) > 0 {
+			if body, err = getBody(); err != nil {
+				return nil, err
+			}
+		}
+		attemptCtx, span := ctx, Span(nopSpan{})
+		if t.config.tracing() {
+			attemptCtx, span = t.config.tracer.Start(ctx, "HTTP "+req.Method+" attempt")
+			span.SetAttributes(Attribute{Key: "retry.attempt", Value: retries + 1})
+		}
+		var timings *timingsTrace
+		if t.config.networkTimings {
+			attemptCtx, timings = t.config.traceTimings(attemptCtx)
+		}
+		attemptCtx = t.config.withAttemptInfo(attemptCtx, req, retries+1, lastResp, lastErr)
+		attempt := req
+		if len(attempts) > 0 || body != req.Body || idempotencyKey != "" || correlationID != "" ||
+			timings != nil || t.config.tracing() || t.config.modifiesAttempts() {
+			attempt = newAttempt(req, attemptCtx, body)
+		}
+		t.config.setDefaultHeaders(attempt)
+		if idempotencyKey != "" {
+			attempt.Header.Set(t.config.idempotencyHeader, idempotencyKey)
+		}
+		if correlationID != "" {
+			attempt.Header.Set(t.config.correlationHeader, correlationID)
+		}
+		if authorization != "" {
+			attempt.Header.Set("Authorization", authorization)
+		}
+		t.config.setRetryHeaders(attempt, retries+1, lastResp, lastErr)
+		t.config.setHeaderTemplates(attempt, false)
+		t.config.addCookies(attempt)
+		t.config.acceptEncoding(attempt)
+		if err := t.prepare(attempt, retries+1, getBody); err != nil {
+			if body != nil {
+				body.Close()
+			}
+			endSpan(span, nil, err)
+			return nil, err
+		}
+
+		attemptStart := t.config.clock.Now()
+		resp, err := t.sendAttempt(attempt, retries+1, getBody)
+		t.config.storeCookies(attempt, resp)
+		attemptEnd := t.config.clock.Now()
+		attempts = append(attempts, newAttemptRecord(attemptStart, attemptEnd, resp, err))
+		attempts[len(attempts)-1].Timings = timings.snapshot()
+		resp = rec.attempt(attempt, getBody, attempts[len(attempts)-1], retries+1, resp)
+		if ctx.Err() == nil {
+			t.config.latency.observe(req.URL.Host, attempts[len(attempts)-1].Duration, attemptEnd)
+		}
+		if herr := t.config.safely(func() { t.config.hooks.onResponse(attempt, resp, err, retries+1) }); herr != nil {
+			drainBody(resp)
+			endSpan(span, nil, herr)
+			return nil, herr
+		}
+
+		// The credentials were rejected, replay once with fresh ones without counting a retry
+		if !reauthorized && getBody != nil && t.config.reauthorizer.rejected(resp) {
+			reauthorized = true
+			if auth, rerr := t.config.reauthorizer.refresh(ctx); rerr == nil {
+				authorization = auth
+				endSpan(span, resp, err)
+				drainBody(resp)
+				retries--
+				continue
+			}
+		}
+		// The server does not take compressed bodies, send this one as it is
+		if compressed && resp != nil && resp.StatusCode == http.StatusUnsupportedMediaType {
+			t.config.requestCompression.reject(req.URL.Host)
+			req, getBody, compressed = uncompressed, uncompressedBody, false
+			endSpan(span, resp, err)
+			drainBody(resp)
+			retries--
+			continue
+		}
+
+		// Without retries configured, behave like a plain transport
+		if getBody == nil || t.config.maxRetries == 0 || (!t.config.mayResend(attempt) && !unsentTimeout(err)) ||
+			!t.shouldRetry(ctx, resp, err, retries+1) {
+			endSpan(span, resp, err)
+			return resp, err
+		}
+		if retries >= t.config.maxRetries {
+			endSpan(span, resp, err)
+			return t.giveUp(req, ErrMaxRetriesExceeded, attempts, resp)
+		}
+		if th := t.config.retryThrottle; th != nil && !th.Allow() {
+			endSpan(span, resp, err)
+			return t.giveUp(req, ErrRetryThrottled, attempts, resp)
+		}
+
+		// Wait for the specified backoff period, unless it would exhaust the time budget
+		delay = t.config.nextBackoff(req.URL.Host, retries, delay)
+		if wait, ok := retryAfter(resp, t.config.clock.Now()); ok && t.config.maxRetryAfter > 0 {
+			// The server told us when to come back, trust it within reason
+			if wait > t.config.maxRetryAfter {
+				wait = t.config.maxRetryAfter
+			}
+			delay = wait
+		}
+		if max := t.config.maxElapsedTime; max > 0 && t.config.clock.Now().Sub(attempts[0].Start)+delay > max {
+			endSpan(span, resp, err)
+			return t.giveUp(req, ErrMaxElapsedTimeExceeded, attempts, resp)
+		}
+		if t.config.wouldExceedDeadline(ctx, req.URL.Host, delay) {
+			endSpan(span, resp, err)
+			return t.giveUp(req, ErrDeadlineWouldExceed, attempts, resp)
+		}
+		attempts[len(attempts)-1].Backoff = delay
+		if herr := t.config.safely(func() { t.config.hooks.onRetry(attempt, resp, err, retries+1, delay) }); herr != nil {
+			drainBody(resp)
+			endSpan(span, nil, herr)
+			return nil, herr
+		}
+		t.config.metrics.Retry(metricLabels(attempt, resp))
+		endSpan(span, resp, err,
+			Attribute{Key: "retry.backoff_ms", Value: delay.Milliseconds()},
+			Attribute{Key: "retry.reason", Value: retryReason(resp, err)},
+		)
+
+		// We're going to retry, consume any response to reuse the connection.
+		drainBody(resp)
+		lastResp, lastErr = resp, err
+
+		if err := sleep(ctx, t.config.clock, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// prepare runs the BeforeAttemptFuncs, the signer and the OnRequest hooks on
+// an attempt about to be sent.
+func (t *retryableTransport) prepare(attempt *http.Request, n int, getBody BodyFunc) (err error) {
+	defer t.config.catchPanic(nil, &err)
+
+	if err := t.config.beforeAttempt(attempt, n); err != nil {
+		return err
+	}
+	if err := t.config.sign(attempt, getBody); err != nil {
+		return err
+	}
+	t.config.hooks.onRequest(attempt, n)
+
+	return nil
+}
+
+// sendAttempt sends one attempt, hedged if hedging is enabled and the request
+// can be sent more than once.
+func (t *retryableTransport) sendAttempt(req *http.Request, attempt int, getBody BodyFunc) (*http.Response, error) {
+	if t.config.maxHedges > 0 && t.config.hedgeDelay > 0 && getBody != nil && t.config.mayResend(req) {
+		return t.hedge(req, attempt, getBody)
+	}
+
+	return t.roundTrip(req, attempt)
+}
+
+// roundTrip sends a single attempt where the picker routes it, if any, and
+// tells the picker how it went.
+func (t *retryableTransport) roundTrip(req *http.Request, attempt int) (*http.Response, error) {
+	picked, err := t.config.pick(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.guardedRoundTrip(picked, attempt)
+	if p := t.config.picker; p != nil && picked.Context().Err() == nil {
+		p.Mark(picked.URL, !t.config.policy.ShouldRetry(resp, err, attempt))
+	}
+
+	return resp, err
+}
+
+// guardedRoundTrip sends a single attempt, after waiting for the rate limiter,
+// any limit learned from the host and a slot in its bulkhead, and guarded by
+// the circuit breaker if any.
+func (t *retryableTransport) guardedRoundTrip(req *http.Request, attempt int) (*http.Response, error) {
+	if t.config.limiter != nil {
+		if err := t.config.limiter(req.URL.Host).Wait(withClock(req.Context(), t.config.clock)); err != nil {
+			return nil, &permanentError{err: err}
+		}
+	}
+	if rl := t.config.rateLimits; rl != nil {
+		if err := rl.Wait(req.Context(), req.URL.Host); err != nil {
+			return nil, &permanentError{err: err}
+		}
+	}
+	if b := t.config.bulkhead; b != nil {
+		release, err := b.acquire(req.Context(), t.config.clock, req.URL.Host)
+		if err != nil {
+			return nil, &permanentError{err: err}
+		}
+		defer release()
+	}
+
+	cb := t.config.circuitBreaker
+	if cb == nil {
+		resp, err := t.limitedSend(req, attempt)
+		t.observe(req, resp, err, attempt)
+		return resp, err
+	}
+
+	host := req.URL.Host
+	if err := cb.allow(host, t.config.clock.Now()); err != nil {
+		t.config.metrics.CircuitState(host, CircuitOpen)
+		return nil, err
+	}
+
+	resp, err := t.limitedSend(req, attempt)
+	t.observe(req, resp, err, attempt)
+	if req.Context().Err() == nil {
+		cb.record(host, !t.config.policy.ShouldRetry(resp, err, attempt), t.config.clock.Now())
+	}
+	t.config.metrics.CircuitState(host, cb.State(host))
+
+	return resp, err
+}
+
+// limitedSend sends a single attempt within the adaptive concurrency limit of
+// its host, if any.
+func (t *retryableTransport) limitedSend(req *http.Request, attempt int) (*http.Response, error) {
+	l := t.config.concurrency
+	if l == nil {
+		return t.send(req)
+	}
+
+	done, err := l.acquire(req.URL.Host)
+	if err != nil {
+		return nil, &permanentError{err: err}
+	}
+	start := t.config.clock.Now()
+	resp, err := t.send(req)
+	done(!t.config.policy.ShouldRetry(resp, err, attempt), req.Context().Err() != nil, t.config.clock.Now().Sub(start))
+
+	return resp, err
+}
+
+// observe reports an attempt, learns the rate limits advertised by resp and
+// settles the attempt with the retry budget.
+func (t *retryableTransport) observe(req *http.Request, resp *http.Response, err error, attempt int) {
+	t.config.metrics.Attempt(metricLabels(req, resp))
+	if t.config.rateLimits != nil {
+		t.config.rateLimits.Observe(req.URL.Host, resp, t.config.maxRetryAfter)
+	}
+	if t.config.retryThrottle != nil && req.Context().Err() == nil {
+		t.config.retryThrottle.Record(!t.config.policy.ShouldRetry(resp, err, attempt))
+	}
+}
+
+// send performs one attempt, bounded by the per-attempt and body read
+// timeouts if any, and verifies, decompresses and validates its response.
+func (t *retryableTransport) send(req *http.Request) (resp *http.Response, err error) {
+	defer t.config.catchPanic(&resp, &err)
+
+	ctx := req.Context()
+	var cancel context.CancelFunc
+	switch {
+	case t.config.attemptTimeout > 0:
+		ctx, cancel = context.WithTimeout(ctx, t.config.attemptTimeout)
+	case t.config.bodyReadTimeout > 0:
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	if cancel == nil {
+		resp, err = t.transport.RoundTrip(req)
+	} else {
+		resp, err = t.transport.RoundTrip(req.WithContext(ctx))
+		if err == nil && t.config.bodyReadTimeout > 0 && resp.Body != nil && resp.Body != http.NoBody {
+			resp.Body = newIdleTimeoutBody(resp.Body, t.config.bodyReadTimeout, t.config.clock, cancel)
+		}
+		resp, err = cancelOnClose(resp, err, cancel)
+	}
+	if err != nil {
+		if certErr := certificateError(err); certErr != nil {
+			return nil, certErr
+		}
+		return nil, t.config.timeoutError(err)
+	}
+	if resp, err = t.config.limitResponse(resp); err != nil {
+		return nil, err
+	}
+	if resp, err = t.config.checkBody(resp); err != nil {
+		return nil, err
+	}
+	if resp, err = t.config.decompress(resp); err != nil {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return nil, &permanentError{err: err}
+		}
+		return nil, err
+	}
+	if len(t.config.validators) == 0 {
+		return resp, nil
+	}
+
+	return validate(resp, t.config.validators)
+}
+
+// modifiesAttempts tells whether anything may change the first attempt of a
+// request. If not, it is sent as is, without the cost of a copy.
+func (c *config) modifiesAttempts() bool {
+	return c.jar != nil || c.decoders != nil || c.signer != nil ||
+		len(c.before) > 0 || len(c.middleware) > 0 || len(c.defaultHeaders) > 0 ||
+		len(c.headerTemplates) > 0
+}
+
+// newAttempt clones req with ctx for a single attempt, leaving the caller's
+// request untouched.
+func newAttempt(req *http.Request, ctx context.Context, body io.ReadCloser) *http.Request {
+	attempt := req.Clone(ctx)
+	attempt.Body = body
+
+	return attempt
+}
+
+// giveUp releases the last response and reports why retrying stopped, or
+// hands over to the fallback.
+func (t *retryableTransport) giveUp(req *http.Request, reason error, attempts []Attempt, resp *http.Response) (*http.Response, error) {
+	drainBody(resp)
+
+	err := &RetryError{Reason: reason, Attempts: attempts}
+	t.config.hooks.onGiveUp(req, err)
+	t.config.metrics.GiveUp(metricLabels(req, resp))
+
+	if t.config.fallback != nil {
+		return t.config.fallback(req, err)
+	}
+
+	return nil, err
+}
+
+// CloseIdleConnections forwards to the wrapped transport, so
+// http.Client.CloseIdleConnections keeps working through the wrapper.
+func (t *retryableTransport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if ci, ok := t.transport.(closeIdler); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+// cancelBody releases a context once the response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
+
+// cancelOnClose ties cancel to the lifetime of resp, since the body is still
+// read after RoundTrip returns.
+func cancelOnClose(resp *http.Response, err error, cancel context.CancelFunc) (*http.Response, error) {
+	if err != nil || resp == nil || resp.Body == nil {
+		cancel()
+		return resp, err
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
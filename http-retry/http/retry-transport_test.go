@@ -0,0 +1,193 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newDrainServer answers every odd request a 503 with a body of size bytes,
+// and every even one a 200.
+func newDrainServer(tb testing.TB, size int) *httptest.Server {
+	body := bytes.Repeat([]byte("x"), size)
+	var n int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&n, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write(body)
+		}
+	}))
+	tb.Cleanup(srv.Close)
+
+	return srv
+}
+
+// countConnects returns ctx counting the connections opened into n.
+func countConnects(ctx context.Context, n *int64) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) { atomic.AddInt64(n, 1) },
+	})
+}
+
+func TestRetryDrainsBodiesForReuse(t *testing.T) {
+	tests := []struct {
+		name         string
+		size         int
+		wantConnects int64
+	}{
+		{name: "empty body", size: 0, wantConnects: 1},
+		{name: "under the drain cap", size: maxDrainBytes / 2, wantConnects: 1},
+		{name: "over the drain cap", size: 16 * maxDrainBytes, wantConnects: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newDrainServer(t, tt.size)
+			c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0))
+
+			var connects int64
+			ctx := countConnects(context.Background(), &connects)
+			for i := 0; i < 4; i++ {
+				status, _, err := c.GetBytes(ctx, srv.URL)
+				if err != nil || status != http.StatusOK {
+					t.Fatalf("request %d = %d, %v", i+1, status, err)
+				}
+			}
+			// Every request retried once: a connection kept makes a single
+			// one for all, else each retry needs a new one
+			if connects != tt.wantConnects {
+				t.Errorf("opened %d connections for 4 retried requests, want %d", connects, tt.wantConnects)
+			}
+		})
+	}
+}
+
+func BenchmarkRetryDrain(b *testing.B) {
+	sizes := []struct {
+		name string
+		size int
+	}{
+		{name: "under cap", size: maxDrainBytes / 2},
+		{name: "over cap", size: 16 * maxDrainBytes},
+	}
+	for _, size := range sizes {
+		b.Run(size.name, func(b *testing.B) {
+			srv := newDrainServer(b, size.size)
+			c := NewRetryableClient(WithBackoff(ConstantBackoff(0)), WithMaxRetryAfter(0))
+			var connects int64
+			ctx := countConnects(context.Background(), &connects)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := c.GetBytes(ctx, srv.URL); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(connects)/float64(b.N), "connects/op")
+		})
+	}
+}
+
+// idleTransport counts its round trips and idle connection closes.
+type idleTransport struct {
+	trips, closes int
+}
+
+func (t *idleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.trips++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (t *idleTransport) CloseIdleConnections() {
+	t.closes++
+}
+
+func TestNewRetryTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      *idleTransport
+		wantTrips int
+	}{
+		{name: "default base"},
+		{name: "custom base", base: &idleTransport{}, wantTrips: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, 503, 200)
+			var base http.RoundTripper
+			if tt.base != nil {
+				base = tt.base
+			}
+			c := &http.Client{Transport: NewRetryTransport(base, fastBackoff)}
+
+			resp, err := c.Get(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			drainBody(resp)
+			c.CloseIdleConnections()
+
+			if resp.StatusCode != http.StatusOK || srv.count() != 2 {
+				t.Errorf("status %d after %d requests, want 200 after 2", resp.StatusCode, srv.count())
+			}
+			if tt.base != nil && (tt.base.trips != tt.wantTrips || tt.base.closes != 1) {
+				t.Errorf("base saw %d round trips and %d closes, want %d and 1", tt.base.trips, tt.base.closes, tt.wantTrips)
+			}
+		})
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		// slow is how many requests the server stalls before answering.
+		slow         int32
+		wantErr      error
+		wantRequests int32
+	}{
+		{name: "attempt timeout retried", opts: []Option{WithAttemptTimeout(50 * time.Millisecond)}, slow: 1, wantRequests: 2},
+		{name: "request timeout", opts: []Option{WithTimeout(50 * time.Millisecond)}, slow: 100, wantErr: context.DeadlineExceeded, wantRequests: 1},
+		{name: "within both", opts: []Option{WithTimeout(time.Second), WithAttemptTimeout(time.Second)}, wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= tt.slow {
+					select {
+					case <-r.Context().Done():
+					case <-time.After(5 * time.Second):
+					}
+					return
+				}
+				w.Write([]byte("ok"))
+			}))
+			defer srv.Close()
+			c := NewRetryableClient(append([]Option{WithBackoff(ConstantBackoff(time.Millisecond))}, tt.opts...)...)
+
+			resp, err := c.Get(srv.URL)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				// The body outlives the attempt's context
+				body, err := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil || string(body) != "ok" {
+					t.Errorf("body = %q, %v", body, err)
+				}
+			}
+			if n := atomic.LoadInt32(&requests); n != tt.wantRequests {
+				t.Errorf("server received %d requests, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
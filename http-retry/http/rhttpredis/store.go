@@ -0,0 +1,242 @@
+// Package rhttpredis implements rhttp.StateStore on Redis, so the replicas of
+// a service share their circuit breakers and rate limits. It speaks the
+// Redis protocol itself and has no dependency.
+package rhttpredis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	rhttp "github.com/kdkumawat/golang/http-retry/http"
+)
+
+// DefaultPoolSize is how many idle connections a Store keeps.
+const DefaultPoolSize = 4
+
+// incrScript increments a counter and sets its expiry when it is created,
+// atomically.
+const incrScript = `local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if v == tonumber(ARGV[1]) then redis.call('PEXPIRE', KEYS[1], ARGV[2]) end
+return v`
+
+// Config describes the Redis server of a Store.
+type Config struct {
+	// Addr is the host:port of the server.
+	Addr     string
+	Password string
+	DB       int
+	// PoolSize is how many idle connections are kept, DefaultPoolSize if
+	// zero.
+	PoolSize int
+}
+
+// Store is an rhttp.StateStore on a Redis server:
+//
+//	store := rhttpredis.New(rhttpredis.Config{Addr: "redis:6379"})
+//	breaker := rhttp.NewSharedCircuitBreaker(rhttp.DefaultCircuitSettings, store, "payments:")
+type Store struct {
+	cfg    Config
+	dialer net.Dialer
+	idle   chan *conn
+}
+
+var _ rhttp.StateStore = (*Store)(nil)
+
+// New returns a store connecting to the server on demand.
+func New(cfg Config) *Store {
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = DefaultPoolSize
+	}
+
+	return &Store{cfg: cfg, idle: make(chan *conn, cfg.PoolSize)}
+}
+
+// Error is an error reply from the server.
+type Error string
+
+func (e Error) Error() string { return "rhttpredis: " + string(e) }
+
+func (s *Store) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	reply, err := s.do(ctx, "EVAL", incrScript, "1", key, strconv.FormatInt(delta, 10), strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("rhttpredis: unexpected reply %v to EVAL", reply)
+	}
+
+	return n, nil
+}
+
+func (s *Store) Get(ctx context.Context, key string) (string, bool, error) {
+	reply, err := s.do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return "", false, err
+	}
+	v, ok := reply.(string)
+	if !ok {
+		return "", false, fmt.Errorf("rhttpredis: unexpected reply %v to GET", reply)
+	}
+
+	return v, true, nil
+}
+
+func (s *Store) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := s.do(ctx, args...)
+
+	return err
+}
+
+func (s *Store) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := s.do(ctx, append([]string{"DEL"}, keys...)...)
+
+	return err
+}
+
+// Close closes the idle connections.
+func (s *Store) Close() error {
+	for {
+		select {
+		case c := <-s.idle:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command and returns its reply: nil, a string, an int64 or a
+// []interface{} of those.
+func (s *Store) do(ctx context.Context, args ...string) (interface{}, error) {
+	c, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(ctx, args)
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection is in an unknown state
+		c.Close()
+		return nil, err
+	}
+	s.put(c)
+
+	return reply, err
+}
+
+func (s *Store) get(ctx context.Context) (*conn, error) {
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+	}
+
+	nc, err := s.dialer.DialContext(ctx, "tcp", s.cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if s.cfg.Password != "" {
+		if _, err := c.do(ctx, []string{"AUTH", s.cfg.Password}); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if s.cfg.DB != 0 {
+		if _, err := c.do(ctx, []string{"SELECT", strconv.Itoa(s.cfg.DB)}); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (s *Store) put(c *conn) {
+	select {
+	case s.idle <- c:
+	default:
+		c.Close()
+	}
+}
+
+// conn is a connection to the server, used by one command at a time.
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (c *conn) do(ctx context.Context, args []string) (interface{}, error) {
+	deadline, _ := ctx.Deadline()
+	c.SetDeadline(deadline)
+
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return c.read()
+}
+
+// read reads one reply in the Redis serialization protocol.
+func (c *conn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("rhttpredis: malformed reply")
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, Error(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("rhttpredis: unknown reply type %q", kind)
+	}
+}
@@ -0,0 +1,391 @@
+package rhttpredis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer speaks enough of the Redis protocol for a Store.
+type fakeServer struct {
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	values   map[string]string
+	ttls     map[string]time.Duration
+	commands [][]string
+	accepted int
+}
+
+func newFakeServer(t *testing.T, password string) *fakeServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln, password: password, values: make(map[string]string), ttls: make(map[string]time.Duration)}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+
+	return s
+}
+
+func (s *fakeServer) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.accepted++
+		s.mu.Unlock()
+		go s.handle(c)
+	}
+}
+
+func (s *fakeServer) handle(c net.Conn) {
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	authed := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+		s.mu.Unlock()
+
+		if args[0] == "AUTH" {
+			if args[1] != s.password {
+				c.Write([]byte("-WRONGPASS invalid password\r\n"))
+				continue
+			}
+			authed = true
+			c.Write([]byte("+OK\r\n"))
+			continue
+		}
+		if !authed {
+			c.Write([]byte("-NOAUTH Authentication required.\r\n"))
+			continue
+		}
+		c.Write([]byte(s.reply(args)))
+	}
+}
+
+func (s *fakeServer) reply(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch args[0] {
+	case "SELECT":
+		return "+OK\r\n"
+	case "EVAL":
+		key := args[3]
+		delta, _ := strconv.ParseInt(args[4], 10, 64)
+		n, _ := strconv.ParseInt(s.values[key], 10, 64)
+		n += delta
+		s.values[key] = strconv.FormatInt(n, 10)
+		if n == delta {
+			ms, _ := strconv.ParseInt(args[5], 10, 64)
+			s.ttls[key] = time.Duration(ms) * time.Millisecond
+		}
+		return ":" + strconv.FormatInt(n, 10) + "\r\n"
+	case "GET":
+		v, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+	case "SET":
+		s.values[args[1]] = args[2]
+		delete(s.ttls, args[1])
+		if len(args) == 5 && args[3] == "PX" {
+			ms, _ := strconv.ParseInt(args[4], 10, 64)
+			s.ttls[args[1]] = time.Duration(ms) * time.Millisecond
+		}
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := s.values[key]; ok {
+				n++
+			}
+			delete(s.values, key)
+			delete(s.ttls, key)
+		}
+		return ":" + strconv.Itoa(n) + "\r\n"
+	case "BROKEN":
+		return "?\r\n"
+	default:
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || line[0] != '*' {
+		return nil, errors.New("not an array")
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+
+	return args, nil
+}
+
+func (s *fakeServer) ttl(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ttls[key]
+}
+
+func (s *fakeServer) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accepted
+}
+
+func (s *fakeServer) sent() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([][]string(nil), s.commands...)
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		// run calls the store, returning what the test checks.
+		run  func(t *testing.T, s *Store, srv *fakeServer) interface{}
+		want interface{}
+	}{
+		{
+			name: "counter",
+			run: func(t *testing.T, s *Store, srv *fakeServer) interface{} {
+				var got []int64
+				for _, delta := range []int64{1, 1, 5} {
+					n, err := s.Incr(ctx, "c", delta, 2*time.Second)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got = append(got, n)
+				}
+				if ttl := srv.ttl("c"); ttl != 2*time.Second {
+					t.Errorf("counter expires after %v, want 2s", ttl)
+				}
+				return got
+			},
+			want: []int64{1, 2, 7},
+		},
+		{
+			name: "set and get",
+			run: func(t *testing.T, s *Store, srv *fakeServer) interface{} {
+				if err := s.Set(ctx, "k", "value with spaces", time.Minute); err != nil {
+					t.Fatal(err)
+				}
+				if ttl := srv.ttl("k"); ttl != time.Minute {
+					t.Errorf("value expires after %v, want 1m", ttl)
+				}
+				v, ok, err := s.Get(ctx, "k")
+				if err != nil || !ok {
+					t.Fatalf("Get() = %q, %v, %v", v, ok, err)
+				}
+				return v
+			},
+			want: "value with spaces",
+		},
+		{
+			name: "set without expiry",
+			run: func(t *testing.T, s *Store, srv *fakeServer) interface{} {
+				s.Set(ctx, "k", "v", 0)
+				return srv.sent()[0]
+			},
+			want: []string{"SET", "k", "v"},
+		},
+		{
+			name: "missing",
+			run: func(t *testing.T, s *Store, srv *fakeServer) interface{} {
+				v, ok, err := s.Get(ctx, "missing")
+				if err != nil || ok {
+					t.Errorf("Get() = %q, %v, %v, want nothing", v, ok, err)
+				}
+				return v
+			},
+			want: "",
+		},
+		{
+			name: "delete",
+			run: func(t *testing.T, s *Store, srv *fakeServer) interface{} {
+				s.Set(ctx, "a", "1", 0)
+				s.Set(ctx, "b", "2", 0)
+				if err := s.Delete(ctx, "a", "b"); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.Delete(ctx); err != nil {
+					t.Fatal(err)
+				}
+				_, ok, _ := s.Get(ctx, "a")
+				return ok
+			},
+			want: false,
+		},
+		{
+			name: "connection reused",
+			run: func(t *testing.T, s *Store, srv *fakeServer) interface{} {
+				for i := 0; i < 5; i++ {
+					s.Get(ctx, "k")
+				}
+				return srv.connections()
+			},
+			want: 1,
+		},
+		{
+			name: "error reply keeps the connection",
+			run: func(t *testing.T, s *Store, srv *fakeServer) interface{} {
+				_, err := s.do(ctx, "NOPE")
+				var replyErr Error
+				if !errors.As(err, &replyErr) || err.Error() != "rhttpredis: ERR unknown command 'NOPE'" {
+					t.Errorf("do() error = %v, want an error reply", err)
+				}
+				s.Get(ctx, "k")
+				return srv.connections()
+			},
+			want: 1,
+		},
+		{
+			name: "broken connection dropped",
+			run: func(t *testing.T, s *Store, srv *fakeServer) interface{} {
+				if _, err := s.do(ctx, "BROKEN"); err == nil {
+					t.Error("malformed reply accepted")
+				}
+				s.Get(ctx, "k")
+				return srv.connections()
+			},
+			want: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeServer(t, "")
+			s := New(Config{Addr: srv.ln.Addr().String()})
+			defer s.Close()
+
+			if got := tt.run(t, s, srv); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreConnect(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		wantErr  string
+		wantSent [][]string
+	}{
+		{name: "authenticated", cfg: Config{Password: "secret"}, wantSent: [][]string{{"AUTH", "secret"}, {"GET", "k"}}},
+		{name: "wrong password", cfg: Config{Password: "wrong"}, wantErr: "rhttpredis: WRONGPASS invalid password", wantSent: [][]string{{"AUTH", "wrong"}}},
+		{name: "no password", wantErr: "rhttpredis: NOAUTH Authentication required.", wantSent: [][]string{{"GET", "k"}}},
+		{name: "database", cfg: Config{Password: "secret", DB: 2}, wantSent: [][]string{{"AUTH", "secret"}, {"SELECT", "2"}, {"GET", "k"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeServer(t, "secret")
+			tt.cfg.Addr = srv.ln.Addr().String()
+			s := New(tt.cfg)
+			defer s.Close()
+
+			_, _, err := s.Get(context.Background(), "k")
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("Get() error = %v, want %q", err, tt.wantErr)
+			}
+			if got := srv.sent(); !reflect.DeepEqual(got, tt.wantSent) {
+				t.Errorf("sent %q, want %q", got, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestStoreUnreachable(t *testing.T) {
+	s := New(Config{Addr: "127.0.0.1:1"})
+	if _, err := s.Incr(context.Background(), "c", 1, time.Second); err == nil {
+		t.Error("Incr() succeeded without a server")
+	}
+}
+
+func TestStorePoolSize(t *testing.T) {
+	if got := cap(New(Config{}).idle); got != DefaultPoolSize {
+		t.Errorf("pool of %d connections, want %d", got, DefaultPoolSize)
+	}
+	if got := cap(New(Config{PoolSize: 1}).idle); got != 1 {
+		t.Errorf("pool of %d connections, want 1", got)
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "simple string", reply: "+OK\r\n", want: "OK"},
+		{name: "error", reply: "-ERR boom\r\n", wantErr: true},
+		{name: "integer", reply: ":-42\r\n", want: int64(-42)},
+		{name: "bulk string", reply: "$5\r\nab\r\nc\r\n", want: "ab\r\nc"},
+		{name: "empty bulk string", reply: "$0\r\n\r\n", want: ""},
+		{name: "nil", reply: "$-1\r\n", want: nil},
+		{name: "array", reply: "*3\r\n:1\r\n$1\r\nx\r\n$-1\r\n", want: []interface{}{int64(1), "x", nil}},
+		{name: "nil array", reply: "*-1\r\n", want: nil},
+		{name: "truncated bulk string", reply: "$5\r\nab", wantErr: true},
+		{name: "no CRLF", reply: "+OK\n", wantErr: true},
+		{name: "unknown type", reply: "%2\r\n", wantErr: true},
+		{name: "bad integer", reply: ":x\r\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &conn{r: bufio.NewReader(strings.NewReader(tt.reply))}
+			got, err := c.read()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("read() error = %v, want an error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Package rhttptest provides helpers for testing code built on the retryable
+// HTTP client.
+package rhttptest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	rhttp "github.com/kdkumawat/golang/http-retry/http"
+)
+
+// FakeClock is a Clock whose time only moves when told to, so retry behavior
+// can be tested instantly and deterministically:
+//
+//	clock := rhttptest.NewFakeClock(time.Now())
+//	client := rhttp.NewRetryableClient(rhttp.WithClock(clock))
+//	go client.Get(url)
+//	clock.BlockUntil(1) // the client is waiting for its first backoff
+//	clock.Advance(time.Second)
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	auto    bool
+	waiters []waiter
+}
+
+type waiter struct {
+	until time.Time
+	c     chan time.Time
+}
+
+// The waits of cancelled requests are released, so they do not count in
+// Waiters.
+var _ rhttp.TimerClock = (*FakeClock)(nil)
+
+// NewFakeClock returns a clock stopped at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+
+	return c
+}
+
+// NewAutoClock returns a clock that never blocks: every wait moves it forward
+// by the requested duration and fires at once. It suits tests checking what
+// the client does rather than when.
+func NewAutoClock(now time.Time) *FakeClock {
+	c := NewFakeClock(now)
+	c.auto = true
+
+	return c
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// After returns a channel receiving the clock's time once it has been
+// advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if c.auto && d > 0 {
+		c.now = c.now.Add(d)
+	}
+	if d <= 0 || c.auto {
+		ch <- c.now
+		return ch
+	}
+
+	c.waiters = append(c.waiters, waiter{until: c.now.Add(d), c: ch})
+	c.cond.Broadcast()
+
+	return ch
+}
+
+// Timer is After with a function stopping the wait, reporting whether it was
+// still pending.
+func (c *FakeClock) Timer(d time.Duration) (<-chan time.Time, func() bool) {
+	ch := c.After(d)
+
+	return ch, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		for i, w := range c.waiters {
+			if w.c == ch {
+				c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+				c.cond.Broadcast()
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Sleep blocks until the clock has been advanced by d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Advance moves the clock forward by d, firing every wait that has elapsed in
+// order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].until.Before(c.waiters[j].until)
+	})
+
+	n := 0
+	for n < len(c.waiters) && !c.waiters[n].until.After(c.now) {
+		c.waiters[n].c <- c.now
+		n++
+	}
+	c.waiters = append(c.waiters[:0], c.waiters[n:]...)
+	c.cond.Broadcast()
+}
+
+// Waiters returns how many waits are pending.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.waiters)
+}
+
+// BlockUntil blocks until at least n waits are pending, e.g. until the client
+// is sleeping between two attempts.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
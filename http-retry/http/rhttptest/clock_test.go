@@ -0,0 +1,102 @@
+package rhttptest
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func fired(c <-chan time.Time) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeClockAdvance(t *testing.T) {
+	tests := []struct {
+		name      string
+		waits     []time.Duration
+		advance   time.Duration
+		wantFired []bool
+	}{
+		{name: "nothing due", waits: []time.Duration{time.Second}, advance: time.Millisecond, wantFired: []bool{false}},
+		{name: "exactly due", waits: []time.Duration{time.Second}, advance: time.Second, wantFired: []bool{true}},
+		{name: "some due", waits: []time.Duration{3 * time.Second, time.Second, 2 * time.Second}, advance: 2 * time.Second, wantFired: []bool{false, true, true}},
+		{name: "zero wait", waits: []time.Duration{0, -time.Second}, wantFired: []bool{true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewFakeClock(epoch)
+			chans := make([]<-chan time.Time, len(tt.waits))
+			for i, d := range tt.waits {
+				chans[i] = c.After(d)
+			}
+			c.Advance(tt.advance)
+
+			pending := 0
+			for i, ch := range chans {
+				if got := fired(ch); got != tt.wantFired[i] {
+					t.Errorf("wait %d for %v fired = %v, want %v", i, tt.waits[i], got, tt.wantFired[i])
+				}
+				if !tt.wantFired[i] {
+					pending++
+				}
+			}
+			if c.Waiters() != pending {
+				t.Errorf("Waiters() = %d, want %d", c.Waiters(), pending)
+			}
+			if got := c.Now(); !got.Equal(epoch.Add(tt.advance)) {
+				t.Errorf("Now() = %v, want %v", got, epoch.Add(tt.advance))
+			}
+		})
+	}
+}
+
+func TestFakeClockTimerStop(t *testing.T) {
+	c := NewFakeClock(epoch)
+	ch, stop := c.Timer(time.Second)
+	if c.Waiters() != 1 {
+		t.Fatalf("Waiters() = %d, want 1", c.Waiters())
+	}
+	if !stop() {
+		t.Error("stop() of a pending wait = false")
+	}
+	if stop() {
+		t.Error("stop() twice = true")
+	}
+	c.Advance(time.Hour)
+	if fired(ch) || c.Waiters() != 0 {
+		t.Errorf("a stopped wait fired or is still pending, Waiters() = %d", c.Waiters())
+	}
+}
+
+func TestFakeClockBlockUntil(t *testing.T) {
+	c := NewFakeClock(epoch)
+	done := make(chan struct{})
+	go func() {
+		c.Sleep(time.Minute)
+		close(done)
+	}()
+
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sleep did not return once the clock was advanced")
+	}
+}
+
+func TestAutoClock(t *testing.T) {
+	c := NewAutoClock(epoch)
+	if !fired(c.After(time.Hour)) || c.Waiters() != 0 {
+		t.Error("an auto clock made a wait block")
+	}
+	if got := c.Now(); !got.Equal(epoch.Add(time.Hour)) {
+		t.Errorf("Now() = %v, want an hour later", got)
+	}
+}
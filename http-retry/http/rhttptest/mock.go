@@ -0,0 +1,212 @@
+package rhttptest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	rhttp "github.com/kdkumawat/golang/http-retry/http"
+)
+
+// Mock answers requests from per-route scripts without any network. It is a
+// rhttp.RetryableDoer, for unit testing code that takes one, and an
+// http.RoundTripper, to run the real retry logic without real sleeps:
+//
+//	mock := rhttptest.NewMock()
+//	mock.On("GET", "/users/1").Respond(503).Then(200).Body(`{"id":1}`)
+//	client := rhttp.NewRetryableClient(
+//		rhttp.WithTransport(mock),
+//		rhttp.WithClock(rhttptest.NewAutoClock(time.Now())),
+//	)
+//
+// Scripts behave like a Server's. A request matching no route gets a 404.
+type Mock struct {
+	mu       sync.Mutex
+	routes   []*Route
+	requests []Request
+}
+
+// Route is the script answering the requests matching a method and URL.
+type Route struct {
+	mock   *Mock
+	method string
+	url    string
+	steps  []*Step
+	served int
+}
+
+var _ rhttp.RetryableDoer = (*Mock)(nil)
+
+// NewMock returns a mock without routes.
+func NewMock() *Mock {
+	return &Mock{}
+}
+
+// On adds a route for method and url, tried in the order routes were added.
+// An empty method matches any method. A url starting with "/" matches the
+// request path, and the query too if it has one; otherwise it must match the
+// whole URL.
+func (m *Mock) On(method, url string) *Route {
+	r := &Route{mock: m, method: method, url: url}
+
+	m.mu.Lock()
+	m.routes = append(m.routes, r)
+	m.mu.Unlock()
+
+	return r
+}
+
+// Respond appends a step answering status to the route's script.
+func (r *Route) Respond(status int) *Step {
+	step := newStep(&r.mock.mu, r.Respond, status)
+
+	r.mock.mu.Lock()
+	r.steps = append(r.steps, step)
+	r.mock.mu.Unlock()
+
+	return step
+}
+
+func (r *Route) matches(req *http.Request) bool {
+	if r.method != "" && !strings.EqualFold(r.method, req.Method) {
+		return false
+	}
+	if !strings.HasPrefix(r.url, "/") {
+		u := *req.URL
+		u.Fragment = ""
+		return r.url == u.String()
+	}
+	if strings.Contains(r.url, "?") {
+		return r.url == req.URL.RequestURI()
+	}
+
+	return r.url == req.URL.Path
+}
+
+// Requests returns the requests received so far, in order.
+func (m *Mock) Requests() []Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Request(nil), m.requests...)
+}
+
+// RequestCount returns how many requests were received so far.
+func (m *Mock) RequestCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.requests)
+}
+
+// Reset removes every route and clears the received requests.
+func (m *Mock) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.routes, m.requests = nil, nil
+}
+
+// Do answers req like RoundTrip. opts are ignored.
+func (m *Mock) Do(ctx context.Context, req *http.Request, opts ...rhttp.Option) (*http.Response, error) {
+	return m.RoundTrip(req.WithContext(ctx))
+}
+
+// RoundTrip records req and answers it from the first matching route.
+func (m *Mock) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+	}
+
+	route, step := m.next(req, Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+		Body:   body,
+	})
+	if route == nil {
+		return response(req, http.StatusNotFound, nil,
+			[]byte(fmt.Sprintf("rhttptest: no route for %s %s", req.Method, req.URL)), -1), nil
+	}
+	if step == nil {
+		return response(req, http.StatusOK, nil, nil, -1), nil
+	}
+
+	if step.delay > 0 {
+		timer := time.NewTimer(step.delay)
+		defer timer.Stop()
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	if step.drop {
+		return nil, &net.OpError{
+			Op:  "read",
+			Net: "tcp",
+			Err: os.NewSyscallError("read", syscall.ECONNRESET),
+		}
+	}
+
+	return response(req, step.status, step.header, step.body, step.dropAfter), nil
+}
+
+// next records req and returns the route and step answering it. The step is
+// nil for a route with an empty script.
+func (m *Mock) next(req *http.Request, rec Request) (*Route, *Step) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests = append(m.requests, rec)
+	for _, r := range m.routes {
+		if r.matches(req) {
+			n := r.served
+			r.served++
+			return r, pick(r.steps, n)
+		}
+	}
+
+	return nil, nil
+}
+
+// response builds the response to req. With dropAfter in range the body is
+// cut after dropAfter bytes, failing with io.ErrUnexpectedEOF.
+func response(req *http.Request, status int, header http.Header, body []byte, dropAfter int) *http.Response {
+	h := header.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+
+	var r io.Reader = strings.NewReader(string(body))
+	if dropAfter >= 0 && dropAfter < len(body) {
+		r = io.MultiReader(strings.NewReader(string(body[:dropAfter])), errReader{io.ErrUnexpectedEOF})
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          ioutil.NopCloser(r),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
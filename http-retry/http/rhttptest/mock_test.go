@@ -0,0 +1,182 @@
+package rhttptest_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	rhttp "github.com/kdkumawat/golang/http-retry/http"
+	"github.com/kdkumawat/golang/http-retry/http/rhttptest"
+)
+
+func TestMockRoutes(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		wantStatus int
+	}{
+		{name: "path", method: http.MethodGet, url: "http://api.test/users/1", wantStatus: 200},
+		{name: "path ignores the query", method: http.MethodGet, url: "http://api.test/users/1?fields=id", wantStatus: 200},
+		{name: "method case", method: "get", url: "http://api.test/users/1", wantStatus: 200},
+		{name: "other method", method: http.MethodDelete, url: "http://api.test/users/1", wantStatus: 404},
+		{name: "query", method: http.MethodGet, url: "http://api.test/search?q=go", wantStatus: 201},
+		{name: "other query", method: http.MethodGet, url: "http://api.test/search?q=rust", wantStatus: 404},
+		{name: "full URL", method: http.MethodPost, url: "http://other.test/hook", wantStatus: 202},
+		{name: "full URL without fragment", method: http.MethodPost, url: "http://other.test/hook#top", wantStatus: 202},
+		{name: "full URL of another host", method: http.MethodPost, url: "http://api.test/hook", wantStatus: 203},
+		{name: "any method", method: http.MethodPatch, url: "http://api.test/hook", wantStatus: 203},
+		{name: "no route", method: http.MethodGet, url: "http://api.test/missing", wantStatus: 404},
+	}
+	mock := rhttptest.NewMock()
+	mock.On(http.MethodGet, "/users/1").Respond(200)
+	mock.On(http.MethodGet, "/search?q=go").Respond(201)
+	mock.On(http.MethodPost, "http://other.test/hook").Respond(202)
+	mock.On("", "/hook").Respond(203)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.url, nil)
+			resp, err := mock.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip() error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestMockDrivesRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		script       func(*rhttptest.Route)
+		wantStatus   int
+		wantBody     string
+		wantErr      string
+		wantRequests int
+	}{
+		{
+			name:         "empty script",
+			script:       func(*rhttptest.Route) {},
+			wantStatus:   http.StatusOK,
+			wantRequests: 1,
+		},
+		{
+			name:         "503 then 200",
+			script:       func(r *rhttptest.Route) { r.Respond(503).Then(200).Body(`{"id":1}`) },
+			wantStatus:   http.StatusOK,
+			wantBody:     `{"id":1}`,
+			wantRequests: 2,
+		},
+		{
+			name:         "header",
+			script:       func(r *rhttptest.Route) { r.Respond(429).Header("Retry-After", "1").Then(200) },
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		},
+		{
+			name:         "connection dropped",
+			script:       func(r *rhttptest.Route) { r.Respond(200).DropConnection().Then(200).Body("ok") },
+			wantStatus:   http.StatusOK,
+			wantBody:     "ok",
+			wantRequests: 2,
+		},
+		{
+			name:         "delay",
+			script:       func(r *rhttptest.Route) { r.Respond(200).Delay(5 * time.Millisecond).Body("late") },
+			wantStatus:   http.StatusOK,
+			wantBody:     "late",
+			wantRequests: 1,
+		},
+		{
+			name:         "body cut short",
+			script:       func(r *rhttptest.Route) { r.Respond(200).Body("truncated").DropAfter(3) },
+			wantErr:      "unexpected EOF",
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := rhttptest.NewMock()
+			tt.script(mock.On(http.MethodGet, "/users/1"))
+			c := rhttp.NewRetryableClient(
+				rhttp.WithTransport(mock),
+				rhttp.WithClock(rhttptest.NewAutoClock(time.Now())),
+			)
+
+			status, body, err := c.GetBytes(context.Background(), "http://api.test/users/1")
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("GetBytes() error = %v, want %q", err, tt.wantErr)
+				}
+			case err != nil || status != tt.wantStatus || string(body) != tt.wantBody:
+				t.Errorf("GetBytes() = %d, %q, %v, want %d, %q", status, body, err, tt.wantStatus, tt.wantBody)
+			}
+			if got := mock.RequestCount(); got != tt.wantRequests {
+				t.Errorf("mock received %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestMockDo(t *testing.T) {
+	mock := rhttptest.NewMock()
+	mock.On(http.MethodGet, "/slow").Respond(200).Delay(time.Hour)
+	var doer rhttp.RetryableDoer = mock
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequest(http.MethodGet, "http://api.test/slow", nil)
+	if _, err := doer.Do(ctx, req); err != context.Canceled {
+		t.Errorf("Do() error = %v, want %v", err, context.Canceled)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "http://api.test/missing", nil)
+	resp, err := doer.Do(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || string(body) != "rhttptest: no route for GET http://api.test/missing" {
+		t.Errorf("Do() = %d, %q", resp.StatusCode, body)
+	}
+}
+
+func TestMockRecordsRequests(t *testing.T) {
+	mock := rhttptest.NewMock()
+	mock.On(http.MethodPut, "/items/1").Respond(503).Then(200)
+
+	c := rhttp.NewRetryableClient(rhttp.WithTransport(mock), rhttp.WithClock(rhttptest.NewAutoClock(time.Now())))
+	resp, err := c.PutContext(context.Background(), "http://api.test/items/1", "text/plain", "payload")
+	if err != nil {
+		t.Fatalf("PutContext() error = %v", err)
+	}
+	resp.Body.Close()
+
+	requests := mock.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("mock received %d requests, want 2", len(requests))
+	}
+	for i, req := range requests {
+		if req.Method != http.MethodPut || req.URL != "http://api.test/items/1" || string(req.Body) != "payload" ||
+			req.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("request %d = %s %s %q %v", i+1, req.Method, req.URL, req.Body, req.Header)
+		}
+	}
+
+	mock.Reset()
+	if mock.RequestCount() != 0 {
+		t.Errorf("RequestCount() after Reset = %d", mock.RequestCount())
+	}
+	req, _ := http.NewRequest(http.MethodPut, "http://api.test/items/1", nil)
+	if resp, _ := mock.RoundTrip(req); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("route kept by Reset, status = %d", resp.StatusCode)
+	}
+}
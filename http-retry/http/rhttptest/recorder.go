@@ -0,0 +1,262 @@
+package rhttptest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// Mode selects whether a Recorder talks to the network.
+type Mode int
+
+const (
+	// ModeReplay serves recorded interactions and never touches the network.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests for real and records the interactions.
+	ModeRecord
+	// ModeAuto replays the cassette if it exists and records it otherwise.
+	ModeAuto
+)
+
+// DefaultRedactedHeaders are the headers a Recorder masks in the cassette.
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+const redacted = "REDACTED"
+
+// Recorder is a transport recording interactions to a cassette file and
+// replaying them, so tests of code using the client run without network:
+//
+//	rec, err := rhttptest.NewRecorder("testdata/users.json", rhttptest.ModeReplay)
+//	...
+//	defer rec.Close()
+//	client := rhttp.NewRetryableClient(rhttp.WithTransport(rec))
+//
+// Transport errors are recorded too, so retries replay as they happened.
+type Recorder struct {
+	// Transport sends the requests in ModeRecord, http.DefaultTransport if nil.
+	Transport http.RoundTripper
+	// RedactHeaders are masked in the cassette, DefaultRedactedHeaders by
+	// default.
+	RedactHeaders []string
+
+	path string
+	mode Mode
+
+	mu           sync.Mutex
+	interactions []*interaction
+	used         []bool
+}
+
+type interaction struct {
+	Request  recordedRequest   `json:"request"`
+	Response *recordedResponse `json:"response,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+type recordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   body        `json:"body,omitempty"`
+}
+
+type recordedResponse struct {
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       body        `json:"body,omitempty"`
+}
+
+// body is stored as text when it is valid UTF-8 and in base64 otherwise.
+type body []byte
+
+func (b body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+func (b *body) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = body(text)
+		return nil
+	}
+
+	var encoded struct {
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded.Base64)
+	*b = decoded
+
+	return err
+}
+
+// NewRecorder returns a recorder using the cassette at path. In ModeReplay
+// the cassette must exist; in ModeRecord it is written by Close.
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	if mode == ModeAuto {
+		mode = ModeRecord
+		if exists(path) {
+			mode = ModeReplay
+		}
+	}
+
+	r := &Recorder{path: path, mode: mode, RedactHeaders: DefaultRedactedHeaders}
+	if mode == ModeRecord {
+		return r, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &r.interactions); err != nil {
+		return nil, fmt.Errorf("rhttptest: reading cassette %s: %w", path, err)
+	}
+	r.used = make([]bool, len(r.interactions))
+
+	return r, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req)
+	}
+
+	return r.record(req, reqBody)
+}
+
+// replay serves the first unused interaction recorded for the method and URL
+// of req.
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, in := range r.interactions {
+		if r.used[i] || in.Request.Method != req.Method || in.Request.URL != req.URL.String() {
+			continue
+		}
+		r.used[i] = true
+
+		if in.Response == nil {
+			return nil, errors.New(in.Error)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          ioutil.NopCloser(bytes.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("rhttptest: no recorded interaction left for %s %s", req.Method, req.URL)
+}
+
+func (r *Recorder) record(req *http.Request, reqBody []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	in := &interaction{Request: recordedRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: r.redact(req.Header),
+		Body:   reqBody,
+	}}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		in.Error = err.Error()
+	} else {
+		respBody, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+		in.Response = &recordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     r.redact(resp.Header),
+			Body:       respBody,
+		}
+	}
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, in)
+	r.mu.Unlock()
+
+	return resp, err
+}
+
+// Close writes the cassette in ModeRecord.
+func (r *Recorder) Close() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, append(data, '\n'), 0o644)
+}
+
+func (r *Recorder) redact(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range r.RedactHeaders {
+		if _, ok := h[http.CanonicalHeaderKey(name)]; ok {
+			h.Set(name, redacted)
+		}
+	}
+
+	return h
+}
+
+// readBody reads the request body and puts it back for the real transport.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	return data, nil
+}
+
+// exists reports whether the cassette at path exists.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
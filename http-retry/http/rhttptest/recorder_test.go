@@ -0,0 +1,199 @@
+package rhttptest_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rhttp "github.com/kdkumawat/golang/http-retry/http"
+	"github.com/kdkumawat/golang/http-retry/http/rhttptest"
+)
+
+func TestRecorderRecordAndReplay(t *testing.T) {
+	tests := []struct {
+		name   string
+		script func(*rhttptest.Server)
+		// paths are fetched in order, once recorded and once replayed.
+		paths      []string
+		wantStatus []int
+		wantBody   []string
+	}{
+		{
+			name:       "single",
+			script:     func(s *rhttptest.Server) { s.Respond(200).Body("hello") },
+			paths:      []string{"/a"},
+			wantStatus: []int{200},
+			wantBody:   []string{"hello"},
+		},
+		{
+			name:       "retries replayed in order",
+			script:     func(s *rhttptest.Server) { s.Respond(503).Then(200).Body("ok") },
+			paths:      []string{"/a"},
+			wantStatus: []int{200},
+			wantBody:   []string{"ok"},
+		},
+		{
+			name:       "binary body",
+			script:     func(s *rhttptest.Server) { s.Respond(200).Body("\xff\xfe\x00") },
+			paths:      []string{"/a"},
+			wantStatus: []int{200},
+			wantBody:   []string{"\xff\xfe\x00"},
+		},
+		{
+			name:       "several requests",
+			script:     func(s *rhttptest.Server) { s.Respond(200).Body("1").Then(404).Body("2") },
+			paths:      []string{"/a", "/b"},
+			wantStatus: []int{200, 404},
+			wantBody:   []string{"1", "2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := rhttptest.NewServer()
+			defer srv.Close()
+			tt.script(srv)
+			cassette := filepath.Join(t.TempDir(), "cassette.json")
+
+			fetch := func(rec *rhttptest.Recorder) {
+				t.Helper()
+				c := rhttp.NewRetryableClient(rhttp.WithTransport(rec), rhttp.WithClock(rhttptest.NewAutoClock(time.Now())))
+				for i, path := range tt.paths {
+					status, body, err := c.GetBytes(context.Background(), srv.URL+path)
+					if err != nil || status != tt.wantStatus[i] || string(body) != tt.wantBody[i] {
+						t.Errorf("GetBytes(%s) = %d, %q, %v, want %d, %q", path, status, body, err, tt.wantStatus[i], tt.wantBody[i])
+					}
+				}
+			}
+
+			rec, err := rhttptest.NewRecorder(cassette, rhttptest.ModeAuto)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fetch(rec)
+			if err := rec.Close(); err != nil {
+				t.Fatal(err)
+			}
+			recorded := srv.RequestCount()
+
+			rec, err = rhttptest.NewRecorder(cassette, rhttptest.ModeAuto)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fetch(rec)
+			rec.Close()
+			if srv.RequestCount() != recorded {
+				t.Errorf("replay sent %d requests", srv.RequestCount()-recorded)
+			}
+		})
+	}
+}
+
+func TestRecorderRedacts(t *testing.T) {
+	tests := []struct {
+		name   string
+		redact []string
+		want   []string
+		keep   []string
+	}{
+		{name: "default", want: []string{"secret-token", "session=1"}, keep: []string{"X-Api-Key"}},
+		{name: "chosen", redact: []string{"x-api-key"}, want: []string{"key-123"}, keep: []string{"secret-token", "session=1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := rhttptest.NewServer()
+			defer srv.Close()
+			srv.Respond(200).Header("Set-Cookie", "session=1")
+			cassette := filepath.Join(t.TempDir(), "cassette.json")
+
+			rec, _ := rhttptest.NewRecorder(cassette, rhttptest.ModeRecord)
+			if tt.redact != nil {
+				rec.RedactHeaders = tt.redact
+			}
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			req.Header.Set("Authorization", "Bearer secret-token")
+			req.Header.Set("X-Api-Key", "key-123")
+			resp, err := rec.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.Header.Get("Set-Cookie") != "session=1" {
+				t.Error("response header redacted for the caller")
+			}
+			rec.Close()
+
+			data, err := ioutil.ReadFile(cassette)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, secret := range tt.want {
+				if strings.Contains(string(data), secret) {
+					t.Errorf("cassette holds %q:\n%s", secret, data)
+				}
+			}
+			for _, kept := range tt.keep {
+				if !strings.Contains(string(data), kept) {
+					t.Errorf("cassette lost %q:\n%s", kept, data)
+				}
+			}
+		})
+	}
+}
+
+func TestRecorderReplaysErrors(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	refused := errors.New("connection refused")
+	rec, _ := rhttptest.NewRecorder(cassette, rhttptest.ModeRecord)
+	rec.Transport = roundTripFunc(func(*http.Request) (*http.Response, error) { return nil, refused })
+	req, _ := http.NewRequest(http.MethodGet, "http://api.test/", nil)
+	if _, err := rec.RoundTrip(req); err != refused {
+		t.Fatalf("RoundTrip() error = %v, want %v", err, refused)
+	}
+	rec.Close()
+
+	rec, err := rhttptest.NewRecorder(cassette, rhttptest.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rec.RoundTrip(req); err == nil || err.Error() != "connection refused" {
+		t.Errorf("replayed error = %v, want the recorded one", err)
+	}
+	if _, err := rec.RoundTrip(req); err == nil || !strings.Contains(err.Error(), "no recorded interaction left") {
+		t.Errorf("RoundTrip() error = %v once the cassette is used up", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestNewRecorderErrors(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "corrupt.json")
+	os.WriteFile(corrupt, []byte("not json"), 0o644)
+	tests := []struct {
+		name    string
+		path    string
+		mode    rhttptest.Mode
+		wantErr bool
+	}{
+		{name: "replay without a cassette", path: filepath.Join(dir, "missing.json"), mode: rhttptest.ModeReplay, wantErr: true},
+		{name: "corrupt cassette", path: corrupt, mode: rhttptest.ModeReplay, wantErr: true},
+		{name: "record without a cassette", path: filepath.Join(dir, "missing.json"), mode: rhttptest.ModeRecord},
+		{name: "auto without a cassette", path: filepath.Join(dir, "missing.json"), mode: rhttptest.ModeAuto},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := rhttptest.NewRecorder(tt.path, tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRecorder() error = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package rhttptest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Server is an httptest.Server answering requests from a script, so retry
+// scenarios can be tested end to end:
+//
+//	srv := rhttptest.NewServer()
+//	defer srv.Close()
+//	srv.Respond(500).Times(2).Then(200).Body("ok")
+//
+// Once the script is exhausted its last step repeats, and an empty script
+// answers 200.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	steps    []*Step
+	served   int
+	requests []Request
+}
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// Step is one scripted response, served Times times in a row.
+type Step struct {
+	mu   *sync.Mutex
+	then func(status int) *Step
+
+	status    int
+	header    http.Header
+	body      []byte
+	times     int
+	delay     time.Duration
+	drop      bool
+	dropAfter int
+}
+
+// NewServer starts a server with an empty script.
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// Respond appends a step answering status to the script.
+func (s *Server) Respond(status int) *Step {
+	step := newStep(&s.mu, s.Respond, status)
+
+	s.mu.Lock()
+	s.steps = append(s.steps, step)
+	s.mu.Unlock()
+
+	return step
+}
+
+// Requests returns the requests received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestCount returns how many requests were received so far.
+func (s *Server) RequestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.requests)
+}
+
+// Reset clears the script and the received requests.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.steps, s.served, s.requests = nil, 0, nil
+}
+
+// next records req and returns the step answering it, nil for the default.
+func (s *Server) next(req Request) *Step {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, req)
+
+	n := s.served
+	s.served++
+
+	return pick(s.steps, n)
+}
+
+func newStep(mu *sync.Mutex, then func(int) *Step, status int) *Step {
+	return &Step{mu: mu, then: then, status: status, header: make(http.Header), times: 1, dropAfter: -1}
+}
+
+// pick returns the step serving the nth response of a script, repeating the
+// last one once it is exhausted, nil for an empty script.
+func pick(steps []*Step, n int) *Step {
+	for _, step := range steps {
+		if n < step.times {
+			return step
+		}
+		n -= step.times
+	}
+	if len(steps) == 0 {
+		return nil
+	}
+
+	return steps[len(steps)-1]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	step := s.next(Request{
+		Method: r.Method,
+		URL:    r.URL.String(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	if step == nil {
+		return
+	}
+
+	if step.delay > 0 {
+		timer := time.NewTimer(step.delay)
+		defer timer.Stop()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timer.C:
+		}
+	}
+
+	if step.drop {
+		hijackAndClose(w)
+		return
+	}
+
+	for k, v := range step.header {
+		w.Header()[k] = v
+	}
+	if step.dropAfter < 0 || step.dropAfter >= len(step.body) {
+		w.WriteHeader(step.status)
+		w.Write(step.body)
+		return
+	}
+
+	// Promise the whole body, then hang up part-way through it
+	w.Header().Set("Content-Length", strconv.Itoa(len(step.body)))
+	w.WriteHeader(step.status)
+	w.Write(step.body[:step.dropAfter])
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	hijackAndClose(w)
+}
+
+// hijackAndClose takes over the connection and closes it.
+func hijackAndClose(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic("rhttptest: connection cannot be hijacked")
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		panic("rhttptest: " + err.Error())
+	}
+	buf.Flush()
+	conn.Close()
+}
+
+// Times serves the step n times in a row instead of once.
+func (st *Step) Times(n int) *Step {
+	st.mu.Lock()
+	st.times = n
+	st.mu.Unlock()
+
+	return st
+}
+
+// Then appends a step answering status after this one.
+func (st *Step) Then(status int) *Step {
+	return st.then(status)
+}
+
+// Body sets the response body.
+func (st *Step) Body(body string) *Step {
+	st.mu.Lock()
+	st.body = []byte(body)
+	st.mu.Unlock()
+
+	return st
+}
+
+// Header adds a response header, e.g. Header("Retry-After", "1").
+func (st *Step) Header(key, value string) *Step {
+	st.mu.Lock()
+	st.header.Add(key, value)
+	st.mu.Unlock()
+
+	return st
+}
+
+// Delay waits d before responding, or until the client gives up.
+func (st *Step) Delay(d time.Duration) *Step {
+	st.mu.Lock()
+	st.delay = d
+	st.mu.Unlock()
+
+	return st
+}
+
+// DropConnection closes the connection without responding.
+func (st *Step) DropConnection() *Step {
+	st.mu.Lock()
+	st.drop = true
+	st.mu.Unlock()
+
+	return st
+}
+
+// DropAfter sends the headers and the first n bytes of the body, then closes
+// the connection, so the client sees a truncated body.
+func (st *Step) DropAfter(n int) *Step {
+	st.mu.Lock()
+	st.dropAfter = n
+	st.mu.Unlock()
+
+	return st
+}
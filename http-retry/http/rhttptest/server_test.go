@@ -0,0 +1,153 @@
+package rhttptest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	rhttp "github.com/kdkumawat/golang/http-retry/http"
+	"github.com/kdkumawat/golang/http-retry/http/rhttptest"
+)
+
+func TestServerDrivesRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		script       func(*rhttptest.Server)
+		opts         []rhttp.Option
+		wantStatus   int
+		wantBody     string
+		wantErr      error
+		wantRequests int
+	}{
+		{
+			name:         "empty script",
+			script:       func(*rhttptest.Server) {},
+			wantStatus:   http.StatusOK,
+			wantRequests: 1,
+		},
+		{
+			name:         "500 twice then 200",
+			script:       func(s *rhttptest.Server) { s.Respond(500).Times(2).Then(200).Body("ok") },
+			opts:         []rhttp.Option{rhttp.RetryOn(500)},
+			wantStatus:   http.StatusOK,
+			wantBody:     "ok",
+			wantRequests: 3,
+		},
+		{
+			name:         "500 not retried by default",
+			script:       func(s *rhttptest.Server) { s.Respond(500).Then(200) },
+			wantStatus:   http.StatusInternalServerError,
+			wantRequests: 1,
+		},
+		{
+			name:         "gives up",
+			script:       func(s *rhttptest.Server) { s.Respond(503) },
+			opts:         []rhttp.Option{rhttp.WithMaxRetries(2)},
+			wantErr:      rhttp.ErrMaxRetriesExceeded,
+			wantRequests: 3,
+		},
+		{
+			name:         "not retried",
+			script:       func(s *rhttptest.Server) { s.Respond(404).Body("missing").Then(200) },
+			wantStatus:   http.StatusNotFound,
+			wantBody:     "missing",
+			wantRequests: 1,
+		},
+		{
+			name:         "Retry-After",
+			script:       func(s *rhttptest.Server) { s.Respond(429).Header("Retry-After", "30").Then(200).Body("ok") },
+			wantStatus:   http.StatusOK,
+			wantBody:     "ok",
+			wantRequests: 2,
+		},
+		{
+			name:         "dropped connection",
+			script:       func(s *rhttptest.Server) { s.Respond(200).DropConnection().Then(200).Body("ok") },
+			wantStatus:   http.StatusOK,
+			wantBody:     "ok",
+			wantRequests: 2,
+		},
+		{
+			name:         "dropped mid-body, verified",
+			script:       func(s *rhttptest.Server) { s.Respond(200).Body("hello").DropAfter(2).Then(200).Body("hello") },
+			opts:         []rhttp.Option{rhttp.WithBodyVerification()},
+			wantStatus:   http.StatusOK,
+			wantBody:     "hello",
+			wantRequests: 2,
+		},
+		{
+			name:         "dropped mid-body, unverified",
+			script:       func(s *rhttptest.Server) { s.Respond(200).Body("hello").DropAfter(2).Then(200) },
+			wantErr:      errUnexpectedEOF,
+			wantRequests: 1,
+		},
+		{
+			name:         "slow attempt",
+			script:       func(s *rhttptest.Server) { s.Respond(200).Delay(time.Hour).Then(200).Body("ok") },
+			opts:         []rhttp.Option{rhttp.WithAttemptTimeout(50 * time.Millisecond)},
+			wantStatus:   http.StatusOK,
+			wantBody:     "ok",
+			wantRequests: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := rhttptest.NewServer()
+			defer srv.Close()
+			tt.script(srv)
+			opts := append([]rhttp.Option{rhttp.WithClock(rhttptest.NewAutoClock(time.Now()))}, tt.opts...)
+			c := rhttp.NewRetryableClient(opts...)
+
+			status, body, err := c.GetBytes(context.Background(), srv.URL)
+			switch {
+			case tt.wantErr == errUnexpectedEOF:
+				if err == nil || !strings.Contains(err.Error(), "unexpected EOF") {
+					t.Errorf("GetBytes() error = %v, want a truncated body", err)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Errorf("GetBytes() error = %v, want %v", err, tt.wantErr)
+			case err == nil && (status != tt.wantStatus || string(body) != tt.wantBody):
+				t.Errorf("GetBytes() = %d, %q, want %d, %q", status, body, tt.wantStatus, tt.wantBody)
+			}
+			if got := srv.RequestCount(); got != tt.wantRequests {
+				t.Errorf("server received %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+// errUnexpectedEOF marks the cases expecting a truncated body, reported by
+// net/http with a message rather than a sentinel.
+var errUnexpectedEOF = errors.New("unexpected EOF")
+
+func TestServerRecordsRequests(t *testing.T) {
+	srv := rhttptest.NewServer()
+	defer srv.Close()
+	srv.Respond(503).Then(200)
+
+	c := rhttp.NewRetryableClient(rhttp.WithClock(rhttptest.NewAutoClock(time.Now())))
+	resp, err := c.PutContext(context.Background(), srv.URL+"/items/1", "text/plain", "payload")
+	if err != nil {
+		t.Fatalf("PutContext() error = %v", err)
+	}
+	resp.Body.Close()
+
+	requests := srv.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("server received %d requests, want 2", len(requests))
+	}
+	for i, req := range requests {
+		if req.Method != http.MethodPut || req.URL != "/items/1" || string(req.Body) != "payload" ||
+			req.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("request %d = %s %s %q %v", i+1, req.Method, req.URL, req.Body, req.Header)
+		}
+	}
+
+	srv.Reset()
+	if srv.RequestCount() != 0 {
+		t.Errorf("RequestCount() after Reset = %d", srv.RequestCount())
+	}
+}
@@ -0,0 +1,339 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings is a declarative configuration of the retry behavior, so it can be
+// tuned from a file or the environment without changing code. Unset fields
+// leave the client's options alone:
+//
+//	{
+//	  "max_retries": 3,
+//	  "backoff": {"base": "200ms", "max": "10s", "jitter": "full"},
+//	  "retry_on": [429, 502, 503, 504],
+//	  "timeout": "30s",
+//	  "hosts": {
+//	    "api.stripe.com": {"max_retries": 5, "attempt_timeout": "2s"}
+//	  }
+//	}
+//
+// An empty retry_on retries no status at all, unlike a missing or null one,
+// which is why both status lists are always encoded.
+type Settings struct {
+	MaxRetries     *int             `json:"max_retries,omitempty"`
+	Backoff        *BackoffSettings `json:"backoff,omitempty"`
+	RetryOn        []int            `json:"retry_on"`
+	NeverRetry     []int            `json:"never_retry"`
+	Timeout        Duration         `json:"timeout,omitempty"`
+	AttemptTimeout Duration         `json:"attempt_timeout,omitempty"`
+	MaxElapsedTime Duration         `json:"max_elapsed_time,omitempty"`
+
+	// Circuit replaces the circuit breaker with a new one, whose circuits
+	// all start closed.
+	Circuit *CircuitBreakerSettings `json:"circuit,omitempty"`
+
+	// Hosts overrides settings for requests matching a WithHostOptions pattern.
+	Hosts map[string]*Settings `json:"hosts,omitempty"`
+}
+
+// BackoffSettings describes a Backoff. Type is "exponential", the default, or
+// "constant", which waits Base every time. Jitter is "full", the default,
+// "decorrelated" or "none".
+type BackoffSettings struct {
+	Type       string   `json:"type,omitempty"`
+	Base       Duration `json:"base,omitempty"`
+	Max        Duration `json:"max,omitempty"`
+	Multiplier float64  `json:"multiplier,omitempty"`
+	Jitter     string   `json:"jitter,omitempty"`
+}
+
+// CircuitBreakerSettings describes the CircuitSettings of a circuit breaker.
+type CircuitBreakerSettings struct {
+	FailureThreshold int      `json:"failure_threshold"`
+	Cooldown         Duration `json:"cooldown"`
+}
+
+// Duration is a time.Duration written as a string such as "1.5s" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1.5s\", got %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+
+	return nil
+}
+
+// LoadSettings reads settings from a JSON file. Unknown fields are rejected,
+// so a misspelled setting does not go unnoticed. YAML is not supported;
+// convert it to JSON and use ParseSettings.
+func LoadSettings(path string) (*Settings, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseSettings(b)
+}
+
+// ParseSettings parses settings in the JSON format read by LoadSettings.
+func ParseSettings(b []byte) (*Settings, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	var s Settings
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("rhttp: parsing settings: %w", err)
+	}
+	if err := s.validate(true); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// SettingsFromEnv reads settings from environment variables named after the
+// JSON fields, upper-cased and prefixed, e.g. with prefix "PAYMENTS_HTTP":
+//
+//	PAYMENTS_HTTP_MAX_RETRIES=5
+//	PAYMENTS_HTTP_BACKOFF_BASE=200ms
+//	PAYMENTS_HTTP_BACKOFF_JITTER=decorrelated
+//	PAYMENTS_HTTP_RETRY_ON=429,503
+//	PAYMENTS_HTTP_ATTEMPT_TIMEOUT=2s
+//
+// Per-host overrides are only read from files.
+func SettingsFromEnv(prefix string) (*Settings, error) {
+	var (
+		s   Settings
+		b   BackoffSettings
+		err error
+	)
+	env := func(name string) (string, bool) {
+		v, ok := os.LookupEnv(prefix + "_" + name)
+		return strings.TrimSpace(v), ok
+	}
+	// fail keeps the first error
+	fail := func(name string, e error) {
+		if err == nil {
+			err = fmt.Errorf("rhttp: %s_%s: %w", prefix, name, e)
+		}
+	}
+	duration := func(name string, d *Duration) {
+		if v, ok := env(name); ok {
+			parsed, e := time.ParseDuration(v)
+			if e != nil {
+				fail(name, e)
+			}
+			*d = Duration(parsed)
+		}
+	}
+	codes := func(name string) []int {
+		v, ok := env(name)
+		if !ok {
+			return nil
+		}
+		var list []int
+		for _, f := range strings.Split(v, ",") {
+			code, e := strconv.Atoi(strings.TrimSpace(f))
+			if e != nil {
+				fail(name, e)
+				return nil
+			}
+			list = append(list, code)
+		}
+		return list
+	}
+
+	if v, ok := env("MAX_RETRIES"); ok {
+		n, e := strconv.Atoi(v)
+		if e != nil {
+			fail("MAX_RETRIES", e)
+		}
+		s.MaxRetries = &n
+	}
+	b.Type, _ = env("BACKOFF_TYPE")
+	duration("BACKOFF_BASE", &b.Base)
+	duration("BACKOFF_MAX", &b.Max)
+	if v, ok := env("BACKOFF_MULTIPLIER"); ok {
+		m, e := strconv.ParseFloat(v, 64)
+		if e != nil {
+			fail("BACKOFF_MULTIPLIER", e)
+		}
+		b.Multiplier = m
+	}
+	b.Jitter, _ = env("BACKOFF_JITTER")
+	s.RetryOn = codes("RETRY_ON")
+	s.NeverRetry = codes("NEVER_RETRY")
+	duration("TIMEOUT", &s.Timeout)
+	duration("ATTEMPT_TIMEOUT", &s.AttemptTimeout)
+	duration("MAX_ELAPSED_TIME", &s.MaxElapsedTime)
+	var cb CircuitBreakerSettings
+	if v, ok := env("CIRCUIT_FAILURE_THRESHOLD"); ok {
+		n, e := strconv.Atoi(v)
+		if e != nil {
+			fail("CIRCUIT_FAILURE_THRESHOLD", e)
+		}
+		cb.FailureThreshold = n
+	}
+	duration("CIRCUIT_COOLDOWN", &cb.Cooldown)
+	if err != nil {
+		return nil, err
+	}
+
+	if b != (BackoffSettings{}) {
+		s.Backoff = &b
+	}
+	if cb != (CircuitBreakerSettings{}) {
+		s.Circuit = &cb
+	}
+	if err := s.validate(false); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *Settings) validate(top bool) error {
+	if s.MaxRetries != nil && *s.MaxRetries < 0 {
+		return fmt.Errorf("rhttp: max_retries must not be negative, got %d", *s.MaxRetries)
+	}
+	if s.Backoff != nil {
+		if _, err := s.Backoff.backoff(); err != nil {
+			return err
+		}
+	}
+	if c := s.Circuit; c != nil && (c.FailureThreshold <= 0 || c.Cooldown <= 0) {
+		return fmt.Errorf("rhttp: circuit needs a positive failure_threshold and cooldown")
+	}
+	if !top && len(s.Hosts) > 0 {
+		return fmt.Errorf("rhttp: host settings cannot have hosts of their own")
+	}
+	for pattern, hs := range s.Hosts {
+		if hs == nil {
+			continue
+		}
+		if err := hs.validate(false); err != nil {
+			return fmt.Errorf("rhttp: host %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+func (b *BackoffSettings) backoff() (Backoff, error) {
+	var jitter Jitter
+	switch b.Jitter {
+	case "", "full":
+		jitter = FullJitter
+	case "decorrelated":
+		jitter = DecorrelatedJitter
+	case "none":
+		jitter = NoJitter
+	default:
+		return nil, fmt.Errorf("rhttp: unknown backoff jitter %q", b.Jitter)
+	}
+
+	switch b.Type {
+	case "", "exponential":
+		return ExponentialBackoff{
+			Base:       time.Duration(b.Base),
+			Max:        time.Duration(b.Max),
+			Multiplier: b.Multiplier,
+			Jitter:     jitter,
+		}, nil
+	case "constant":
+		return ConstantBackoff(time.Duration(b.Base)), nil
+	default:
+		return nil, fmt.Errorf("rhttp: unknown backoff type %q", b.Type)
+	}
+}
+
+// Options returns the options applying s. RetryOn replaces the retry policy
+// with a StatusPolicy, while NeverRetry alone removes codes from the current
+// one.
+func (s *Settings) Options() []Option {
+	var opts []Option
+	if s.MaxRetries != nil {
+		opts = append(opts, WithMaxRetries(*s.MaxRetries))
+	}
+	if s.Backoff != nil {
+		if b, err := s.Backoff.backoff(); err == nil {
+			opts = append(opts, WithBackoff(b))
+		}
+	}
+	switch {
+	case s.RetryOn != nil:
+		opts = append(opts, WithRetryPolicy(&StatusPolicy{
+			Codes: append([]int(nil), s.RetryOn...),
+			Never: append([]int(nil), s.NeverRetry...),
+		}))
+	case s.NeverRetry != nil:
+		opts = append(opts, NeverRetry(s.NeverRetry...))
+	}
+	if s.Timeout != 0 {
+		opts = append(opts, WithTimeout(time.Duration(s.Timeout)))
+	}
+	if s.AttemptTimeout != 0 {
+		opts = append(opts, WithAttemptTimeout(time.Duration(s.AttemptTimeout)))
+	}
+	if s.MaxElapsedTime != 0 {
+		opts = append(opts, WithMaxElapsedTime(time.Duration(s.MaxElapsedTime)))
+	}
+	if c := s.Circuit; c != nil {
+		// One breaker for every request, however often the option is applied
+		cb := NewCircuitBreaker(CircuitSettings{
+			FailureThreshold: c.FailureThreshold,
+			Cooldown:         time.Duration(c.Cooldown),
+		})
+		opts = append(opts, WithCircuitBreaker(cb))
+	}
+
+	patterns := make([]string, 0, len(s.Hosts))
+	for pattern, hs := range s.Hosts {
+		if hs != nil {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		opts = append(opts, WithHostOptions(pattern, s.Hosts[pattern].Options()...))
+	}
+
+	return opts
+}
+
+// WithSettings applies s, e.g. loaded with LoadSettings. Options given after
+// it take precedence, so settings from the environment can be layered on top
+// of a file:
+//
+//	rhttp.NewRetryableClient(rhttp.WithSettings(file), rhttp.WithSettings(env))
+func WithSettings(s *Settings) Option {
+	return func(c *config) {
+		if s == nil {
+			return
+		}
+		for _, opt := range s.Options() {
+			opt(c)
+		}
+		c.policySource = PolicySource{Fingerprint: PolicyFingerprint(s)}
+	}
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{name: "full", json: `{"max_retries": 3, "backoff": {"base": "200ms", "max": "10s", "jitter": "decorrelated"},
+			"retry_on": [429, 503], "timeout": "30s", "circuit": {"failure_threshold": 5, "cooldown": "1m"},
+			"hosts": {"api.example.com": {"max_retries": 5, "attempt_timeout": "2s"}}}`},
+		{name: "constant backoff", json: `{"backoff": {"type": "constant", "base": "1s", "jitter": "none"}}`},
+		{name: "empty", json: `{}`},
+		{name: "unknown field", json: `{"max_retry": 3}`, wantErr: "unknown field"},
+		{name: "negative retries", json: `{"max_retries": -1}`, wantErr: "must not be negative"},
+		{name: "numeric duration", json: `{"timeout": 30}`, wantErr: "duration must be a string"},
+		{name: "bad duration", json: `{"timeout": "soon"}`, wantErr: "invalid duration"},
+		{name: "bad jitter", json: `{"backoff": {"jitter": "some"}}`, wantErr: "unknown backoff jitter"},
+		{name: "bad type", json: `{"backoff": {"type": "linear"}}`, wantErr: "unknown backoff type"},
+		{name: "bad circuit", json: `{"circuit": {"failure_threshold": 0, "cooldown": "1s"}}`, wantErr: "circuit needs"},
+		{name: "nested hosts", json: `{"hosts": {"a.example.com": {"hosts": {"b.example.com": {}}}}}`, wantErr: "cannot have hosts"},
+		{name: "bad host settings", json: `{"hosts": {"a.example.com": {"max_retries": -2}}}`, wantErr: `host "a.example.com"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSettings([]byte(tt.json))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseSettings() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseSettings() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSettingsFromEnv(t *testing.T) {
+	t.Setenv("APP_HTTP_MAX_RETRIES", "5")
+	t.Setenv("APP_HTTP_BACKOFF_BASE", "200ms")
+	t.Setenv("APP_HTTP_BACKOFF_JITTER", "none")
+	t.Setenv("APP_HTTP_RETRY_ON", "429, 503")
+	t.Setenv("APP_HTTP_ATTEMPT_TIMEOUT", "2s")
+	t.Setenv("APP_HTTP_CIRCUIT_FAILURE_THRESHOLD", "3")
+	t.Setenv("APP_HTTP_CIRCUIT_COOLDOWN", "10s")
+
+	s, err := SettingsFromEnv("APP_HTTP")
+	if err != nil {
+		t.Fatalf("SettingsFromEnv() error = %v", err)
+	}
+	if s.MaxRetries == nil || *s.MaxRetries != 5 {
+		t.Errorf("MaxRetries = %v, want 5", s.MaxRetries)
+	}
+	if s.Backoff == nil || time.Duration(s.Backoff.Base) != 200*time.Millisecond || s.Backoff.Jitter != "none" {
+		t.Errorf("Backoff = %+v, want a 200ms base without jitter", s.Backoff)
+	}
+	if len(s.RetryOn) != 2 || s.RetryOn[0] != 429 || s.RetryOn[1] != 503 {
+		t.Errorf("RetryOn = %v, want [429 503]", s.RetryOn)
+	}
+	if time.Duration(s.AttemptTimeout) != 2*time.Second {
+		t.Errorf("AttemptTimeout = %v, want 2s", time.Duration(s.AttemptTimeout))
+	}
+	if s.Circuit == nil || s.Circuit.FailureThreshold != 3 || time.Duration(s.Circuit.Cooldown) != 10*time.Second {
+		t.Errorf("Circuit = %+v, want 3 failures and 10s", s.Circuit)
+	}
+	if s.Timeout != 0 || s.NeverRetry != nil {
+		t.Errorf("unset variables were read: %+v", s)
+	}
+}
+
+func TestSettingsFromEnvErrors(t *testing.T) {
+	tests := []struct {
+		name, key, value, wantErr string
+	}{
+		{name: "bad count", key: "APP_HTTP_MAX_RETRIES", value: "many", wantErr: "APP_HTTP_MAX_RETRIES"},
+		{name: "bad duration", key: "APP_HTTP_TIMEOUT", value: "soon", wantErr: "APP_HTTP_TIMEOUT"},
+		{name: "bad code", key: "APP_HTTP_RETRY_ON", value: "429,five", wantErr: "APP_HTTP_RETRY_ON"},
+		{name: "bad jitter", key: "APP_HTTP_BACKOFF_JITTER", value: "some", wantErr: "unknown backoff jitter"},
+		{name: "negative retries", key: "APP_HTTP_MAX_RETRIES", value: "-1", wantErr: "must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			_, err := SettingsFromEnv("APP_HTTP")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("SettingsFromEnv() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithSettings(t *testing.T) {
+	srv := newScriptServer(t, 500)
+	host := mustParseURL(t, srv.URL).Host
+	s, err := ParseSettings([]byte(`{"max_retries": 1, "retry_on": [500], "backoff": {"base": "1ms", "jitter": "none"},
+		"hosts": {"` + host + `/slow/": {"max_retries": 3}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewRetryableClient(WithSettings(s))
+
+	c.GetBytes(context.Background(), srv.URL+"/fast")
+	if srv.count() != 2 {
+		t.Errorf("server received %d requests, want 2 with retry_on 500 and max_retries 1", srv.count())
+	}
+	c.GetBytes(context.Background(), srv.URL+"/slow/x")
+	if srv.count() != 2+4 {
+		t.Errorf("server received %d requests, want 4 more under the host settings", srv.count())
+	}
+}
@@ -0,0 +1,226 @@
+package http
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultStateTimeout bounds every call to a StateStore. A store that fails
+// or is too slow is ignored for that call, so the client falls back on what
+// its own process saw instead of failing requests.
+const DefaultStateTimeout = 250 * time.Millisecond
+
+// sharedSyncInterval is how often a closed circuit checks whether another
+// replica opened it.
+const sharedSyncInterval = time.Second
+
+// StateStore is state shared between the replicas of a service, so they
+// coordinate circuit breakers and rate limits instead of each hammering the
+// same upstream. The rhttpredis package implements it on Redis.
+type StateStore interface {
+	// Incr adds delta to the counter at key, creating it to expire after ttl,
+	// and returns its new value.
+	Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Get returns the value at key, with ok false if there is none.
+	Get(ctx context.Context, key string) (value string, ok bool, err error)
+	// Set stores value at key, to expire after ttl.
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// Delete removes keys.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// MemoryStateStore is a StateStore within a single process, for tests and
+// for clients sharing state without a server.
+type MemoryStateStore struct {
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+// NewMemoryStateStore returns an empty store.
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{
+		values:  make(map[string]string),
+		expires: make(map[string]time.Time),
+	}
+}
+
+// lookup returns the value at key, dropping it if it expired. s.mu must be
+// held.
+func (s *MemoryStateStore) lookup(key string) (string, bool) {
+	if until, ok := s.expires[key]; ok && !time.Now().Before(until) {
+		delete(s.values, key)
+		delete(s.expires, key)
+	}
+	v, ok := s.values[key]
+
+	return v, ok
+}
+
+func (s *MemoryStateStore) Incr(_ context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.lookup(key)
+	n, _ := strconv.ParseInt(v, 10, 64)
+	n += delta
+	s.values[key] = strconv.FormatInt(n, 10)
+	if !ok && ttl > 0 {
+		s.expires[key] = time.Now().Add(ttl)
+	}
+
+	return n, nil
+}
+
+func (s *MemoryStateStore) Get(_ context.Context, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.lookup(key)
+
+	return v, ok, nil
+}
+
+func (s *MemoryStateStore) Set(_ context.Context, key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = value
+	delete(s.expires, key)
+	if ttl > 0 {
+		s.expires[key] = time.Now().Add(ttl)
+	}
+
+	return nil
+}
+
+func (s *MemoryStateStore) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.values, key)
+		delete(s.expires, key)
+	}
+
+	return nil
+}
+
+// stateContext returns the context calls to a StateStore are made with.
+func stateContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), DefaultStateTimeout)
+}
+
+// SharedRateLimiter is a Limiter allowing limit requests per window across
+// every replica of a service sharing its store and key. It counts requests
+// in fixed windows, a single counter increment per request.
+type SharedRateLimiter struct {
+	store  StateStore
+	key    string
+	limit  int64
+	window time.Duration
+}
+
+// NewSharedRateLimiter returns a limiter counting requests at key in store,
+// e.g. for a limit per host:
+//
+//	rhttp.NewHostLimiter(func(host string) rhttp.Limiter {
+//		return rhttp.NewSharedRateLimiter(store, "rate:"+host, 100, time.Second)
+//	})
+func NewSharedRateLimiter(store StateStore, key string, limit int, window time.Duration) *SharedRateLimiter {
+	if window <= 0 {
+		window = time.Second
+	}
+
+	return &SharedRateLimiter{store: store, key: key, limit: int64(limit), window: window}
+}
+
+// Wait blocks until the current window has room for a request or ctx is
+// done. If the store fails, the request goes through.
+func (l *SharedRateLimiter) Wait(ctx context.Context) error {
+	for {
+		now := time.Now()
+		start := now.Truncate(l.window)
+		key := l.key + ":" + strconv.FormatInt(start.UnixNano()/int64(l.window), 10)
+
+		sctx, cancel := context.WithTimeout(ctx, DefaultStateTimeout)
+		n, err := l.store.Incr(sctx, key, 1, 2*l.window)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return nil
+		}
+		if n <= l.limit {
+			return nil
+		}
+		if err := sleep(ctx, systemClock{}, start.Add(l.window).Sub(now)); err != nil {
+			return err
+		}
+	}
+}
+
+// sharedCircuits keeps the circuits of a CircuitBreaker in a StateStore: a
+// failure counter per host, expiring after the cooldown, and a key marking
+// an open circuit.
+type sharedCircuits struct {
+	store  StateStore
+	prefix string
+}
+
+func (s *sharedCircuits) failuresKey(host string) string {
+	return s.prefix + "circuit:" + host + ":failures"
+}
+
+func (s *sharedCircuits) openKey(host string) string {
+	return s.prefix + "circuit:" + host + ":open"
+}
+
+// opened returns when another replica opened the circuit for host, if it is
+// open.
+func (s *sharedCircuits) opened(host string) (time.Time, bool) {
+	ctx, cancel := stateContext()
+	defer cancel()
+
+	v, ok, err := s.store.Get(ctx, s.openKey(host))
+	if err != nil || !ok {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, nanos), true
+}
+
+// fail counts a failure, returning the failures of every replica within
+// the cooldown, or zero if the store failed.
+func (s *sharedCircuits) fail(host string, cooldown time.Duration) int {
+	ctx, cancel := stateContext()
+	defer cancel()
+
+	n, err := s.store.Incr(ctx, s.failuresKey(host), 1, cooldown)
+	if err != nil {
+		return 0
+	}
+
+	return int(n)
+}
+
+func (s *sharedCircuits) open(host string, at time.Time, cooldown time.Duration) {
+	ctx, cancel := stateContext()
+	defer cancel()
+
+	s.store.Set(ctx, s.openKey(host), strconv.FormatInt(at.UnixNano(), 10), cooldown)
+}
+
+func (s *sharedCircuits) reset(host string) {
+	ctx, cancel := stateContext()
+	defer cancel()
+
+	s.store.Delete(ctx, s.failuresKey(host), s.openKey(host))
+}
@@ -0,0 +1,244 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingStore is a StateStore whose server is down.
+type failingStore struct{}
+
+var errStoreDown = errors.New("store down")
+
+func (failingStore) Incr(context.Context, string, int64, time.Duration) (int64, error) {
+	return 0, errStoreDown
+}
+
+func (failingStore) Get(context.Context, string) (string, bool, error) {
+	return "", false, errStoreDown
+}
+
+func (failingStore) Set(context.Context, string, string, time.Duration) error { return errStoreDown }
+
+func (failingStore) Delete(context.Context, ...string) error { return errStoreDown }
+
+func TestMemoryStateStore(t *testing.T) {
+	ctx := context.Background()
+	type op struct {
+		incr, set, del string
+		delta          int64
+		value          string
+		ttl            time.Duration
+		// sleep waits before the op.
+		sleep time.Duration
+		// wantIncr is the value Incr returns.
+		wantIncr int64
+	}
+	tests := []struct {
+		name   string
+		ops    []op
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{name: "missing", key: "a"},
+		{name: "counted", ops: []op{{incr: "a", delta: 1, wantIncr: 1}, {incr: "a", delta: 4, wantIncr: 5}, {incr: "a", delta: -2, wantIncr: 3}}, key: "a", want: "3", wantOK: true},
+		{name: "set", ops: []op{{set: "a", value: "v"}}, key: "a", want: "v", wantOK: true},
+		{name: "counter over a value", ops: []op{{set: "a", value: "x"}, {incr: "a", delta: 2, wantIncr: 2}}, key: "a", want: "2", wantOK: true},
+		{name: "deleted", ops: []op{{set: "a", value: "v"}, {incr: "b", delta: 1, wantIncr: 1}, {del: "a"}}, key: "a"},
+		{name: "expired", ops: []op{{set: "a", value: "v", ttl: time.Millisecond}, {sleep: 5 * time.Millisecond}}, key: "a"},
+		{name: "no expiry", ops: []op{{set: "a", value: "v"}, {sleep: 5 * time.Millisecond}}, key: "a", want: "v", wantOK: true},
+		{name: "expiry dropped by set", ops: []op{{set: "a", value: "v", ttl: time.Millisecond}, {set: "a", value: "w"}, {sleep: 5 * time.Millisecond}}, key: "a", want: "w", wantOK: true},
+		{
+			// The expiry is set once, when the counter is created
+			name: "counter expires",
+			ops: []op{
+				{incr: "a", delta: 1, ttl: 5 * time.Millisecond, wantIncr: 1},
+				{incr: "a", delta: 1, ttl: time.Hour, wantIncr: 2},
+				{sleep: 10 * time.Millisecond},
+				{incr: "a", delta: 1, ttl: time.Hour, wantIncr: 1},
+			},
+			key:    "a",
+			want:   "1",
+			wantOK: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStateStore()
+			for i, o := range tt.ops {
+				time.Sleep(o.sleep)
+				switch {
+				case o.incr != "":
+					if n, err := s.Incr(ctx, o.incr, o.delta, o.ttl); err != nil || n != o.wantIncr {
+						t.Errorf("op %d: Incr() = %d, %v, want %d", i+1, n, err, o.wantIncr)
+					}
+				case o.set != "":
+					s.Set(ctx, o.set, o.value, o.ttl)
+				case o.del != "":
+					s.Delete(ctx, o.del, "missing")
+				}
+			}
+
+			if v, ok, err := s.Get(ctx, tt.key); err != nil || v != tt.want || ok != tt.wantOK {
+				t.Errorf("Get(%q) = %q, %v, %v, want %q, %v", tt.key, v, ok, err, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSharedRateLimiter(t *testing.T) {
+	tests := []struct {
+		name  string
+		store StateStore
+		limit int
+		// limiters share the limit, each waiting in turn.
+		limiters int
+		waits    int
+		// wantLimited is set when the last wait is to be cut short by its
+		// context.
+		wantLimited bool
+	}{
+		{name: "within the limit", store: NewMemoryStateStore(), limit: 3, limiters: 1, waits: 3},
+		{name: "over the limit", store: NewMemoryStateStore(), limit: 3, limiters: 1, waits: 4, wantLimited: true},
+		{name: "shared by replicas", store: NewMemoryStateStore(), limit: 3, limiters: 2, waits: 4, wantLimited: true},
+		{name: "store down", store: failingStore{}, limit: 1, limiters: 2, waits: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiters := make([]*SharedRateLimiter, tt.limiters)
+			for i := range limiters {
+				limiters[i] = NewSharedRateLimiter(tt.store, "rate:api", tt.limit, time.Hour)
+			}
+
+			for i := 0; i < tt.waits; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				err := limiters[i%len(limiters)].Wait(ctx)
+				cancel()
+				if last := i == tt.waits-1; last && tt.wantLimited {
+					if !errors.Is(err, context.DeadlineExceeded) {
+						t.Errorf("wait %d = %v, want it limited", i+1, err)
+					}
+				} else if err != nil {
+					t.Errorf("wait %d = %v", i+1, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSharedRateLimiterNextWindow(t *testing.T) {
+	l := NewSharedRateLimiter(NewMemoryStateStore(), "rate:api", 1, 20*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatalf("wait %d = %v, want it to go through in a later window", i+1, err)
+		}
+	}
+}
+
+func TestSharedCircuitBreaker(t *testing.T) {
+	const host = "api.test"
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type step struct {
+		// replica records an outcome, or with allow set asks whether a
+		// request may be sent, after elapsed.
+		replica int
+		fail    bool
+		allow   bool
+		elapsed time.Duration
+		// wantOpen is checked for allow steps.
+		wantOpen bool
+	}
+	tests := []struct {
+		name  string
+		store StateStore
+		steps []step
+	}{
+		{
+			name:  "failures pooled",
+			store: NewMemoryStateStore(),
+			steps: []step{
+				{replica: 0, fail: true}, {replica: 1, fail: true}, {replica: 0, fail: true}, {replica: 1, fail: true},
+				{replica: 1, allow: true, wantOpen: true},
+			},
+		},
+		{
+			name:  "opened by another replica",
+			store: NewMemoryStateStore(),
+			steps: []step{
+				{replica: 0, fail: true}, {replica: 0, fail: true}, {replica: 0, fail: true}, {replica: 0, fail: true},
+				{replica: 1, allow: true, wantOpen: true},
+			},
+		},
+		{
+			name:  "success resets",
+			store: NewMemoryStateStore(),
+			steps: []step{
+				{replica: 0, fail: true}, {replica: 0, fail: true}, {replica: 0, fail: true}, {replica: 0},
+				{replica: 1, fail: true}, {replica: 1, allow: true},
+			},
+		},
+		{
+			name:  "synced once a second",
+			store: NewMemoryStateStore(),
+			steps: []step{
+				{replica: 1, allow: true},
+				{replica: 0, fail: true}, {replica: 0, fail: true}, {replica: 0, fail: true}, {replica: 0, fail: true},
+				{replica: 1, allow: true, elapsed: 500 * time.Millisecond},
+				{replica: 1, allow: true, elapsed: time.Second, wantOpen: true},
+			},
+		},
+		{
+			name:  "store down",
+			store: failingStore{},
+			steps: []step{
+				{replica: 0, fail: true}, {replica: 1, fail: true}, {replica: 0, fail: true}, {replica: 1, fail: true},
+				{replica: 1, allow: true},
+				{replica: 1, fail: true}, {replica: 1, fail: true},
+				{replica: 1, allow: true, wantOpen: true},
+				{replica: 0, allow: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := CircuitSettings{FailureThreshold: 4, Cooldown: time.Minute}
+			replicas := []*CircuitBreaker{
+				NewSharedCircuitBreaker(settings, tt.store, "svc:"),
+				NewSharedCircuitBreaker(settings, tt.store, "svc:"),
+			}
+
+			for i, s := range tt.steps {
+				b := replicas[s.replica]
+				if !s.allow {
+					b.record(host, !s.fail, now)
+					continue
+				}
+				err := b.allow(host, now.Add(s.elapsed))
+				if s.wantOpen != errors.Is(err, ErrCircuitOpen) {
+					t.Errorf("step %d: replica %d allow() = %v, want open: %v", i+1, s.replica+1, err, s.wantOpen)
+				}
+			}
+		})
+	}
+}
+
+func TestSharedCircuitsPrefix(t *testing.T) {
+	store := NewMemoryStateStore()
+	settings := CircuitSettings{FailureThreshold: 1, Cooldown: time.Minute}
+	payments := NewSharedCircuitBreaker(settings, store, "payments:")
+	search := NewSharedCircuitBreaker(settings, store, "search:")
+
+	payments.Record("api.test", false)
+	if err := search.Allow("api.test"); err != nil {
+		t.Errorf("circuit opened through another prefix: %v", err)
+	}
+	if _, ok, _ := store.Get(context.Background(), "payments:circuit:api.test:open"); !ok {
+		t.Error("open circuit not published under its prefix")
+	}
+}
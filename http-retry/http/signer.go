@@ -0,0 +1,50 @@
+package http
+
+import (
+	"net/http"
+	"time"
+)
+
+// Signer signs an attempt right before it is sent, after every other header
+// has been set. Signatures are time-bound, so they are computed again for
+// every retry instead of once per request. The signer may read the payload
+// through req.GetBody.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// SignerFunc adapts a plain function to the Signer interface.
+type SignerFunc func(req *http.Request) error
+
+func (f SignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+// WithSigner signs every attempt with s, e.g. a SigV4Signer or an HMAC
+// scheme. A signing error fails the request without retrying.
+func WithSigner(s Signer) Option {
+	return func(c *config) {
+		c.signer = s
+	}
+}
+
+// timedSigner is a Signer whose signatures depend on the time, which the
+// client tells it with its clock.
+type timedSigner interface {
+	sign(req *http.Request, now time.Time) error
+}
+
+// sign signs attempt, giving the signer access to the payload via getBody.
+func (c *config) sign(attempt *http.Request, getBody BodyFunc) error {
+	if c.signer == nil {
+		return nil
+	}
+	if attempt.GetBody == nil && getBody != nil {
+		attempt.GetBody = getBody
+	}
+	if s, ok := c.signer.(timedSigner); ok {
+		return s.sign(attempt, c.clock.Now())
+	}
+
+	return c.signer.Sign(attempt)
+}
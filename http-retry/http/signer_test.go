@@ -0,0 +1,67 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWithSigner(t *testing.T) {
+	errSign := errors.New("no key")
+	tests := []struct {
+		name      string
+		statuses  []int
+		signErr   error
+		wantSigns int
+		wantCount int
+	}{
+		{name: "signed", statuses: []int{200}, wantSigns: 1, wantCount: 1},
+		{name: "every retry signed again", statuses: []int{503, 503, 200}, wantSigns: 3, wantCount: 3},
+		{name: "signing error", statuses: []int{200}, signErr: errSign, wantSigns: 1, wantCount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			signs := 0
+			signer := SignerFunc(func(req *http.Request) error {
+				signs++
+				// The payload can be read without consuming the body sent
+				body, err := req.GetBody()
+				if err != nil {
+					return err
+				}
+				payload, _ := ioutil.ReadAll(body)
+				req.Header.Set("X-Signature", string(payload)+"-"+strings.Repeat("x", signs))
+				return tt.signErr
+			})
+			c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0), WithSigner(signer))
+			req, err := NewRequest(context.Background(), http.MethodPut, srv.URL, "payload")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := c.Do(context.Background(), req)
+			if tt.signErr != nil {
+				if !errors.Is(err, tt.signErr) {
+					t.Errorf("Do() error = %v, want %v", err, tt.signErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				drainBody(resp)
+			}
+			if signs != tt.wantSigns || srv.count() != tt.wantCount {
+				t.Fatalf("%d signatures for %d requests, want %d for %d", signs, srv.count(), tt.wantSigns, tt.wantCount)
+			}
+			for i := 0; i < srv.count(); i++ {
+				r, body := srv.request(i)
+				if want := "payload-" + strings.Repeat("x", i+1); r.Header.Get("X-Signature") != want || body != "payload" {
+					t.Errorf("attempt %d sent %q signed %q, want %q", i+1, body, r.Header.Get("X-Signature"), want)
+				}
+			}
+		})
+	}
+}
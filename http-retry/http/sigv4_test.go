@@ -0,0 +1,166 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigV4Signer(t *testing.T) {
+	// The examples of the AWS Signature Version 4 documentation and test suite
+	signer := SigV4Signer{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		service string
+		url     string
+		header  map[string]string
+		want    string
+	}{
+		{
+			name:    "get-vanilla",
+			service: "service",
+			url:     "https://example.amazonaws.com/",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:    "IAM ListUsers",
+			service: "iam",
+			url:     "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+			header:  map[string]string{"Content-Type": "application/x-www-form-urlencoded; charset=utf-8"},
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+				"SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			s := signer
+			s.Service = tt.service
+
+			if err := s.sign(req, now); err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization =\n%s\nwant\n%s", got, tt.want)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %q", got)
+			}
+		})
+	}
+}
+
+func TestSigV4SignerHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		signer SigV4Signer
+		body   func() *http.Request
+		// want are headers expected on the signed request.
+		want map[string]string
+	}{
+		{
+			name:   "session token",
+			signer: SigV4Signer{AccessKeyID: "id", SecretAccessKey: "key", SessionToken: "token", Region: "eu-west-1", Service: "sqs"},
+			want:   map[string]string{"X-Amz-Security-Token": "token", "X-Amz-Content-Sha256": ""},
+		},
+		{
+			name:   "S3 payload hash of an empty body",
+			signer: SigV4Signer{AccessKeyID: "id", SecretAccessKey: "key", Region: "eu-west-1", Service: "s3"},
+			want:   map[string]string{"X-Amz-Content-Sha256": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		},
+		{
+			name:   "S3 payload hash",
+			signer: SigV4Signer{AccessKeyID: "id", SecretAccessKey: "key", Region: "eu-west-1", Service: "s3"},
+			body: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodPut, "https://bucket.s3.amazonaws.com/key", strings.NewReader("hello"))
+				return req
+			},
+			want: map[string]string{"X-Amz-Content-Sha256": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		},
+		{
+			name:   "S3 body read once",
+			signer: SigV4Signer{AccessKeyID: "id", SecretAccessKey: "key", Region: "eu-west-1", Service: "s3"},
+			body: func() *http.Request {
+				req, _ := http.NewRequest(http.MethodPut, "https://bucket.s3.amazonaws.com/key", ioutil.NopCloser(strings.NewReader("hello")))
+				return req
+			},
+			want: map[string]string{"X-Amz-Content-Sha256": "UNSIGNED-PAYLOAD"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+			if tt.body != nil {
+				req = tt.body()
+			}
+			if err := tt.signer.Sign(req); err != nil {
+				t.Fatal(err)
+			}
+			for k, want := range tt.want {
+				if got := req.Header.Get(k); got != want {
+					t.Errorf("%s = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSigV4SignerMissingCredentials(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err := (SigV4Signer{Region: "us-east-1", Service: "sqs"}).Sign(req); err == nil {
+		t.Error("Sign() without credentials succeeded")
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "empty", query: "", want: ""},
+		{name: "sorted by key", query: "b=2&a=1", want: "a=1&b=2"},
+		{name: "key prefix of another", query: "a1=2&a-b=3&a=1", want: "a=1&a-b=3&a1=2"},
+		{name: "values of a key sorted", query: "a=2&a=10&a=1", want: "a=1&a=10&a=2"},
+		{name: "escaped", query: "k%20ey=a+b&x=%7E", want: "k%20ey=a%20b&x=~"},
+		{name: "no value", query: "flag&a=1", want: "a=1&flag="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/?"+tt.query, nil)
+			if got := canonicalQuery(req); got != tt.want {
+				t.Errorf("canonicalQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAWSEscape(t *testing.T) {
+	tests := []struct {
+		in        string
+		keepSlash bool
+		want      string
+	}{
+		{in: "AZaz09-_.~", want: "AZaz09-_.~"},
+		{in: "a b+c", want: "a%20b%2Bc"},
+		{in: "/a/b", want: "%2Fa%2Fb"},
+		{in: "/a/b", keepSlash: true, want: "/a/b"},
+		{in: "é", want: "%C3%A9"},
+	}
+	for _, tt := range tests {
+		if got := awsEscape(tt.in, tt.keepSlash); got != tt.want {
+			t.Errorf("awsEscape(%q, %v) = %q, want %q", tt.in, tt.keepSlash, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package http
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultSimulatedRequests is how many requests Simulate sends by default.
+const DefaultSimulatedRequests = 10000
+
+// FailurePattern describes the synthetic upstream of Simulate. Attempts fail
+// independently of each other.
+type FailurePattern struct {
+	// Requests is how many requests to simulate, DefaultSimulatedRequests if
+	// zero.
+	Requests int
+	// FailureRate is the probability, from 0 to 1, that an attempt fails.
+	FailureRate float64
+	// Status is the status of failed attempts, 0 to fail them with a
+	// connection reset instead.
+	Status int
+	// Latency is how long every attempt takes, plus a random part up to
+	// Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+	// Seed seeds the failures and latencies, so runs can be compared.
+	Seed int64
+}
+
+// SimulationReport is what Simulate measured.
+type SimulationReport struct {
+	Requests int
+	// SuccessRate is the share of requests that ended with a response below
+	// 400.
+	SuccessRate float64
+	// MeanAttempts is the mean number of attempts per request; it is also
+	// the load amplification on the upstream compared to no retries. During
+	// an outage it tends to MaxAttempts.
+	MeanAttempts float64
+	MaxAttempts  int
+	// AttemptCounts maps a number of attempts to how many requests took it.
+	AttemptCounts map[int]int
+	// Latency percentiles are those of whole requests, backoff waits
+	// included.
+	P50, P90, P99, MaxLatency time.Duration
+}
+
+func (r SimulationReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "requests: %d, success rate: %.2f%%\n", r.Requests, r.SuccessRate*100)
+	fmt.Fprintf(&b, "attempts: mean %.3f (load x%.2f), max %d\n", r.MeanAttempts, r.MeanAttempts, r.MaxAttempts)
+	fmt.Fprintf(&b, "latency: p50 %v, p90 %v, p99 %v, max %v", r.P50.Round(time.Millisecond),
+		r.P90.Round(time.Millisecond), r.P99.Round(time.Millisecond), r.MaxLatency.Round(time.Millisecond))
+
+	return b.String()
+}
+
+// Simulate runs the retry loop configured by opts against an upstream failing
+// as described by pattern and reports the attempt counts, latencies and load
+// it caused, so a change to the retry configuration can be reviewed before it
+// ships. Waits are simulated, so Simulate returns in a moment whatever the
+// backoff. Hedging, caching, mirroring and request deduplication are left
+// out, timeouts only count through deadline checks, and shared state such as
+// a circuit breaker or a retry throttle is updated as by real requests.
+func Simulate(opts []Option, pattern FailurePattern) SimulationReport {
+	if pattern.Requests <= 0 {
+		pattern.Requests = DefaultSimulatedRequests
+	}
+
+	clock := &simClock{}
+	cfg := newConfig(opts...)
+	cfg.transport = nil
+	cfg.clock = clock
+	cfg.hedgeDelay, cfg.maxHedges = 0, 0
+	cfg.cache, cfg.singleflight, cfg.writeDedupe, cfg.mirror = nil, nil, nil, nil
+	upstream := &simUpstream{pattern: pattern, clock: clock, rand: rand.New(rand.NewSource(pattern.Seed))}
+	t := newRetryableTransport(upstream, cfg)
+
+	report := SimulationReport{Requests: pattern.Requests, AttemptCounts: make(map[int]int)}
+	latencies := make([]time.Duration, 0, pattern.Requests)
+	var attempts, succeeded int
+	for i := 0; i < pattern.Requests; i++ {
+		start := clock.reset()
+		upstream.attempts = 0
+
+		req, _ := http.NewRequest(http.MethodGet, "http://upstream.invalid/", nil)
+		resp, err := t.RoundTrip(req)
+		if err == nil {
+			if resp.StatusCode < 400 {
+				succeeded++
+			}
+			resp.Body.Close()
+		}
+
+		latencies = append(latencies, clock.Now().Sub(start))
+		attempts += upstream.attempts
+		report.AttemptCounts[upstream.attempts]++
+		if upstream.attempts > report.MaxAttempts {
+			report.MaxAttempts = upstream.attempts
+		}
+	}
+
+	report.SuccessRate = float64(succeeded) / float64(pattern.Requests)
+	report.MeanAttempts = float64(attempts) / float64(pattern.Requests)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	report.P50 = percentile(latencies, 0.50)
+	report.P90 = percentile(latencies, 0.90)
+	report.P99 = percentile(latencies, 0.99)
+	report.MaxLatency = latencies[len(latencies)-1]
+
+	return report
+}
+
+// percentile returns the p quantile of sorted, which must not be empty.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(p * float64(len(sorted)))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+
+	return sorted[i]
+}
+
+// simClock is a Clock whose waits return at once, moving its time forward.
+type simClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// reset sets the clock to the current time, so deadlines set on the real
+// clock still apply, and returns it.
+func (c *simClock) reset() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = time.Now()
+
+	return c.now
+}
+
+func (c *simClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *simClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.advance(d)
+
+	return ch
+}
+
+func (c *simClock) advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+
+	return c.now
+}
+
+// simUpstream answers attempts as described by a FailurePattern.
+type simUpstream struct {
+	pattern  FailurePattern
+	clock    *simClock
+	rand     *rand.Rand
+	attempts int
+}
+
+func (u *simUpstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	u.attempts++
+	latency := u.pattern.Latency
+	if u.pattern.Jitter > 0 {
+		latency += time.Duration(u.rand.Int63n(int64(u.pattern.Jitter)))
+	}
+	u.clock.advance(latency)
+
+	status := http.StatusOK
+	if u.rand.Float64() < u.pattern.FailureRate {
+		if u.pattern.Status == 0 {
+			return nil, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+		}
+		status = u.pattern.Status
+	}
+
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
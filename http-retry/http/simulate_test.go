@@ -0,0 +1,158 @@
+package http
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSimulate(t *testing.T) {
+	noWait := WithBackoff(ConstantBackoff(0))
+	tests := []struct {
+		name    string
+		opts    []Option
+		pattern FailurePattern
+		// check is called with the report if set, the fields below are
+		// compared otherwise.
+		check            func(t *testing.T, r SimulationReport)
+		wantRequests     int
+		wantSuccessRate  float64
+		wantMeanAttempts float64
+		wantLatency      time.Duration
+	}{
+		{
+			name:             "healthy",
+			pattern:          FailurePattern{Requests: 100, Latency: 10 * time.Millisecond},
+			wantRequests:     100,
+			wantSuccessRate:  1,
+			wantMeanAttempts: 1,
+			wantLatency:      10 * time.Millisecond,
+		},
+		{
+			name:             "default requests",
+			pattern:          FailurePattern{},
+			wantRequests:     DefaultSimulatedRequests,
+			wantSuccessRate:  1,
+			wantMeanAttempts: 1,
+		},
+		{
+			name:             "outage",
+			opts:             []Option{noWait, WithMaxRetries(2)},
+			pattern:          FailurePattern{Requests: 100, FailureRate: 1, Status: http.StatusServiceUnavailable},
+			wantRequests:     100,
+			wantMeanAttempts: 3,
+		},
+		{
+			name:             "connection resets",
+			opts:             []Option{noWait, WithMaxRetries(2)},
+			pattern:          FailurePattern{Requests: 100, FailureRate: 1},
+			wantRequests:     100,
+			wantMeanAttempts: 3,
+		},
+		{
+			name:             "status not retried",
+			opts:             []Option{noWait, WithMaxRetries(2)},
+			pattern:          FailurePattern{Requests: 100, FailureRate: 1, Status: http.StatusInternalServerError},
+			wantRequests:     100,
+			wantMeanAttempts: 1,
+		},
+		{
+			name: "backoff counted",
+			opts: []Option{
+				WithMaxRetries(2),
+				WithBackoff(ExponentialBackoff{Base: time.Second, Max: time.Minute, Jitter: NoJitter}),
+			},
+			pattern:          FailurePattern{Requests: 10, FailureRate: 1, Status: http.StatusServiceUnavailable, Latency: 10 * time.Millisecond},
+			wantRequests:     10,
+			wantMeanAttempts: 3,
+			wantLatency:      3*time.Second + 30*time.Millisecond,
+		},
+		{
+			name:    "partial outage",
+			opts:    []Option{noWait, WithMaxRetries(3)},
+			pattern: FailurePattern{Requests: 1000, FailureRate: 0.5, Status: http.StatusBadGateway, Seed: 1},
+			check: func(t *testing.T, r SimulationReport) {
+				if r.MeanAttempts <= 1.5 || r.MeanAttempts >= 2.5 || r.MaxAttempts != 4 {
+					t.Errorf("attempts: mean %v, max %d", r.MeanAttempts, r.MaxAttempts)
+				}
+				if r.SuccessRate <= 0.9 || r.SuccessRate >= 1 {
+					t.Errorf("success rate = %v", r.SuccessRate)
+				}
+				total := 0
+				for attempts, n := range r.AttemptCounts {
+					if attempts < 1 || attempts > 4 {
+						t.Errorf("%d requests took %d attempts", n, attempts)
+					}
+					total += n
+				}
+				if total != r.Requests {
+					t.Errorf("AttemptCounts covers %d requests, want %d", total, r.Requests)
+				}
+			},
+		},
+		{
+			name:    "jitter",
+			pattern: FailurePattern{Requests: 1000, Latency: 10 * time.Millisecond, Jitter: 10 * time.Millisecond, Seed: 1},
+			check: func(t *testing.T, r SimulationReport) {
+				if r.P50 < 10*time.Millisecond || !(r.P50 <= r.P90 && r.P90 <= r.P99 && r.P99 <= r.MaxLatency) || r.MaxLatency >= 20*time.Millisecond {
+					t.Errorf("latencies: p50 %v, p90 %v, p99 %v, max %v", r.P50, r.P90, r.P99, r.MaxLatency)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Simulate(tt.opts, tt.pattern)
+			if tt.check != nil {
+				tt.check(t, r)
+				return
+			}
+			if r.Requests != tt.wantRequests || r.SuccessRate != tt.wantSuccessRate || r.MeanAttempts != tt.wantMeanAttempts {
+				t.Errorf("Simulate() = %d requests, success rate %v, mean attempts %v, want %d, %v, %v",
+					r.Requests, r.SuccessRate, r.MeanAttempts, tt.wantRequests, tt.wantSuccessRate, tt.wantMeanAttempts)
+			}
+			wantCounts := map[int]int{int(tt.wantMeanAttempts): tt.wantRequests}
+			if r.MaxAttempts != int(tt.wantMeanAttempts) || !reflect.DeepEqual(r.AttemptCounts, wantCounts) {
+				t.Errorf("attempts: max %d, counts %v, want %v", r.MaxAttempts, r.AttemptCounts, wantCounts)
+			}
+			if r.P50 != tt.wantLatency || r.MaxLatency != tt.wantLatency {
+				t.Errorf("latency: p50 %v, max %v, want %v", r.P50, r.MaxLatency, tt.wantLatency)
+			}
+		})
+	}
+}
+
+func TestSimulateSeeded(t *testing.T) {
+	opts := []Option{WithMaxRetries(3), WithBackoff(ExponentialBackoff{Base: 100 * time.Millisecond, Max: time.Second})}
+	pattern := FailurePattern{Requests: 500, FailureRate: 0.3, Status: http.StatusServiceUnavailable, Jitter: 50 * time.Millisecond, Seed: 42}
+
+	// The same seed gives the same report, whatever the backoff jitter
+	a, b := Simulate(opts, pattern), Simulate(opts, pattern)
+	if a.MeanAttempts != b.MeanAttempts || !reflect.DeepEqual(a.AttemptCounts, b.AttemptCounts) {
+		t.Errorf("runs differ: %v and %v", a.AttemptCounts, b.AttemptCounts)
+	}
+	pattern.Seed = 43
+	if c := Simulate(opts, pattern); reflect.DeepEqual(a.AttemptCounts, c.AttemptCounts) {
+		t.Errorf("seeds 42 and 43 gave the same attempts %v", c.AttemptCounts)
+	}
+}
+
+func TestSimulationReportString(t *testing.T) {
+	r := SimulationReport{
+		Requests:     100,
+		SuccessRate:  0.995,
+		MeanAttempts: 1.25,
+		MaxAttempts:  3,
+		P50:          10 * time.Millisecond,
+		P90:          1500 * time.Microsecond,
+		P99:          time.Second,
+		MaxLatency:   3*time.Second + 400*time.Microsecond,
+	}
+	want := "requests: 100, success rate: 99.50%\n" +
+		"attempts: mean 1.250 (load x1.25), max 3\n" +
+		"latency: p50 10ms, p90 2ms, p99 1s, max 3s"
+	if got := r.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+}
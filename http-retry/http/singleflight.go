@@ -0,0 +1,122 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultSingleflightVary are the request headers distinguishing otherwise
+// identical requests for WithSingleflight.
+var DefaultSingleflightVary = []string{"Authorization", "Cookie", "Accept", "Accept-Encoding", "Accept-Language"}
+
+var errFlightPanicked = errors.New("rhttp: shared request panicked")
+
+// flightGroup lets concurrent identical GET and HEAD requests share one
+// upstream request and its retries.
+type flightGroup struct {
+	vary []string
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	done chan struct{}
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+// WithSingleflight makes concurrent GET and HEAD requests for the same URL,
+// with the same values of the vary headers, share a single upstream request
+// and its retries. Every caller gets its own copy of the response, whose body
+// is buffered in memory. vary defaults to DefaultSingleflightVary.
+func WithSingleflight(vary ...string) Option {
+	if len(vary) == 0 {
+		vary = DefaultSingleflightVary
+	}
+	g := &flightGroup{vary: vary, flights: make(map[string]*flight)}
+
+	return func(c *config) {
+		c.singleflight = g
+	}
+}
+
+func (g *flightGroup) key(req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(req.Method + " " + req.URL.String())
+	for _, name := range g.vary {
+		b.WriteString("\n" + name + ":" + strings.Join(req.Header.Values(name), ","))
+	}
+
+	return b.String()
+}
+
+// do sends req through next, or waits for an identical request already in
+// flight and shares its response.
+func (g *flightGroup) do(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if g == nil || (req.Method != http.MethodGet && req.Method != http.MethodHead) ||
+		(req.Body != nil && req.Body != http.NoBody) {
+		return next(req)
+	}
+
+	key := g.key(req)
+	g.mu.Lock()
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		return g.wait(req, f, next)
+	}
+	// The error stays if next panics, so the waiters are not left hanging
+	f := &flight{done: make(chan struct{}), err: errFlightPanicked}
+	g.flights[key] = f
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.flights, key)
+		g.mu.Unlock()
+		close(f.done)
+	}()
+
+	f.resp, f.err = next(req)
+	if f.err == nil {
+		f.body, f.err = ioutil.ReadAll(f.resp.Body)
+		f.resp.Body.Close()
+	}
+
+	return f.response(req)
+}
+
+// wait waits for f on behalf of req. If f failed only because its own caller
+// gave up, req is sent on its own.
+func (g *flightGroup) wait(req *http.Request, f *flight, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-f.done:
+	}
+
+	if errors.Is(f.err, context.Canceled) || errors.Is(f.err, context.DeadlineExceeded) {
+		return next(req)
+	}
+
+	return f.response(req)
+}
+
+// response returns a copy of the shared response for req.
+func (f *flight) response(req *http.Request) (*http.Response, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	resp := *f.resp
+	resp.Header = f.resp.Header.Clone()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(f.body))
+	resp.Request = req
+
+	return &resp, nil
+}
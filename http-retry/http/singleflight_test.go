@@ -0,0 +1,264 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitingContext reports on waiting when Done is first called, which the
+// flight group does only for a request waiting on another one.
+type waitingContext struct {
+	context.Context
+	once    sync.Once
+	waiting chan<- struct{}
+}
+
+func (c *waitingContext) Done() <-chan struct{} {
+	c.once.Do(func() { c.waiting <- struct{}{} })
+	return c.Context.Done()
+}
+
+// flightNext is a next function for a flightGroup counting its calls and not
+// returning before release is closed.
+type flightNext struct {
+	calls   int64
+	called  chan struct{}
+	release chan struct{}
+	result  func(req *http.Request) (*http.Response, error)
+}
+
+func newFlightNext(result func(req *http.Request) (*http.Response, error)) *flightNext {
+	if result == nil {
+		result = func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("body")), Request: req}, nil
+		}
+	}
+
+	return &flightNext{called: make(chan struct{}, 16), release: make(chan struct{}), result: result}
+}
+
+func (n *flightNext) next(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&n.calls, 1)
+	n.called <- struct{}{}
+	<-n.release
+
+	return n.result(req)
+}
+
+func TestSingleflight(t *testing.T) {
+	tests := []struct {
+		name      string
+		vary      []string
+		requests  func() []*http.Request
+		wantCalls int64
+	}{
+		{
+			name: "identical GETs shared",
+			requests: func() []*http.Request {
+				return []*http.Request{newGet(t, nil), newGet(t, nil), newGet(t, nil)}
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "HEAD shared",
+			requests: func() []*http.Request {
+				head, _ := http.NewRequest(http.MethodHead, "http://example.com/a", nil)
+				head2, _ := http.NewRequest(http.MethodHead, "http://example.com/a", nil)
+				return []*http.Request{head, head2}
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "different URLs",
+			requests: func() []*http.Request {
+				other, _ := http.NewRequest(http.MethodGet, "http://example.com/b", nil)
+				return []*http.Request{newGet(t, nil), other}
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "different vary headers",
+			requests: func() []*http.Request {
+				return []*http.Request{newGet(t, http.Header{"Authorization": {"a"}}), newGet(t, http.Header{"Authorization": {"b"}})}
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "other headers ignored",
+			requests: func() []*http.Request {
+				return []*http.Request{newGet(t, http.Header{"X-Trace": {"1"}}), newGet(t, http.Header{"X-Trace": {"2"}})}
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "custom vary",
+			vary: []string{"X-Tenant"},
+			requests: func() []*http.Request {
+				return []*http.Request{
+					newGet(t, http.Header{"X-Tenant": {"a"}, "Authorization": {"a"}}),
+					newGet(t, http.Header{"X-Tenant": {"a"}, "Authorization": {"b"}}),
+					newGet(t, http.Header{"X-Tenant": {"b"}}),
+				}
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "POSTs not shared",
+			requests: func() []*http.Request {
+				a, _ := http.NewRequest(http.MethodPost, "http://example.com/a", nil)
+				b, _ := http.NewRequest(http.MethodPost, "http://example.com/a", nil)
+				return []*http.Request{a, b}
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "GETs with a body not shared",
+			requests: func() []*http.Request {
+				a, _ := http.NewRequest(http.MethodGet, "http://example.com/a", strings.NewReader("x"))
+				b, _ := http.NewRequest(http.MethodGet, "http://example.com/a", strings.NewReader("x"))
+				return []*http.Request{a, b}
+			},
+			wantCalls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vary := tt.vary
+			if vary == nil {
+				vary = DefaultSingleflightVary
+			}
+			g := &flightGroup{vary: vary, flights: make(map[string]*flight)}
+			n := newFlightNext(nil)
+
+			reqs := tt.requests()
+			waiting := make(chan struct{}, len(reqs))
+			bodies := make(chan string, len(reqs))
+			for _, req := range reqs {
+				req = req.WithContext(&waitingContext{Context: context.Background(), waiting: waiting})
+				go func(req *http.Request) {
+					resp, err := g.do(req, n.next)
+					if err != nil {
+						t.Errorf("do() error = %v", err)
+						bodies <- ""
+						return
+					}
+					body, _ := ioutil.ReadAll(resp.Body)
+					if resp.Request != req {
+						t.Error("a shared response carries another caller's request")
+					}
+					bodies <- string(body)
+				}(req)
+				// Each request either sends or waits before the next one
+				select {
+				case <-n.called:
+				case <-waiting:
+				case <-time.After(5 * time.Second):
+					t.Fatal("a request neither sent nor waited")
+				}
+			}
+			close(n.release)
+
+			for range reqs {
+				if body := <-bodies; body != "body" {
+					t.Errorf("body = %q, want %q", body, "body")
+				}
+			}
+			if n.calls != tt.wantCalls {
+				t.Errorf("%d upstream requests, want %d", n.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func newGet(t *testing.T, header http.Header) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	return req
+}
+
+func TestSingleflightLeaderFails(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name      string
+		result    error
+		panics    bool
+		wantErr   error
+		wantCalls int64
+	}{
+		{name: "error shared", result: errBoom, wantErr: errBoom, wantCalls: 1},
+		{name: "cancelled leader", result: context.Canceled, wantCalls: 2},
+		{name: "deadline of the leader", result: context.DeadlineExceeded, wantCalls: 2},
+		{name: "panic", panics: true, wantErr: errFlightPanicked, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &flightGroup{vary: DefaultSingleflightVary, flights: make(map[string]*flight)}
+			var calls int64
+			n := newFlightNext(func(req *http.Request) (*http.Response, error) {
+				if atomic.AddInt64(&calls, 1) > 1 {
+					return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("body"))}, nil
+				}
+				if tt.panics {
+					panic("boom")
+				}
+				return nil, tt.result
+			})
+
+			go func() {
+				defer func() { recover() }()
+				g.do(newGet(t, nil), n.next)
+			}()
+			<-n.called
+
+			waiting := make(chan struct{}, 1)
+			follower := newGet(t, nil).WithContext(&waitingContext{Context: context.Background(), waiting: waiting})
+			done := make(chan error, 1)
+			go func() {
+				resp, err := g.do(follower, n.next)
+				if err == nil {
+					resp.Body.Close()
+				}
+				done <- err
+			}()
+			<-waiting
+			close(n.release)
+
+			if err := <-done; !errors.Is(err, tt.wantErr) {
+				t.Errorf("follower error = %v, want %v", err, tt.wantErr)
+			}
+			if n.calls != tt.wantCalls {
+				t.Errorf("%d upstream requests, want %d", n.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSingleflightFollowerGivesUp(t *testing.T) {
+	g := &flightGroup{vary: DefaultSingleflightVary, flights: make(map[string]*flight)}
+	n := newFlightNext(nil)
+	defer close(n.release)
+	go g.do(newGet(t, nil), n.next)
+	<-n.called
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.do(newGet(t, nil).WithContext(ctx), n.next); !errors.Is(err, context.Canceled) {
+		t.Errorf("do() error = %v, want context.Canceled", err)
+	}
+	if n.calls != 1 {
+		t.Errorf("%d upstream requests, want 1", n.calls)
+	}
+}
@@ -0,0 +1,203 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a server-sent event. Type is "message" unless the server named
+// it, and ID is the last event ID the server set.
+type Event struct {
+	ID   string
+	Type string
+	Data string
+}
+
+// SSEHandler receives the events of a subscription. Any field may be nil.
+type SSEHandler struct {
+	// OnEvent is called with every event. An error ends the subscription
+	// and is returned by SubscribeSSE.
+	OnEvent func(Event) error
+	// OnReconnect is called when the stream broke with err and is reopened
+	// after delay. attempt counts the reconnects since the last event.
+	OnReconnect func(attempt int, delay time.Duration, err error)
+}
+
+// errStreamEnded reports a stream closed by the server.
+var errStreamEnded = errors.New("rhttp: event stream ended")
+
+// SubscribeSSE streams the server-sent events at url to h until ctx is done,
+// h fails or the server answers 204 No Content. A broken stream is reopened
+// with a Last-Event-ID header after the wait the server asked for, or the
+// client's backoff. The initial connection and every reconnect are retried
+// like any request; when the client gives up, SubscribeSSE returns the error.
+// The client's timeouts, cache, singleflight, decompression, validators and
+// response size limit do not apply to the stream.
+func (c *RetryableClient) SubscribeSSE(ctx context.Context, url string, h SSEHandler) error {
+	s := sseStream{h: h}
+	var delay time.Duration
+	for attempt := 0; ; {
+		err := c.openSSE(ctx, url, &s)
+		if err == nil || ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var stop *sseStop
+		if errors.As(err, &stop) {
+			return stop.err
+		}
+
+		if s.received {
+			attempt, delay = 0, 0
+			s.received = false
+		}
+		delay = backoffDelay(c.current().backoff, attempt, delay)
+		if s.retry > 0 {
+			delay = s.retry
+		}
+		attempt++
+		if h.OnReconnect != nil {
+			h.OnReconnect(attempt, delay, err)
+		}
+		if err := sleep(ctx, c.config.clock, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// sseStop wraps the errors ending a subscription instead of a reconnect.
+type sseStop struct {
+	err error
+}
+
+func (e *sseStop) Error() string {
+	return e.err.Error()
+}
+
+// sseStream is the state of a subscription kept across reconnects.
+type sseStream struct {
+	h           SSEHandler
+	lastEventID string
+	retry       time.Duration
+	received    bool
+}
+
+// openSSE reads one connection of the stream. It returns nil when the server
+// asked to stop, an *sseStop when the subscription must end, and any other
+// error when the stream broke.
+func (c *RetryableClient) openSSE(ctx context.Context, url string, s *sseStream) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return &sseStop{err}
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-store")
+	req.Header.Set("Accept-Encoding", "identity")
+	if s.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", s.lastEventID)
+	}
+
+	resp, err := c.Do(ctx, req, streaming())
+	if err != nil {
+		return &sseStop{err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return nil
+	case resp.StatusCode != http.StatusOK:
+		return &sseStop{c.current().statusError(resp)}
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/event-stream" {
+		return &sseStop{fmt.Errorf("rhttp: unexpected event stream content type %q", resp.Header.Get("Content-Type"))}
+	}
+
+	return s.read(resp.Body)
+}
+
+// read dispatches the events of body until it ends.
+func (s *sseStream) read(body io.Reader) error {
+	r := bufio.NewReader(body)
+	var data strings.Builder
+	eventType := ""
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = errStreamEnded
+			}
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			// A blank line dispatches the event
+			if data.Len() > 0 {
+				ev := Event{ID: s.lastEventID, Type: eventType, Data: strings.TrimSuffix(data.String(), "\n")}
+				if ev.Type == "" {
+					ev.Type = "message"
+				}
+				s.received = true
+				if s.h.OnEvent != nil {
+					if err := s.h.OnEvent(ev); err != nil {
+						return &sseStop{err}
+					}
+				}
+			}
+			data.Reset()
+			eventType = ""
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.lastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseInt(value, 10, 64); err == nil && digits(value) {
+				if ms > int64(maxDuration/time.Millisecond) {
+					ms = int64(maxDuration / time.Millisecond)
+				}
+				s.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// streaming turns off the options buffering or bounding a response body, for
+// long-lived streams.
+func streaming() Option {
+	return func(c *config) {
+		c.timeout = 0
+		c.attemptTimeout = 0
+		c.bodyReadTimeout = 0
+		c.cache = nil
+		c.mirror = nil
+		c.singleflight = nil
+		c.decoders = nil
+		c.validators = nil
+		c.verifyBodies = false
+		c.maxResponseBytes = 0
+	}
+}
@@ -0,0 +1,243 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSSERead(t *testing.T) {
+	tests := []struct {
+		name       string
+		stream     string
+		wantEvents []Event
+		wantID     string
+		wantRetry  time.Duration
+	}{
+		{
+			name:       "message",
+			stream:     "data: hello\n\n",
+			wantEvents: []Event{{Type: "message", Data: "hello"}},
+		},
+		{
+			name:       "named event with id",
+			stream:     "event: update\nid: 7\ndata: x\n\n",
+			wantEvents: []Event{{ID: "7", Type: "update", Data: "x"}},
+			wantID:     "7",
+		},
+		{
+			name:       "multi-line data",
+			stream:     "data: a\ndata: b\n\n",
+			wantEvents: []Event{{Type: "message", Data: "a\nb"}},
+		},
+		{
+			name:       "CRLF and no space",
+			stream:     "data:x\r\n\r\n",
+			wantEvents: []Event{{Type: "message", Data: "x"}},
+		},
+		{
+			name:       "comments and unknown fields ignored",
+			stream:     ": ping\nfoo: bar\ndata: x\n\n",
+			wantEvents: []Event{{Type: "message", Data: "x"}},
+		},
+		{
+			name:       "no data, no event",
+			stream:     "event: update\nid: 1\n\ndata: x\n\n",
+			wantEvents: []Event{{ID: "1", Type: "message", Data: "x"}},
+			wantID:     "1",
+		},
+		{
+			name:       "id kept across events",
+			stream:     "id: 1\ndata: a\n\ndata: b\n\n",
+			wantEvents: []Event{{ID: "1", Type: "message", Data: "a"}, {ID: "1", Type: "message", Data: "b"}},
+			wantID:     "1",
+		},
+		{
+			name:       "id with NUL ignored",
+			stream:     "id: a\x00b\ndata: x\n\n",
+			wantEvents: []Event{{Type: "message", Data: "x"}},
+		},
+		{
+			name:      "retry",
+			stream:    "retry: 1500\n\n",
+			wantRetry: 1500 * time.Millisecond,
+		},
+		{
+			name:   "invalid retry ignored",
+			stream: "retry: 1.5\nretry: -1\nretry: 1s\n\n",
+		},
+		{
+			name:      "huge retry capped",
+			stream:    "retry: 99999999999999999\n\n",
+			wantRetry: maxDuration / time.Millisecond * time.Millisecond,
+		},
+		{
+			name:   "unterminated event dropped",
+			stream: "data: partial\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []Event
+			s := sseStream{h: SSEHandler{OnEvent: func(e Event) error {
+				events = append(events, e)
+				return nil
+			}}}
+			if err := s.read(strings.NewReader(tt.stream)); err != errStreamEnded {
+				t.Errorf("read() error = %v, want errStreamEnded", err)
+			}
+			if !reflect.DeepEqual(events, tt.wantEvents) {
+				t.Errorf("events = %+v, want %+v", events, tt.wantEvents)
+			}
+			if s.lastEventID != tt.wantID || s.retry != tt.wantRetry {
+				t.Errorf("last event ID, retry = %q, %v, want %q, %v", s.lastEventID, s.retry, tt.wantID, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestSubscribeSSE(t *testing.T) {
+	errHandler := errors.New("handler")
+	tests := []struct {
+		name string
+		// connections writes the nth connection's answer, the last one
+		// repeating.
+		connections    []func(w http.ResponseWriter)
+		onEvent        func(Event) error
+		wantErr        func(error) bool
+		wantLastIDs    []string
+		wantReconnects int
+	}{
+		{
+			name: "ends on 204",
+			connections: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusNoContent) },
+			},
+			wantErr:     func(err error) bool { return err == nil },
+			wantLastIDs: []string{""},
+		},
+		{
+			name: "reconnects with the last event ID",
+			connections: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { writeSSE(w, "id: 1\ndata: a\n\n") },
+				func(w http.ResponseWriter) { writeSSE(w, "retry: 10\nid: 2\ndata: b\n\n") },
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusNoContent) },
+			},
+			wantErr:        func(err error) bool { return err == nil },
+			wantLastIDs:    []string{"", "1", "2"},
+			wantReconnects: 2,
+		},
+		{
+			name: "handler error",
+			connections: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { writeSSE(w, "data: a\n\n") },
+			},
+			onEvent:     func(Event) error { return errHandler },
+			wantErr:     func(err error) bool { return errors.Is(err, errHandler) },
+			wantLastIDs: []string{""},
+		},
+		{
+			name: "status error",
+			connections: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) },
+			},
+			wantErr: func(err error) bool {
+				var statusErr *StatusError
+				return errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound
+			},
+			wantLastIDs: []string{""},
+		},
+		{
+			name: "not an event stream",
+			connections: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.Write([]byte("<html>")) },
+			},
+			wantErr:     func(err error) bool { return err != nil && strings.Contains(err.Error(), "content type") },
+			wantLastIDs: []string{""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var lastIDs []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				n := len(lastIDs)
+				lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+				mu.Unlock()
+				if n >= len(tt.connections) {
+					n = len(tt.connections) - 1
+				}
+				tt.connections[n](w)
+			}))
+			defer srv.Close()
+
+			reconnects := 0
+			c := NewRetryableClient(fastBackoff, WithClock(newStepClock()))
+			err := c.SubscribeSSE(context.Background(), srv.URL, SSEHandler{
+				OnEvent:     tt.onEvent,
+				OnReconnect: func(int, time.Duration, error) { reconnects++ },
+			})
+			if !tt.wantErr(err) {
+				t.Errorf("SubscribeSSE() error = %v", err)
+			}
+			if !reflect.DeepEqual(lastIDs, tt.wantLastIDs) {
+				t.Errorf("Last-Event-ID of each connection = %q, want %q", lastIDs, tt.wantLastIDs)
+			}
+			if reconnects != tt.wantReconnects {
+				t.Errorf("reconnected %d times, want %d", reconnects, tt.wantReconnects)
+			}
+		})
+	}
+}
+
+func writeSSE(w http.ResponseWriter, stream string) {
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Write([]byte(stream))
+}
+
+func TestSubscribeSSEIgnoresMaxResponseBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "id: %d\ndata: an event long enough to pass the cap\n\n", i)
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	done := errors.New("done")
+	var events []Event
+	reconnects := 0
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := NewRetryableClient(WithMaxResponseBytes(16))
+	err := c.SubscribeSSE(ctx, srv.URL, SSEHandler{
+		OnEvent: func(e Event) error {
+			events = append(events, e)
+			if len(events) == 3 {
+				return done
+			}
+			return nil
+		},
+		OnReconnect: func(int, time.Duration, error) { reconnects++ },
+	})
+
+	if !errors.Is(err, done) {
+		t.Fatalf("SubscribeSSE() = %v, want the handler's error", err)
+	}
+	if reconnects != 0 {
+		t.Errorf("reconnected %d times, want a single stream", reconnects)
+	}
+	if len(events) != 3 || events[2].ID != "3" {
+		t.Errorf("last event ID = %q, want 3", events[2].ID)
+	}
+}
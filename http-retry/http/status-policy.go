@@ -0,0 +1,96 @@
+package http
+
+import "net/http"
+
+// StatusPolicy is a declarative RetryPolicy. A response is retried when its
+// status is listed in Codes or its class (5 for 5xx) in Classes, unless the
+// status is listed in Never. Transport errors are retried when their class is
+// listed in Errors, or when Errors is empty unless they are certificate errors.
+type StatusPolicy struct {
+	Codes   []int
+	Classes []int
+	Never   []int
+	Errors  []ErrorClass
+}
+
+func (p *StatusPolicy) ShouldRetry(resp *http.Response, err error, attempt int) bool {
+	if err != nil {
+		if len(p.Errors) == 0 {
+			return defaultRetryableError(err)
+		}
+		class := ClassifyError(err)
+		for _, c := range p.Errors {
+			if c == class {
+				return true
+			}
+		}
+		return false
+	}
+
+	code := resp.StatusCode
+	if containsInt(p.Never, code) {
+		return false
+	}
+
+	return containsInt(p.Codes, code) || containsInt(p.Classes, code/100)
+}
+
+func (p *StatusPolicy) clone() *StatusPolicy {
+	return &StatusPolicy{
+		Codes:   append([]int(nil), p.Codes...),
+		Classes: append([]int(nil), p.Classes...),
+		Never:   append([]int(nil), p.Never...),
+		Errors:  append([]ErrorClass(nil), p.Errors...),
+	}
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// statusPolicy returns a copy of the StatusPolicy configured on c, or a new
+// one replacing any other policy.
+func (c *config) statusPolicy(seed []int) *StatusPolicy {
+	if p, ok := c.policy.(*StatusPolicy); ok {
+		return p.clone()
+	}
+
+	return &StatusPolicy{Codes: append([]int(nil), seed...)}
+}
+
+// RetryOn retries responses with the given status codes, on top of transport
+// errors. Combined with the other status options it replaces the default
+// policy, e.g. RetryOn(429, 502, 503, 504).
+func RetryOn(codes ...int) Option {
+	return func(c *config) {
+		p := c.statusPolicy(nil)
+		p.Codes = append(p.Codes, codes...)
+		c.policy = p
+	}
+}
+
+// RetryOn5xx retries every 5xx response, on top of transport errors.
+func RetryOn5xx() Option {
+	return func(c *config) {
+		p := c.statusPolicy(nil)
+		p.Classes = append(p.Classes, 5)
+		c.policy = p
+	}
+}
+
+// NeverRetry excludes status codes that would otherwise be retried, e.g.
+// RetryOn5xx(), NeverRetry(501). On its own it removes codes from the default
+// set of retried statuses.
+func NeverRetry(codes ...int) Option {
+	return func(c *config) {
+		p := c.statusPolicy(defaultRetryStatuses)
+		p.Never = append(p.Never, codes...)
+		c.policy = p
+	}
+}
@@ -0,0 +1,121 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestStatusOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		retried   []int
+		unretried []int
+	}{
+		{
+			name:      "default",
+			retried:   []int{429, 502, 503, 504},
+			unretried: []int{200, 400, 404, 500, 501},
+		},
+		{
+			name:      "RetryOn replaces the default",
+			opts:      []Option{RetryOn(500, 409)},
+			retried:   []int{409, 500},
+			unretried: []int{429, 502, 503, 504},
+		},
+		{
+			name:      "RetryOn accumulates",
+			opts:      []Option{RetryOn(500), RetryOn(502)},
+			retried:   []int{500, 502},
+			unretried: []int{503},
+		},
+		{
+			name:      "RetryOn5xx",
+			opts:      []Option{RetryOn5xx()},
+			retried:   []int{500, 501, 503, 599},
+			unretried: []int{429, 200, 404},
+		},
+		{
+			name:      "RetryOn5xx and NeverRetry",
+			opts:      []Option{RetryOn5xx(), NeverRetry(501)},
+			retried:   []int{500, 503},
+			unretried: []int{501},
+		},
+		{
+			name:      "NeverRetry alone trims the default",
+			opts:      []Option{NeverRetry(429)},
+			retried:   []int{502, 503, 504},
+			unretried: []int{429, 500},
+		},
+		{
+			name:      "NeverRetry before RetryOn",
+			opts:      []Option{NeverRetry(503), RetryOn(500)},
+			retried:   []int{429, 500, 502, 504},
+			unretried: []int{503},
+		},
+		{
+			name:      "Never wins over Codes",
+			opts:      []Option{RetryOn(500), NeverRetry(500)},
+			unretried: []int{500},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := newConfig(tt.opts...).policy
+			for _, code := range tt.retried {
+				if !policy.ShouldRetry(&http.Response{StatusCode: code}, nil, 1) {
+					t.Errorf("%d not retried", code)
+				}
+			}
+			for _, code := range tt.unretried {
+				if policy.ShouldRetry(&http.Response{StatusCode: code}, nil, 1) {
+					t.Errorf("%d retried", code)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusOptionsDoNotShareState(t *testing.T) {
+	base := newConfig(RetryOn(500))
+	derived := base.with(RetryOn(502))
+
+	if base.policy.ShouldRetry(&http.Response{StatusCode: 502}, nil, 1) {
+		t.Error("an option applied to a derived config changed the original")
+	}
+	if !derived.policy.ShouldRetry(&http.Response{StatusCode: 500}, nil, 1) {
+		t.Error("a derived config lost the original's codes")
+	}
+}
+
+func TestStatusPolicyErrors(t *testing.T) {
+	errOther := errors.New("boom")
+	tests := []struct {
+		name   string
+		policy StatusPolicy
+		err    error
+		want   bool
+	}{
+		{name: "any error by default", err: errOther, want: true},
+		{name: "certificate errors never by default", err: &CertificateError{Err: errors.New("x509")}},
+		{
+			name:   "listed class",
+			policy: StatusPolicy{Errors: []ErrorClass{ErrorClassTimeout}},
+			err:    &TimeoutError{Phase: TimeoutResponseHeader, Err: errors.New("slow")},
+			want:   true,
+		},
+		{
+			name:   "class not listed",
+			policy: StatusPolicy{Errors: []ErrorClass{ErrorClassTimeout}},
+			err:    errOther,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.ShouldRetry(nil, tt.err, 1); got != tt.want {
+				t.Errorf("ShouldRetry(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TimeoutPhase tells which part of an attempt timed out.
+type TimeoutPhase int
+
+const (
+	// TimeoutConnect means no connection could be made in time. Nothing was
+	// sent, so it is retried whatever the method.
+	TimeoutConnect TimeoutPhase = iota
+	// TimeoutTLSHandshake means the TLS handshake did not complete in time.
+	// Nothing was sent either.
+	TimeoutTLSHandshake
+	// TimeoutResponseHeader means the request was sent but the response
+	// headers did not arrive in time.
+	TimeoutResponseHeader
+	// TimeoutBodyRead means the response body stopped arriving for too long.
+	TimeoutBodyRead
+)
+
+func (p TimeoutPhase) String() string {
+	switch p {
+	case TimeoutConnect:
+		return "connect"
+	case TimeoutTLSHandshake:
+		return "tls handshake"
+	case TimeoutResponseHeader:
+		return "response header"
+	case TimeoutBodyRead:
+		return "body read"
+	default:
+		return fmt.Sprintf("TimeoutPhase(%d)", int(p))
+	}
+}
+
+// DefaultRetriedTimeouts are the timeout phases retried unless
+// RetryOnTimeouts says otherwise. A body that stalls is not retried, since a
+// new attempt would start the transfer over; see Download for resuming it.
+var DefaultRetriedTimeouts = []TimeoutPhase{TimeoutConnect, TimeoutTLSHandshake, TimeoutResponseHeader}
+
+// TimeoutError reports an attempt that timed out in Phase. It is classified
+// as ErrorClassTimeout.
+type TimeoutError struct {
+	Phase TimeoutPhase
+	// Limit is the timeout that passed, zero if it is not known.
+	Limit time.Duration
+	Err   error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Limit > 0 {
+		return fmt.Sprintf("rhttp: %s timeout after %s", e.Phase, e.Limit)
+	}
+
+	return fmt.Sprintf("rhttp: %s timeout", e.Phase)
+}
+
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+// Timeout reports true, as net.Error does for timeouts.
+func (e *TimeoutError) Timeout() bool { return true }
+
+// unsent reports whether the attempt failed before the request was written.
+func (e *TimeoutError) unsent() bool {
+	return e.Phase == TimeoutConnect || e.Phase == TimeoutTLSHandshake
+}
+
+// WithConnectTimeout bounds how long a new connection may take, with every
+// address of the host tried. It applies to an *http.Transport, see
+// WithTransport.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.connectTimeout = d
+	}
+}
+
+// WithTLSHandshakeTimeout bounds the TLS handshake of a new connection. It
+// applies to an *http.Transport, see WithTransport.
+func WithTLSHandshakeTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.tlsHandshakeTimeout = d
+	}
+}
+
+// WithResponseHeaderTimeout bounds the wait for the response headers once
+// the request is written, so a server slow to first byte fails into a retry.
+// It applies to an *http.Transport, see WithTransport.
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.responseHeaderTimeout = d
+	}
+}
+
+// WithBodyReadTimeout fails a read of the response body that waits more than
+// d for data, however long the whole body takes, so a stalled transfer does
+// not hang until the request deadline.
+func WithBodyReadTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.bodyReadTimeout = d
+	}
+}
+
+// RetryOnTimeouts retries the timeouts of the given phases only, instead of
+// DefaultRetriedTimeouts. The retry policy still has the last word on them.
+// With no phase, no timeout is retried.
+func RetryOnTimeouts(phases ...TimeoutPhase) Option {
+	return func(c *config) {
+		c.retriedTimeouts = append([]TimeoutPhase{}, phases...)
+	}
+}
+
+// retriesTimeout reports whether timeouts in phase may be retried.
+func (c *config) retriesTimeout(phase TimeoutPhase) bool {
+	phases := c.retriedTimeouts
+	if phases == nil {
+		phases = DefaultRetriedTimeouts
+	}
+	for _, p := range phases {
+		if p == phase {
+			return true
+		}
+	}
+
+	return false
+}
+
+// timeoutRetryable reports whether err may be retried as far as its timeout
+// phase goes, true if it is not a *TimeoutError.
+func (c *config) timeoutRetryable(err error) bool {
+	var te *TimeoutError
+	if !errors.As(err, &te) {
+		return true
+	}
+
+	return c.retriesTimeout(te.Phase)
+}
+
+// unsentTimeout reports whether err is a timeout hit before the request was
+// written, which even a non-idempotent request may be resent after.
+func unsentTimeout(err error) bool {
+	var te *TimeoutError
+
+	return errors.As(err, &te) && te.unsent()
+}
+
+// timeoutError turns the timeouts reported by http.Transport into a
+// *TimeoutError telling their phase.
+func (c *config) timeoutError(err error) error {
+	var te *TimeoutError
+	if errors.As(err, &te) {
+		return err
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "TLS handshake timeout"):
+		return &TimeoutError{Phase: TimeoutTLSHandshake, Limit: c.tlsHandshakeTimeout, Err: err}
+	case strings.Contains(msg, "timeout awaiting response headers"):
+		return &TimeoutError{Phase: TimeoutResponseHeader, Limit: c.responseHeaderTimeout, Err: err}
+	default:
+		return err
+	}
+}
+
+// connectTimeoutDialer bounds dial by d, failing with a *TimeoutError.
+func connectTimeoutDialer(dial dialFunc, d time.Duration) dialFunc {
+	if dial == nil {
+		dial = (&net.Dialer{KeepAlive: 30 * time.Second}).DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialCtx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+
+		conn, err := dial(dialCtx, network, addr)
+		if err != nil && ctx.Err() == nil && dialCtx.Err() == context.DeadlineExceeded {
+			return nil, &TimeoutError{Phase: TimeoutConnect, Limit: d, Err: err}
+		}
+
+		return conn, err
+	}
+}
+
+// idleTimeoutBody fails a Read waiting more than timeout for data, by
+// cancelling the attempt's context.
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	clock   Clock
+	cancel  context.CancelFunc
+	// timer is reused by every Read with the system clock.
+	timer   *time.Timer
+	expired int32
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, clock Clock, cancel context.CancelFunc) *idleTimeoutBody {
+	b := &idleTimeoutBody{ReadCloser: body, timeout: timeout, clock: clock, cancel: cancel}
+	if _, ok := clock.(systemClock); ok {
+		b.timer = time.AfterFunc(timeout, b.expire)
+		b.timer.Stop()
+	}
+
+	return b
+}
+
+func (b *idleTimeoutBody) expire() {
+	atomic.StoreInt32(&b.expired, 1)
+	b.cancel()
+}
+
+// watch arms the timeout for one Read, returning the function disarming it.
+func (b *idleTimeoutBody) watch() func() {
+	if b.timer != nil {
+		b.timer.Reset(b.timeout)
+		return func() { b.timer.Stop() }
+	}
+
+	wake, stop := newTimer(b.clock, b.timeout)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-wake:
+			b.expire()
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		stop()
+	}
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	stop := b.watch()
+	n, err := b.ReadCloser.Read(p)
+	stop()
+	if err != nil && err != io.EOF && atomic.LoadInt32(&b.expired) == 1 {
+		err = &TimeoutError{Phase: TimeoutBodyRead, Limit: b.timeout, Err: err}
+	}
+
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,284 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTimeoutPhaseString(t *testing.T) {
+	tests := []struct {
+		phase TimeoutPhase
+		want  string
+	}{
+		{TimeoutConnect, "connect"},
+		{TimeoutTLSHandshake, "tls handshake"},
+		{TimeoutResponseHeader, "response header"},
+		{TimeoutBodyRead, "body read"},
+		{TimeoutPhase(9), "TimeoutPhase(9)"},
+	}
+	for _, tt := range tests {
+		if got := tt.phase.String(); got != tt.want {
+			t.Errorf("TimeoutPhase(%d).String() = %q, want %q", int(tt.phase), got, tt.want)
+		}
+	}
+}
+
+func TestTimeoutError(t *testing.T) {
+	cause := errors.New("i/o timeout")
+	tests := []struct {
+		name       string
+		err        *TimeoutError
+		wantMsg    string
+		wantUnsent bool
+	}{
+		{name: "connect", err: &TimeoutError{Phase: TimeoutConnect, Limit: time.Second, Err: cause}, wantMsg: "rhttp: connect timeout after 1s", wantUnsent: true},
+		{name: "handshake", err: &TimeoutError{Phase: TimeoutTLSHandshake, Err: cause}, wantMsg: "rhttp: tls handshake timeout", wantUnsent: true},
+		{name: "response header", err: &TimeoutError{Phase: TimeoutResponseHeader, Limit: 5 * time.Second, Err: cause}, wantMsg: "rhttp: response header timeout after 5s"},
+		{name: "body read", err: &TimeoutError{Phase: TimeoutBodyRead, Err: cause}, wantMsg: "rhttp: body read timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.wantMsg {
+				t.Errorf("Error() = %q, want %q", got, tt.wantMsg)
+			}
+			var timeout interface{ Timeout() bool }
+			if !errors.Is(tt.err, cause) || !errors.As(tt.err, &timeout) || !timeout.Timeout() {
+				t.Error("not a timeout wrapping its cause")
+			}
+			if got := unsentTimeout(tt.err); got != tt.wantUnsent {
+				t.Errorf("unsentTimeout() = %v, want %v", got, tt.wantUnsent)
+			}
+		})
+	}
+}
+
+func TestRetryOnTimeouts(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want map[TimeoutPhase]bool
+	}{
+		{
+			name: "default",
+			want: map[TimeoutPhase]bool{TimeoutConnect: true, TimeoutTLSHandshake: true, TimeoutResponseHeader: true, TimeoutBodyRead: false},
+		},
+		{
+			name: "chosen",
+			opts: []Option{RetryOnTimeouts(TimeoutConnect, TimeoutBodyRead)},
+			want: map[TimeoutPhase]bool{TimeoutConnect: true, TimeoutTLSHandshake: false, TimeoutResponseHeader: false, TimeoutBodyRead: true},
+		},
+		{
+			name: "none",
+			opts: []Option{RetryOnTimeouts()},
+			want: map[TimeoutPhase]bool{TimeoutConnect: false, TimeoutTLSHandshake: false, TimeoutResponseHeader: false, TimeoutBodyRead: false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(tt.opts...)
+			for phase, want := range tt.want {
+				if got := cfg.timeoutRetryable(&TimeoutError{Phase: phase}); got != want {
+					t.Errorf("timeout in phase %v retryable = %v, want %v", phase, got, want)
+				}
+			}
+			if !cfg.timeoutRetryable(errors.New("not a timeout")) {
+				t.Error("error other than a timeout not retryable")
+			}
+		})
+	}
+}
+
+func TestTimeoutErrorOfTransport(t *testing.T) {
+	cfg := newConfig(WithTLSHandshakeTimeout(time.Second), WithResponseHeaderTimeout(2*time.Second))
+	tests := []struct {
+		name      string
+		err       error
+		wantPhase TimeoutPhase
+		wantLimit time.Duration
+		// wantSame is set when the error is returned as it is.
+		wantSame bool
+	}{
+		{name: "TLS handshake", err: errors.New("net/http: TLS handshake timeout"), wantPhase: TimeoutTLSHandshake, wantLimit: time.Second},
+		{name: "response header", err: errors.New("net/http: timeout awaiting response headers"), wantPhase: TimeoutResponseHeader, wantLimit: 2 * time.Second},
+		{name: "already a timeout", err: &TimeoutError{Phase: TimeoutConnect}, wantSame: true},
+		{name: "other", err: errors.New("connection reset by peer"), wantSame: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cfg.timeoutError(tt.err)
+			if tt.wantSame {
+				if err != tt.err {
+					t.Errorf("timeoutError() = %v, want %v as it is", err, tt.err)
+				}
+				return
+			}
+			var te *TimeoutError
+			if !errors.As(err, &te) || te.Phase != tt.wantPhase || te.Limit != tt.wantLimit || te.Err != tt.err {
+				t.Errorf("timeoutError() = %#v", err)
+			}
+		})
+	}
+}
+
+func TestConnectTimeoutDialer(t *testing.T) {
+	refused := errors.New("connection refused")
+	tests := []struct {
+		name string
+		dial dialFunc
+		// cancel cancels the caller's context before dialing.
+		cancel      bool
+		wantTimeout bool
+		wantErr     error
+	}{
+		{
+			name: "connected",
+			dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				client, server := net.Pipe()
+				server.Close()
+				return client, nil
+			},
+		},
+		{
+			name: "blackholed",
+			dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+			wantTimeout: true,
+		},
+		{
+			name:    "refused",
+			dial:    func(ctx context.Context, network, addr string) (net.Conn, error) { return nil, refused },
+			wantErr: refused,
+		},
+		{
+			name: "cancelled by the caller",
+			dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+			cancel:  true,
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			conn, err := connectTimeoutDialer(tt.dial, 10*time.Millisecond)(ctx, "tcp", "192.0.2.1:80")
+			if conn != nil {
+				conn.Close()
+			}
+			var te *TimeoutError
+			switch {
+			case tt.wantTimeout:
+				if !errors.As(err, &te) || te.Phase != TimeoutConnect || te.Limit != 10*time.Millisecond {
+					t.Errorf("dial error = %v, want a connect timeout", err)
+				}
+			case errors.As(err, &te):
+				t.Errorf("dial error = %v, want no timeout", err)
+			case !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil):
+				t.Errorf("dial error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithResponseHeaderTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		opts   []Option
+		// wantSent is the number of attempts, wantErr whether the request
+		// fails with a response header timeout.
+		wantSent int32
+		wantErr  bool
+	}{
+		{name: "retried", method: http.MethodGet, wantSent: 2},
+		{name: "not retried", method: http.MethodGet, opts: []Option{RetryOnTimeouts(TimeoutConnect)}, wantSent: 1, wantErr: true},
+		{name: "sent write not resent", method: http.MethodPost, wantSent: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent int32
+			release := make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&sent, 1) == 1 {
+					<-release
+				}
+			}))
+			defer srv.Close()
+			defer close(release)
+			c := NewRetryableClient(append([]Option{fastBackoff, WithResponseHeaderTimeout(20 * time.Millisecond)}, tt.opts...)...)
+			req, _ := NewRequest(context.Background(), tt.method, srv.URL, "payload")
+
+			resp, err := c.Do(context.Background(), req)
+			if err == nil {
+				drainBody(resp)
+			}
+			var te *TimeoutError
+			if tt.wantErr != (errors.As(err, &te) && te.Phase == TimeoutResponseHeader) {
+				t.Errorf("Do() error = %v, want a response header timeout: %v", err, tt.wantErr)
+			}
+			if n := atomic.LoadInt32(&sent); n != tt.wantSent {
+				t.Errorf("%d attempts, want %d", n, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestWithBodyReadTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		// chunks are written every gap.
+		chunks  int
+		gap     time.Duration
+		wantErr bool
+	}{
+		{name: "steady", chunks: 5, gap: 10 * time.Millisecond},
+		{name: "stalled", chunks: 2, gap: 500 * time.Millisecond, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for i := 0; i < tt.chunks; i++ {
+					w.Write([]byte("chunk"))
+					w.(http.Flusher).Flush()
+					select {
+					case <-r.Context().Done():
+						return
+					case <-time.After(tt.gap):
+					}
+				}
+			}))
+			defer srv.Close()
+			c := NewRetryableClient(WithBodyReadTimeout(100 * time.Millisecond))
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			var te *TimeoutError
+			if tt.wantErr {
+				if !errors.As(err, &te) || te.Phase != TimeoutBodyRead || te.Limit != 100*time.Millisecond {
+					t.Errorf("read error = %v, want a body read timeout", err)
+				}
+			} else if err != nil || len(body) != 5*tt.chunks {
+				t.Errorf("read %q, %v", body, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// NetworkPhase is a step of an attempt, from resolving the host to reading
+// the response.
+type NetworkPhase int
+
+const (
+	PhaseDNS NetworkPhase = iota
+	PhaseConnect
+	PhaseTLS
+	// PhaseRequest is writing the request on a connection.
+	PhaseRequest
+	// PhaseResponse is waiting for the server to respond.
+	PhaseResponse
+)
+
+var phaseNames = [...]string{"dns", "connect", "tls", "request", "response"}
+
+func (p NetworkPhase) String() string {
+	if p < 0 || int(p) >= len(phaseNames) {
+		return "unknown"
+	}
+
+	return phaseNames[p]
+}
+
+// AttemptTimings are the network timings of an attempt, see
+// WithNetworkTimings. Durations are zero for the phases skipped, e.g. when
+// the connection was reused.
+type AttemptTimings struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// TimeToFirstByte runs from the request being written to the first byte
+	// of the response.
+	TimeToFirstByte time.Duration
+	ReusedConn      bool
+	// Phase is the last phase the attempt reached, telling for a failed one
+	// whether it failed to connect, in the TLS handshake or at the server.
+	Phase NetworkPhase
+}
+
+// WithNetworkTimings traces every attempt with net/http/httptrace and records
+// its AttemptTimings in Attempt.Timings, also available to hooks with
+// AttemptTimingsOf.
+func WithNetworkTimings() Option {
+	return func(c *config) {
+		c.networkTimings = true
+	}
+}
+
+type timingsKey struct{}
+
+// AttemptTimingsOf returns the timings of the attempt req so far, e.g. from
+// Hooks.OnResponse, and false if it was not traced.
+func AttemptTimingsOf(req *http.Request) (AttemptTimings, bool) {
+	tr, ok := req.Context().Value(timingsKey{}).(*timingsTrace)
+	if !ok {
+		return AttemptTimings{}, false
+	}
+
+	return tr.snapshot(), true
+}
+
+// timingsTrace collects the timings of an attempt. Its callbacks may run on
+// the transport's dialing goroutines.
+type timingsTrace struct {
+	clock Clock
+
+	mu                                      sync.Mutex
+	timings                                 AttemptTimings
+	dnsStart, connectStart, tlsStart, wrote time.Time
+}
+
+// traceTimings returns ctx tracing the attempt made with it.
+func (c *config) traceTimings(ctx context.Context) (context.Context, *timingsTrace) {
+	tr := &timingsTrace{clock: c.clock}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			tr.update(func(now time.Time) { tr.dnsStart = now })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			tr.update(func(now time.Time) { tr.timings.DNS = now.Sub(tr.dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			tr.update(func(now time.Time) {
+				// Dialing several addresses at once counts from the first
+				if tr.connectStart.IsZero() {
+					tr.connectStart = now
+				}
+				tr.timings.Phase = PhaseConnect
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				tr.update(func(now time.Time) { tr.timings.Connect = now.Sub(tr.connectStart) })
+			}
+		},
+		TLSHandshakeStart: func() {
+			tr.update(func(now time.Time) {
+				tr.tlsStart = now
+				tr.timings.Phase = PhaseTLS
+			})
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			tr.update(func(now time.Time) { tr.timings.TLS = now.Sub(tr.tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			tr.update(func(time.Time) {
+				tr.timings.ReusedConn = info.Reused
+				tr.timings.Phase = PhaseRequest
+			})
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			tr.update(func(now time.Time) {
+				tr.wrote = now
+				tr.timings.Phase = PhaseResponse
+			})
+		},
+		GotFirstResponseByte: func() {
+			tr.update(func(now time.Time) { tr.timings.TimeToFirstByte = now.Sub(tr.wrote) })
+		},
+	}
+
+	return httptrace.WithClientTrace(context.WithValue(ctx, timingsKey{}, tr), trace), tr
+}
+
+func (tr *timingsTrace) update(f func(now time.Time)) {
+	now := tr.clock.Now()
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	f(now)
+}
+
+func (tr *timingsTrace) snapshot() AttemptTimings {
+	if tr == nil {
+		return AttemptTimings{}
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return tr.timings
+}
@@ -0,0 +1,157 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithNetworkTimings(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	unavailable := newScriptServer(t, 503, 200)
+	secure := httptest.NewTLSServer(handler)
+	secure.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	defer secure.Close()
+	trusted := secure.Client().Transport.(*http.Transport).TLSClientConfig
+
+	tests := []struct {
+		name string
+		url  string
+		opts []Option
+		// check is called with the timings of every attempt.
+		check   func(t *testing.T, attempt int, got AttemptTimings)
+		wantErr bool
+	}{
+		{
+			name: "new connection",
+			url:  plain.URL,
+			check: func(t *testing.T, attempt int, got AttemptTimings) {
+				if got.ReusedConn || got.Connect <= 0 || got.TLS != 0 || got.TimeToFirstByte < 10*time.Millisecond || got.Phase != PhaseResponse {
+					t.Errorf("timings = %+v", got)
+				}
+			},
+		},
+		{
+			name: "reused connection",
+			url:  unavailable.URL,
+			check: func(t *testing.T, attempt int, got AttemptTimings) {
+				if attempt == 2 && (!got.ReusedConn || got.Connect != 0 || got.Phase != PhaseResponse) {
+					t.Errorf("timings of the retry = %+v", got)
+				}
+			},
+		},
+		{
+			name: "TLS",
+			url:  secure.URL,
+			opts: []Option{WithTLSConfig(trusted)},
+			check: func(t *testing.T, attempt int, got AttemptTimings) {
+				if got.Connect <= 0 || got.TLS <= 0 || got.Phase != PhaseResponse {
+					t.Errorf("timings = %+v", got)
+				}
+			},
+		},
+		{
+			name:    "TLS handshake failed",
+			url:     secure.URL,
+			wantErr: true,
+			check: func(t *testing.T, attempt int, got AttemptTimings) {
+				if got.Phase != PhaseTLS || got.TimeToFirstByte != 0 {
+					t.Errorf("timings = %+v", got)
+				}
+			},
+		},
+		{
+			name:    "connection refused",
+			url:     "http://127.0.0.1:1",
+			opts:    []Option{WithMaxRetries(1)},
+			wantErr: true,
+			check: func(t *testing.T, attempt int, got AttemptTimings) {
+				if got.Phase != PhaseConnect || got.Connect != 0 {
+					t.Errorf("timings = %+v", got)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var traced []AttemptTimings
+			c := NewRetryableClient(append([]Option{
+				fastBackoff,
+				WithNetworkTimings(),
+				WithHooks(Hooks{
+					OnResponse: func(req *http.Request, resp *http.Response, err error, attempt int) {
+						timings, ok := AttemptTimingsOf(req)
+						if !ok {
+							t.Errorf("attempt %d not traced", attempt)
+						}
+						mu.Lock()
+						traced = append(traced, timings)
+						mu.Unlock()
+					},
+				}),
+			}, tt.opts...)...)
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, tt.url))
+			if tt.wantErr {
+				var retryErr *RetryError
+				if err == nil {
+					t.Fatal("Do() succeeded, want an error")
+				}
+				if errors.As(err, &retryErr) {
+					for i, a := range retryErr.Attempts {
+						if a.Timings != traced[i] {
+							t.Errorf("attempt %d recorded %+v, traced %+v", i+1, a.Timings, traced[i])
+						}
+					}
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				drainBody(resp)
+			}
+			if len(traced) == 0 {
+				t.Fatal("no attempt traced")
+			}
+			for i, timings := range traced {
+				tt.check(t, i+1, timings)
+			}
+		})
+	}
+}
+
+func TestAttemptTimingsOfUntraced(t *testing.T) {
+	if got, ok := AttemptTimingsOf(mustNewRequest(t, "http://example.com")); ok || got != (AttemptTimings{}) {
+		t.Errorf("AttemptTimingsOf() = %+v, %v, want nothing", got, ok)
+	}
+}
+
+func TestNetworkPhaseString(t *testing.T) {
+	tests := []struct {
+		phase NetworkPhase
+		want  string
+	}{
+		{PhaseDNS, "dns"},
+		{PhaseConnect, "connect"},
+		{PhaseTLS, "tls"},
+		{PhaseRequest, "request"},
+		{PhaseResponse, "response"},
+		{NetworkPhase(-1), "unknown"},
+		{NetworkPhase(42), "unknown"},
+	}
+	for _, tt := range tests {
+		if got := tt.phase.String(); got != tt.want {
+			t.Errorf("NetworkPhase(%d).String() = %q, want %q", int(tt.phase), got, tt.want)
+		}
+	}
+}
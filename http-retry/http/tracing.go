@@ -0,0 +1,70 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// Attribute is a key/value annotation on a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span is the subset of a tracing span the client needs.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Tracer starts spans. The client starts a parent span for every logical
+// request and a child span for each attempt, so an adapter over an
+// OpenTelemetry trace.Tracer is enough to see retry storms in traces.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+// tracing tells whether a Tracer is set, so spans and their attributes are
+// only built when someone looks at them.
+func (c *config) tracing() bool {
+	_, nop := c.tracer.(nopTracer)
+	return !nop
+}
+
+func (nopSpan) SetAttributes(...Attribute) {}
+func (nopSpan) RecordError(error)          {}
+func (nopSpan) End()                       {}
+
+// endSpan annotates span with the outcome of resp and err and ends it.
+func endSpan(span Span, resp *http.Response, err error, attrs ...Attribute) {
+	if _, ok := span.(nopSpan); ok {
+		return
+	}
+	if resp != nil {
+		attrs = append(attrs, Attribute{Key: "http.status_code", Value: resp.StatusCode})
+	}
+	span.SetAttributes(attrs...)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// retryReason describes why an attempt is being retried.
+func retryReason(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+
+	return strconv.Itoa(resp.StatusCode)
+}
@@ -0,0 +1,158 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// recordingTracer records the spans it starts.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+type parentKey struct{}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := &recordingSpan{name: name, attrs: map[string]interface{}{}}
+	if parent, ok := ctx.Value(parentKey{}).(*recordingSpan); ok {
+		s.parent = parent.name
+	}
+	t.spans = append(t.spans, s)
+
+	return context.WithValue(ctx, parentKey{}, s), s
+}
+
+type recordingSpan struct {
+	mu     sync.Mutex
+	name   string
+	parent string
+	attrs  map[string]interface{}
+	errs   int
+	ended  bool
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.errs++
+}
+
+func (s *recordingSpan) End() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ended = true
+}
+
+func TestTracing(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		opts     []Option
+		// want lists each span as its name, <parent> and status code.
+		want []string
+		// wantReasons are the retry reasons of the attempt spans retried.
+		wantReasons []interface{}
+		wantErrors  int
+	}{
+		{
+			name:     "single attempt",
+			statuses: []int{200},
+			want:     []string{"HTTP GET <> 200", "HTTP GET attempt <HTTP GET> 200"},
+		},
+		{
+			name:     "retried",
+			statuses: []int{503, 200},
+			want: []string{
+				"HTTP GET <> 200",
+				"HTTP GET attempt <HTTP GET> 503",
+				"HTTP GET attempt <HTTP GET> 200",
+			},
+			wantReasons: []interface{}{"503"},
+		},
+		{
+			name:     "given up",
+			statuses: []int{503},
+			opts:     []Option{WithMaxRetries(1)},
+			want: []string{
+				"HTTP GET <> <nil>",
+				"HTTP GET attempt <HTTP GET> 503",
+				"HTTP GET attempt <HTTP GET> 503",
+			},
+			wantReasons: []interface{}{"503"},
+			wantErrors:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			tracer := &recordingTracer{}
+			c := NewRetryableClient(append([]Option{fastBackoff, WithMaxRetryAfter(0), WithTracer(tracer)}, tt.opts...)...)
+
+			resp, err := c.Do(context.Background(), mustNewRequest(t, srv.URL))
+			if err == nil {
+				drainBody(resp)
+			}
+
+			var got []string
+			var reasons []interface{}
+			errs := 0
+			for _, s := range tracer.spans {
+				got = append(got, fmt.Sprintf("%s <%s> %v", s.name, s.parent, s.attrs["http.status_code"]))
+				if reason, ok := s.attrs["retry.reason"]; ok {
+					reasons = append(reasons, reason)
+				}
+				errs += s.errs
+				if !s.ended {
+					t.Errorf("span %q not ended", s.name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("spans = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(reasons, tt.wantReasons) {
+				t.Errorf("retry reasons = %v, want %v", reasons, tt.wantReasons)
+			}
+			if errs != tt.wantErrors {
+				t.Errorf("%d errors recorded, want %d", errs, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestRetryReason(t *testing.T) {
+	if got := retryReason(nil, errors.New("connection reset")); got != "connection reset" {
+		t.Errorf("retryReason(error) = %q", got)
+	}
+	if got := retryReason(&http.Response{StatusCode: 503}, nil); got != "503" {
+		t.Errorf("retryReason(503) = %q", got)
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	if newConfig().tracing() || newConfig(WithTracer(nil)).tracing() {
+		t.Error("tracing enabled without a tracer")
+	}
+	if !newConfig(WithTracer(&recordingTracer{})).tracing() {
+		t.Error("tracing disabled with a tracer")
+	}
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// WithTransport makes the retry logic wrap rt instead of the transport of the
+// client given with WithHTTPClient, or a new *http.Transport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *config) {
+		c.transport = rt
+	}
+}
+
+// WithProxy sets the proxy function of the underlying *http.Transport, e.g.
+// http.ProxyFromEnvironment.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(c *config) {
+		c.proxy = proxy
+		c.proxyFailover = nil
+	}
+}
+
+// WithProxyURL sends every request through the proxy at u. Besides HTTP and
+// HTTPS proxies, u may be a socks5 URL, and credentials in u authenticate to
+// the proxy. See WithProxies to fail over between several proxies.
+func WithProxyURL(u *url.URL) Option {
+	return WithProxy(http.ProxyURL(u))
+}
+
+// WithTLSConfig sets the TLS configuration of the underlying *http.Transport,
+// e.g. to trust a private CA or present a client certificate.
+func WithTLSConfig(tc *tls.Config) Option {
+	return func(c *config) {
+		c.tlsConfig = tc
+	}
+}
+
+// WithDialContext sets the function the underlying *http.Transport opens
+// connections with.
+func WithDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(c *config) {
+		c.dialContext = dial
+	}
+}
+
+// WithUnixSocket connects to the Unix domain socket at path whatever the
+// request's host, e.g. to talk to a local daemon with requests to
+// http://localhost/v1.43/containers/json.
+func WithUnixSocket(path string) Option {
+	var d net.Dialer
+
+	return WithDialContext(func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return d.DialContext(ctx, "unix", path)
+	})
+}
+
+// baseTransport returns the transport the retry logic wraps: base, or the
+// one from WithTransport, with the proxy, TLS, dialer, dual-stack, timeout,
+// endpoint and HTTP/2 options applied to a copy of it. Those only apply to an
+// *http.Transport; other round trippers are used as they are.
+func (c *config) baseTransport(base http.RoundTripper) http.RoundTripper {
+	if c.transport != nil {
+		base = c.transport
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if c.proxy == nil && c.tlsConfig == nil && c.getClientCertificate == nil && c.dialContext == nil && c.dualStack == nil &&
+		c.connectTimeout <= 0 && c.tlsHandshakeTimeout <= 0 && c.responseHeaderTimeout <= 0 &&
+		c.endpointSelection == EndpointInOrder && c.http2ReadIdleTimeout <= 0 {
+		return base
+	}
+
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return base
+	}
+	t = t.Clone()
+	if c.proxy != nil {
+		t.Proxy = c.proxy
+	}
+	if c.tlsConfig != nil {
+		t.TLSClientConfig = c.tlsConfig.Clone()
+	}
+	if c.getClientCertificate != nil {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.GetClientCertificate = c.getClientCertificate
+	}
+	if c.dialContext != nil {
+		t.DialContext = c.dialContext
+	}
+	if c.dualStack != nil {
+		t.DialContext = newDualStackDialer(t.DialContext, *c.dualStack).DialContext
+	}
+	if c.endpointSelection == EndpointRotate {
+		t.DialContext = newRotatingDialer(t.DialContext).DialContext
+	}
+	if c.connectTimeout > 0 {
+		t.DialContext = connectTimeoutDialer(t.DialContext, c.connectTimeout)
+	}
+	if c.tlsHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = c.tlsHandshakeTimeout
+	}
+	if c.responseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = c.responseHeaderTimeout
+	}
+	if c.http2ReadIdleTimeout > 0 {
+		c.configureHTTP2(t)
+	}
+	if c.proxyFailover != nil {
+		return &proxyFailoverTransport{transport: t, failover: c.proxyFailover}
+	}
+
+	return t
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBaseTransport(t *testing.T) {
+	proxyURL := &url.URL{Scheme: "http", Host: "proxy.example.com:3128"}
+	custom := &opaqueTransport{}
+	tests := []struct {
+		name string
+		opts []Option
+		base http.RoundTripper
+		// wantBase is set when the base transport must be used as it is.
+		wantBase http.RoundTripper
+		check    func(t *testing.T, tr *http.Transport)
+	}{
+		{name: "no options", base: http.DefaultTransport, wantBase: http.DefaultTransport},
+		{name: "nil base", wantBase: http.DefaultTransport},
+		{name: "WithTransport", opts: []Option{WithTransport(custom)}, base: http.DefaultTransport, wantBase: custom},
+		{name: "not an *http.Transport", opts: []Option{WithProxyURL(proxyURL)}, base: custom, wantBase: custom},
+		{
+			name: "proxy",
+			opts: []Option{WithProxyURL(proxyURL)},
+			check: func(t *testing.T, tr *http.Transport) {
+				req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+				if u, err := tr.Proxy(req); err != nil || u.String() != proxyURL.String() {
+					t.Errorf("proxy = %v, %v, want %v", u, err, proxyURL)
+				}
+			},
+		},
+		{
+			name: "TLS configuration",
+			opts: []Option{WithTLSConfig(&tls.Config{ServerName: "internal"})},
+			check: func(t *testing.T, tr *http.Transport) {
+				if tr.TLSClientConfig == nil || tr.TLSClientConfig.ServerName != "internal" {
+					t.Errorf("TLS configuration = %+v", tr.TLSClientConfig)
+				}
+			},
+		},
+		{
+			name: "timeouts",
+			opts: []Option{WithTLSHandshakeTimeout(2 * time.Second), WithResponseHeaderTimeout(3 * time.Second)},
+			check: func(t *testing.T, tr *http.Transport) {
+				if tr.TLSHandshakeTimeout != 2*time.Second || tr.ResponseHeaderTimeout != 3*time.Second {
+					t.Errorf("timeouts = %v, %v", tr.TLSHandshakeTimeout, tr.ResponseHeaderTimeout)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newConfig(tt.opts...).baseTransport(tt.base)
+			if tt.check == nil {
+				if got != tt.wantBase {
+					t.Errorf("baseTransport() = %T, want the base transport", got)
+				}
+				return
+			}
+
+			tr, ok := got.(*http.Transport)
+			if !ok || tr == http.DefaultTransport {
+				t.Fatalf("baseTransport() = %T, want a copy of the default transport", got)
+			}
+			tt.check(t, tr)
+		})
+	}
+}
+
+// opaqueTransport is a round tripper that is not an *http.Transport.
+type opaqueTransport struct{}
+
+func (*opaqueTransport) RoundTrip(*http.Request) (*http.Response, error) { return nil, nil }
+
+func TestBaseTransportLeavesBaseAlone(t *testing.T) {
+	base := &http.Transport{}
+	newConfig(WithTLSConfig(&tls.Config{ServerName: "internal"})).baseTransport(base)
+	// Cloning sets up HTTP/2 on base, which gives it a TLS configuration
+	if base.TLSClientConfig != nil && base.TLSClientConfig.ServerName != "" {
+		t.Error("baseTransport() changed the transport it was given")
+	}
+}
+
+func TestWithUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daemon.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("no Unix sockets: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+	c := NewRetryableClient(WithUnixSocket(path))
+
+	_, body, err := c.GetBytes(context.Background(), "http://localhost/v1.43/containers/json")
+	if err != nil || string(body) != "/v1.43/containers/json" {
+		t.Errorf("GetBytes() = %q, %v", body, err)
+	}
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tunable holds the configuration of a client, which UpdatePolicy replaces at
+// runtime. Requests already in flight keep the configuration they started
+// with.
+type tunable struct {
+	base    *config
+	current atomic.Value // tuned
+
+	mu sync.Mutex // serializes updates
+}
+
+type tuned struct {
+	config   *config
+	settings *Settings
+}
+
+func newTunable(cfg *config) *tunable {
+	t := &tunable{base: cfg}
+	t.current.Store(tuned{config: cfg})
+
+	return t
+}
+
+func (t *tunable) load() tuned {
+	return t.current.Load().(tuned)
+}
+
+// UpdatePolicy applies s on top of the options the client was created with,
+// replacing the settings of any previous update, so retry, backoff and
+// circuit settings can be changed while the client is in use. A nil s reverts
+// to the original options. Requests already in flight are not affected.
+func (c *RetryableClient) UpdatePolicy(s *Settings) error {
+	if s != nil {
+		if err := s.validate(true); err != nil {
+			return err
+		}
+	}
+
+	c.tunable.mu.Lock()
+	defer c.tunable.mu.Unlock()
+
+	c.tunable.current.Store(tuned{config: c.tunable.base.with(WithSettings(s)), settings: s})
+
+	return nil
+}
+
+// Policy returns the settings of the last UpdatePolicy, nil if there was none.
+func (c *RetryableClient) Policy() *Settings {
+	return c.tunable.load().settings
+}
+
+// current returns the client's configuration as last updated.
+func (c *RetryableClient) current() *config {
+	return c.tunable.load().config
+}
+
+// DefaultWatchInterval is how often WatchSettings reloads the settings file
+// when given no positive interval.
+const DefaultWatchInterval = time.Second
+
+// WatchSettings reloads the settings file at path every interval, applying it
+// with UpdatePolicy whenever its content changes, until ctx is done. errs, if
+// not nil, is called when the file cannot be read or parsed, in which case the
+// previous settings stay in effect until it is fixed. An interval that is not
+// positive is DefaultWatchInterval. Run it in its own goroutine:
+//
+//	go client.WatchSettings(ctx, "/etc/app/http-retry.json", 10*time.Second, log.Print)
+func (c *RetryableClient) WatchSettings(ctx context.Context, path string, interval time.Duration, errs func(error)) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	report := func(err error) {
+		if errs != nil {
+			errs(err)
+		}
+	}
+
+	var last []byte
+	for {
+		b, err := ioutil.ReadFile(path)
+		switch {
+		case err != nil:
+			report(err)
+		case !bytes.Equal(b, last):
+			// A broken file is reported once, not on every reload
+			last = b
+			s, err := ParseSettings(b)
+			if err == nil {
+				err = c.UpdatePolicy(s)
+			}
+			if err != nil {
+				report(err)
+			}
+		}
+
+		if err := sleep(ctx, c.config.clock, interval); err != nil {
+			return
+		}
+	}
+}
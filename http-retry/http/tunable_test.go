@@ -0,0 +1,75 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUpdatePolicy(t *testing.T) {
+	srv := newScriptServer(t, 503)
+	c := NewRetryableClient(WithMaxRetries(3), fastBackoff)
+
+	one := 1
+	if err := c.UpdatePolicy(&Settings{MaxRetries: &one}); err != nil {
+		t.Fatalf("UpdatePolicy() error = %v", err)
+	}
+	if _, _, err := c.GetBytes(context.Background(), srv.URL); err == nil {
+		t.Fatal("GetBytes() succeeded against a failing server")
+	}
+	if srv.count() != 2 {
+		t.Errorf("server received %d requests under max_retries 1, want 2", srv.count())
+	}
+	if c.Policy() == nil || *c.Policy().MaxRetries != 1 {
+		t.Errorf("Policy() = %+v, want the updated settings", c.Policy())
+	}
+
+	negative := -1
+	if err := c.UpdatePolicy(&Settings{MaxRetries: &negative}); err == nil {
+		t.Error("UpdatePolicy() accepted negative max_retries")
+	}
+
+	if err := c.UpdatePolicy(nil); err != nil {
+		t.Fatalf("UpdatePolicy(nil) error = %v", err)
+	}
+	c.GetBytes(context.Background(), srv.URL)
+	if srv.count() != 2+4 {
+		t.Errorf("server received %d requests after reverting, want %d", srv.count(), 2+4)
+	}
+	if c.Policy() != nil {
+		t.Errorf("Policy() = %+v after reverting, want nil", c.Policy())
+	}
+}
+
+func TestWatchSettingsDefaultsInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if err := ioutil.WriteFile(path, []byte(`{"max_retries": 1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := newStepClock()
+	clock.onWait = func(n int, _ time.Duration) {
+		switch n {
+		case 1:
+			ioutil.WriteFile(path, []byte(`{"max_retries": 2}`), 0o600)
+		case 3:
+			cancel()
+		}
+	}
+	c := NewRetryableClient(WithClock(clock))
+
+	c.WatchSettings(ctx, path, 0, func(err error) { t.Errorf("WatchSettings reported %v", err) })
+
+	for i, d := range clock.Waits() {
+		if d != DefaultWatchInterval {
+			t.Errorf("wait %d = %v, want DefaultWatchInterval", i+1, d)
+		}
+	}
+	if p := c.Policy(); p == nil || *p.MaxRetries != 2 {
+		t.Errorf("Policy() = %+v, want the reloaded max_retries 2", p)
+	}
+}
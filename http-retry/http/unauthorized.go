@@ -0,0 +1,36 @@
+package http
+
+import (
+	"context"
+	"net/http"
+)
+
+// TokenRefresher returns a new value for the Authorization header of a
+// request whose credentials were rejected, e.g. "Bearer " + a fresh token.
+type TokenRefresher func(ctx context.Context) (string, error)
+
+type reauthorizer struct {
+	refresh  TokenRefresher
+	statuses []int
+}
+
+// WithOnUnauthorized calls refresh when an attempt is answered 401, or one of
+// statuses if given, and replays the request at once with the Authorization
+// header it returns. This happens once per request and does not count as a
+// retry; if the replay is rejected too, or refresh fails, the response goes
+// through the retry policy as usual. refresh may be called by concurrent
+// requests at the same time, so it should share the token it obtains.
+func WithOnUnauthorized(refresh TokenRefresher, statuses ...int) Option {
+	if len(statuses) == 0 {
+		statuses = []int{http.StatusUnauthorized}
+	}
+
+	return func(c *config) {
+		c.reauthorizer = &reauthorizer{refresh: refresh, statuses: statuses}
+	}
+}
+
+// rejected reports whether resp rejected the request's credentials.
+func (r *reauthorizer) rejected(resp *http.Response) bool {
+	return r != nil && resp != nil && containsInt(r.statuses, resp.StatusCode)
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWithOnUnauthorized(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		rejects    []int
+		refreshErr error
+		opts       []Option
+		wantStatus int
+		// wantAuth is the Authorization header of each attempt.
+		wantAuth      []string
+		wantRefreshes int
+	}{
+		{
+			name:       "accepted",
+			statuses:   []int{200},
+			wantStatus: 200,
+			wantAuth:   []string{"Bearer old"},
+		},
+		{
+			name:          "replayed with a fresh token",
+			statuses:      []int{401, 200},
+			wantStatus:    200,
+			wantAuth:      []string{"Bearer old", "Bearer new"},
+			wantRefreshes: 1,
+		},
+		{
+			name:          "not a retry",
+			statuses:      []int{401, 503, 200},
+			opts:          []Option{WithMaxRetries(1)},
+			wantStatus:    200,
+			wantAuth:      []string{"Bearer old", "Bearer new", "Bearer new"},
+			wantRefreshes: 1,
+		},
+		{
+			name:          "refreshed once",
+			statuses:      []int{401},
+			wantStatus:    401,
+			wantAuth:      []string{"Bearer old", "Bearer new"},
+			wantRefreshes: 1,
+		},
+		{
+			name:          "refresh fails",
+			statuses:      []int{401, 200},
+			refreshErr:    errors.New("token endpoint down"),
+			wantStatus:    401,
+			wantAuth:      []string{"Bearer old"},
+			wantRefreshes: 1,
+		},
+		{
+			name:          "other statuses",
+			statuses:      []int{403, 200},
+			rejects:       []int{403},
+			wantStatus:    200,
+			wantAuth:      []string{"Bearer old", "Bearer new"},
+			wantRefreshes: 1,
+		},
+		{
+			name:       "401 not among the statuses",
+			statuses:   []int{401, 200},
+			rejects:    []int{403},
+			wantStatus: 401,
+			wantAuth:   []string{"Bearer old"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			refreshes := 0
+			refresh := func(ctx context.Context) (string, error) {
+				refreshes++
+				return "Bearer new", tt.refreshErr
+			}
+			c := NewRetryableClient(append([]Option{fastBackoff, WithMaxRetryAfter(0), WithOnUnauthorized(refresh, tt.rejects...)}, tt.opts...)...)
+			req := mustNewRequest(t, srv.URL)
+			req.Header.Set("Authorization", "Bearer old")
+
+			resp, err := c.Do(context.Background(), req)
+			if err != nil || resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Do() = %v, %v, want %d", resp, err, tt.wantStatus)
+			}
+			drainBody(resp)
+
+			if srv.count() != len(tt.wantAuth) {
+				t.Fatalf("server received %d requests, want %d", srv.count(), len(tt.wantAuth))
+			}
+			for i, want := range tt.wantAuth {
+				if r, _ := srv.request(i); r.Header.Get("Authorization") != want {
+					t.Errorf("attempt %d Authorization = %q, want %q", i+1, r.Header.Get("Authorization"), want)
+				}
+			}
+			if refreshes != tt.wantRefreshes {
+				t.Errorf("%d refreshes, want %d", refreshes, tt.wantRefreshes)
+			}
+		})
+	}
+}
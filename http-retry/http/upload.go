@@ -0,0 +1,153 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// DefaultChunkSize is the default chunk size of UploadChunks.
+const DefaultChunkSize = 8 << 20
+
+// Chunk is one part of a chunked upload, Size bytes at Offset of a body of
+// Total bytes. Index counts from zero.
+type Chunk struct {
+	Index  int
+	Offset int64
+	Size   int64
+	Total  int64
+}
+
+// UploadOptions configures UploadChunks. Every field is optional.
+type UploadOptions struct {
+	// ChunkSize defaults to DefaultChunkSize.
+	ChunkSize int64
+	// Offset skips the start of the body, e.g. to resume an upload from the
+	// Offset of a ChunkError. It should fall on a chunk boundary.
+	Offset int64
+	// Method is the method of the default chunk requests, PUT by default.
+	Method string
+	// Header is added to the default chunk requests.
+	Header http.Header
+	// NewRequest builds the request sending a chunk, replacing the default
+	// one with a Content-Range header, e.g. for an S3 style multipart upload
+	// with a part number in the query. body returns a fresh copy of the
+	// chunk for every attempt.
+	NewRequest func(ctx context.Context, chunk Chunk, body BodyFunc) (*http.Request, error)
+	// OnChunk is called with the response to every chunk but the last, e.g.
+	// to collect part ETags. An error stops the upload.
+	OnChunk func(chunk Chunk, resp *http.Response) error
+	// Progress is called after every chunk with the bytes uploaded so far.
+	Progress func(sent, total int64)
+}
+
+// ChunkError reports the chunk an upload failed at. Passing its Offset as
+// UploadOptions.Offset resumes the upload there.
+type ChunkError struct {
+	Chunk
+	Err error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("rhttp: uploading chunk %d at byte %d: %v", e.Index, e.Offset, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// UploadChunks uploads the size bytes of body to url in chunks, each sent
+// with a Content-Range header and retried on its own, so a failed attempt
+// only resends one chunk instead of the whole body. A chunk succeeds on a 2xx
+// or a 308 Resume Incomplete. The response to the last chunk is returned.
+func (c *RetryableClient) UploadChunks(ctx context.Context, url string, body io.ReaderAt, size int64, opts UploadOptions) (*http.Response, error) {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	newRequest := opts.NewRequest
+	if newRequest == nil {
+		newRequest = opts.contentRangeRequest(url)
+	}
+
+	index := int(opts.Offset / chunkSize)
+	for offset := opts.Offset; ; index++ {
+		chunk := Chunk{Index: index, Offset: offset, Size: chunkSize, Total: size}
+		if offset+chunk.Size > size {
+			chunk.Size = size - offset
+		}
+		getBody := func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(io.NewSectionReader(body, chunk.Offset, chunk.Size)), nil
+		}
+
+		resp, err := c.uploadChunk(ctx, chunk, getBody, newRequest)
+		if err != nil {
+			return nil, &ChunkError{Chunk: chunk, Err: err}
+		}
+		offset += chunk.Size
+		if opts.Progress != nil {
+			opts.Progress(offset, size)
+		}
+		if offset >= size {
+			return resp, nil
+		}
+
+		if opts.OnChunk != nil {
+			err = opts.OnChunk(chunk, resp)
+		}
+		drainBody(resp)
+		if err != nil {
+			return nil, &ChunkError{Chunk: chunk, Err: err}
+		}
+	}
+}
+
+func (c *RetryableClient) uploadChunk(ctx context.Context, chunk Chunk, getBody BodyFunc,
+	newRequest func(context.Context, Chunk, BodyFunc) (*http.Request, error)) (*http.Response, error) {
+	req, err := newRequest(ctx, chunk, getBody)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusPermanentRedirect {
+		defer drainBody(resp)
+		return nil, c.current().statusError(resp)
+	}
+
+	return resp, nil
+}
+
+// contentRangeRequest returns a NewRequest sending chunks to url with a
+// Content-Range header.
+func (o UploadOptions) contentRangeRequest(url string) func(context.Context, Chunk, BodyFunc) (*http.Request, error) {
+	method := o.Method
+	if method == "" {
+		method = http.MethodPut
+	}
+
+	return func(ctx context.Context, chunk Chunk, body BodyFunc) (*http.Request, error) {
+		req, err := NewRequest(ctx, method, url, body)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range o.Header {
+			req.Header[name] = values
+		}
+		req.ContentLength = chunk.Size
+		if chunk.Size == 0 {
+			// An empty body has no byte range
+			req.Header.Set("Content-Range", "bytes */"+strconv.FormatInt(chunk.Total, 10))
+		} else {
+			req.Header.Set("Content-Range", "bytes "+strconv.FormatInt(chunk.Offset, 10)+"-"+
+				strconv.FormatInt(chunk.Offset+chunk.Size-1, 10)+"/"+strconv.FormatInt(chunk.Total, 10))
+		}
+
+		return req, nil
+	}
+}
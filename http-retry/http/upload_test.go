@@ -0,0 +1,168 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUploadChunks(t *testing.T) {
+	const content = "0123456789"
+	tests := []struct {
+		name      string
+		statuses  []int
+		opts      UploadOptions
+		empty     bool
+		wantRange []string
+		wantBody  []string
+		wantErr   bool
+	}{
+		{
+			name:      "chunked",
+			opts:      UploadOptions{ChunkSize: 4},
+			wantRange: []string{"bytes 0-3/10", "bytes 4-7/10", "bytes 8-9/10"},
+			wantBody:  []string{"0123", "4567", "89"},
+		},
+		{
+			name:      "one chunk",
+			opts:      UploadOptions{ChunkSize: 100},
+			wantRange: []string{"bytes 0-9/10"},
+			wantBody:  []string{content},
+		},
+		{
+			name:      "only the failed chunk resent",
+			statuses:  []int{200, 503, 200},
+			opts:      UploadOptions{ChunkSize: 5},
+			wantRange: []string{"bytes 0-4/10", "bytes 5-9/10", "bytes 5-9/10"},
+			wantBody:  []string{"01234", "56789", "56789"},
+		},
+		{
+			name:      "resume incomplete",
+			statuses:  []int{308, 200},
+			opts:      UploadOptions{ChunkSize: 5},
+			wantRange: []string{"bytes 0-4/10", "bytes 5-9/10"},
+			wantBody:  []string{"01234", "56789"},
+		},
+		{
+			name:      "resumed",
+			opts:      UploadOptions{ChunkSize: 4, Offset: 4},
+			wantRange: []string{"bytes 4-7/10", "bytes 8-9/10"},
+			wantBody:  []string{"4567", "89"},
+		},
+		{
+			name:      "empty body",
+			empty:     true,
+			opts:      UploadOptions{ChunkSize: 4},
+			wantRange: []string{"bytes */0"},
+			wantBody:  []string{""},
+		},
+		{
+			name:      "chunk refused",
+			statuses:  []int{200, 400},
+			opts:      UploadOptions{ChunkSize: 5},
+			wantRange: []string{"bytes 0-4/10", "bytes 5-9/10"},
+			wantBody:  []string{"01234", "56789"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := content
+			if tt.empty {
+				body = ""
+			}
+			srv := newScriptServer(t, append(tt.statuses, 200)...)
+			c := NewRetryableClient(fastBackoff, WithMaxRetryAfter(0))
+
+			resp, err := c.UploadChunks(context.Background(), srv.URL, strings.NewReader(body), int64(len(body)), tt.opts)
+			if tt.wantErr {
+				var chunkErr *ChunkError
+				if !errors.As(err, &chunkErr) || chunkErr.Index != 1 || chunkErr.Offset != 5 {
+					t.Errorf("UploadChunks() error = %v, want a ChunkError at the second chunk", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				drainBody(resp)
+			}
+
+			var ranges, bodies []string
+			for i := 0; i < srv.count(); i++ {
+				r, b := srv.request(i)
+				if r.Method != http.MethodPut {
+					t.Errorf("chunk sent with %s", r.Method)
+				}
+				ranges, bodies = append(ranges, r.Header.Get("Content-Range")), append(bodies, b)
+			}
+			if !reflect.DeepEqual(ranges, tt.wantRange) || !reflect.DeepEqual(bodies, tt.wantBody) {
+				t.Errorf("sent %q as %q, want %q as %q", bodies, ranges, tt.wantBody, tt.wantRange)
+			}
+		})
+	}
+}
+
+func TestUploadChunksOptions(t *testing.T) {
+	srv := newScriptServer(t, 200)
+	c := NewRetryableClient()
+	var chunks []int
+	var progress []int64
+
+	_, err := c.UploadChunks(context.Background(), srv.URL, strings.NewReader("0123456789"), 10, UploadOptions{
+		ChunkSize: 4,
+		NewRequest: func(ctx context.Context, chunk Chunk, body BodyFunc) (*http.Request, error) {
+			return NewRequest(ctx, http.MethodPost, srv.URL+"?part="+strconv.Itoa(chunk.Index+1), body)
+		},
+		OnChunk:  func(chunk Chunk, resp *http.Response) error { chunks = append(chunks, chunk.Index); return nil },
+		Progress: func(sent, total int64) { progress = append(progress, sent) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		r, _ := srv.request(i)
+		if q, _ := url.ParseQuery(r.URL.RawQuery); r.Method != http.MethodPost || q.Get("part") != strconv.Itoa(i+1) {
+			t.Errorf("chunk %d sent as %s %s", i, r.Method, r.URL)
+		}
+	}
+	if !reflect.DeepEqual(chunks, []int{0, 1}) {
+		t.Errorf("OnChunk called for %v, want every chunk but the last", chunks)
+	}
+	if !reflect.DeepEqual(progress, []int64{4, 8, 10}) {
+		t.Errorf("progress = %v", progress)
+	}
+}
+
+func TestUploadChunksOnChunkError(t *testing.T) {
+	srv := newScriptServer(t, 200)
+	errParts := errors.New("no ETag")
+	c := NewRetryableClient()
+
+	_, err := c.UploadChunks(context.Background(), srv.URL, strings.NewReader("0123456789"), 10, UploadOptions{
+		ChunkSize: 4,
+		OnChunk:   func(Chunk, *http.Response) error { return errParts },
+	})
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) || !errors.Is(err, errParts) || chunkErr.Index != 0 {
+		t.Errorf("UploadChunks() error = %v, want the OnChunk error at the first chunk", err)
+	}
+	if srv.count() != 1 {
+		t.Errorf("%d chunks sent after the error, want 1", srv.count())
+	}
+}
+
+func TestChunkError(t *testing.T) {
+	errCause := errors.New("refused")
+	err := &ChunkError{Chunk: Chunk{Index: 2, Offset: 8}, Err: errCause}
+	if got, want := err.Error(), "rhttp: uploading chunk 2 at byte 8: refused"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, errCause) {
+		t.Error("ChunkError does not unwrap to its cause")
+	}
+}
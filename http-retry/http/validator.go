@@ -0,0 +1,61 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// ResponseValidator checks a response the server reported as successful or
+// not, e.g. a 200 whose JSON body says "pending". It may read resp.Body; the
+// bytes it reads are put back before the response is returned.
+type ResponseValidator func(resp *http.Response) error
+
+// ValidationError is the error of an attempt whose response was rejected by a
+// ResponseValidator. The retry policy sees it like a transport error, so the
+// default policy retries it.
+type ValidationError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *ValidationError) Error() string {
+	return "rhttp: invalid response: " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// WithResponseValidator rejects responses for which v returns an error, as if
+// the attempt had failed. It may be used several times; validators run in the
+// order they were added.
+func WithResponseValidator(v ResponseValidator) Option {
+	return func(c *config) {
+		c.validators = append(c.validators[:len(c.validators):len(c.validators)], v)
+	}
+}
+
+// validate runs the validators on resp, restoring whatever part of the body
+// they read. A rejected response is released.
+func validate(resp *http.Response, validators []ResponseValidator) (*http.Response, error) {
+	for _, v := range validators {
+		body := resp.Body
+		var read bytes.Buffer
+		resp.Body = readCloser{Reader: io.TeeReader(body, &read), Closer: body}
+
+		err := v(resp)
+		resp.Body = readCloser{Reader: io.MultiReader(&read, body), Closer: body}
+		if err != nil {
+			drainBody(resp)
+			return nil, &ValidationError{StatusCode: resp.StatusCode, Err: err}
+		}
+	}
+
+	return resp, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
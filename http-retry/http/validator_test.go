@@ -0,0 +1,128 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// rejectPending rejects responses whose body is still pending.
+func rejectPending(resp *http.Response) error {
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(b), "pending") {
+		return errors.New("still pending")
+	}
+	return nil
+}
+
+func TestWithResponseValidator(t *testing.T) {
+	tests := []struct {
+		name       string
+		bodies     []string
+		validators []ResponseValidator
+		opts       []Option
+		wantBody   string
+		wantErr    bool
+		wantCount  int64
+	}{
+		{
+			name:       "valid",
+			bodies:     []string{"done"},
+			validators: []ResponseValidator{rejectPending},
+			wantBody:   "done",
+			wantCount:  1,
+		},
+		{
+			name:       "retried until valid",
+			bodies:     []string{"pending", "pending", "done"},
+			validators: []ResponseValidator{rejectPending},
+			wantBody:   "done",
+			wantCount:  3,
+		},
+		{
+			name:       "given up",
+			bodies:     []string{"pending"},
+			validators: []ResponseValidator{rejectPending},
+			opts:       []Option{WithMaxRetries(2)},
+			wantErr:    true,
+			wantCount:  3,
+		},
+		{
+			name:   "validators run in order",
+			bodies: []string{"pending", "done"},
+			validators: []ResponseValidator{
+				func(resp *http.Response) error {
+					// Reads only a part of the body
+					b := make([]byte, 2)
+					_, err := resp.Body.Read(b)
+					return err
+				},
+				rejectPending,
+			},
+			wantBody:  "done",
+			wantCount: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var count int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt64(&count, 1)) - 1
+				if n >= len(tt.bodies) {
+					n = len(tt.bodies) - 1
+				}
+				w.Write([]byte(tt.bodies[n]))
+			}))
+			defer srv.Close()
+			opts := []Option{fastBackoff}
+			for _, v := range tt.validators {
+				opts = append(opts, WithResponseValidator(v))
+			}
+			c := NewRetryableClient(append(opts, tt.opts...)...)
+
+			_, body, err := c.GetBytes(context.Background(), srv.URL)
+			if tt.wantErr {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) || validationErr.StatusCode != 200 {
+					t.Errorf("GetBytes() error = %v, want a ValidationError", err)
+				}
+			} else if err != nil || string(body) != tt.wantBody {
+				t.Errorf("GetBytes() = %q, %v, want %q", body, err, tt.wantBody)
+			}
+			if count != tt.wantCount {
+				t.Errorf("server received %d requests, want %d", count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestValidateRestoresBody(t *testing.T) {
+	resp := &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader("the whole body"))}
+	resp, err := validate(resp, []ResponseValidator{rejectPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != "the whole body" {
+		t.Errorf("body after validation = %q", b)
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	errPending := errors.New("still pending")
+	err := error(&ValidationError{StatusCode: 200, Err: errPending})
+	if !errors.Is(err, errPending) {
+		t.Error("ValidationError does not unwrap to the validator's error")
+	}
+	if err.Error() != "rhttp: invalid response: still pending" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
@@ -0,0 +1,206 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultWebhookSignatureHeader is the header carrying webhook signatures.
+const DefaultWebhookSignatureHeader = "X-Webhook-Signature"
+
+// DefaultWebhookSchedule is the default wait between two deliveries of a
+// webhook.
+var DefaultWebhookSchedule = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour}
+
+// ErrWebhookSignature is returned by VerifyWebhook for a missing, malformed,
+// expired or wrong signature.
+var ErrWebhookSignature = errors.New("rhttp: invalid webhook signature")
+
+// WebhookConfig configures a Webhook. Every field but Secret is optional.
+type WebhookConfig struct {
+	// Secret is the key payloads are signed with, shared with the receivers.
+	Secret []byte
+	// SignatureHeader defaults to DefaultWebhookSignatureHeader.
+	SignatureHeader string
+	// Schedule is the wait between deliveries, DefaultWebhookSchedule by
+	// default.
+	Schedule []time.Duration
+	// Schedules overrides Schedule for the destinations matching its keys,
+	// patterns as accepted by WithHostOptions.
+	Schedules map[string][]time.Duration
+	// Queue sets the workers, stores and outcome callbacks of the delivery
+	// queue. Its Backoff and MaxDeliveries are replaced by the schedules.
+	Queue QueueConfig
+	// OnDeadLetter is called with every webhook given up on without a
+	// successful response.
+	OnDeadLetter func(Delivery)
+}
+
+// Webhook delivers signed webhooks in the background. A webhook failing with
+// a transport error, a 5xx, 408 or 429 is delivered again on its
+// destination's schedule; any status but 2xx counts as a failed receipt.
+// Every delivery of a webhook carries the same Idempotency-Key, its ID, so
+// receivers can deduplicate them.
+type Webhook struct {
+	queue *Queue
+}
+
+// NewWebhook returns a webhook sender delivering with a client configured by
+// opts on top of the webhook defaults.
+func NewWebhook(cfg WebhookConfig, opts ...Option) *Webhook {
+	schedule := cfg.Schedule
+	if len(schedule) == 0 {
+		schedule = DefaultWebhookSchedule
+	}
+	defaults := []Option{
+		RetryOn5xx(),
+		RetryOn(http.StatusRequestTimeout, http.StatusTooManyRequests),
+		WithIdempotencyKey(),
+		WithSigner(WebhookSigner{Secret: cfg.Secret, Header: cfg.SignatureHeader}),
+		WithDeliverySchedule(schedule...),
+	}
+
+	patterns := make([]string, 0, len(cfg.Schedules))
+	for pattern := range cfg.Schedules {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		defaults = append(defaults, WithHostOptions(pattern, WithDeliverySchedule(cfg.Schedules[pattern]...)))
+	}
+
+	if onDeadLetter := cfg.OnDeadLetter; onDeadLetter != nil {
+		onDone := cfg.Queue.OnDone
+		cfg.Queue.OnDone = func(d Delivery) {
+			if onDone != nil {
+				onDone(d)
+			}
+			if d.Failed() {
+				onDeadLetter(d)
+			}
+		}
+	}
+	client := NewRetryableClient(append(defaults, opts...)...)
+
+	return &Webhook{queue: NewQueue(client, cfg.Queue)}
+}
+
+// Send queues payload, a JSON document, for delivery to url and returns the
+// webhook's ID. ctx only provides request options, see WithRequestOptions.
+func (w *Webhook) Send(ctx context.Context, url string, payload []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return w.queue.Enqueue(req)
+}
+
+// Queue returns the delivery queue, e.g. to Resume or Close it.
+func (w *Webhook) Queue() *Queue {
+	return w.queue
+}
+
+// WebhookSigner signs requests with an HMAC-SHA256 of their payload. The
+// signature header reads "t=<unix time>,v1=<hex HMAC of t.payload>", and is
+// computed again for every attempt so a late retry is not taken for a
+// replay.
+type WebhookSigner struct {
+	Secret []byte
+	// Header defaults to DefaultWebhookSignatureHeader.
+	Header string
+}
+
+// Sign sets the signature header of req.
+func (s WebhookSigner) Sign(req *http.Request) error {
+	return s.sign(req, time.Now())
+}
+
+func (s WebhookSigner) sign(req *http.Request, now time.Time) error {
+	var payload []byte
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		payload, err = ioutil.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	req.Header.Set(webhookHeader(s.Header), signWebhook(s.Secret, now, payload))
+
+	return nil
+}
+
+// VerifyWebhook checks header, the signature header of a webhook, against
+// its payload. Signatures older than tolerance are rejected; zero accepts any
+// age.
+func VerifyWebhook(secret []byte, header string, payload []byte, tolerance time.Duration) error {
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			sigs = append(sigs, kv[1])
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrWebhookSignature
+	}
+	signed := time.Unix(unix, 0)
+	if age := time.Since(signed); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return ErrWebhookSignature
+	}
+
+	want := webhookMAC(secret, ts, payload)
+	for _, sig := range sigs {
+		if got, err := hex.DecodeString(sig); err == nil && hmac.Equal(got, want) {
+			return nil
+		}
+	}
+
+	return ErrWebhookSignature
+}
+
+func signWebhook(secret []byte, now time.Time, payload []byte) string {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(webhookMAC(secret, ts, payload))
+}
+
+func webhookMAC(secret []byte, ts string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+
+	return mac.Sum(nil)
+}
+
+func webhookHeader(name string) string {
+	if name == "" {
+		return DefaultWebhookSignatureHeader
+	}
+
+	return name
+}
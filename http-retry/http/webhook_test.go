@@ -0,0 +1,135 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	secret := []byte("secret")
+	payload := []byte(`{"event":"paid"}`)
+	now := time.Now()
+	valid := signWebhook(secret, now, payload)
+	tests := []struct {
+		name      string
+		header    string
+		payload   []byte
+		tolerance time.Duration
+		wantErr   bool
+	}{
+		{name: "valid", header: valid, payload: payload, tolerance: time.Minute},
+		{name: "any age", header: signWebhook(secret, now.Add(-24*time.Hour), payload), payload: payload},
+		{name: "expired", header: signWebhook(secret, now.Add(-time.Hour), payload), payload: payload, tolerance: time.Minute, wantErr: true},
+		{name: "from the future", header: signWebhook(secret, now.Add(time.Hour), payload), payload: payload, tolerance: time.Minute, wantErr: true},
+		{name: "other payload", header: valid, payload: []byte(`{"event":"refunded"}`), wantErr: true},
+		{name: "other secret", header: signWebhook([]byte("other"), now, payload), payload: payload, wantErr: true},
+		{name: "one of several signatures", header: valid[:strings.Index(valid, ",")] + ",v1=00ff," + valid[strings.Index(valid, ",")+1:], payload: payload},
+		{name: "timestamp changed", header: "t=" + strconv.FormatInt(now.Unix()+1, 10) + valid[strings.Index(valid, ","):], payload: payload, wantErr: true},
+		{name: "no timestamp", header: valid[strings.Index(valid, ",")+1:], payload: payload, wantErr: true},
+		{name: "malformed", header: "garbage", payload: payload, wantErr: true},
+		{name: "empty", payload: payload, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyWebhook(secret, tt.header, tt.payload, tt.tolerance)
+			if tt.wantErr != (err != nil) || (err != nil && err != ErrWebhookSignature) {
+				t.Errorf("VerifyWebhook() error = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		schedules map[string][]time.Duration
+		// wantWaits are the waits between deliveries.
+		wantWaits  []time.Duration
+		wantStatus int
+		wantDead   bool
+	}{
+		{name: "delivered", statuses: []int{200}, wantStatus: 200},
+		{
+			name:       "delivered again on the schedule",
+			statuses:   []int{500, 429, 408, 200},
+			wantWaits:  []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute},
+			wantStatus: 200,
+		},
+		{
+			name:       "given up",
+			statuses:   []int{503},
+			wantWaits:  DefaultWebhookSchedule,
+			wantStatus: 503,
+			wantDead:   true,
+		},
+		{name: "refused", statuses: []int{410}, wantStatus: 410, wantDead: true},
+		{
+			name:       "schedule of the destination",
+			statuses:   []int{503},
+			schedules:  map[string][]time.Duration{"127.0.0.1": {time.Second}},
+			wantWaits:  []time.Duration{time.Second},
+			wantStatus: 503,
+			wantDead:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newScriptServer(t, tt.statuses...)
+			clock := newStepClock()
+			done := make(chan Delivery, 1)
+			var dead []string
+			w := NewWebhook(WebhookConfig{
+				Secret:       []byte("secret"),
+				Schedules:    tt.schedules,
+				Queue:        QueueConfig{Done: done},
+				OnDeadLetter: func(d Delivery) { dead = append(dead, d.ID) },
+			}, WithClock(clock), WithMaxRetries(0))
+			defer w.Queue().Close(context.Background())
+			payload := []byte(`{"event":"paid"}`)
+
+			id, err := w.Send(context.Background(), srv.URL, payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := <-done
+			if d.ID != id || d.Err != nil || d.Response.StatusCode != tt.wantStatus {
+				t.Fatalf("delivery = %v, %v, want %d", d.Response, d.Err, tt.wantStatus)
+			}
+			if got := clock.Waits(); !reflect.DeepEqual(got, tt.wantWaits) {
+				t.Errorf("waits = %v, want %v", got, tt.wantWaits)
+			}
+			if (len(dead) == 1 && dead[0] == id) != tt.wantDead {
+				t.Errorf("dead letters = %v, want the webhook: %v", dead, tt.wantDead)
+			}
+
+			for i := 0; i < srv.count(); i++ {
+				r, body := srv.request(i)
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || body != string(payload) {
+					t.Errorf("delivery %d = %s %s %q", i+1, r.Method, r.Header.Get("Content-Type"), body)
+				}
+				if r.Header.Get(DefaultIdempotencyKeyHeader) != id {
+					t.Errorf("delivery %d key = %q, want the ID", i+1, r.Header.Get(DefaultIdempotencyKeyHeader))
+				}
+				if err := VerifyWebhook([]byte("secret"), r.Header.Get(DefaultWebhookSignatureHeader), []byte(body), 0); err != nil {
+					t.Errorf("delivery %d signature: %v", i+1, err)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookSignerHeader(t *testing.T) {
+	req, _ := NewRequest(context.Background(), http.MethodPost, "http://example.com", "payload")
+	if err := (WebhookSigner{Secret: []byte("secret"), Header: "X-Signature"}).Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyWebhook([]byte("secret"), req.Header.Get("X-Signature"), []byte("payload"), time.Minute); err != nil {
+		t.Errorf("signature in X-Signature: %v", err)
+	}
+}
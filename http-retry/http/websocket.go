@@ -0,0 +1,157 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DialFunc opens a long-lived connection, typically a WebSocket dial with a
+// library such as gorilla/websocket or nhooyr.io/websocket. resp is the
+// handshake response, if any: its status is what the retry policy judges,
+// so a 503 is retried while a 403 is not.
+type DialFunc[C any] func(ctx context.Context) (conn C, resp *http.Response, err error)
+
+// Dial calls dial until it succeeds, with the retry policy, backoff, rate
+// limits and circuit breaker of c, the circuit being that of rawURL's host.
+// When c gives up, the error is a *RetryError.
+func Dial[C any](ctx context.Context, c *RetryableClient, rawURL string, dial DialFunc[C]) (C, error) {
+	var zero C
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return zero, err
+	}
+	cfg := c.current().with(requestOptions(ctx)...)
+
+	start := cfg.clock.Now()
+	var attempts []Attempt
+	var delay time.Duration
+	for retries := 0; ; retries++ {
+		attemptStart := cfg.clock.Now()
+		conn, resp, err := dialOnce(ctx, cfg, u.Host, dial, retries+1)
+		attempts = append(attempts, newAttemptRecord(attemptStart, cfg.clock.Now(), resp, err))
+		if err == nil {
+			return conn, nil
+		}
+		drainBody(resp)
+
+		if ctx.Err() != nil || isPermanent(err) || errors.Is(err, ErrCircuitOpen) ||
+			cfg.maxRetries == 0 || !cfg.shouldRedial(resp, err, retries+1) {
+			return zero, err
+		}
+		if retries >= cfg.maxRetries {
+			return zero, &RetryError{Reason: ErrMaxRetriesExceeded, Attempts: attempts}
+		}
+
+		delay = cfg.nextBackoff(u.Host, retries, delay)
+		if wait, ok := retryAfter(resp, cfg.clock.Now()); ok && cfg.maxRetryAfter > 0 {
+			if wait > cfg.maxRetryAfter {
+				wait = cfg.maxRetryAfter
+			}
+			delay = wait
+		}
+		if max := cfg.maxElapsedTime; max > 0 && cfg.clock.Now().Sub(start)+delay > max {
+			return zero, &RetryError{Reason: ErrMaxElapsedTimeExceeded, Attempts: attempts}
+		}
+		attempts[len(attempts)-1].Backoff = delay
+		if err := sleep(ctx, cfg.clock, delay); err != nil {
+			return zero, err
+		}
+	}
+}
+
+// dialOnce makes one dial attempt to host, guarded like a request attempt.
+func dialOnce[C any](ctx context.Context, c *config, host string, dial DialFunc[C], attempt int) (C, *http.Response, error) {
+	var zero C
+	if c.limiter != nil {
+		if err := c.limiter(host).Wait(withClock(ctx, c.clock)); err != nil {
+			return zero, nil, &permanentError{err: err}
+		}
+	}
+	if c.circuitBreaker != nil {
+		if err := c.circuitBreaker.allow(host, c.clock.Now()); err != nil {
+			return zero, nil, err
+		}
+	}
+
+	conn, resp, err := dial(ctx)
+	if c.circuitBreaker != nil && ctx.Err() == nil {
+		c.circuitBreaker.record(host, err == nil || !c.shouldRedial(resp, err, attempt), c.clock.Now())
+	}
+
+	return conn, resp, err
+}
+
+// shouldRedial asks the retry policy about a failed dial, judging the
+// handshake response when there is one rather than the library's error.
+func (c *config) shouldRedial(resp *http.Response, err error, attempt int) bool {
+	if resp != nil {
+		return c.policy.ShouldRetry(resp, nil, attempt)
+	}
+
+	return c.policy.ShouldRetry(nil, err, attempt)
+}
+
+// Session keeps a long-lived connection across reconnects. Whoever notices
+// the connection broke calls Reconnect; the others keep using Conn.
+type Session[C comparable] struct {
+	// OnReconnect is called with every new connection but the first, e.g. to
+	// subscribe again. Its error is returned by Reconnect along with the new
+	// connection, which stays current. Set it before the session is used.
+	OnReconnect func(ctx context.Context, conn C) error
+
+	client *RetryableClient
+	url    string
+	dial   DialFunc[C]
+
+	mu   sync.Mutex
+	conn C
+	open bool
+}
+
+// NewSession returns a session connecting to url with dial, see Dial.
+func NewSession[C comparable](c *RetryableClient, url string, dial DialFunc[C]) *Session[C] {
+	return &Session[C]{client: c, url: url, dial: dial}
+}
+
+// Conn returns the current connection, connecting first if needed.
+func (s *Session[C]) Conn(ctx context.Context) (C, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.open {
+		return s.conn, nil
+	}
+
+	return s.connect(ctx, false)
+}
+
+// Reconnect replaces broken, a connection that failed, with a new one. If
+// another caller already replaced it, the current connection is returned.
+// Closing broken is left to the caller.
+func (s *Session[C]) Reconnect(ctx context.Context, broken C) (C, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.open && s.conn != broken {
+		return s.conn, nil
+	}
+
+	return s.connect(ctx, true)
+}
+
+// connect dials a new connection. s.mu must be held.
+func (s *Session[C]) connect(ctx context.Context, reconnect bool) (C, error) {
+	s.open = false
+	conn, err := Dial(ctx, s.client, s.url, s.dial)
+	if err != nil {
+		return conn, err
+	}
+	s.conn, s.open = conn, true
+	if reconnect && s.OnReconnect != nil {
+		return conn, s.OnReconnect(ctx, conn)
+	}
+
+	return conn, nil
+}
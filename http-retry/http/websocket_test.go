@@ -0,0 +1,239 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dialStep is the outcome of one dial: a handshake response of status, if
+// not zero, and err.
+type dialStep struct {
+	status     int
+	retryAfter string
+	err        error
+}
+
+// dialScript returns a dial playing steps in order, the last one repeating.
+// Its connections are the number of the dial that made them.
+func dialScript(steps ...dialStep) (DialFunc[int], func() int) {
+	var mu sync.Mutex
+	dials := 0
+	dial := func(ctx context.Context) (int, *http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dials++
+		step := steps[len(steps)-1]
+		if dials <= len(steps) {
+			step = steps[dials-1]
+		}
+		var resp *http.Response
+		if step.status != 0 {
+			resp = &http.Response{StatusCode: step.status, Header: http.Header{}, Body: http.NoBody}
+			if step.retryAfter != "" {
+				resp.Header.Set("Retry-After", step.retryAfter)
+			}
+		}
+		if step.err != nil || (resp != nil && resp.StatusCode != http.StatusSwitchingProtocols) {
+			if step.err == nil {
+				step.err = errors.New("bad handshake")
+			}
+			return 0, resp, step.err
+		}
+		return dials, resp, nil
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return dials
+	}
+
+	return dial, count
+}
+
+func TestDial(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	tests := []struct {
+		name      string
+		steps     []dialStep
+		opts      []Option
+		wantConn  int
+		wantDials int
+		wantErr   func(error) bool
+		wantWaits []time.Duration
+	}{
+		{name: "connected", steps: []dialStep{{status: 101}}, wantConn: 1, wantDials: 1},
+		{name: "unavailable", steps: []dialStep{{status: 503}, {status: 101}}, wantConn: 2, wantDials: 2},
+		{name: "transport error", steps: []dialStep{{err: errRefused}, {}}, wantConn: 2, wantDials: 2},
+		{
+			name:      "forbidden",
+			steps:     []dialStep{{status: 403}},
+			wantDials: 1,
+			wantErr:   func(err error) bool { return err != nil && !errors.As(err, new(*RetryError)) },
+		},
+		{
+			name:      "given up",
+			steps:     []dialStep{{status: 503}},
+			wantDials: 3,
+			wantErr: func(err error) bool {
+				var retryErr *RetryError
+				return errors.As(err, &retryErr) && retryErr.Reason == ErrMaxRetriesExceeded && len(retryErr.Attempts) == 3
+			},
+		},
+		{
+			name:      "no retries",
+			steps:     []dialStep{{err: errRefused}},
+			opts:      []Option{WithMaxRetries(0)},
+			wantDials: 1,
+			wantErr:   func(err error) bool { return err == errRefused },
+		},
+		{
+			name:      "Retry-After",
+			steps:     []dialStep{{status: 503, retryAfter: "7"}, {status: 101}},
+			opts:      []Option{WithMaxRetryAfter(time.Minute)},
+			wantConn:  2,
+			wantDials: 2,
+			wantWaits: []time.Duration{7 * time.Second},
+		},
+		{
+			name:      "circuit open",
+			steps:     []dialStep{{status: 503}},
+			opts:      []Option{WithCircuitBreaker(NewCircuitBreaker(CircuitSettings{FailureThreshold: 1, Cooldown: time.Hour}))},
+			wantDials: 1,
+			wantErr:   func(err error) bool { return errors.Is(err, ErrCircuitOpen) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dial, dials := dialScript(tt.steps...)
+			clock := newStepClock()
+			c := NewRetryableClient(append([]Option{fastBackoff, WithMaxRetries(2), WithClock(clock)}, tt.opts...)...)
+
+			conn, err := Dial(context.Background(), c, "ws://example.com/socket", dial)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("Dial() error = %v", err)
+				}
+			} else if err != nil || conn != tt.wantConn {
+				t.Errorf("Dial() = %d, %v, want %d", conn, err, tt.wantConn)
+			}
+			if dials() != tt.wantDials {
+				t.Errorf("%d dials, want %d", dials(), tt.wantDials)
+			}
+			if tt.wantWaits != nil && !reflect.DeepEqual(clock.Waits(), tt.wantWaits) {
+				t.Errorf("waits = %v, want %v", clock.Waits(), tt.wantWaits)
+			}
+		})
+	}
+}
+
+func TestDialCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dial := func(ctx context.Context) (int, *http.Response, error) {
+		cancel()
+		return 0, nil, ctx.Err()
+	}
+
+	if _, err := Dial(ctx, NewRetryableClient(fastBackoff), "ws://example.com", dial); !errors.Is(err, context.Canceled) {
+		t.Errorf("Dial() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestSession(t *testing.T) {
+	errSubscribe := errors.New("subscribe failed")
+	tests := []struct {
+		name        string
+		onReconnect error
+		// use runs against the session, returning the connection it ends
+		// with.
+		use           func(s *Session[int]) (int, error)
+		wantConn      int
+		wantDials     int
+		wantReconnect []int
+		wantErr       error
+	}{
+		{
+			name: "connection kept",
+			use: func(s *Session[int]) (int, error) {
+				s.Conn(context.Background())
+				return s.Conn(context.Background())
+			},
+			wantConn:  1,
+			wantDials: 1,
+		},
+		{
+			name: "reconnected",
+			use: func(s *Session[int]) (int, error) {
+				conn, _ := s.Conn(context.Background())
+				return s.Reconnect(context.Background(), conn)
+			},
+			wantConn:      2,
+			wantDials:     2,
+			wantReconnect: []int{2},
+		},
+		{
+			name: "already reconnected",
+			use: func(s *Session[int]) (int, error) {
+				conn, _ := s.Conn(context.Background())
+				s.Reconnect(context.Background(), conn)
+				return s.Reconnect(context.Background(), conn)
+			},
+			wantConn:      2,
+			wantDials:     2,
+			wantReconnect: []int{2},
+		},
+		{
+			name:        "OnReconnect failed",
+			onReconnect: errSubscribe,
+			use: func(s *Session[int]) (int, error) {
+				conn, _ := s.Conn(context.Background())
+				if _, err := s.Reconnect(context.Background(), conn); err != errSubscribe {
+					return 0, err
+				}
+				return s.Conn(context.Background())
+			},
+			wantConn:      2,
+			wantDials:     2,
+			wantReconnect: []int{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dial, dials := dialScript(dialStep{})
+			s := NewSession(NewRetryableClient(), "ws://example.com", dial)
+			var reconnects []int
+			s.OnReconnect = func(ctx context.Context, conn int) error {
+				reconnects = append(reconnects, conn)
+				return tt.onReconnect
+			}
+
+			conn, err := tt.use(s)
+			if err != tt.wantErr || conn != tt.wantConn {
+				t.Errorf("connection = %d, %v, want %d, %v", conn, err, tt.wantConn, tt.wantErr)
+			}
+			if dials() != tt.wantDials {
+				t.Errorf("%d dials, want %d", dials(), tt.wantDials)
+			}
+			if !reflect.DeepEqual(reconnects, tt.wantReconnect) {
+				t.Errorf("OnReconnect called with %v, want %v", reconnects, tt.wantReconnect)
+			}
+		})
+	}
+}
+
+func TestSessionConnectFailed(t *testing.T) {
+	dial, dials := dialScript(dialStep{status: 403}, dialStep{})
+	s := NewSession(NewRetryableClient(), "ws://example.com", dial)
+
+	if _, err := s.Conn(context.Background()); err == nil {
+		t.Fatal("Conn() succeeded, want the dial error")
+	}
+	// The failed dial leaves the session without a connection to reuse
+	if conn, err := s.Conn(context.Background()); err != nil || conn != 2 || dials() != 2 {
+		t.Errorf("Conn() = %d, %v after %d dials, want the second", conn, err, dials())
+	}
+}
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// writeDedupe shares the response of a write with the duplicates of it sent
+// within a window.
+type writeDedupe struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	writes map[string]*dedupedWrite
+	// expiries lists the writes in the order they expire, which is the order
+	// they were sent since the window is fixed
+	expiries []*dedupedWrite
+}
+
+type dedupedWrite struct {
+	flight
+	key     string
+	expires time.Time
+	// shared is set once the response may be handed to duplicates
+	shared bool
+}
+
+// WithWriteDeduplication makes a write with a non-idempotent method, such as
+// POST, get a copy of the response to an identical write sent less than
+// window ago, instead of being sent again. Writes are identical when they have
+// the same method, URL and idempotency key, e.g. a message ID, so a message
+// handled twice by an at-least-once queue consumer is only written once. A
+// duplicate sent while the first write is in flight waits for it. Writes that
+// failed or got a 5xx response are forgotten, so their duplicates are sent.
+// Only idempotency keys set by the caller count, see WithIdempotencyKeyHeader.
+func WithWriteDeduplication(window time.Duration) Option {
+	d := &writeDedupe{window: window, writes: make(map[string]*dedupedWrite)}
+
+	return func(c *config) {
+		c.writeDedupe = d
+	}
+}
+
+// dedupeKey returns the key identifying req for write deduplication, or "" if
+// req is not deduplicated.
+func (c *config) dedupeKey(req *http.Request) string {
+	if c.writeDedupe == nil || idempotentMethods[req.Method] {
+		return ""
+	}
+	key := req.Header.Get(c.idempotencyKeyHeader())
+	if key == "" {
+		return ""
+	}
+
+	return req.Method + " " + req.URL.String() + "\n" + key
+}
+
+// do sends req through next, unless a write with the same key was sent within
+// the window, in which case req gets a copy of its response.
+func (d *writeDedupe) do(req *http.Request, key string, clock Clock, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	now := clock.Now()
+
+	d.mu.Lock()
+	d.expire(now)
+	if w, ok := d.writes[key]; ok {
+		d.mu.Unlock()
+		return d.wait(req, key, w, clock, next)
+	}
+	w := &dedupedWrite{flight: flight{done: make(chan struct{})}, key: key, expires: now.Add(d.window)}
+	d.writes[key] = w
+	d.expiries = append(d.expiries, w)
+	d.mu.Unlock()
+
+	// Stays false if next panics, so the duplicates send their own write
+	shared := false
+	defer func() {
+		d.mu.Lock()
+		w.shared = shared
+		if !shared || !clock.Now().Before(w.expires) {
+			d.forget(w)
+		}
+		d.mu.Unlock()
+		close(w.done)
+	}()
+
+	resp, err := next(req)
+	if err != nil || resp.StatusCode >= 500 {
+		return resp, err
+	}
+	w.resp = resp
+	w.body, w.err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	shared = w.err == nil
+
+	return w.response(req)
+}
+
+// wait waits for w on behalf of req, sending req on its own if w is not
+// shared.
+func (d *writeDedupe) wait(req *http.Request, key string, w *dedupedWrite, clock Clock, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-w.done:
+	}
+
+	if !w.shared {
+		return d.do(req, key, clock, next)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	return w.response(req)
+}
+
+// forget drops w, unless it was replaced already. d.mu must be held.
+func (d *writeDedupe) forget(w *dedupedWrite) {
+	if d.writes[w.key] == w {
+		delete(d.writes, w.key)
+	}
+}
+
+// expire drops the writes whose window is over, except those still in
+// flight, which are dropped once done. d.mu must be held.
+func (d *writeDedupe) expire(now time.Time) {
+	i := 0
+	for ; i < len(d.expiries) && !now.Before(d.expiries[i].expires); i++ {
+		if w := d.expiries[i]; w.shared {
+			d.forget(w)
+		}
+	}
+	d.expiries = d.expiries[i:]
+}
@@ -0,0 +1,222 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithWriteDeduplication(t *testing.T) {
+	type write struct {
+		method, path, key string
+		// advance moves the clock before the write.
+		advance  time.Duration
+		wantBody string
+	}
+	tests := []struct {
+		name string
+		// keyHeader is the idempotency key header, the default if empty.
+		keyHeader string
+		// status is sent to the first write.
+		status   int
+		writes   []write
+		wantSent int
+	}{
+		{
+			name: "duplicate",
+			writes: []write{
+				{method: http.MethodPost, key: "a", wantBody: "1"},
+				{method: http.MethodPost, key: "a", advance: 500 * time.Millisecond, wantBody: "1"},
+				{method: http.MethodPost, key: "a", advance: 400 * time.Millisecond, wantBody: "1"},
+			},
+			wantSent: 1,
+		},
+		{
+			name: "window over",
+			writes: []write{
+				{method: http.MethodPost, key: "a", wantBody: "1"},
+				{method: http.MethodPost, key: "a", advance: time.Second, wantBody: "2"},
+				{method: http.MethodPost, key: "a", wantBody: "2"},
+			},
+			wantSent: 2,
+		},
+		{
+			name: "other key",
+			writes: []write{
+				{method: http.MethodPost, key: "a", wantBody: "1"},
+				{method: http.MethodPost, key: "b", wantBody: "2"},
+			},
+			wantSent: 2,
+		},
+		{
+			name: "no key",
+			writes: []write{
+				{method: http.MethodPost, wantBody: "1"},
+				{method: http.MethodPost, wantBody: "2"},
+			},
+			wantSent: 2,
+		},
+		{
+			name: "other method",
+			writes: []write{
+				{method: http.MethodPost, key: "a", wantBody: "1"},
+				{method: http.MethodPatch, key: "a", wantBody: "2"},
+			},
+			wantSent: 2,
+		},
+		{
+			name: "other URL",
+			writes: []write{
+				{method: http.MethodPost, path: "/a", key: "a", wantBody: "1"},
+				{method: http.MethodPost, path: "/b", key: "a", wantBody: "2"},
+			},
+			wantSent: 2,
+		},
+		{
+			name: "idempotent method",
+			writes: []write{
+				{method: http.MethodPut, key: "a", wantBody: "1"},
+				{method: http.MethodPut, key: "a", wantBody: "2"},
+			},
+			wantSent: 2,
+		},
+		{
+			name:   "5xx forgotten",
+			status: http.StatusInternalServerError,
+			writes: []write{
+				{method: http.MethodPost, key: "a", wantBody: "1"},
+				{method: http.MethodPost, key: "a", wantBody: "2"},
+				{method: http.MethodPost, key: "a", wantBody: "2"},
+			},
+			wantSent: 2,
+		},
+		{
+			name:   "4xx shared",
+			status: http.StatusConflict,
+			writes: []write{
+				{method: http.MethodPost, key: "a", wantBody: "1"},
+				{method: http.MethodPost, key: "a", wantBody: "1"},
+			},
+			wantSent: 1,
+		},
+		{
+			name:      "custom key header",
+			keyHeader: "X-Message-Id",
+			writes: []write{
+				{method: http.MethodPost, key: "a", wantBody: "1"},
+				{method: http.MethodPost, key: "a", wantBody: "1"},
+			},
+			wantSent: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&sent, 1)
+				if n == 1 && tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				w.Write([]byte(strconv.Itoa(int(n))))
+			}))
+			defer srv.Close()
+			clock := newStepClock()
+			opts := []Option{WithClock(clock), WithWriteDeduplication(time.Second)}
+			header := DefaultIdempotencyKeyHeader
+			if tt.keyHeader != "" {
+				opts = append(opts, WithIdempotencyKeyHeader(tt.keyHeader))
+				header = tt.keyHeader
+			}
+			c := NewRetryableClient(opts...)
+
+			for i, w := range tt.writes {
+				clock.Advance(w.advance)
+				req, _ := NewRequest(context.Background(), w.method, srv.URL+w.path, "payload")
+				if w.key != "" {
+					req.Header.Set(header, w.key)
+				}
+				resp, err := c.Do(context.Background(), req)
+				if err != nil {
+					t.Fatalf("write %d: %v", i+1, err)
+				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if string(body) != w.wantBody {
+					t.Errorf("write %d got response %q, want %q", i+1, body, w.wantBody)
+				}
+			}
+			if n := atomic.LoadInt32(&sent); int(n) != tt.wantSent {
+				t.Errorf("%d writes sent, want %d", n, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestWriteDeduplicationInFlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		wantSent int32
+	}{
+		{name: "shared", status: http.StatusCreated, wantSent: 1},
+		{name: "failed", status: http.StatusBadGateway, wantSent: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent int32
+			received := make(chan struct{}, 2)
+			release := make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&sent, 1)
+				received <- struct{}{}
+				if n == 1 {
+					<-release
+					w.WriteHeader(tt.status)
+				}
+			}))
+			defer srv.Close()
+			c := NewRetryableClient(WithMaxRetries(0), WithWriteDeduplication(time.Minute))
+
+			var wg sync.WaitGroup
+			statuses := make([]int, 2)
+			for i := range statuses {
+				if i > 0 {
+					<-received
+				}
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					req, _ := NewRequest(context.Background(), http.MethodPost, srv.URL, "payload")
+					req.Header.Set(DefaultIdempotencyKeyHeader, "a")
+					resp, err := c.Do(context.Background(), req)
+					if err != nil {
+						t.Errorf("write %d: %v", i+1, err)
+						return
+					}
+					drainBody(resp)
+					statuses[i] = resp.StatusCode
+				}(i)
+			}
+			// The duplicate waits for the first write rather than being sent
+			time.Sleep(20 * time.Millisecond)
+			if n := atomic.LoadInt32(&sent); n != 1 {
+				t.Errorf("%d writes sent while the first is in flight, want 1", n)
+			}
+			close(release)
+			wg.Wait()
+
+			if n := atomic.LoadInt32(&sent); n != tt.wantSent {
+				t.Errorf("%d writes sent, want %d", n, tt.wantSent)
+			}
+			if statuses[0] != tt.status {
+				t.Errorf("first write got %d, want %d", statuses[0], tt.status)
+			}
+		})
+	}
+}
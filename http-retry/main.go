@@ -1,25 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 
 	rhttp "github.com/kdkumawat/golang/http-retry/http"
 )
 
 func main() {
 	client := rhttp.NewRetryableClient()
-	resp, err := client.Get("https://reqres.in/api/users/2")
+	status, body, err := client.GetBytes(context.Background(), "https://reqres.in/api/users/2")
 	if err != nil {
 		fmt.Println("err", err)
+		return
 	}
 
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println("err reading body : %w", err)
-	}
-
-	fmt.Println("resp", string(body))
+	fmt.Println("resp", status, string(body))
 }